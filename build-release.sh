@@ -19,8 +19,8 @@ mkdir -p ${BUILD_DIR}
 COMMIT_HASH=$(git rev-parse --short HEAD 2>/dev/null || echo "unknown")
 BUILD_TIME=$(date -u '+%Y-%m-%d_%H:%M:%S')
 
-# Build flags
-LDFLAGS="-X main.version=${VERSION} -X main.commit=${COMMIT_HASH} -X main.buildTime=${BUILD_TIME} -s -w"
+# Build flags; ERROR_REPORTING_DSN sets the endpoint of the opt-in error reports
+LDFLAGS="-X main.version=${VERSION} -X main.commit=${COMMIT_HASH} -X main.buildTime=${BUILD_TIME} -X main.errorReportingDSN=${ERROR_REPORTING_DSN:-} -s -w"
 
 # Platforms to build for (using GitHub Release naming convention)
 declare -a PLATFORMS=(
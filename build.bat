@@ -6,6 +6,11 @@ set VERSION=1.0.0
 set BUILD_DIR=dist
 set MAIN_FILE=main.go
 
+REM Version info embedded in the binary
+set COMMIT_HASH=unknown
+for /f %%i in ('git rev-parse --short HEAD 2^>nul') do set COMMIT_HASH=%%i
+set LDFLAGS=-X main.version=%VERSION% -X main.commit=%COMMIT_HASH% -s -w
+
 echo 🧹 清理之前的构建...
 if exist %BUILD_DIR% rmdir /s /q %BUILD_DIR%
 mkdir %BUILD_DIR%
@@ -17,35 +22,35 @@ echo 📦 构建 windows/amd64...
 set GOOS=windows
 set GOARCH=amd64
 set CGO_ENABLED=0
-go build -ldflags="-s -w" -o %BUILD_DIR%\%APP_NAME%-windows-amd64.exe %MAIN_FILE%
+go build -ldflags="%LDFLAGS%" -o %BUILD_DIR%\%APP_NAME%-windows-amd64.exe %MAIN_FILE%
 
 REM Build for Windows ARM64
 echo 📦 构建 windows/arm64...
 set GOOS=windows
 set GOARCH=arm64
 set CGO_ENABLED=0
-go build -ldflags="-s -w" -o %BUILD_DIR%\%APP_NAME%-windows-arm64.exe %MAIN_FILE%
+go build -ldflags="%LDFLAGS%" -o %BUILD_DIR%\%APP_NAME%-windows-arm64.exe %MAIN_FILE%
 
 REM Build for Linux AMD64
 echo 📦 构建 linux/amd64...
 set GOOS=linux
 set GOARCH=amd64
 set CGO_ENABLED=0
-go build -ldflags="-s -w" -o %BUILD_DIR%\%APP_NAME%-linux-amd64 %MAIN_FILE%
+go build -ldflags="%LDFLAGS%" -o %BUILD_DIR%\%APP_NAME%-linux-amd64 %MAIN_FILE%
 
 REM Build for macOS AMD64
 echo 📦 构建 darwin/amd64...
 set GOOS=darwin
 set GOARCH=amd64
 set CGO_ENABLED=0
-go build -ldflags="-s -w" -o %BUILD_DIR%\%APP_NAME%-darwin-amd64 %MAIN_FILE%
+go build -ldflags="%LDFLAGS%" -o %BUILD_DIR%\%APP_NAME%-darwin-amd64 %MAIN_FILE%
 
 REM Build for macOS ARM64
 echo 📦 构建 darwin/arm64...
 set GOOS=darwin
 set GOARCH=arm64
 set CGO_ENABLED=0
-go build -ldflags="-s -w" -o %BUILD_DIR%\%APP_NAME%-darwin-arm64 %MAIN_FILE%
+go build -ldflags="%LDFLAGS%" -o %BUILD_DIR%\%APP_NAME%-darwin-arm64 %MAIN_FILE%
 
 echo.
 echo 🎉 构建完成！
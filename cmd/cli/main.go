@@ -122,7 +122,10 @@ func main() {
 			}
 
 			// Load config and start server
-			cfg := config.Load()
+			cfg, err := config.Load()
+			if err != nil {
+				cli.ShowError(fmt.Errorf("配置无效: %v", err))
+			}
 			srv := server.New(cfg)
 
 			fmt.Printf("🚀 启动服务器在 http://%s:%s\n", cfg.Host, cfg.Port)
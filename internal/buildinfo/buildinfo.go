@@ -0,0 +1,57 @@
+package buildinfo
+
+import (
+	"runtime"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+)
+
+// AnthropicVersion is the Anthropic API version assumed when a client sends no
+// anthropic-version header
+const AnthropicVersion = "2023-06-01"
+
+// Build metadata, set from the ldflags of main at startup
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+
+	// ErrorReportingDSN is where opt-in error reports go unless the
+	// configuration names another endpoint; empty in builds without one
+	ErrorReportingDSN = ""
+)
+
+// ReportingDSN returns the endpoint of the error reports for a configuration
+func ReportingDSN(cfg *config.Config) string {
+	if cfg.ErrorReportingDSN != "" {
+		return cfg.ErrorReportingDSN
+	}
+	return ErrorReportingDSN
+}
+
+// Info describes the running build and what it is compatible with
+type Info struct {
+	Version          string   `json:"version"`
+	Commit           string   `json:"commit"`
+	BuildTime        string   `json:"build_time"`
+	GoVersion        string   `json:"go_version"`
+	Platform         string   `json:"platform"`
+	ConfigSchema     int      `json:"config_schema_version"`
+	AnthropicVersion string   `json:"anthropic_version"`
+	UpstreamFormats  []string `json:"upstream_formats"`
+}
+
+// Get returns the build metadata of this binary
+func Get() Info {
+	return Info{
+		Version:          Version,
+		Commit:           Commit,
+		BuildTime:        BuildTime,
+		GoVersion:        runtime.Version(),
+		Platform:         runtime.GOOS + "/" + runtime.GOARCH,
+		ConfigSchema:     config.SchemaVersion,
+		AnthropicVersion: AnthropicVersion,
+		UpstreamFormats:  []string{services.UpstreamFormatOpenAI, services.UpstreamFormatAnthropic},
+	}
+}
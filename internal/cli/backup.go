@@ -0,0 +1,439 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/manifoldco/promptui"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// backupManifest describes the archive and comes first in it
+	backupManifest = "backup.json"
+
+	// backupMagic starts encrypted backups, followed by the scrypt salt,
+	// the AES-GCM nonce and the sealed archive
+	backupMagic = "CLAUDEPROXY-BACKUP-1\n"
+
+	// backupPasswordEnv supplies the password when there is no terminal
+	backupPasswordEnv = "CLAUDEPROXY_BACKUP_PASSWORD"
+)
+
+// backupDataFiles are the files of the config directory a backup includes
+// besides the configuration and transcripts
+var backupDataFiles = []string{"usage.jsonl", "mirror.jsonl", "models.yaml"}
+
+// backupReferencedFiles are the options naming files outside the config
+// directory that a configuration cannot be loaded without. They are stored
+// under the option name and restored into the config directory when their
+// path does not exist on the new machine.
+var backupReferencedFiles = map[string]func(cfg *JSONConfig) *string{
+	"transform_script": func(cfg *JSONConfig) *string { return &cfg.TransformScript },
+	"ca_cert_file":     func(cfg *JSONConfig) *string { return &cfg.Transport.CACertFile },
+}
+
+// BackupOptions configures "claudeproxy backup"
+type BackupOptions struct {
+	Output        string // Archive path, generated in the current directory when empty
+	NoSecrets     bool   // Leave API keys and tokens out of the configuration
+	Encrypt       bool   // Encrypt the archive with a password
+	NoTranscripts bool   // Leave the stored conversations out
+}
+
+// backupInfo is the manifest of a backup archive
+type backupInfo struct {
+	Created time.Time `json:"created"`
+	Version string    `json:"version"` // Version of claudeproxy that made the backup
+	Secrets bool      `json:"secrets"` // Whether the configuration includes secrets
+	Files   []string  `json:"files"`
+}
+
+// RunBackup writes the configuration, the files it references, usage and
+// mirror records, model overrides and transcripts of the config directory to
+// one gzipped tar archive for moving to another machine. Logs and the files
+// of the running server are not included.
+func RunBackup(opts BackupOptions) error {
+	cm := NewJSONConfigManager()
+	if !cm.ConfigExists() {
+		return fmt.Errorf("配置文件不存在，请先运行 'claudeproxy setup'")
+	}
+	configData, err := cm.ExportConfig(opts.NoSecrets)
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{"config.json": configData}
+	dir := config.Dir()
+	for _, name := range backupDataFiles {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			files[name] = data
+		}
+	}
+	if current, err := cm.LoadConfig(); err == nil {
+		for option, field := range backupReferencedFiles {
+			if file := *field(current); file != "" {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("读取 %s 失败: %v", option, err)
+				}
+				files[option+"/"+filepath.Base(file)] = data
+			}
+		}
+	}
+	if !opts.NoTranscripts {
+		paths, _ := filepath.Glob(filepath.Join(dir, "transcripts", "*.jsonl"))
+		for _, p := range paths {
+			if data, err := os.ReadFile(p); err == nil {
+				files["transcripts/"+filepath.Base(p)] = data
+			}
+		}
+	}
+
+	info := backupInfo{Created: time.Now(), Version: buildinfo.Version, Secrets: !opts.NoSecrets}
+	for name := range files {
+		info.Files = append(info.Files, name)
+	}
+	sort.Strings(info.Files)
+	archive, err := writeBackupArchive(&info, files)
+	if err != nil {
+		return fmt.Errorf("生成备份失败: %v", err)
+	}
+
+	output := opts.Output
+	if output == "" {
+		output = "claudeproxy-backup-" + info.Created.Format("20060102-150405") + ".tar.gz"
+		if opts.Encrypt {
+			output += ".enc"
+		}
+	}
+	if opts.Encrypt {
+		password, err := backupPassword(true)
+		if err != nil {
+			return err
+		}
+		if archive, err = encryptBackup(archive, password); err != nil {
+			return fmt.Errorf("加密备份失败: %v", err)
+		}
+	}
+	if err := os.WriteFile(output, archive, config.PrivateFileMode); err != nil {
+		return fmt.Errorf("写入备份文件失败: %v", err)
+	}
+
+	fmt.Printf("✅ 已备份 %d 个文件到 %s\n", len(files), output)
+	if cfg, err := config.Load(); err == nil && cfg.StorageBackend != "" && cfg.StorageBackend != services.StorageJSONL {
+		fmt.Println("⚠️  用量记录和会话记录保存在数据库中，未包含在备份里，请使用数据库自身的备份工具")
+	}
+	if !opts.NoSecrets && !opts.Encrypt {
+		fmt.Println("⚠️  备份包含 API 密钥，请妥善保管 (可使用 --encrypt 加密或 --no-secrets 排除)")
+	}
+	return nil
+}
+
+// RunRestore replaces the configuration, usage records and transcripts with
+// the ones of a backup. Secrets left out of the backup are kept from the
+// current configuration.
+func RunRestore(sm *ServiceManager, file string, yes bool) error {
+	archive, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("读取备份文件失败: %v", err)
+	}
+	if bytes.HasPrefix(archive, []byte(backupMagic)) {
+		password, err := backupPassword(false)
+		if err != nil {
+			return err
+		}
+		if archive, err = decryptBackup(archive, password); err != nil {
+			return err
+		}
+	}
+	info, files, err := readBackupArchive(archive)
+	if err != nil {
+		return fmt.Errorf("读取备份失败: %v", err)
+	}
+
+	fmt.Printf("📦 备份创建于 %s (版本 %s)，包含 %d 个文件\n",
+		info.Created.Local().Format("2006-01-02 15:04:05"), info.Version, len(files))
+	cm := NewJSONConfigManager()
+	if cm.ConfigExists() && !yes && !ConfirmAction("恢复将覆盖当前的配置、用量记录和同名会话记录，确认继续吗?") {
+		fmt.Println("操作已取消")
+		return nil
+	}
+
+	dir := config.Dir()
+	if data, ok := files["config.json"]; ok {
+		data, err := restoreReferencedFiles(data, files, dir)
+		if err != nil {
+			return err
+		}
+		if err := cm.importConfigData(data); err != nil {
+			return err
+		}
+	}
+	for name, data := range files {
+		if name == "config.json" || backupReferencedFiles[path.Dir(name)] != nil {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), config.PrivateDirMode); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, config.PrivateFileMode); err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", name, err)
+		}
+	}
+
+	fmt.Printf("✅ 已从 %s 恢复\n", file)
+	if !info.Secrets && cm.GetConfig("SSY_API_KEY") == "" {
+		fmt.Println("⚠️  备份不包含 API 密钥，请运行 'claudeproxy set' 设置")
+	}
+	if sm.IsRunning() {
+		fmt.Println("ℹ️  运行 'claudeproxy restart' 使服务加载恢复的配置和用量记录")
+	}
+	return nil
+}
+
+// restoreReferencedFiles writes the files referenced by the configuration of
+// a backup into the config directory when their paths do not exist on this
+// machine, and returns the configuration pointing at the restored files.
+// Files that exist are kept as they are.
+func restoreReferencedFiles(configData []byte, files map[string][]byte, dir string) ([]byte, error) {
+	var cfg JSONConfig
+	if err := json.Unmarshal(configData, &cfg); err != nil {
+		return nil, fmt.Errorf("解析备份中的配置失败: %v", err)
+	}
+
+	changed := false
+	for option, field := range backupReferencedFiles {
+		file := field(&cfg)
+		if *file == "" {
+			continue
+		}
+		if _, err := os.Stat(*file); err == nil {
+			continue
+		}
+		name := option + "/" + filepath.Base(*file)
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), config.PrivateDirMode); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, data, config.PrivateFileMode); err != nil {
+			return nil, fmt.Errorf("写入 %s 失败: %v", name, err)
+		}
+		fmt.Printf("ℹ️  %s 不存在，已恢复到 %s\n", *file, target)
+		*file = target
+		changed = true
+	}
+	if !changed {
+		return configData, nil
+	}
+	return json.MarshalIndent(&cfg, "", "  ")
+}
+
+// writeBackupArchive packs the manifest and files into a gzipped tar archive
+func writeBackupArchive(info *backupInfo, files map[string][]byte) ([]byte, error) {
+	manifest, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: info.Created}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := write(backupManifest, manifest); err != nil {
+		return nil, err
+	}
+	for _, name := range info.Files {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readBackupArchive unpacks an archive made by writeBackupArchive. Only the
+// files a backup contains are accepted, so a crafted archive cannot write
+// outside the config directory.
+func readBackupArchive(archive []byte) (*backupInfo, map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, nil, errors.New("不是 claudeproxy 备份文件")
+	}
+	tr := tar.NewReader(gz)
+
+	var info *backupInfo
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch name := header.Name; {
+		case name == backupManifest:
+			info = &backupInfo{}
+			if err := json.Unmarshal(data, info); err != nil {
+				return nil, nil, fmt.Errorf("备份清单无效: %v", err)
+			}
+		case name == "config.json", isBackupDataFile(name):
+			files[name] = data
+		case backupReferencedFiles[path.Dir(name)] != nil && fs.ValidPath(name):
+			files[name] = data
+		case path.Dir(name) == "transcripts" && strings.HasSuffix(name, ".jsonl") && fs.ValidPath(name):
+			files[name] = data
+		default:
+			return nil, nil, fmt.Errorf("备份中有未知文件 %s", name)
+		}
+	}
+	if info == nil {
+		return nil, nil, errors.New("不是 claudeproxy 备份文件")
+	}
+	return info, files, nil
+}
+
+// isBackupDataFile reports whether a file of the config directory is backed up
+func isBackupDataFile(name string) bool {
+	for _, file := range backupDataFiles {
+		if name == file {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptBackup seals an archive with AES-256-GCM under a key derived from
+// the password with scrypt
+func encryptBackup(archive []byte, password string) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := backupCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(backupMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, archive, []byte(backupMagic)), nil
+}
+
+// decryptBackup opens an archive sealed by encryptBackup
+func decryptBackup(data []byte, password string) ([]byte, error) {
+	data = data[len(backupMagic):]
+	if len(data) < 16 {
+		return nil, errors.New("备份文件已损坏")
+	}
+	gcm, err := backupCipher(password, data[:16])
+	if err != nil {
+		return nil, err
+	}
+	data = data[16:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("备份文件已损坏")
+	}
+	archive, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(backupMagic))
+	if err != nil {
+		return nil, errors.New("密码错误或备份文件已损坏")
+	}
+	return archive, nil
+}
+
+// backupCipher derives the AES-GCM cipher of a password and salt
+func backupCipher(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(password), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupPassword reads the backup password from the environment or the
+// terminal, asking twice when setting it
+func backupPassword(confirm bool) (string, error) {
+	if password := os.Getenv(backupPasswordEnv); password != "" {
+		return password, nil
+	}
+	if !interactive() {
+		return "", fmt.Errorf("请在终端中运行，或通过 %s 环境变量提供备份密码", backupPasswordEnv)
+	}
+
+	prompt := promptui.Prompt{
+		Label: "备份密码",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if confirm && len(input) < 8 {
+				return errors.New("密码至少 8 位")
+			}
+			return nil
+		},
+	}
+	password, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("输入密码失败: %v", err)
+	}
+	if confirm {
+		prompt = promptui.Prompt{Label: "确认备份密码", Mask: '*'}
+		again, err := prompt.Run()
+		if err != nil {
+			return "", fmt.Errorf("输入密码失败: %v", err)
+		}
+		if again != password {
+			return "", errors.New("两次输入的密码不一致")
+		}
+	}
+	return password, nil
+}
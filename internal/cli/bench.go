@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BenchOptions configures a load test against the local proxy
+type BenchOptions struct {
+	URL         string // Proxy base URL
+	Requests    int    // Total number of requests
+	Concurrency int    // Number of concurrent workers
+	Stream      bool   // Use streaming requests
+	Model       string // Anthropic model name sent to the proxy
+	MaxTokens   int
+	Prompt      string
+}
+
+// benchSample is the measurement of a single request
+type benchSample struct {
+	latency time.Duration
+	ttfb    time.Duration
+	err     error
+}
+
+// memorySample is the memory reported by the proxy health endpoint
+type memorySample struct {
+	AllocBytes uint64 `json:"alloc_bytes"`
+	SysBytes   uint64 `json:"sys_bytes"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// RunBench fires synthetic /v1/messages requests at the proxy and prints
+// throughput, latency percentiles and proxy memory usage
+func RunBench(opts BenchOptions) error {
+	if opts.Requests <= 0 || opts.Concurrency <= 0 {
+		return fmt.Errorf("请求数和并发数必须大于 0")
+	}
+	if opts.Concurrency > opts.Requests {
+		opts.Concurrency = opts.Requests
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":      opts.Model,
+		"max_tokens": opts.MaxTokens,
+		"stream":     opts.Stream,
+		"messages": []map[string]interface{}{
+			{"role": "user", "content": opts.Prompt},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: 120 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.Concurrency,
+			MaxIdleConnsPerHost: opts.Concurrency,
+		},
+	}
+
+	before, err := fetchMemory(client, opts.URL)
+	if err != nil {
+		return fmt.Errorf("无法连接到代理服务 %s: %v", opts.URL, err)
+	}
+
+	mode := "非流式"
+	if opts.Stream {
+		mode = "流式"
+	}
+	fmt.Printf("🚀 压测 %s/v1/messages (%s, 模型 %s)\n", opts.URL, mode, opts.Model)
+	fmt.Printf("   请求数: %d  并发数: %d\n\n", opts.Requests, opts.Concurrency)
+
+	// Sample proxy memory while the benchmark runs
+	peak := *before
+	stopSampling := make(chan struct{})
+	samplingDone := make(chan struct{})
+	go func() {
+		defer close(samplingDone)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopSampling:
+				return
+			case <-ticker.C:
+				if sample, err := fetchMemory(client, opts.URL); err == nil {
+					if sample.AllocBytes > peak.AllocBytes {
+						peak.AllocBytes = sample.AllocBytes
+					}
+					if sample.SysBytes > peak.SysBytes {
+						peak.SysBytes = sample.SysBytes
+					}
+					if sample.Goroutines > peak.Goroutines {
+						peak.Goroutines = sample.Goroutines
+					}
+				}
+			}
+		}
+	}()
+
+	jobs := make(chan struct{}, opts.Requests)
+	for i := 0; i < opts.Requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	samples := make([]benchSample, 0, opts.Requests)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				sample := sendBenchRequest(client, opts.URL, body)
+				mu.Lock()
+				samples = append(samples, sample)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	close(stopSampling)
+	<-samplingDone
+	after, _ := fetchMemory(client, opts.URL)
+
+	printBenchReport(opts, samples, elapsed, before, &peak, after)
+	return nil
+}
+
+// sendBenchRequest sends a single request and reads the full response
+func sendBenchRequest(client *http.Client, baseURL string, body []byte) benchSample {
+	req, err := http.NewRequest("POST", baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return benchSample{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "claudeproxy")
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return benchSample{err: err}
+	}
+	defer resp.Body.Close()
+
+	// Time to the first byte of the body
+	var ttfb time.Duration
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 && ttfb == 0 {
+			ttfb = time.Since(start)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return benchSample{err: err}
+		}
+	}
+	latency := time.Since(start)
+
+	if resp.StatusCode != http.StatusOK {
+		return benchSample{latency: latency, err: fmt.Errorf("HTTP %d", resp.StatusCode)}
+	}
+
+	return benchSample{latency: latency, ttfb: ttfb}
+}
+
+// fetchMemory reads the memory usage reported by the proxy health endpoint
+func fetchMemory(client *http.Client, baseURL string) (*memorySample, error) {
+	resp, err := client.Get(baseURL + "/health")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Memory memorySample `json:"memory"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, err
+	}
+	return &health.Memory, nil
+}
+
+// printBenchReport prints the benchmark summary
+func printBenchReport(opts BenchOptions, samples []benchSample, elapsed time.Duration, before, peak, after *memorySample) {
+	var latencies, ttfbs []time.Duration
+	errorCounts := make(map[string]int)
+	for _, sample := range samples {
+		if sample.err != nil {
+			errorCounts[sample.err.Error()]++
+			continue
+		}
+		latencies = append(latencies, sample.latency)
+		ttfbs = append(ttfbs, sample.ttfb)
+	}
+
+	failed := len(samples) - len(latencies)
+	fmt.Println("📊 压测结果")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("总耗时:     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("成功/失败:  %d / %d\n", len(latencies), failed)
+	fmt.Printf("吞吐量:     %.2f 请求/秒\n", float64(len(samples))/elapsed.Seconds())
+
+	if len(latencies) > 0 {
+		fmt.Printf("延迟:       平均 %s  p50 %s  p95 %s  p99 %s  最大 %s\n",
+			averageDuration(latencies),
+			percentile(latencies, 0.50),
+			percentile(latencies, 0.95),
+			percentile(latencies, 0.99),
+			percentile(latencies, 1.0))
+		if opts.Stream {
+			fmt.Printf("首字节:     p50 %s  p95 %s\n", percentile(ttfbs, 0.50), percentile(ttfbs, 0.95))
+		}
+	}
+
+	if before != nil && peak != nil {
+		fmt.Printf("代理内存:   开始 %s  峰值 %s", formatBytes(before.AllocBytes), formatBytes(peak.AllocBytes))
+		if after != nil {
+			fmt.Printf("  结束 %s", formatBytes(after.AllocBytes))
+		}
+		fmt.Printf("  (系统 %s, 峰值协程 %d)\n", formatBytes(peak.SysBytes), peak.Goroutines)
+	}
+
+	if len(errorCounts) > 0 {
+		fmt.Println("\n错误:")
+		for msg, count := range errorCounts {
+			fmt.Printf("   %d × %s\n", count, msg)
+		}
+	}
+}
+
+// percentile returns the p-th percentile of the durations
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index].Round(time.Millisecond)
+}
+
+// averageDuration returns the mean of the durations
+func averageDuration(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return (total / time.Duration(len(durations))).Round(time.Millisecond)
+}
+
+// formatBytes formats a byte count in MB
+func formatBytes(b uint64) string {
+	return fmt.Sprintf("%.1fMB", float64(b)/1024/1024)
+}
@@ -0,0 +1,327 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// compareBatchPairs is the number of answer pairs embedded per request
+	compareBatchPairs = 32
+
+	// maxCompareTextRunes limits the text of an answer sent for embedding
+	maxCompareTextRunes = 8000
+
+	// lowSimilarity marks answers that say something noticeably different
+	lowSimilarity = 0.8
+
+	compareEmbeddingTimeout = 2 * time.Minute
+)
+
+// CompareOptions configures the comparison report of mirrored requests
+type CompareOptions struct {
+	Since          time.Duration // Only include requests newer than this; 0 includes all
+	EmbeddingModel string        // Overrides mirror.embedding_model
+	Limit          int           // Most recent pairs measured for similarity; 0 measures all
+	Worst          int           // Least similar pairs listed
+}
+
+// comparePair is a mirrored request both models answered
+type comparePair struct {
+	record     *services.MirrorRecord
+	similarity float64
+	measured   bool
+}
+
+// compareGroup collects the mirrored requests of one primary and shadow model
+type compareGroup struct {
+	primary, shadow               string
+	requests                      int
+	primaryErrors, shadowErrors   int
+	pairs                         []*comparePair
+	primaryLatency, shadowLatency []time.Duration
+	primaryOutput, shadowOutput   int
+	primaryText, shadowText       int
+	primaryCost, shadowCost       float64
+	primaryPriced, shadowPriced   bool
+	toolRequests, toolAgreements  int // Pairs where either model called tools
+	stopAgreements                int
+}
+
+// RunCompare reports how the shadow model of request mirroring compares to
+// the primary model on the recorded requests: latency, output length, cost,
+// agreement of tool calls and stop reasons and, with an embedding model, the
+// semantic similarity of the answers
+func RunCompare(opts CompareOptions) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	var since time.Time
+	if opts.Since > 0 {
+		since = time.Now().Add(-opts.Since)
+	}
+	records, err := storage.LoadMirror(since)
+	if err != nil {
+		return fmt.Errorf("读取镜像记录失败: %v", err)
+	}
+	if len(records) == 0 && opts.Since == 0 {
+		return fmt.Errorf("没有找到镜像记录 (%s)，请在配置中设置 mirror.model 和 mirror.percent 并重启服务", storage)
+	}
+	if len(records) == 0 {
+		fmt.Println("没有符合条件的镜像记录")
+		return nil
+	}
+
+	groups := groupMirrorRecords(records)
+	embeddingModel := opts.EmbeddingModel
+	if embeddingModel == "" {
+		embeddingModel = cfg.Mirror.EmbeddingModel
+	}
+	if embeddingModel != "" {
+		if err := measureSimilarity(cfg, embeddingModel, groups, opts.Limit); err != nil {
+			fmt.Printf("⚠️  计算语义相似度失败: %v\n\n", err)
+		}
+	}
+
+	fmt.Printf("🔬 镜像对比 (%s, %s 起)\n", storage, records[0].Time.Local().Format("2006-01-02 15:04"))
+	for _, group := range groups {
+		printCompareGroup(group, opts.Worst)
+	}
+	if embeddingModel == "" {
+		fmt.Println("\n💡 设置 mirror.embedding_model 或使用 --embedding-model 可计算回答的语义相似度")
+	}
+	return nil
+}
+
+// groupMirrorRecords sorts the records by primary and shadow model
+func groupMirrorRecords(records []services.MirrorRecord) []*compareGroup {
+	byModels := make(map[string]*compareGroup)
+	var groups []*compareGroup
+	for i := range records {
+		record := &records[i]
+		key := record.Primary.Model + "\x00" + record.Shadow.Model
+		group, ok := byModels[key]
+		if !ok {
+			group = &compareGroup{primary: record.Primary.Model, shadow: record.Shadow.Model}
+			byModels[key] = group
+			groups = append(groups, group)
+		}
+
+		group.requests++
+		if record.Primary.Error != "" {
+			group.primaryErrors++
+		}
+		if record.Shadow.Error != "" {
+			group.shadowErrors++
+		}
+		if record.Primary.Error != "" || record.Shadow.Error != "" {
+			continue
+		}
+
+		group.pairs = append(group.pairs, &comparePair{record: record})
+		group.primaryLatency = append(group.primaryLatency, time.Duration(record.Primary.LatencyMs)*time.Millisecond)
+		group.shadowLatency = append(group.shadowLatency, time.Duration(record.Shadow.LatencyMs)*time.Millisecond)
+		group.primaryOutput += record.Primary.OutputTokens
+		group.shadowOutput += record.Shadow.OutputTokens
+		group.primaryText += record.Primary.TextLength
+		group.shadowText += record.Shadow.TextLength
+		if record.Primary.Cost != nil {
+			group.primaryCost += *record.Primary.Cost
+			group.primaryPriced = true
+		}
+		if record.Shadow.Cost != nil {
+			group.shadowCost += *record.Shadow.Cost
+			group.shadowPriced = true
+		}
+		if len(record.Primary.ToolCalls) > 0 || len(record.Shadow.ToolCalls) > 0 {
+			group.toolRequests++
+			if record.SameTools {
+				group.toolAgreements++
+			}
+		}
+		if record.Primary.StopReason == record.Shadow.StopReason {
+			group.stopAgreements++
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].requests > groups[j].requests })
+	return groups
+}
+
+// measureSimilarity embeds the answers of the most recent pairs of every
+// group and sets the cosine similarity of each pair
+func measureSimilarity(cfg *config.Config, model string, groups []*compareGroup, limit int) error {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := services.NewOpenAIClient(cfg, logger, nil, services.NewMetricsService())
+	defer client.Close()
+	if client.IsAnthropicUpstream() {
+		return fmt.Errorf("Anthropic 格式的上游不提供 embeddings 接口")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), compareEmbeddingTimeout)
+	defer cancel()
+	for _, group := range groups {
+		var pending []*comparePair
+		for i := len(group.pairs) - 1; i >= 0 && (limit <= 0 || len(pending) < limit); i-- {
+			pair := group.pairs[i]
+			if len(pair.record.Primary.Content) > 0 || len(pair.record.Shadow.Content) > 0 {
+				pending = append(pending, pair)
+			}
+		}
+
+		for start := 0; start < len(pending); start += compareBatchPairs {
+			batch := pending[start:min(start+compareBatchPairs, len(pending))]
+			inputs := make([]string, 0, 2*len(batch))
+			for _, pair := range batch {
+				inputs = append(inputs, answerText(pair.record.Primary.Content), answerText(pair.record.Shadow.Content))
+			}
+			vectors, err := client.CreateEmbeddings(ctx, model, inputs)
+			if err != nil {
+				return err
+			}
+			for i, pair := range batch {
+				pair.similarity = cosineSimilarity(vectors[2*i], vectors[2*i+1])
+				pair.measured = true
+			}
+		}
+	}
+	return nil
+}
+
+// printCompareGroup prints the comparison of one primary and shadow model
+func printCompareGroup(group *compareGroup, worst int) {
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("%s → %s: %d 个请求，主模型失败 %d，影子模型失败 %d\n",
+		group.primary, group.shadow, group.requests, group.primaryErrors, group.shadowErrors)
+	n := len(group.pairs)
+	if n == 0 {
+		fmt.Println("没有两个模型都成功回答的请求")
+		return
+	}
+
+	fmt.Printf("\n%-18s %14s %14s\n", "", "PRIMARY", "SHADOW")
+	fmt.Printf("%-18s %14v %14v\n", "LATENCY P50", percentile(group.primaryLatency, 0.5), percentile(group.shadowLatency, 0.5))
+	fmt.Printf("%-18s %14v %14v\n", "LATENCY P95", percentile(group.primaryLatency, 0.95), percentile(group.shadowLatency, 0.95))
+	fmt.Printf("%-18s %14.0f %14.0f\n", "AVG OUTPUT TOKENS", float64(group.primaryOutput)/float64(n), float64(group.shadowOutput)/float64(n))
+	fmt.Printf("%-18s %14.0f %14.0f\n", "AVG TEXT LENGTH", float64(group.primaryText)/float64(n), float64(group.shadowText)/float64(n))
+	fmt.Printf("%-18s %14s %14s\n", "COST", formatCompareCost(group.primaryCost, group.primaryPriced), formatCompareCost(group.shadowCost, group.shadowPriced))
+
+	fmt.Println()
+	if group.toolRequests > 0 {
+		fmt.Printf("工具调用一致: %s (%d/%d 个调用了工具的请求)\n",
+			formatShare(group.toolAgreements, group.toolRequests), group.toolAgreements, group.toolRequests)
+	} else {
+		fmt.Println("工具调用一致: - (两个模型都没有调用工具)")
+	}
+	fmt.Printf("结束原因一致: %s (%d/%d)\n", formatShare(group.stopAgreements, n), group.stopAgreements, n)
+
+	var measured []*comparePair
+	var total float64
+	low := 0
+	for _, pair := range group.pairs {
+		if !pair.measured {
+			continue
+		}
+		measured = append(measured, pair)
+		total += pair.similarity
+		if pair.similarity < lowSimilarity {
+			low++
+		}
+	}
+	if len(measured) == 0 {
+		return
+	}
+	fmt.Printf("语义相似度: 平均 %.3f，低于 %.1f 的 %d/%d\n", total/float64(len(measured)), lowSimilarity, low, len(measured))
+
+	sort.Slice(measured, func(i, j int) bool { return measured[i].similarity < measured[j].similarity })
+	if worst > len(measured) {
+		worst = len(measured)
+	}
+	if worst > 0 {
+		fmt.Printf("\n差异最大的请求:\n%-19s %-24s %10s %12s %12s\n", "TIME", "REQUEST ID", "SIMILARITY", "PRIMARY LEN", "SHADOW LEN")
+		for _, pair := range measured[:worst] {
+			record := pair.record
+			fmt.Printf("%-19s %-24s %10.3f %12d %12d\n",
+				record.Time.Local().Format("2006-01-02 15:04:05"), truncate(record.RequestID, 24),
+				pair.similarity, record.Primary.TextLength, record.Shadow.TextLength)
+		}
+	}
+}
+
+// answerText renders the content blocks of an answer as text for embedding,
+// tool calls as their name and input
+func answerText(content []interface{}) string {
+	var parts []string
+	for _, item := range content {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			if text, _ := block["text"].(string); text != "" {
+				parts = append(parts, text)
+			}
+		case "tool_use":
+			input, _ := json.Marshal(block["input"])
+			parts = append(parts, fmt.Sprintf("[%v] %s", block["name"], input))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if runes := []rune(text); len(runes) > maxCompareTextRunes {
+		text = string(runes[:maxCompareTextRunes])
+	}
+	if text == "" {
+		// Embedding APIs reject empty input
+		text = " "
+	}
+	return text
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// formatShare formats part of total as a percentage
+func formatShare(part, total int) string {
+	return fmt.Sprintf("%.0f%%", float64(part)/float64(total)*100)
+}
+
+// formatCompareCost formats the summed cost of one model, "-" when unpriced
+func formatCompareCost(cost float64, priced bool) string {
+	if !priced {
+		return "-"
+	}
+	return fmt.Sprintf("%.6f", cost)
+}
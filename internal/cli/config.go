@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -41,6 +42,28 @@ func (cm *ConfigManager) SetModels(bigModel, smallModel string) error {
 	})
 }
 
+// SetErrorReporting turns the anonymous error reports on or off
+func (cm *ConfigManager) SetErrorReporting(enabled bool) error {
+	return cm.jsonConfigManager.UpdateConfig(map[string]string{
+		"ERROR_REPORTING": strconv.FormatBool(enabled),
+	})
+}
+
+// SetValue sets a single configuration value by key or dotted path
+func (cm *ConfigManager) SetValue(key, value string) error {
+	return cm.jsonConfigManager.SetValue(key, value)
+}
+
+// ExportConfig serializes the configuration, optionally without secrets
+func (cm *ConfigManager) ExportConfig(noSecrets bool) ([]byte, error) {
+	return cm.jsonConfigManager.ExportConfig(noSecrets)
+}
+
+// ImportConfig replaces the configuration with the one in the given file
+func (cm *ConfigManager) ImportConfig(path string) error {
+	return cm.jsonConfigManager.ImportConfig(path)
+}
+
 // LoadConfig loads configuration from JSON file
 func (cm *ConfigManager) LoadConfig() error {
 	// For backward compatibility, we just check if config exists
@@ -80,6 +103,26 @@ func (cm *ConfigManager) ListConfig() error {
 	return cm.jsonConfigManager.ListConfig()
 }
 
+// PinnedModels returns the models pinned with "claudeproxy models pin"
+func (cm *ConfigManager) PinnedModels() []string {
+	return cm.jsonConfigManager.PinnedModels()
+}
+
+// PinModel pins a model, reporting false when it was pinned already
+func (cm *ConfigManager) PinModel(model string) (bool, error) {
+	return cm.jsonConfigManager.PinModel(model)
+}
+
+// UnpinModel unpins a model, reporting false when it was not pinned
+func (cm *ConfigManager) UnpinModel(model string) (bool, error) {
+	return cm.jsonConfigManager.UnpinModel(model)
+}
+
+// ListPinnedModels displays the pinned models
+func (cm *ConfigManager) ListPinnedModels() error {
+	return cm.jsonConfigManager.ListPinnedModels()
+}
+
 // CheckExistingEnvVars checks for existing configuration values
 func (cm *ConfigManager) CheckExistingEnvVars() map[string]string {
 	return cm.jsonConfigManager.CheckExistingConfig()
@@ -104,33 +147,52 @@ func (cm *ConfigManager) UpdateGlobalEnvVarSilent(key, value string) error {
 	}
 }
 
-// updateUnixEnvVarSilent updates environment variable on Unix-like systems without printing messages
-func (cm *ConfigManager) updateUnixEnvVarSilent(key, value string) error {
+// shellProfiles lists the shell configuration files the ANTHROPIC
+// environment variables are exported from on Unix-like systems
+func shellProfiles() []string {
 	homeDir, _ := os.UserHomeDir()
-
-	// List of possible shell configuration files
-	var profileFiles []string
-
 	if runtime.GOOS == "darwin" {
 		// macOS: Update multiple shell config files
-		profileFiles = []string{
+		return []string{
 			filepath.Join(homeDir, ".zshrc"),
 			filepath.Join(homeDir, ".bash_profile"),
 			filepath.Join(homeDir, ".bashrc"),
 			filepath.Join(homeDir, ".profile"),
 		}
-	} else {
-		// Linux: Update common shell config files
-		profileFiles = []string{
-			filepath.Join(homeDir, ".bashrc"),
-			filepath.Join(homeDir, ".zshrc"),
-			filepath.Join(homeDir, ".profile"),
+	}
+	// Linux: Update common shell config files
+	return []string{
+		filepath.Join(homeDir, ".bashrc"),
+		filepath.Join(homeDir, ".zshrc"),
+		filepath.Join(homeDir, ".profile"),
+	}
+}
+
+// profileEnvVars returns the values a variable is exported with in the
+// shell configuration files, by file
+func profileEnvVars(key string) map[string]string {
+	values := make(map[string]string)
+	for _, profileFile := range shellProfiles() {
+		content, err := os.ReadFile(profileFile)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), fmt.Sprintf("export %s=", key)); ok {
+				values[profileFile] = strings.Trim(value, `"'`)
+			}
 		}
 	}
+	return values
+}
+
+// updateUnixEnvVarSilent updates environment variable on Unix-like systems without printing messages
+func (cm *ConfigManager) updateUnixEnvVarSilent(key, value string) error {
+	homeDir, _ := os.UserHomeDir()
 
 	// Update all existing shell configuration files
 	updated := false
-	for _, profileFile := range profileFiles {
+	for _, profileFile := range shellProfiles() {
 		if _, err := os.Stat(profileFile); err == nil {
 			if err := cm.updateShellProfileSilent(profileFile, key, value); err != nil {
 				continue // Silent failure
@@ -234,25 +296,7 @@ func (cm *ConfigManager) ClearAllEnvVars() error {
 
 // clearUnixEnvVars clears environment variables from Unix shell profiles
 func (cm *ConfigManager) clearUnixEnvVars(keys []string) error {
-	homeDir, _ := os.UserHomeDir()
-
-	var profileFiles []string
-	if runtime.GOOS == "darwin" {
-		profileFiles = []string{
-			filepath.Join(homeDir, ".zshrc"),
-			filepath.Join(homeDir, ".bash_profile"),
-			filepath.Join(homeDir, ".bashrc"),
-			filepath.Join(homeDir, ".profile"),
-		}
-	} else {
-		profileFiles = []string{
-			filepath.Join(homeDir, ".bashrc"),
-			filepath.Join(homeDir, ".zshrc"),
-			filepath.Join(homeDir, ".profile"),
-		}
-	}
-
-	for _, profileFile := range profileFiles {
+	for _, profileFile := range shellProfiles() {
 		if _, err := os.Stat(profileFile); err == nil {
 			if err := cm.removeEnvVarsFromProfile(profileFile, keys); err != nil {
 				fmt.Printf("⚠️  清理 %s 失败: %v\n", filepath.Base(profileFile), err)
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+// SetValue sets a single configuration value. The key is either a legacy
+// upper case name (PORT, LOG_LEVEL, BIG_MODEL_NAME) or a dotted path into the
+// JSON configuration (hedging.delay_ms, upstreams.deepseek-chat.base_url,
+// api_keys.0.weight). A "." inside a map key is written as "\.". The value is
+// parsed as JSON when possible and used as a plain string otherwise. The
+// resulting configuration is validated before it is saved.
+func (jcm *JSONConfigManager) SetValue(key, value string) error {
+	current, err := jcm.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	path := splitConfigPath(key)
+	if len(path) == 0 {
+		return fmt.Errorf("配置项不能为空")
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+
+	var parsed interface{} = value
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		parsed = value
+	}
+
+	updated, err := applyConfigValue(tree, path, parsed)
+	if err != nil && parsed != value {
+		// The value looked like JSON but the field expects a string, e.g. PORT 3180
+		updated, err = applyConfigValue(tree, path, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := config.Validate(updated); err != nil {
+		return err
+	}
+	return jcm.SaveConfig(updated)
+}
+
+// applyConfigValue sets the value at path and decodes the result strictly,
+// rejecting unknown keys and values of the wrong type
+func applyConfigValue(tree interface{}, path []string, value interface{}) (*JSONConfig, error) {
+	tree, err := setConfigPath(cloneTree(tree), path, value, "")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var config JSONConfig
+	if err := decoder.Decode(&config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("配置项 %s 的类型应为 %s", typeErr.Field, typeErr.Type)
+		}
+		if strings.HasPrefix(err.Error(), "json: unknown field") {
+			return nil, fmt.Errorf("未知的配置项: %s", strings.Join(path, "."))
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+// splitConfigPath splits a dotted key into path segments. Upper case legacy
+// names such as LOG_LEVEL map to their JSON field names.
+func splitConfigPath(key string) []string {
+	if key == strings.ToUpper(key) && !strings.Contains(key, ".") {
+		key = strings.ToLower(key)
+	}
+
+	var path []string
+	var segment strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			segment.WriteByte('.')
+			i++
+		case key[i] == '.':
+			path = append(path, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteByte(key[i])
+		}
+	}
+	if key != "" {
+		path = append(path, segment.String())
+	}
+	return path
+}
+
+// setConfigPath returns node with the value stored at path, creating
+// intermediate objects as needed
+func setConfigPath(node interface{}, path []string, value interface{}, parent string) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	segment, rest := path[0], path[1:]
+	name := strings.TrimPrefix(parent+"."+segment, ".")
+	if segment == "" {
+		return nil, fmt.Errorf("无效的配置项: %s", name)
+	}
+
+	// Start a new list when the first element is addressed, an object otherwise
+	if node == nil && segment == "0" {
+		node = []interface{}{}
+	}
+
+	switch n := node.(type) {
+	case nil:
+		child, err := setConfigPath(nil, rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{segment: child}, nil
+	case map[string]interface{}:
+		child, err := setConfigPath(n[segment], rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		n[segment] = child
+		return n, nil
+	case []interface{}:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index > len(n) {
+			return nil, fmt.Errorf("%s 的下标应在 0 到 %d 之间", parent, len(n))
+		}
+		if index == len(n) {
+			n = append(n, nil)
+		}
+		child, err := setConfigPath(n[index], rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = child
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%s 不是对象，不能设置 %s", parent, name)
+	}
+}
+
+// cloneTree deep copies a decoded JSON tree so a failed attempt leaves it untouched
+func cloneTree(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(n))
+		for key, value := range n {
+			clone[key] = cloneTree(value)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(n))
+		for i, value := range n {
+			clone[i] = cloneTree(value)
+		}
+		return clone
+	default:
+		return n
+	}
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+)
+
+// ExportConfig serializes the full configuration. With noSecrets the API keys,
+// tokens, DSNs and custom header values are left out so the file can be
+// shared with a team.
+func (jcm *JSONConfigManager) ExportConfig(noSecrets bool) ([]byte, error) {
+	config, err := jcm.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if noSecrets {
+		stripSecrets(config)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ImportConfig replaces the configuration with the one in the given file.
+// Secrets missing from the file, as in an export made with --no-secrets, are
+// kept from the current configuration.
+func (jcm *JSONConfigManager) ImportConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取导入文件失败: %v", err)
+	}
+	return jcm.importConfigData(data)
+}
+
+// importConfigData replaces the configuration with an exported one
+func (jcm *JSONConfigManager) importConfigData(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var imported JSONConfig
+	if err := decoder.Decode(&imported); err != nil {
+		return fmt.Errorf("解析导入文件失败: %v", err)
+	}
+
+	if jcm.ConfigExists() {
+		if current, err := jcm.LoadConfig(); err == nil {
+			keepSecrets(&imported, current)
+		}
+	}
+
+	// Secrets left out of the file and unknown on this machine, as on a new
+	// machine, are reported for the user to set instead of failing validation
+	missing := missingSecrets(&imported)
+	if err := config.Validate(withPlaceholderSecrets(&imported)); err != nil {
+		return err
+	}
+	if err := jcm.SaveConfig(&imported); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		fmt.Printf("⚠️  以下密钥未包含在导入的配置中，请在 %s 中设置后再使用: %s\n", jcm.configPath, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// missingSecrets lists the required secrets of a configuration that are
+// empty, as after an export without secrets
+func missingSecrets(cfg *JSONConfig) []string {
+	var missing []string
+	for i, key := range cfg.APIKeys {
+		if key.Key == "" {
+			missing = append(missing, fmt.Sprintf("api_keys.%d.key", i))
+		}
+	}
+	for i, key := range cfg.LocalKeys {
+		if key.Key == "" {
+			missing = append(missing, fmt.Sprintf("local_keys.%d.key", i))
+		}
+	}
+	if cfg.Hedging.BaseURL != "" && cfg.Hedging.APIKey == "" && !services.SameHost(cfg.Hedging.BaseURL, cfg.BaseURL) {
+		missing = append(missing, "hedging.api_key")
+	}
+	if cfg.Mirror.BaseURL != "" && cfg.Mirror.APIKey == "" {
+		missing = append(missing, "mirror.api_key")
+	}
+	return missing
+}
+
+// withPlaceholderSecrets returns a copy of the configuration with the
+// missing secrets filled in, for validating the rest of it
+func withPlaceholderSecrets(cfg *JSONConfig) *JSONConfig {
+	const placeholder = "placeholder"
+	filled := *cfg
+	filled.APIKeys = append([]config.APIKeyConfig(nil), cfg.APIKeys...)
+	for i := range filled.APIKeys {
+		if filled.APIKeys[i].Key == "" {
+			filled.APIKeys[i].Key = placeholder
+		}
+	}
+	filled.LocalKeys = append([]config.LocalKeyConfig(nil), cfg.LocalKeys...)
+	for i := range filled.LocalKeys {
+		if filled.LocalKeys[i].Key == "" {
+			filled.LocalKeys[i].Key = placeholder
+		}
+	}
+	if filled.Hedging.APIKey == "" {
+		filled.Hedging.APIKey = placeholder
+	}
+	if filled.Mirror.APIKey == "" {
+		filled.Mirror.APIKey = placeholder
+	}
+	return &filled
+}
+
+// stripSecrets removes API keys and tokens from the configuration
+func stripSecrets(config *JSONConfig) {
+	config.SSYAPIKey = ""
+	config.AdminToken = ""
+	config.Hedging.APIKey = ""
+	config.Mirror.APIKey = ""
+	config.UsageReport.WebhookURL = ""
+	config.UsageReport.SMTP.Password = ""
+	config.RedisURL = ""
+	config.StorageDSN = ""
+	config.ErrorReportingDSN = ""
+	stripHeaderValues(config.CustomHeaders)
+	stripHeaderValues(config.Hedging.CustomHeaders)
+	stripHeaderValues(config.Mirror.CustomHeaders)
+	for i := range config.APIKeys {
+		config.APIKeys[i].Key = ""
+	}
+	for i := range config.LocalKeys {
+		config.LocalKeys[i].Key = ""
+		config.LocalKeys[i].UpstreamKey = ""
+	}
+	for model, upstream := range config.Upstreams {
+		upstream.APIKey = ""
+		stripHeaderValues(upstream.CustomHeaders)
+		config.Upstreams[model] = upstream
+	}
+}
+
+// stripHeaderValues removes the values of custom headers, which often carry
+// tokens; the names are kept so the values can be restored on import
+func stripHeaderValues(headers map[string]string) {
+	for name := range headers {
+		headers[name] = ""
+	}
+}
+
+// keepHeaderValues fills custom header values missing from an imported
+// configuration with the current values of the same headers
+func keepHeaderValues(imported, current map[string]string) {
+	for name, value := range imported {
+		if value == "" {
+			imported[name] = current[name]
+		}
+	}
+}
+
+// keepSecrets fills secrets missing from an imported configuration with the
+// current values. Named pooled keys, local keys and upstream keys are matched
+// by name, unnamed pooled keys by their position.
+func keepSecrets(imported, current *JSONConfig) {
+	if imported.SSYAPIKey == "" {
+		imported.SSYAPIKey = current.SSYAPIKey
+	}
+	if imported.AdminToken == "" {
+		imported.AdminToken = current.AdminToken
+	}
+	if imported.Hedging.APIKey == "" {
+		imported.Hedging.APIKey = current.Hedging.APIKey
+	}
+	if imported.Mirror.APIKey == "" {
+		imported.Mirror.APIKey = current.Mirror.APIKey
+	}
+	if imported.UsageReport.WebhookURL == "" {
+		imported.UsageReport.WebhookURL = current.UsageReport.WebhookURL
+	}
+	if imported.UsageReport.SMTP.Password == "" {
+		imported.UsageReport.SMTP.Password = current.UsageReport.SMTP.Password
+	}
+	if imported.RedisURL == "" {
+		imported.RedisURL = current.RedisURL
+	}
+	if imported.StorageDSN == "" {
+		imported.StorageDSN = current.StorageDSN
+	}
+	if imported.ErrorReportingDSN == "" {
+		imported.ErrorReportingDSN = current.ErrorReportingDSN
+	}
+	keepHeaderValues(imported.CustomHeaders, current.CustomHeaders)
+	keepHeaderValues(imported.Hedging.CustomHeaders, current.Hedging.CustomHeaders)
+	keepHeaderValues(imported.Mirror.CustomHeaders, current.Mirror.CustomHeaders)
+
+	// Named pooled keys are matched by name, unnamed ones by position
+	currentKeys := make(map[string]string)
+	for _, key := range current.APIKeys {
+		if key.Name != "" {
+			currentKeys[key.Name] = key.Key
+		}
+	}
+	for i, key := range imported.APIKeys {
+		switch {
+		case key.Key != "":
+		case key.Name != "":
+			imported.APIKeys[i].Key = currentKeys[key.Name]
+		case i < len(current.APIKeys) && current.APIKeys[i].Name == "":
+			imported.APIKeys[i].Key = current.APIKeys[i].Key
+		}
+	}
+
+	// Local keys have unique names
+	currentLocalKeys := make(map[string]config.LocalKeyConfig)
+	for _, key := range current.LocalKeys {
+		if key.Name != "" {
+			currentLocalKeys[key.Name] = key
+		}
+	}
+	for i, key := range imported.LocalKeys {
+		if key.Key == "" {
+			imported.LocalKeys[i].Key = currentLocalKeys[key.Name].Key
+		}
+		if key.UpstreamKey == "" {
+			imported.LocalKeys[i].UpstreamKey = currentLocalKeys[key.Name].UpstreamKey
+		}
+	}
+
+	for model, upstream := range imported.Upstreams {
+		if upstream.APIKey == "" {
+			upstream.APIKey = current.Upstreams[model].APIKey
+		}
+		keepHeaderValues(upstream.CustomHeaders, current.Upstreams[model].CustomHeaders)
+		imported.Upstreams[model] = upstream
+	}
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// errStartAborted is returned by CheckConflicts when the user declines to start
+var errStartAborted = errors.New("已取消启动")
+
+// maxPortSearch bounds the ports tried after the configured one when
+// looking for a free port
+const maxPortSearch = 100
+
+// CheckConflicts looks for other local AI proxies before "claudeproxy start":
+// ANTHROPIC_BASE_URL or ANTHROPIC_AUTH_TOKEN set up for another service,
+// which starting would overwrite, and another program on the configured
+// port. On a terminal it offers to take over, move to a free port or
+// abort; otherwise it only warns and leaves the decision to Start.
+func (sm *ServiceManager) CheckConflicts() error {
+	if err := sm.checkPortConflict(); err != nil {
+		return err
+	}
+	return sm.checkEnvConflict()
+}
+
+// checkPortConflict handles the configured port being used by a program
+// other than the server of this CLI
+func (sm *ServiceManager) checkPortConflict() error {
+	if _, err := sm.instance(); !errors.Is(err, errPortInUse) {
+		return nil
+	}
+
+	port := sm.configManager.GetConfig("PORT")
+	portNumber, _ := strconv.Atoi(port)
+	var servers []process
+	if processes, err := findProcesses(portNumber); err == nil {
+		for _, p := range processes {
+			if p.Listens && p.Server {
+				servers = append(servers, p)
+			}
+		}
+	}
+	switch {
+	case len(servers) > 0:
+		fmt.Printf("⚠️  端口 %s 被失去跟踪的 claudeproxy 服务进程占用 (PID: %d)\n", port, servers[0].PID)
+	case sm.servesMessages():
+		fmt.Printf("⚠️  端口 %s 上已有其他服务在处理 /v1/messages 请求，可能是另一个 AI 代理\n", port)
+	default:
+		fmt.Printf("⚠️  端口 %s 已被其他程序占用\n", port)
+	}
+	if !interactive() {
+		return nil
+	}
+
+	free := sm.freePort(portNumber)
+	var choices []string
+	var actions []func() error
+	if len(servers) > 0 {
+		choices = append(choices, "接管: 结束失去跟踪的服务进程后启动")
+		actions = append(actions, func() error {
+			for _, p := range servers {
+				if err := terminateProcess(p.PID); err != nil {
+					return fmt.Errorf("结束进程失败 (PID: %d): %v", p.PID, err)
+				}
+				fmt.Printf("已结束服务进程 (PID: %d)\n", p.PID)
+			}
+			return nil
+		})
+	}
+	if free != 0 {
+		choices = append(choices, fmt.Sprintf("改用空闲端口 %d 并保存到配置", free))
+		actions = append(actions, func() error {
+			if err := sm.configManager.updateConfig(map[string]string{"PORT": strconv.Itoa(free)}); err != nil {
+				return fmt.Errorf("保存配置失败: %v", err)
+			}
+			fmt.Printf("✅ 端口已改为 %d\n", free)
+			return nil
+		})
+	}
+	choices = append(choices, "取消启动")
+	actions = append(actions, func() error { return errStartAborted })
+
+	return sm.chooseAction("如何处理端口冲突", choices, actions)
+}
+
+// checkEnvConflict handles ANTHROPIC_BASE_URL and ANTHROPIC_AUTH_TOKEN
+// values set up for another service, in the environment of this shell or
+// in the shell configuration files
+func (sm *ServiceManager) checkEnvConflict() error {
+	type setting struct{ source, key, value string }
+	var settings []setting
+	add := func(source, key, value string) {
+		if value != "" {
+			settings = append(settings, setting{source, key, value})
+		}
+	}
+	for _, key := range []string{"ANTHROPIC_BASE_URL", "ANTHROPIC_AUTH_TOKEN"} {
+		add("当前终端", key, os.Getenv(key))
+		if runtime.GOOS != "windows" {
+			for profile, value := range profileEnvVars(key) {
+				add(profile, key, value)
+			}
+		}
+	}
+
+	var conflicts []setting
+	for _, s := range settings {
+		if s.key == "ANTHROPIC_BASE_URL" && !sm.pointsHere(s.value) ||
+			s.key == "ANTHROPIC_AUTH_TOKEN" && s.value != "claudeproxy" {
+			conflicts = append(conflicts, s)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	fmt.Println("⚠️  检测到 Claude Code 的环境变量指向其他服务，启动后会被改为指向本代理:")
+	for _, s := range conflicts {
+		value := s.value
+		if s.key == "ANTHROPIC_AUTH_TOKEN" {
+			value = maskAPIKey(value)
+		}
+		fmt.Printf("   %s=%s (%s)\n", s.key, value, s.source)
+	}
+	if !interactive() {
+		return nil
+	}
+
+	return sm.chooseAction("是否接管这些环境变量", []string{
+		"接管: 改为指向本代理并启动",
+		"取消启动",
+	}, []func() error{
+		func() error { return nil },
+		func() error { return errStartAborted },
+	})
+}
+
+// chooseAction lets the user pick one of the choices and runs its action
+func (sm *ServiceManager) chooseAction(label string, choices []string, actions []func() error) error {
+	choice, err := PromptForChoice(label, choices)
+	if err != nil {
+		return errStartAborted
+	}
+	for i, c := range choices {
+		if c == choice {
+			return actions[i]()
+		}
+	}
+	return errStartAborted
+}
+
+// pointsHere reports whether a base URL addresses the configured port of
+// this machine
+func (sm *ServiceManager) pointsHere(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Port() != sm.configManager.GetConfig("PORT") {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1", "0.0.0.0", sm.configManager.GetConfig("HOST"):
+		return true
+	}
+	return false
+}
+
+// servesMessages reports whether the program on the configured port
+// answers /v1/messages like an Anthropic API, rejecting the empty request
+// rather than the path or method
+func (sm *ServiceManager) servesMessages() bool {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Post(sm.localURL()+"/v1/messages", "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError &&
+		resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusMethodNotAllowed
+}
+
+// freePort returns the first port after the given one that can be listened
+// on at the configured host, or 0
+func (sm *ServiceManager) freePort(port int) int {
+	host := sm.configManager.GetConfig("HOST")
+	for candidate := port + 1; candidate <= port+maxPortSearch && candidate <= 65535; candidate++ {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(candidate)))
+		if err == nil {
+			ln.Close()
+			return candidate
+		}
+	}
+	return 0
+}
+
+// interactive reports whether the CLI can ask the user, that is whether
+// stdin is a terminal
+func interactive() bool {
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+)
+
+// logEntry holds the fields of a service log line used to match requests
+type logEntry struct {
+	Time       time.Time   `json:"time"`
+	Level      string      `json:"level"`
+	RequestID  string      `json:"request_id"`
+	StatusCode json.Number `json:"status_code"`
+}
+
+var (
+	bundleNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	bearerTokenPattern  = regexp.MustCompile(`(Bearer )[^\s",]+`)
+)
+
+// RunDebug collects everything known about a request into a zip file for
+// attaching to bug reports: the recorded upstream exchange, related log lines,
+// the configuration without secrets and version information. Without a
+// request ID the most recent failed request is used.
+func RunDebug(cm *ConfigManager, sm *ServiceManager, lm *LogManager, requestID, output string) error {
+	logFile := lm.GetLogFile()
+	if requestID == "" {
+		requestID = lastFailedRequest(logFile)
+		if requestID == "" {
+			return fmt.Errorf("日志中没有找到失败的请求，请指定请求 ID (见响应头 X-Request-ID 或日志中的 request_id)")
+		}
+		fmt.Printf("🔎 使用最近失败的请求: %s\n", requestID)
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("claudeproxy-debug-%s.zip", bundleNameSanitizer.ReplaceAllString(requestID, "_"))
+	}
+
+	// The bundle holds prompts and responses, so it is readable only by the
+	// user, also when it replaces an existing file
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, config.PrivateFileMode)
+	if err != nil {
+		return fmt.Errorf("创建调试包失败: %v", err)
+	}
+	defer file.Close()
+	if err := file.Chmod(config.PrivateFileMode); err != nil {
+		return fmt.Errorf("创建调试包失败: %v", err)
+	}
+
+	bundle := zip.NewWriter(file)
+	add := func(name string, data []byte) error {
+		w, err := bundle.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	addJSON := func(name string, value interface{}) error {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, append(data, '\n'))
+	}
+
+	// Version of this binary and of the running service
+	versions := map[string]interface{}{"client": buildinfo.Get()}
+	if sm.IsRunning() {
+		if info, err := sm.ServerVersion(); err == nil {
+			versions["server"] = info
+		}
+	}
+	if err := addJSON("version.json", versions); err != nil {
+		return err
+	}
+
+	// Configuration without API keys and tokens
+	if data, err := cm.ExportConfig(true); err == nil {
+		if err := add("config.json", data); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("⚠️  无法读取配置: %v\n", err)
+	}
+
+	// Log lines of the request
+	lines, err := requestLogLines(logFile, requestID)
+	if err != nil {
+		fmt.Printf("⚠️  无法读取日志: %v\n", err)
+	}
+	if err := add("service.log", []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		return err
+	}
+
+	// Failure reported by the running service
+	if sm.IsRunning() {
+		if snapshot, err := sm.Stats(); err == nil {
+			for _, failure := range snapshot.RecentErrors {
+				if failure.RequestID == requestID {
+					if err := addJSON("error.json", failure); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// Recorded upstream exchanges
+	fixtures := requestFixtures(requestID)
+	for _, fixture := range fixtures {
+		if err := addJSON("fixtures/"+fixture.Name+".json", fixture); err != nil {
+			return err
+		}
+	}
+
+	if err := bundle.Close(); err != nil {
+		return fmt.Errorf("写入调试包失败: %v", err)
+	}
+
+	fmt.Printf("✅ 调试包已生成: %s\n", output)
+	fmt.Printf("   日志: %d 行，录制的请求: %d 个\n", len(lines), len(fixtures))
+	if len(fixtures) == 0 {
+		fmt.Println("💡 配置 record_dir 后可以在调试包中包含完整的上游请求和响应")
+	} else {
+		fmt.Println("⚠️  调试包包含对话内容，请确认可以公开后再附加到 Issue")
+	}
+	return nil
+}
+
+// lastFailedRequest returns the ID of the most recent request that logged a
+// warning or error or was answered with an error status
+func lastFailedRequest(logFile string) string {
+	file, err := os.Open(logFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	last := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry logEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.RequestID == "" {
+			continue
+		}
+		status, _ := entry.StatusCode.Int64()
+		if entry.Level == "warning" || entry.Level == "error" || status >= 400 {
+			last = entry.RequestID
+		}
+	}
+	return last
+}
+
+// requestLogLines returns the log lines of a request. Lines logged without a
+// request ID are included when they fall within the time span of the request.
+func requestLogLines(logFile, requestID string) ([]string, error) {
+	scan := func(visit func(line string, entry *logEntry)) error {
+		file, err := os.Open(logFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry logEntry
+			if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+				continue
+			}
+			visit(scanner.Text(), &entry)
+		}
+		return scanner.Err()
+	}
+
+	// Find the time span of the request
+	var first, last time.Time
+	err := scan(func(line string, entry *logEntry) {
+		if entry.RequestID != requestID {
+			return
+		}
+		if first.IsZero() {
+			first = entry.Time
+		}
+		last = entry.Time
+	})
+	if err != nil || first.IsZero() {
+		return nil, err
+	}
+
+	var lines []string
+	err = scan(func(line string, entry *logEntry) {
+		if entry.RequestID == requestID ||
+			(entry.RequestID == "" && !entry.Time.Before(first) && !entry.Time.After(last)) {
+			// Debug logs include a prefix of the upstream API key
+			lines = append(lines, bearerTokenPattern.ReplaceAllString(line, "${1}[REDACTED]"))
+		}
+	})
+	return lines, err
+}
+
+// requestFixtures returns the upstream exchanges recorded for a request
+func requestFixtures(requestID string) []*services.Fixture {
+	cfg, err := config.LoadFile()
+	if err != nil || cfg.RecordDir == "" {
+		return nil
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(cfg.RecordDir, "*.json"))
+	var fixtures []*services.Fixture
+	for _, path := range paths {
+		fixture, err := services.LoadFixture(path)
+		if err != nil || fixture.RequestID != requestID {
+			continue
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures
+}
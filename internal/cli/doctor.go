@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"runtime"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+// RunDoctor checks the permissions of the config directory, config file and
+// logs, and tightens them when fixPerms is set
+func RunDoctor(fixPerms bool) error {
+	fmt.Println("🩺 检查配置文件权限")
+	fmt.Printf("   配置目录: %s\n", config.Dir())
+
+	if runtime.GOOS == "windows" {
+		fmt.Println("ℹ️  Windows 不使用 Unix 文件权限，跳过检查")
+		return nil
+	}
+
+	issues := config.CheckPermissions()
+	if len(issues) == 0 {
+		fmt.Println("✅ 配置文件和日志仅当前用户可访问")
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Printf("⚠️  %s 权限为 %04o，其他用户可以访问 (应为 %04o)\n", issue.Path, issue.Mode, issue.Want)
+	}
+
+	if !fixPerms {
+		fmt.Println("\n💡 运行 'claudeproxy doctor --fix-perms' 修复权限")
+		return nil
+	}
+
+	if err := config.FixPermissions(issues); err != nil {
+		return fmt.Errorf("修复权限失败: %v", err)
+	}
+	fmt.Println("✅ 权限已修复")
+	return nil
+}
+
+// warnInsecureTLS prints a warning when upstream certificates are not verified
+func warnInsecureTLS(cfg *JSONConfig) {
+	if cfg != nil && cfg.Transport.InsecureSkipVerify {
+		fmt.Println("⚠️  已关闭上游 TLS 证书校验 (transport.insecure_skip_verify)，API 密钥和对话内容可能被中间人窃取，建议改用 transport.ca_cert_file")
+	}
+}
+
+// warnInsecurePermissions prints a warning when other users can access the config
+func warnInsecurePermissions() {
+	if issues := config.CheckPermissions(); len(issues) > 0 {
+		fmt.Printf("⚠️  配置文件或日志可被其他用户读取 (如 %s)，运行 'claudeproxy doctor --fix-perms' 修复\n", issues[0].Path)
+	}
+}
@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+const (
+	// exposeKeyName names the local key generated for the tunnel
+	exposeKeyName = "expose"
+
+	// exposeURLTimeout bounds the wait for the tunnel to report its address
+	exposeURLTimeout = 60 * time.Second
+)
+
+// tunnelProvider is a program publishing a local port on a public URL
+type tunnelProvider struct {
+	name    string
+	command string
+	args    func(port int) []string
+	url     *regexp.Regexp // Matches the public URL in the program output
+}
+
+// tunnelProviders are tried in order when no provider is chosen
+var tunnelProviders = []tunnelProvider{
+	{
+		name:    "cloudflared",
+		command: "cloudflared",
+		args: func(port int) []string {
+			return []string{"tunnel", "--no-autoupdate", "--url", fmt.Sprintf("http://127.0.0.1:%d", port)}
+		},
+		url: regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`),
+	},
+	{
+		name:    "tailscale",
+		command: "tailscale",
+		args: func(port int) []string {
+			return []string{"funnel", fmt.Sprint(port)}
+		},
+		url: regexp.MustCompile(`https://[A-Za-z0-9.-]+\.ts\.net`),
+	},
+}
+
+// RunExpose publishes the proxy on a public URL through a Cloudflare quick
+// tunnel or Tailscale Funnel until interrupted, so Claude Code on another
+// machine can use it. The tunnel reaches the proxy through a gate that only
+// passes the API and health check and requires one of the local keys; a key
+// is generated when none is configured.
+func RunExpose(sm *ServiceManager, providerName string) error {
+	provider, err := findTunnelProvider(providerName)
+	if err != nil {
+		return err
+	}
+	if !sm.IsRunning() {
+		fmt.Println("🚀 服务未运行，正在启动...")
+		if err := sm.Start(); err != nil {
+			return err
+		}
+	}
+	key, generated, err := exposeKey()
+	if err != nil {
+		return err
+	}
+	target, err := url.Parse(sm.localURL())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("启动本地转发失败: %v", err)
+	}
+	gate := &http.Server{Handler: exposeGate(target, cfg.LocalKeys)}
+	go gate.Serve(listener)
+	defer gate.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	cmd := exec.Command(provider.command, provider.args(port)...)
+	output, writer := io.Pipe()
+	cmd.Stdout, cmd.Stderr = writer, writer
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动 %s 失败: %v", provider.name, err)
+	}
+	fmt.Printf("🌐 正在通过 %s 建立隧道...\n", provider.name)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+		writer.Close()
+	}()
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			if publicURL := provider.url.FindString(scanner.Text()); publicURL != "" {
+				select {
+				case found <- publicURL:
+				default:
+				}
+			}
+		}
+		// Keep draining when a line was too long to scan
+		io.Copy(io.Discard, output)
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case publicURL := <-found:
+		printExposeInfo(publicURL, key, generated)
+	case err := <-exited:
+		return fmt.Errorf("%s 已退出: %v", provider.name, err)
+	case <-time.After(exposeURLTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("%s 未在 %v 内返回公网地址", provider.name, exposeURLTimeout)
+	case <-quit:
+		cmd.Process.Kill()
+		<-exited
+		return nil
+	}
+
+	select {
+	case err := <-exited:
+		return fmt.Errorf("隧道已断开: %s 已退出: %v", provider.name, err)
+	case <-quit:
+		fmt.Println("\n🛑 正在关闭隧道...")
+		cmd.Process.Kill()
+		<-exited
+		return nil
+	}
+}
+
+// findTunnelProvider returns the named tunnel provider, or with "auto" the
+// first one installed
+func findTunnelProvider(name string) (*tunnelProvider, error) {
+	var names []string
+	for i := range tunnelProviders {
+		provider := &tunnelProviders[i]
+		names = append(names, provider.name)
+		if name != "auto" && name != provider.name {
+			continue
+		}
+		if _, err := exec.LookPath(provider.command); err != nil {
+			if name == "auto" {
+				continue
+			}
+			return nil, fmt.Errorf("找不到 %s 命令，请先安装", provider.command)
+		}
+		return provider, nil
+	}
+	if name != "auto" {
+		return nil, fmt.Errorf("不支持的隧道: %s，可选: auto, %s", name, strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("找不到 cloudflared 或 tailscale，请先安装其中之一:\n" +
+		"  cloudflared: https://developers.cloudflare.com/cloudflare-one/connections/connect-networks/downloads/\n" +
+		"  tailscale:   https://tailscale.com/download")
+}
+
+// exposeKey returns the first configured local key, generating and saving
+// one when there is none
+func exposeKey() (key string, generated bool, err error) {
+	jcm := NewJSONConfigManager()
+	cfg, err := jcm.LoadConfig()
+	if err != nil {
+		return "", false, err
+	}
+	for _, local := range cfg.LocalKeys {
+		if local.Key != "" {
+			return local.Key, false, nil
+		}
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", false, err
+	}
+	key = "sk-claudeproxy-" + hex.EncodeToString(random)
+	cfg.LocalKeys = append(cfg.LocalKeys, config.LocalKeyConfig{Name: exposeKeyName, Key: key})
+	if err := jcm.SaveConfig(cfg); err != nil {
+		return "", false, err
+	}
+	return key, true, nil
+}
+
+// exposeGate forwards the API and health check requests carrying a local key
+// to the proxy, streaming responses as they arrive. The admin API and
+// anything else are not reachable through the tunnel.
+func exposeGate(target *url.URL, keys []config.LocalKeyConfig) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.FlushInterval = -1
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v1/") || r.Method == http.MethodConnect {
+			http.NotFound(w, r)
+			return
+		}
+		if !validExposeKey(requestKey(r), keys) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid API key"}}`)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// requestKey returns the API key of a request, as the server reads it
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// validExposeKey reports whether a key is one of the local keys, comparing
+// in constant time
+func validExposeKey(key string, keys []config.LocalKeyConfig) bool {
+	valid := false
+	for _, local := range keys {
+		if local.Key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(local.Key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// printExposeInfo prints the settings for Claude Code on another machine
+func printExposeInfo(publicURL, key string, generated bool) {
+	fmt.Printf("\n✅ 代理已公开: %s\n", publicURL)
+	if generated {
+		fmt.Printf("🔑 已生成本地密钥 %q 并保存到 local_keys，可在配置文件中修改或设置额度\n", exposeKeyName)
+		fmt.Println("⚠️  配置 local_keys 后其他密钥会被拒绝，本机的 Claude Code 也需要将 ANTHROPIC_AUTH_TOKEN 设置为该密钥")
+	}
+	fmt.Println("💡 在另一台电脑上执行以下命令后运行 claude：")
+	if runtime.GOOS == "windows" {
+		fmt.Printf("set ANTHROPIC_BASE_URL=%s\n", publicURL)
+		fmt.Printf("set ANTHROPIC_AUTH_TOKEN=%s\n", key)
+	} else {
+		fmt.Printf("export ANTHROPIC_BASE_URL=%s\n", publicURL)
+		fmt.Printf("export ANTHROPIC_AUTH_TOKEN=%s\n", key)
+	}
+	fmt.Println("⚠️  只有携带 local_keys 中密钥的请求能通过隧道，管理接口不会公开")
+	fmt.Println("按 Ctrl+C 关闭隧道")
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+)
+
+// Export formats of "claudeproxy history export"
+const (
+	HistoryFormatMarkdown = "markdown"
+	HistoryFormatJSON     = "json"
+)
+
+// RunHistoryList prints the sessions with stored transcripts
+func RunHistoryList() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	sessions, err := storage.ListTranscripts()
+	if err != nil {
+		return fmt.Errorf("读取会话记录失败: %v", err)
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("没有找到会话记录 (%s)，请在配置中设置 \"transcripts\": true 并重启服务", storage)
+	}
+
+	fmt.Printf("💬 会话记录 (%s)\n", storage)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("%-36s %-16s %-16s %6s  %s\n", "SESSION", "STARTED", "UPDATED", "REQS", "TITLE")
+	for _, session := range sessions {
+		fmt.Printf("%-36s %-16s %-16s %6d  %s\n",
+			truncate(session.ID, 36), session.Started.Local().Format("2006-01-02 15:04"),
+			session.Updated.Local().Format("2006-01-02 15:04"), session.Requests, truncate(session.Title, 60))
+	}
+	fmt.Println("\n💡 运行 'claudeproxy history export <SESSION>' 导出会话，SESSION 可只写开头几位")
+	return nil
+}
+
+// RunHistoryExport writes the conversation of a session as Markdown or as
+// an Anthropic messages request body, to a file or stdout
+func RunHistoryExport(session, format, output string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	entries, err := storage.LoadTranscript(session)
+	if err != nil {
+		return fmt.Errorf("读取会话记录失败: %v", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("会话 %s 没有记录", session)
+	}
+	conversation := services.Conversation(entries)
+
+	var data []byte
+	switch format {
+	case HistoryFormatMarkdown:
+		data = []byte(renderMarkdown(entries[0].Session, entries[0].Time, conversation))
+	case HistoryFormatJSON:
+		// Conversations quote code, which should stay readable
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(conversation); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("不支持的格式: %s (可选 %s、%s)", format, HistoryFormatMarkdown, HistoryFormatJSON)
+	}
+
+	if output == "" || output == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	fmt.Printf("✅ 会话已导出到 %s\n", output)
+	return nil
+}
+
+// renderMarkdown formats a conversation for reading. The <system-reminder>
+// blocks Claude Code adds to user messages are left out.
+func renderMarkdown(session string, started time.Time, conversation *services.TranscriptConversation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Claude Code session %s\n\n", session)
+	fmt.Fprintf(&b, "- Model: %s\n", conversation.Model)
+	fmt.Fprintf(&b, "- Started: %s\n\n", started.Local().Format("2006-01-02 15:04:05"))
+
+	if system := systemText(conversation.System); system != "" {
+		b.WriteString("<details>\n<summary>System prompt</summary>\n\n")
+		b.WriteString(codeBlock("", system))
+		b.WriteString("</details>\n\n")
+	}
+
+	for _, message := range conversation.Messages {
+		body := renderContent(message.Content)
+		if body == "" {
+			continue
+		}
+		role := "User"
+		if message.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s", role, body)
+	}
+	return b.String()
+}
+
+// renderContent formats the content blocks of a message
+func renderContent(content interface{}) string {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		blocks = []interface{}{content}
+	}
+
+	var b strings.Builder
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			for _, text := range services.MessageTexts(item) {
+				b.WriteString(strings.TrimSpace(text) + "\n\n")
+			}
+			continue
+		}
+
+		switch block["type"] {
+		case "text":
+			for _, text := range services.MessageTexts([]interface{}{block}) {
+				b.WriteString(strings.TrimSpace(text) + "\n\n")
+			}
+		case "thinking":
+			thinking, _ := block["thinking"].(string)
+			if thinking = strings.TrimSpace(thinking); thinking != "" {
+				b.WriteString("> *Thinking*\n>\n> " + strings.ReplaceAll(thinking, "\n", "\n> ") + "\n\n")
+			}
+		case "tool_use":
+			name, _ := block["name"].(string)
+			input, _ := json.MarshalIndent(block["input"], "", "  ")
+			fmt.Fprintf(&b, "**Tool call: %s**\n\n", name)
+			b.WriteString(codeBlock("json", string(input)))
+		case "tool_result":
+			label := "Tool result"
+			if isError, _ := block["is_error"].(bool); isError {
+				label += " (error)"
+			}
+			fmt.Fprintf(&b, "**%s**\n\n", label)
+			b.WriteString(codeBlock("", toolResultText(block["content"])))
+		case "image":
+			b.WriteString("*[image]*\n\n")
+		}
+	}
+	return b.String()
+}
+
+// toolResultText joins the text of a tool result
+func toolResultText(content interface{}) string {
+	if text, ok := content.(string); ok {
+		return text
+	}
+	var parts []string
+	items, _ := content.([]interface{})
+	for _, item := range items {
+		block, _ := item.(map[string]interface{})
+		switch block["type"] {
+		case "text":
+			text, _ := block["text"].(string)
+			parts = append(parts, text)
+		case "image":
+			parts = append(parts, "[image]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// systemText joins the text of a system prompt given as string or blocks
+func systemText(system interface{}) string {
+	if text, ok := system.(string); ok {
+		return strings.TrimSpace(text)
+	}
+	var parts []string
+	items, _ := system.([]interface{})
+	for _, item := range items {
+		block, _ := item.(map[string]interface{})
+		if text, _ := block["text"].(string); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
+}
+
+// codeBlock fences text, using a longer fence when the text contains one
+func codeBlock(language, text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n\n"
+}
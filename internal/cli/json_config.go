@@ -5,23 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"claude-code-provider-proxy/internal/config"
 )
 
-// JSONConfig represents the configuration stored in JSON format
-type JSONConfig struct {
-	SSYAPIKey       string `json:"ssy_api_key"`
-	BigModelName    string `json:"big_model_name"`
-	SmallModelName  string `json:"small_model_name"`
-	BaseURL         string `json:"base_url"`
-	ReferrerURL     string `json:"referrer_url"`
-	AppName         string `json:"app_name"`
-	AppVersion      string `json:"app_version"`
-	Host            string `json:"host"`
-	Port            string `json:"port"`
-	Reload          string `json:"reload"`
-	OpenClaudeCache string `json:"open_claude_cache"`
-	LogLevel        string `json:"log_level"`
-}
+// JSONConfig represents the configuration stored in JSON format.
+// It shares its definition with the server so that fields unknown to the
+// CLI are preserved when the configuration is saved.
+type JSONConfig = config.JSONConfig
 
 // JSONConfigManager handles JSON configuration file operations
 type JSONConfigManager struct {
@@ -30,15 +21,8 @@ type JSONConfigManager struct {
 
 // NewJSONConfigManager creates a new JSON configuration manager
 func NewJSONConfigManager() *JSONConfigManager {
-	// Get user's home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		// Fallback to current directory
-		homeDir, _ = os.Getwd()
-	}
-
-	configDir := filepath.Join(homeDir, ".claudeproxy")
-	os.MkdirAll(configDir, 0755)
+	configDir := config.Dir()
+	os.MkdirAll(configDir, config.PrivateDirMode)
 
 	return &JSONConfigManager{
 		configPath: filepath.Join(configDir, "config.json"),
@@ -65,15 +49,20 @@ func (jcm *JSONConfigManager) LoadConfig() (*JSONConfig, error) {
 }
 
 // SaveConfig saves configuration to JSON file
-func (jcm *JSONConfigManager) SaveConfig(config *JSONConfig) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+func (jcm *JSONConfigManager) SaveConfig(cfg *JSONConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return fmt.Errorf("序列化配置失败: %v", err)
 	}
 
-	if err := os.WriteFile(jcm.configPath, data, 0644); err != nil {
+	// The file holds API keys, so only the owner may read it. WriteFile keeps
+	// the mode of an existing file, hence the explicit chmod.
+	if err := os.WriteFile(jcm.configPath, data, config.PrivateFileMode); err != nil {
 		return fmt.Errorf("写入配置文件失败: %v", err)
 	}
+	if err := os.Chmod(jcm.configPath, config.PrivateFileMode); err != nil {
+		return fmt.Errorf("设置配置文件权限失败: %v", err)
+	}
 
 	return nil
 }
@@ -109,6 +98,8 @@ func (jcm *JSONConfigManager) SetDefaults() error {
 		Reload:          "true",
 		OpenClaudeCache: "true",
 		LogLevel:        "INFO",
+		// Pinned models outlive a new setup
+		PinnedModels: jcm.PinnedModels(),
 	}
 
 	return jcm.SaveConfig(config)
@@ -156,6 +147,10 @@ func (jcm *JSONConfigManager) UpdateConfig(updates map[string]string) error {
 			config.OpenClaudeCache = value
 		case "LOG_LEVEL":
 			config.LogLevel = value
+		case "ADMIN_TOKEN":
+			config.AdminToken = value
+		case "ERROR_REPORTING":
+			config.ErrorReporting = value == "true"
 		}
 	}
 
@@ -194,6 +189,8 @@ func (jcm *JSONConfigManager) GetConfig(key string) string {
 		return config.OpenClaudeCache
 	case "LOG_LEVEL":
 		return config.LogLevel
+	case "ADMIN_TOKEN":
+		return config.AdminToken
 	default:
 		return ""
 	}
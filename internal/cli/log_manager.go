@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,6 +13,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"claude-code-provider-proxy/internal/config"
 )
 
 // LogManager handles log viewing operations
@@ -20,12 +24,7 @@ type LogManager struct {
 
 // NewLogManager creates a new log manager
 func NewLogManager() *LogManager {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		homeDir, _ = os.Getwd()
-	}
-
-	logFile := filepath.Join(homeDir, ".claudeproxy", "logs", "service.log")
+	logFile := filepath.Join(config.Dir(), "logs", "service.log")
 	return &LogManager{
 		logFile: logFile,
 	}
@@ -79,6 +78,87 @@ func (lm *LogManager) FollowLogs() error {
 	}
 }
 
+// FollowRemoteLogs streams the log of a service over HTTP from its
+// /admin/logs/stream endpoint, reconnecting when the connection drops
+func (lm *LogManager) FollowRemoteLogs(baseURL, token, level string, lines int) error {
+	streamURL := func(lines int) string {
+		query := url.Values{}
+		if level != "" {
+			query.Set("level", level)
+		}
+		if lines > 0 {
+			query.Set("lines", strconv.Itoa(lines))
+		}
+		return strings.TrimRight(baseURL, "/") + "/admin/logs/stream?" + query.Encode()
+	}
+
+	fmt.Printf("🔍 正在监控远程日志: %s\n", baseURL)
+	fmt.Println("💡 按 Ctrl+C 退出监控")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	for {
+		err := lm.streamRemoteLogs(streamURL(lines), token)
+		if _, fatal := err.(remoteLogError); fatal {
+			return err
+		}
+		fmt.Printf("⚠️  连接中断: %v，2 秒后重连...\n", err)
+
+		// Replay the backlog only on the first connection
+		lines = 0
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// remoteLogError is a rejected log stream request that retrying cannot fix
+type remoteLogError struct {
+	status int
+}
+
+func (e remoteLogError) Error() string {
+	switch e.status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("访问被拒绝 (HTTP %d)，请检查 admin_token 或使用 --token", e.status)
+	case http.StatusNotFound:
+		return fmt.Sprintf("服务端没有日志文件或不支持日志流 (HTTP %d)", e.status)
+	default:
+		return fmt.Sprintf("获取日志失败 (HTTP %d)", e.status)
+	}
+}
+
+// streamRemoteLogs prints log events until the stream ends
+func (lm *LogManager) streamRemoteLogs(streamURL, token string) error {
+	req, err := http.NewRequest("GET", streamURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return remoteLogError{status: resp.StatusCode}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			fmt.Println(data)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
 // viewLogsUnix shows logs on Unix-like systems
 func (lm *LogManager) viewLogsUnix(lines int) error {
 	cmd := exec.Command("tail", "-n", strconv.Itoa(lines), lm.logFile)
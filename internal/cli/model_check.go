@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// modelCheckTimeout bounds the test completion of one model
+const modelCheckTimeout = 30 * time.Second
+
+// ModelCheck is the result of a test completion against a model
+type ModelCheck struct {
+	Model   string
+	Latency time.Duration
+	Err     error
+}
+
+// CheckModels sends a one-token test completion to each model at once with
+// the configured upstream and API key
+func CheckModels(cfg *config.Config, modelNames ...string) []ModelCheck {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := services.NewOpenAIClient(cfg, logger, nil, services.NewMetricsService())
+	defer client.Close()
+
+	checks := make([]ModelCheck, len(modelNames))
+	var wg sync.WaitGroup
+	for i, model := range modelNames {
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), modelCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := checkModel(ctx, client, model)
+			checks[i] = ModelCheck{Model: model, Latency: time.Since(start), Err: err}
+		}(i, model)
+	}
+	wg.Wait()
+	return checks
+}
+
+// checkModel sends a one-token completion to the model in the API format of the upstream
+func checkModel(ctx context.Context, client *services.OpenAIClient, model string) error {
+	if !client.IsAnthropicUpstream() {
+		_, err := client.CreateChatCompletion(ctx, &models.OpenAIRequest{
+			Model:     model,
+			Messages:  []models.OpenAIMessage{{Role: "user", Content: "test"}},
+			MaxTokens: 1,
+		})
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "test"}},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Forward(ctx, model, "/messages", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, data)
+	}
+	return nil
+}
+
+// ConfirmModels tests the selected big and small model and reports the
+// result. When a test fails the user chooses to select again (false) or to
+// keep the models anyway (true).
+func ConfirmModels(cfg *config.Config, bigModel, smallModel string) bool {
+	fmt.Println("\n🔌 测试模型连通性 (发送 1 个 token 的测试请求)...")
+	roles := []string{"大", "小"}
+	modelNames := []string{bigModel, smallModel}
+	if bigModel == smallModel {
+		roles, modelNames = []string{"大/小"}, modelNames[:1]
+	}
+
+	failed := false
+	for i, check := range CheckModels(cfg, modelNames...) {
+		if check.Err != nil {
+			failed = true
+			fmt.Printf("❌ %s模型 %s: %v\n", roles[i], check.Model, check.Err)
+			continue
+		}
+		fmt.Printf("✅ %s模型 %s: %dms\n", roles[i], check.Model, check.Latency.Milliseconds())
+	}
+	if !failed {
+		return true
+	}
+
+	fmt.Println("💡 请检查模型名称是否正确、API 密钥是否有权限使用该模型，以及网络能否访问上游")
+	choice, err := PromptForChoice("模型测试未通过", []string{"重新选择模型", "仍然保存"})
+	return err == nil && choice == "仍然保存"
+}
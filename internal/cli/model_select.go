@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+const (
+	// modelPageSize is the number of models on one page of the selector
+	modelPageSize = 15
+
+	// Widest name and API name columns of the selector
+	maxNameColumn    = 28
+	maxAPINameColumn = 40
+)
+
+// Entries of the selector besides the models
+const (
+	searchAgainItem = "🔍 重新搜索 (输入新的关键词)"
+	prevPageItem    = "⬅  上一页"
+	nextPageItem    = "➡  下一页"
+)
+
+// companyGroup is a company and its models in the order of the model list
+type companyGroup struct {
+	Company string
+	Models  []Model
+}
+
+// groupByCompany groups the models by company, largest groups first. Models
+// without a company are grouped under "其他".
+func groupByCompany(models []Model) []companyGroup {
+	index := make(map[string]int)
+	var groups []companyGroup
+	for _, model := range models {
+		company := strings.TrimSpace(model.Company)
+		if company == "" {
+			company = "其他"
+		}
+		i, ok := index[company]
+		if !ok {
+			i = len(groups)
+			index[company] = i
+			groups = append(groups, companyGroup{Company: company})
+		}
+		groups[i].Models = append(groups[i].Models, model)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Models) != len(groups[j].Models) {
+			return len(groups[i].Models) > len(groups[j].Models)
+		}
+		return groups[i].Company < groups[j].Company
+	})
+	return groups
+}
+
+// promptForCompany lets the user narrow the models to one company. It returns
+// the models grouped by company for all companies, and false to search again.
+func promptForCompany(groups []companyGroup, modelType string) ([]Model, bool, error) {
+	var all []Model
+	for _, group := range groups {
+		all = append(all, group.Models...)
+	}
+
+	items := []string{searchAgainItem, fmt.Sprintf("全部公司 (%d 个模型)", len(all))}
+	for _, group := range groups {
+		items = append(items, fmt.Sprintf("%s (%d)", group.Company, len(group.Models)))
+	}
+
+	prompt := promptui.Select{
+		Label: fmt.Sprintf("按公司筛选%s模型", modelType),
+		Items: items,
+		Size:  15,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}:",
+			Active:   "▶ {{ . | cyan }}",
+			Inactive: "  {{ . }}",
+			Selected: "✓ {{ . | green }}",
+		},
+	}
+
+	index, _, err := prompt.Run()
+	if err != nil {
+		return nil, false, fmt.Errorf("选择公司失败: %v", err)
+	}
+	switch index {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return all, true, nil
+	default:
+		return groups[index-2].Models, true, nil
+	}
+}
+
+// promptForModelPage shows the models a page at a time in aligned columns.
+// It returns the API name of the selected model, or an empty name to search
+// again.
+func promptForModelPage(models []Model, modelType string) (string, error) {
+	pages := (len(models) + modelPageSize - 1) / modelPageSize
+	page := 0
+	for {
+		start := page * modelPageSize
+		end := min(start+modelPageSize, len(models))
+		pageModels := models[start:end]
+
+		items := []string{searchAgainItem}
+		if page > 0 {
+			items = append(items, prevPageItem)
+		}
+		offset := len(items)
+		items = append(items, formatModelColumns(pageModels)...)
+		if page < pages-1 {
+			items = append(items, nextPageItem)
+		}
+
+		label := fmt.Sprintf("请选择%s模型", modelType)
+		if pages > 1 {
+			label = fmt.Sprintf("请选择%s模型 (第 %d/%d 页，共 %d 个)", modelType, page+1, pages, len(models))
+		}
+		prompt := promptui.Select{
+			Label: label,
+			Items: items,
+			Size:  len(items),
+			Templates: &promptui.SelectTemplates{
+				Label:    "{{ . }}:",
+				Active:   "▶ {{ . | cyan }}",
+				Inactive: "  {{ . }}",
+				Selected: "✓ {{ . | green }}",
+			},
+		}
+
+		index, item, err := prompt.Run()
+		if err != nil {
+			return "", fmt.Errorf("选择模型失败: %v", err)
+		}
+		switch item {
+		case searchAgainItem:
+			return "", nil
+		case prevPageItem:
+			page--
+		case nextPageItem:
+			page++
+		default:
+			return pageModels[index-offset].APIName, nil
+		}
+	}
+}
+
+// formatModelColumns formats the models as rows of name, API name and company
+// in aligned columns
+func formatModelColumns(models []Model) []string {
+	var nameWidth, apiNameWidth int
+	for _, model := range models {
+		nameWidth = max(nameWidth, displayWidth(truncate(model.Name, maxNameColumn)))
+		apiNameWidth = max(apiNameWidth, displayWidth(truncate(model.APIName, maxAPINameColumn)))
+	}
+
+	rows := make([]string, len(models))
+	for i, model := range models {
+		rows[i] = fmt.Sprintf("%s  %s  %s",
+			padRight(truncate(model.Name, maxNameColumn), nameWidth),
+			padRight(truncate(model.APIName, maxAPINameColumn), apiNameWidth),
+			model.Company)
+	}
+	return rows
+}
+
+// padRight pads a string with spaces to a display width
+func padRight(s string, width int) string {
+	if w := displayWidth(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+// displayWidth is the number of terminal columns of a string, counting East
+// Asian wide characters as two
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+			r >= 0x2E80 && r <= 0xA4CF, // CJK radicals to Yi
+			r >= 0xAC00 && r <= 0xD7A3, // Hangul syllables
+			r >= 0xF900 && r <= 0xFAFF, // CJK compatibility ideographs
+			r >= 0xFE30 && r <= 0xFE4F, // CJK compatibility forms
+			r >= 0xFF00 && r <= 0xFF60, // Fullwidth forms
+			r >= 0xFFE0 && r <= 0xFFE6:
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/server"
+)
+
+// RunOpenAPI writes the OpenAPI document of the proxy API to output, or to
+// stdout when output is empty, for generating clients without a running service
+func RunOpenAPI(output string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(server.OpenAPISpec("http://localhost:"+cfg.Port), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("写入 OpenAPI 文档失败: %v", err)
+	}
+	fmt.Printf("✅ OpenAPI 文档已写入 %s\n", output)
+	return nil
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+// process is an entry of the process table
+type process struct {
+	PID     int
+	Name    string   // Base name of the executable
+	Args    []string // Command line, starting with the program
+	Listens bool     // Listens on the configured port
+	Server  bool     // A server of this program
+	Home    string   // CLAUDEPROXY_HOME of the process, empty when unknown
+}
+
+// isServer reports whether a process is a server of the named executable:
+// started with "server" or listening on the configured port
+func (p *process) isServer(name string) bool {
+	if !sameExecutable(p.Name, name) {
+		return false
+	}
+	if p.Listens {
+		return true
+	}
+	for i, arg := range p.Args {
+		if i > 0 && arg == "server" {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedBy reports whether a server uses the configuration directory: it
+// listens on the configured port or was started for the directory
+func (p *process) ownedBy(dir string) bool {
+	if p.Listens {
+		return true
+	}
+	return p.Home != "" && filepath.Clean(p.Home) == filepath.Clean(dir)
+}
+
+// commandLine joins the command line for display
+func (p *process) commandLine() string {
+	if len(p.Args) == 0 {
+		return p.Name
+	}
+	return truncate(strings.Join(p.Args, " "), 80)
+}
+
+// sameExecutable compares executable names, ignoring the .exe suffix and
+// case on Windows
+func sameExecutable(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		a = strings.TrimSuffix(strings.ToLower(a), ".exe")
+		b = strings.TrimSuffix(strings.ToLower(b), ".exe")
+	}
+	return a != "" && a == b
+}
+
+// findProcesses returns the processes that are servers of this program or
+// listen on the port, other than this process
+func findProcesses(port int) ([]process, error) {
+	processes, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+	listeners, err := portListeners(port)
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if exe, err := os.Executable(); err == nil {
+		name = filepath.Base(exe)
+	}
+
+	var found []process
+	for _, p := range processes {
+		if p.PID == os.Getpid() {
+			continue
+		}
+		p.Listens = listeners[p.PID]
+		p.Server = p.isServer(name)
+		if p.Listens || p.Server {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+// unmanagedServers returns the server processes of this configuration
+// directory other than the one the instance file names, such as servers whose
+// instance file was deleted
+func (sm *ServiceManager) unmanagedServers(managed int) []process {
+	port, _ := strconv.Atoi(sm.configManager.GetConfig("PORT"))
+	processes, err := findProcesses(port)
+	if err != nil {
+		return nil
+	}
+
+	var servers []process
+	for _, p := range processes {
+		if p.Server && p.ownedBy(config.Dir()) && p.PID != managed {
+			servers = append(servers, p)
+		}
+	}
+	return servers
+}
+
+// StopAll stops the running server and ends every other server process of
+// this configuration directory, including ones the CLI lost track of.
+// Servers of other directories are left running; processes of other programs
+// on the configured port are only reported.
+func (sm *ServiceManager) StopAll() error {
+	managed := 0
+	if info, err := sm.instance(); err == nil {
+		if err := sm.Stop(); err != nil {
+			return err
+		}
+		managed = info.PID
+	}
+
+	port, _ := strconv.Atoi(sm.configManager.GetConfig("PORT"))
+	processes, err := findProcesses(port)
+	if err != nil {
+		return fmt.Errorf("查找服务进程失败: %v", err)
+	}
+
+	ended := 0
+	for _, p := range processes {
+		if !p.Server {
+			fmt.Printf("⚠️  端口 %d 被其他程序占用 (PID: %d): %s，未结束该进程\n", port, p.PID, p.commandLine())
+			continue
+		}
+		if !p.ownedBy(config.Dir()) {
+			fmt.Printf("跳过其他配置目录的服务进程 (PID: %d): %s\n", p.PID, p.commandLine())
+			continue
+		}
+		// The stopped server finishes the requests in flight on its own
+		if p.PID == managed {
+			continue
+		}
+		if err := terminateProcess(p.PID); err != nil {
+			fmt.Printf("❌ 结束进程失败 (PID: %d): %v\n", p.PID, err)
+			continue
+		}
+		fmt.Printf("已结束服务进程 (PID: %d): %s\n", p.PID, p.commandLine())
+		ended++
+	}
+
+	if managed == 0 && ended == 0 {
+		fmt.Println("没有找到运行中的服务进程")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listProcesses reads the process table from /proc
+func listProcesses() ([]process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue // Exited, or a kernel thread
+		}
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+
+		// The link names the binary even when argv[0] does not; it is
+		// unreadable for processes of other users
+		name := filepath.Base(args[0])
+		if exe, err := os.Readlink(filepath.Join("/proc", entry.Name(), "exe")); err == nil {
+			name = filepath.Base(strings.TrimSuffix(exe, " (deleted)"))
+		}
+		processes = append(processes, process{PID: pid, Name: name, Args: args, Home: processHome(entry.Name())})
+	}
+	return processes, nil
+}
+
+// processHome reads CLAUDEPROXY_HOME from the environment of a process; the
+// environment is unreadable for processes of other users
+func processHome(pid string) string {
+	environ, err := os.ReadFile(filepath.Join("/proc", pid, "environ"))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range strings.Split(string(environ), "\x00") {
+		if home, ok := strings.CutPrefix(entry, "CLAUDEPROXY_HOME="); ok {
+			return home
+		}
+	}
+	return ""
+}
+
+// portListeners finds the processes listening on a TCP port by matching the
+// sockets of /proc/net/tcp and tcp6 against the open files of each process
+func portListeners(port int) (map[int]bool, error) {
+	inodes := make(map[string]bool)
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(table)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || fields[3] != "0A" { // TCP_LISTEN
+				continue
+			}
+			if strings.HasSuffix(fields[1], fmt.Sprintf(":%04X", port)) {
+				inodes["socket:["+fields[9]+"]"] = true
+			}
+		}
+	}
+
+	listeners := make(map[int]bool)
+	if len(inodes) == 0 {
+		return listeners, nil
+	}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err == nil && inodes[link] {
+			pid, _ := strconv.Atoi(strings.Split(fd, "/")[2])
+			listeners[pid] = true
+		}
+	}
+	return listeners, nil
+}
@@ -0,0 +1,53 @@
+//go:build !linux && !windows
+
+package cli
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listProcesses reads the process table with ps
+func listProcesses() ([]process, error) {
+	out, err := exec.Command("ps", "-axo", "pid=,args=").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []process
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		processes = append(processes, process{PID: pid, Name: filepath.Base(fields[1]), Args: fields[1:]})
+	}
+	return processes, nil
+}
+
+// portListeners finds the processes listening on a TCP port with lsof
+func portListeners(port int) (map[int]bool, error) {
+	out, err := exec.Command("lsof", "-nP", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-t").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(out) == 0 {
+		err = nil // No matches
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make(map[int]bool)
+	for _, field := range strings.Fields(string(out)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			listeners[pid] = true
+		}
+	}
+	return listeners, nil
+}
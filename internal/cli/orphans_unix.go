@@ -0,0 +1,25 @@
+//go:build !windows
+
+package cli
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// terminateProcess asks a process to exit with SIGTERM, which lets a server
+// shut down gracefully, and kills it if it is still there after stopTimeout
+func terminateProcess(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+	}
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
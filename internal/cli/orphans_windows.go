@@ -0,0 +1,70 @@
+//go:build windows
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listProcesses reads the process table through WMI, the only source of the
+// command lines of other processes
+func listProcesses() ([]process, error) {
+	out, err := powershell("Get-CimInstance Win32_Process | Select-Object ProcessId,Name,CommandLine | ConvertTo-Json -Compress")
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		ProcessId   int
+		Name        string
+		CommandLine string
+	}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, err
+	}
+
+	processes := make([]process, 0, len(entries))
+	for _, entry := range entries {
+		processes = append(processes, process{
+			PID:  entry.ProcessId,
+			Name: entry.Name,
+			Args: strings.Fields(entry.CommandLine),
+		})
+	}
+	return processes, nil
+}
+
+// portListeners finds the processes listening on a TCP port
+func portListeners(port int) (map[int]bool, error) {
+	out, err := powershell("Get-NetTCPConnection -State Listen -LocalPort " + strconv.Itoa(port) +
+		" -ErrorAction SilentlyContinue | Select-Object -ExpandProperty OwningProcess")
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make(map[int]bool)
+	for _, field := range strings.Fields(string(out)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			listeners[pid] = true
+		}
+	}
+	return listeners, nil
+}
+
+// terminateProcess ends a process. Windows cannot ask a console process
+// without a window to exit, so it is killed.
+func terminateProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// powershell runs a PowerShell command and returns its output
+func powershell(command string) ([]byte, error) {
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", command).Output()
+}
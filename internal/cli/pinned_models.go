@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PinnedModels returns the pinned models, empty without a configuration
+func (jcm *JSONConfigManager) PinnedModels() []string {
+	if !jcm.ConfigExists() {
+		return nil
+	}
+	config, err := jcm.LoadConfig()
+	if err != nil {
+		return nil
+	}
+	return config.PinnedModels
+}
+
+// PinModel adds a model to the pinned models. It reports false when the
+// model was pinned already.
+func (jcm *JSONConfigManager) PinModel(model string) (bool, error) {
+	model = strings.TrimSpace(model)
+	if err := validateModelName(model); err != nil {
+		return false, err
+	}
+
+	config, err := jcm.LoadConfig()
+	if err != nil {
+		return false, err
+	}
+	if containsString(config.PinnedModels, model) {
+		return false, nil
+	}
+
+	config.PinnedModels = append(config.PinnedModels, model)
+	return true, jcm.SaveConfig(config)
+}
+
+// UnpinModel removes a model from the pinned models. It reports false when
+// the model was not pinned.
+func (jcm *JSONConfigManager) UnpinModel(model string) (bool, error) {
+	model = strings.TrimSpace(model)
+	config, err := jcm.LoadConfig()
+	if err != nil {
+		return false, err
+	}
+
+	var kept []string
+	for _, pinned := range config.PinnedModels {
+		if pinned != model {
+			kept = append(kept, pinned)
+		}
+	}
+	if len(kept) == len(config.PinnedModels) {
+		return false, nil
+	}
+
+	config.PinnedModels = kept
+	return true, jcm.SaveConfig(config)
+}
+
+// ListPinnedModels prints the pinned models, marking the configured big and
+// small model
+func (jcm *JSONConfigManager) ListPinnedModels() error {
+	config, err := jcm.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(config.PinnedModels) == 0 {
+		fmt.Println("📌 还没有收藏的模型")
+		fmt.Println("💡 使用 'claudeproxy models pin <模型>' 收藏常用模型，收藏的模型会在选择模型时排在最前面")
+		return nil
+	}
+
+	fmt.Printf("📌 收藏的模型 (%d):\n", len(config.PinnedModels))
+	for _, model := range config.PinnedModels {
+		var roles []string
+		if model == config.BigModelName {
+			roles = append(roles, "大模型")
+		}
+		if model == config.SmallModelName {
+			roles = append(roles, "小模型")
+		}
+		if len(roles) > 0 {
+			fmt.Printf("  %s  (当前%s)\n", model, strings.Join(roles, "、"))
+		} else {
+			fmt.Printf("  %s\n", model)
+		}
+	}
+	return nil
+}
+
+// containsString reports whether the list contains the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,11 +3,16 @@ package cli
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/manifoldco/promptui"
 )
 
+// modelNamePattern is the format of a model API name such as
+// "deepseek/deepseek-v3" or "claude-sonnet-4@20250514"
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/@+-]*$`)
+
 // PromptForAPIKey prompts user for API key
 func PromptForAPIKey() (string, error) {
 	prompt := promptui.Prompt{
@@ -31,7 +36,7 @@ func PromptForModel(models []Model, modelType string) (string, error) {
 	}
 
 	fmt.Printf("\n💡 共找到 %d 个模型，您可以输入关键词进行搜索筛选\n", len(models))
-	fmt.Println("💡 搜索支持: 模型名称、API名称、公司名称")
+	fmt.Println("💡 搜索支持: 模型名称、API名称、公司名称；匹配较多时可按公司筛选并翻页")
 	fmt.Println("💡 留空直接回车可查看所有模型")
 
 	// Add specific guidance based on model type
@@ -60,7 +65,6 @@ func PromptForModel(models []Model, modelType string) (string, error) {
 
 		// Filter models based on search keyword
 		var filteredModels []Model
-		var filteredItems []string
 
 		searchKeyword = strings.ToLower(strings.TrimSpace(searchKeyword))
 
@@ -70,7 +74,6 @@ func PromptForModel(models []Model, modelType string) (string, error) {
 				strings.Contains(strings.ToLower(model.APIName), searchKeyword) ||
 				strings.Contains(strings.ToLower(model.Company), searchKeyword) {
 				filteredModels = append(filteredModels, model)
-				filteredItems = append(filteredItems, fmt.Sprintf("%s (%s) - %s", model.Name, model.APIName, model.Company))
 			}
 		}
 
@@ -81,35 +84,107 @@ func PromptForModel(models []Model, modelType string) (string, error) {
 
 		fmt.Printf("\n✅ 找到 %d 个匹配的模型\n", len(filteredModels))
 
-		// Add option to search again
-		filteredItems = append([]string{"🔍 重新搜索 (输入新的关键词)"}, filteredItems...)
-
-		// Show selection prompt
-		selectPrompt := promptui.Select{
-			Label: fmt.Sprintf("请选择%s模型", modelType),
-			Items: filteredItems,
-			Size:  15,
-			Templates: &promptui.SelectTemplates{
-				Label:    "{{ . }}:",
-				Active:   "▶ {{ . | cyan }}",
-				Inactive: "  {{ . }}",
-				Selected: "✓ {{ . | green }}",
-			},
+		// Offer to narrow the matches to a company when they do not fit on one page
+		groups := groupByCompany(filteredModels)
+		if len(groups) > 1 && len(filteredModels) > modelPageSize {
+			var ok bool
+			filteredModels, ok, err = promptForCompany(groups, modelType)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				continue // Retry search in the same loop
+			}
 		}
 
-		index, _, err := selectPrompt.Run()
+		// Show the matches a page at a time; an empty name searches again
+		apiName, err := promptForModelPage(filteredModels, modelType)
 		if err != nil {
-			return "", fmt.Errorf("选择模型失败: %v", err)
+			return "", err
 		}
+		if apiName == "" {
+			continue
+		}
+		return apiName, nil
+	}
+}
 
-		// Check if user wants to search again
-		if index == 0 {
-			continue // Retry search in the same loop
+// PromptForRecommendedModel offers the pinned models and the shortlist of
+// recommended models before the full model list. Without either it is the
+// same as PromptForModel.
+func PromptForRecommendedModel(models []Model, modelType string, pinned []string, shortlist []ModelScore) (string, error) {
+	if len(pinned) == 0 && len(shortlist) == 0 {
+		return PromptForModel(models, modelType)
+	}
+
+	items := []string{"🔍 搜索全部模型"}
+	choices := []string{""}
+	for _, model := range pinned {
+		items = append(items, "📌 "+describeModel(models, model))
+		choices = append(choices, model)
+	}
+	for _, score := range shortlist {
+		if containsString(pinned, score.Model) {
+			continue
 		}
+		items = append(items, fmt.Sprintf("⭐ %s  评分 %.1f  上下文 %s  价格 %s  首字 %s",
+			score.Model, score.Score, formatContextWindow(score.ContextWindow),
+			formatPrice(score.Price), formatFirstToken(score.FirstTokenMs)))
+		choices = append(choices, score.Model)
+	}
 
-		// Adjust index for actual model selection (subtract 1 for the search option)
-		return filteredModels[index-1].APIName, nil
+	label := fmt.Sprintf("收藏的%s模型", modelType)
+	if len(shortlist) > 0 {
+		label = fmt.Sprintf("收藏和推荐的%s模型 (claudeproxy recommend 可查看评分说明)", modelType)
+	}
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+		Size:  min(len(items), 15),
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}:",
+			Active:   "▶ {{ . | cyan }}",
+			Inactive: "  {{ . }}",
+			Selected: "✓ {{ . | green }}",
+		},
 	}
+
+	index, _, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("选择模型失败: %v", err)
+	}
+	if index == 0 {
+		return PromptForModel(models, modelType)
+	}
+	return choices[index], nil
+}
+
+// describeModel names a model of the model list with its display name and
+// company, if the list has it
+func describeModel(models []Model, apiName string) string {
+	for _, model := range models {
+		if model.APIName == apiName {
+			return fmt.Sprintf("%s (%s - %s)", apiName, model.Name, model.Company)
+		}
+	}
+	return apiName
+}
+
+// PromptForModelName prompts user to type a model API name, for setups that
+// cannot fetch the model list. The existing value is offered as the default.
+func PromptForModelName(modelType, existingValue string) (string, error) {
+	prompt := promptui.Prompt{
+		Label:    fmt.Sprintf("请输入%s模型的 API 名称", modelType),
+		Default:  existingValue,
+		Validate: validateModelName,
+	}
+
+	result, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("输入模型名称失败: %v", err)
+	}
+
+	return strings.TrimSpace(result), nil
 }
 
 // ConfirmAction prompts user for confirmation
@@ -127,6 +202,16 @@ func ConfirmAction(message string) bool {
 	return strings.ToLower(result) == "y"
 }
 
+// PromptForErrorReporting asks whether to send anonymous error reports
+func PromptForErrorReporting() bool {
+	fmt.Println()
+	fmt.Println("📮 帮助改进 Claude Code Proxy")
+	fmt.Println("   开启后，服务崩溃和上游错误会以匿名报告发送给维护者，用于发现哪些服务商和模型的转换最常出错。")
+	fmt.Println("   报告只包含错误类型、状态码、模型名、服务商域名和程序调用栈，不包含任何提示词、对话内容或密钥。")
+	fmt.Println("   可随时通过 claudeproxy config set error_reporting false 关闭。")
+	return ConfirmAction("是否发送匿名错误报告")
+}
+
 // PromptForChoice prompts user to select from a list of choices
 func PromptForChoice(label string, choices []string) (string, error) {
 	prompt := promptui.Select{
@@ -150,6 +235,18 @@ func validateAPIKey(input string) error {
 	return nil
 }
 
+// validateModelName validates the format of a model API name
+func validateModelName(input string) error {
+	input = strings.TrimSpace(input)
+	if len(input) == 0 {
+		return fmt.Errorf("模型名称不能为空")
+	}
+	if !modelNamePattern.MatchString(input) {
+		return fmt.Errorf("模型名称只能包含字母、数字和 . _ : / @ + -，且以字母或数字开头")
+	}
+	return nil
+}
+
 // ShowWelcome displays welcome message
 func ShowWelcome() {
 	fmt.Println()
@@ -233,8 +330,9 @@ func PromptForAPIKeyWithExisting(existingValue string) (string, bool, error) {
 	return apiKey, true, err
 }
 
-// PromptForModelWithExisting prompts for model selection, considering existing value
-func PromptForModelWithExisting(models []Model, modelType, existingValue string) (string, bool, error) {
+// PromptForModelWithExisting prompts for model selection, considering existing
+// value and offering the pinned models first
+func PromptForModelWithExisting(models []Model, modelType, existingValue string, pinned []string) (string, bool, error) {
 	if existingValue != "" {
 		// Find the model name for display
 		var modelName string
@@ -276,6 +374,6 @@ func PromptForModelWithExisting(models []Model, modelType, existingValue string)
 	}
 
 	// Prompt for new model selection
-	newModel, err := PromptForModel(models, modelType)
+	newModel, err := PromptForRecommendedModel(models, modelType, pinned, nil)
 	return newModel, true, err
 }
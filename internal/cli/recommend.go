@@ -0,0 +1,327 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	recommendTimeout = 30 * time.Second
+
+	// fullContextWindow is the context window that scores fully, that of the Claude models
+	fullContextWindow = 200000
+)
+
+// nonChatModelMarkers mark upstream models that cannot serve Claude Code
+var nonChatModelMarkers = []string{"embed", "rerank", "tts", "whisper", "dall-e", "moderation", "image", "audio"}
+
+// recommendWeights weigh the parts of the score of a role
+type recommendWeights struct {
+	capability, context, latency, price float64
+}
+
+var (
+	// The big model handles the main conversation: capability and context matter most
+	bigWeights = recommendWeights{capability: 0.25, context: 0.30, latency: 0.25, price: 0.20}
+	// The small model handles titles and summaries: cost and speed matter most
+	smallWeights = recommendWeights{capability: 0.10, context: 0.15, latency: 0.35, price: 0.40}
+)
+
+// RecommendOptions configures the model recommendation
+type RecommendOptions struct {
+	Since time.Duration // Window of the latency statistics from the usage ledger
+	Top   int           // Models listed per role
+}
+
+// RecommendDefaults are the options of the recommendation in the wizard
+var RecommendDefaults = RecommendOptions{Since: 7 * 24 * time.Hour, Top: 5}
+
+// ModelScore is a candidate model for the big or small role with the
+// figures its score is based on
+type ModelScore struct {
+	Model         string
+	Score         float64 // 0-100
+	ContextWindow int     // 0 when unknown
+	Price         *config.ModelPrice
+	FirstTokenMs  int64 // Average of recent streams, 0 when unknown
+	Requests      int   // Recent requests in the usage ledger
+	Errors        int   // Of which failed
+	Vision        bool
+	JSONSchema    bool
+	PromptCache   bool
+}
+
+// Recommendations are the ranked shortlists of both roles
+type Recommendations struct {
+	Big, Small []ModelScore
+	Latency    bool // Latency statistics were available
+}
+
+// modelLatency sums the recent requests of a model in the usage ledger
+type modelLatency struct {
+	requests, errors, streams int
+	firstTokenMs              int64
+}
+
+// RecommendModels scores the chat models of the upstream for the big and
+// small roles by capability, context window, price and the first token
+// latency of recent requests in the usage ledger. Models without tool
+// support are left out, as Claude Code relies on tools.
+func RecommendModels(cfg *config.Config, opts RecommendOptions) (*Recommendations, error) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := services.NewOpenAIClient(cfg, logger, nil, services.NewMetricsService())
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), recommendTimeout)
+	defer cancel()
+	upstreamModels, err := client.GetModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取上游模型列表失败: %v", err)
+	}
+	// Routers without prices in their model list leave the price unknown
+	upstreamPrices, _ := client.GetModelPrices(ctx)
+	latencies := loadLatencies(cfg, opts.Since)
+
+	var candidates []ModelScore
+	for _, model := range upstreamModels {
+		if !isChatModel(model.ID) || !cfg.SupportsTools(model.ID) {
+			continue
+		}
+		caps := cfg.Capabilities(model.ID)
+		candidate := ModelScore{
+			Model:         model.ID,
+			ContextWindow: caps.ContextWindow,
+			Vision:        cfg.SupportsVision(model.ID),
+			JSONSchema:    cfg.SupportsJSONSchema(model.ID),
+			PromptCache:   caps.PromptCache != nil && *caps.PromptCache,
+		}
+		if candidate.ContextWindow == 0 {
+			candidate.ContextWindow = model.ContextLength
+		}
+		// The price table of the config and the model registry take precedence
+		// over the upstream's, as for cost estimates
+		if price, ok := cfg.Pricing[model.ID]; ok {
+			candidate.Price = &price
+		} else if caps.Pricing != nil {
+			candidate.Price = caps.Pricing
+		} else if price, ok := upstreamPrices[model.ID]; ok {
+			candidate.Price = &price
+		}
+		if latency, ok := latencies[model.ID]; ok {
+			candidate.Requests, candidate.Errors = latency.requests, latency.errors
+			if latency.streams > 0 {
+				candidate.FirstTokenMs = latency.firstTokenMs / int64(latency.streams)
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("上游没有支持工具调用的对话模型")
+	}
+
+	return &Recommendations{
+		Big:     rankModels(candidates, bigWeights, opts.Top),
+		Small:   rankModels(candidates, smallWeights, opts.Top),
+		Latency: len(latencies) > 0,
+	}, nil
+}
+
+// isChatModel reports whether an upstream model looks like a chat model
+func isChatModel(model string) bool {
+	model = strings.ToLower(model)
+	for _, marker := range nonChatModelMarkers {
+		if strings.Contains(model, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadLatencies sums the recent requests of every upstream model in the
+// usage ledger. Without a ledger no latencies are known.
+func loadLatencies(cfg *config.Config, since time.Duration) map[string]*modelLatency {
+	latencies := make(map[string]*modelLatency)
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return latencies
+	}
+	defer storage.Close()
+
+	var from time.Time
+	if since > 0 {
+		from = time.Now().Add(-since)
+	}
+	records, err := storage.LoadUsage(from)
+	if err != nil {
+		return latencies
+	}
+	for _, record := range records {
+		latency, ok := latencies[record.Model]
+		if !ok {
+			latency = &modelLatency{}
+			latencies[record.Model] = latency
+		}
+		latency.requests++
+		if record.Status >= 400 {
+			latency.errors++
+		}
+		if record.FirstTokenMs > 0 {
+			latency.streams++
+			latency.firstTokenMs += record.FirstTokenMs
+		}
+	}
+	return latencies
+}
+
+// rankModels scores the candidates with the weights of a role and returns
+// the best ones. Price and latency score relative to the best candidate;
+// unknown figures score half.
+func rankModels(candidates []ModelScore, weights recommendWeights, top int) []ModelScore {
+	var cheapest, fastest float64
+	for _, candidate := range candidates {
+		if price := blendedPrice(candidate.Price); price > 0 && (cheapest == 0 || price < cheapest) {
+			cheapest = price
+		}
+		if latency := float64(candidate.FirstTokenMs); latency > 0 && (fastest == 0 || latency < fastest) {
+			fastest = latency
+		}
+	}
+
+	ranked := make([]ModelScore, len(candidates))
+	for i, candidate := range candidates {
+		capability := 0.0
+		if candidate.Vision {
+			capability += 0.5
+		}
+		if candidate.JSONSchema {
+			capability += 0.25
+		}
+		if candidate.PromptCache {
+			capability += 0.25
+		}
+
+		contextScore := 0.5
+		if candidate.ContextWindow > 0 {
+			contextScore = float64(min(candidate.ContextWindow, fullContextWindow)) / fullContextWindow
+		}
+
+		priceScore := 0.5
+		switch price := blendedPrice(candidate.Price); {
+		case candidate.Price == nil:
+		case price == 0:
+			priceScore = 1
+		default:
+			priceScore = cheapest / price
+		}
+
+		latencyScore := 0.5
+		if candidate.FirstTokenMs > 0 {
+			latencyScore = fastest / float64(candidate.FirstTokenMs)
+		}
+		// Failing requests count against the model
+		if candidate.Requests > 0 {
+			latencyScore *= 1 - float64(candidate.Errors)/float64(candidate.Requests)
+		}
+
+		candidate.Score = 100 * (weights.capability*capability + weights.context*contextScore +
+			weights.latency*latencyScore + weights.price*priceScore)
+		ranked[i] = candidate
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Model < ranked[j].Model
+	})
+	if top > 0 && len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	return ranked
+}
+
+// blendedPrice is the price per million tokens weighted by Claude Code's
+// typical mix of three input tokens to one output token
+func blendedPrice(price *config.ModelPrice) float64 {
+	if price == nil {
+		return 0
+	}
+	return (3*price.InputPerMillion + price.OutputPerMillion) / 4
+}
+
+// RunRecommend prints the ranked shortlists of upstream models for the big
+// and small roles
+func RunRecommend(opts RecommendOptions) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fmt.Println("🔄 获取上游模型列表...")
+	recs, err := RecommendModels(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	printRecommendations("🏆 大模型推荐 (复杂任务、主对话)", recs.Big, cfg.BigModelName)
+	printRecommendations("⚡ 小模型推荐 (标题、摘要等简单任务)", recs.Small, cfg.SmallModelName)
+
+	fmt.Println("\n评分综合工具以外的能力（图片、完整 JSON Schema、提示缓存）、上下文长度、价格和首字延迟，大模型更看重能力和上下文，小模型更看重价格和速度")
+	if !recs.Latency {
+		fmt.Println("💡 开启 \"usage_ledger\": true 后，推荐会参考最近请求的首字延迟和失败率")
+	}
+	fmt.Println("💡 使用 'claudeproxy set' 选择模型，或 'claudeproxy config set BIG_MODEL_NAME <模型>' 直接修改")
+	return nil
+}
+
+// printRecommendations prints a ranked shortlist, marking the configured model
+func printRecommendations(title string, scores []ModelScore, current string) {
+	fmt.Printf("\n%s\n", title)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("%-4s %-40s %6s %8s %16s %8s %6s\n", "RANK", "MODEL", "SCORE", "CONTEXT", "PRICE IN/OUT", "TTFB", "REQS")
+	for i, score := range scores {
+		name := truncate(score.Model, 38)
+		if score.Model == current {
+			name += " *"
+		}
+		fmt.Printf("%-4d %-40s %6.1f %8s %16s %8s %6d\n",
+			i+1, name, score.Score, formatContextWindow(score.ContextWindow),
+			formatPrice(score.Price), formatFirstToken(score.FirstTokenMs), score.Requests)
+	}
+	if current != "" {
+		fmt.Printf("* 当前配置的模型: %s\n", current)
+	}
+}
+
+// formatContextWindow formats a context window in thousands of tokens
+func formatContextWindow(tokens int) string {
+	if tokens <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dK", tokens/1000)
+}
+
+// formatPrice formats the input and output price per million tokens
+func formatPrice(price *config.ModelPrice) string {
+	if price == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f/%.2f", price.InputPerMillion, price.OutputPerMillion)
+}
+
+// formatFirstToken formats an average first token latency
+func formatFirstToken(ms int64) string {
+	if ms <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", ms)
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RunReplay replays recorded fixtures through the conversion and streaming
+// services and compares the results with the golden output stored in each
+// fixture. With update set, the golden output is (re)written instead.
+func RunReplay(path string, update bool) error {
+	files, err := fixtureFiles(path)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Printf("📝 未找到录制文件: %s\n", path)
+		return nil
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var passed, failed, updated int
+	for _, file := range files {
+		name := filepath.Base(file)
+
+		fixture, err := services.LoadFixture(file)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", name, err)
+			failed++
+			continue
+		}
+
+		result, err := services.ReplayFixture(fixture, logger)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", name, err)
+			failed++
+			continue
+		}
+
+		if update || (fixture.ExpectedRequest == "" && fixture.ExpectedOutput == "") {
+			fixture.ExpectedRequest = result.Request
+			fixture.ExpectedOutput = result.Output
+			if err := services.SaveFixture(file, fixture); err != nil {
+				fmt.Printf("❌ %s: 保存失败: %v\n", name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("📝 %s: 已更新基准结果\n", name)
+			updated++
+			continue
+		}
+
+		var diffs []string
+		if result.Request != fixture.ExpectedRequest {
+			diffs = append(diffs, "请求转换: "+firstDifference(fixture.ExpectedRequest, result.Request))
+		}
+		if result.Output != fixture.ExpectedOutput {
+			diffs = append(diffs, "响应转换: "+firstDifference(fixture.ExpectedOutput, result.Output))
+		}
+
+		if len(diffs) > 0 {
+			fmt.Printf("❌ %s\n", name)
+			for _, diff := range diffs {
+				fmt.Printf("   %s\n", diff)
+			}
+			failed++
+			continue
+		}
+
+		fmt.Printf("✅ %s\n", name)
+		passed++
+	}
+
+	fmt.Printf("\n通过: %d  失败: %d  更新: %d\n", passed, failed, updated)
+	if failed > 0 {
+		return fmt.Errorf("%d 个录制回放失败", failed)
+	}
+	return nil
+}
+
+// RunAddFixture promotes a capture of record_dir into the fixture corpus in
+// dir. The capture is named by its file name or the proxy request ID (a
+// prefix is enough); the golden result of the current conversion is stored
+// with it.
+func RunAddFixture(captureID, name, dir string) error {
+	capture, err := findCapture(captureID)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = capture.Name
+	}
+	name = bundleNameSanitizer.ReplaceAllString(strings.TrimSuffix(name, ".json"), "_")
+	path := filepath.Join(dir, name+".json")
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("录制文件已存在: %s (使用 --name 指定其他名称)", path)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	gin.SetMode(gin.ReleaseMode)
+	result, err := services.ReplayFixture(capture, logger)
+	if err != nil {
+		return fmt.Errorf("回放录制失败: %v", err)
+	}
+	capture.Name = name
+	capture.ExpectedRequest = result.Request
+	capture.ExpectedOutput = result.Output
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := services.SaveFixture(path, capture); err != nil {
+		return fmt.Errorf("保存录制文件失败: %v", err)
+	}
+
+	fmt.Printf("✅ 已添加录制文件: %s\n", path)
+	fmt.Println("💡 录制文件包含完整的对话内容，提交前请检查其中没有不宜公开的提示词、代码或图片")
+	return nil
+}
+
+// findCapture finds the capture in record_dir with the given file name or
+// request ID prefix
+func findCapture(captureID string) (*services.Fixture, error) {
+	cfg, err := config.LoadFile()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RecordDir == "" {
+		return nil, fmt.Errorf("未配置 record_dir，没有可添加的录制")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.RecordDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	captureID = strings.TrimSuffix(captureID, ".json")
+
+	var matches []*services.Fixture
+	for _, path := range paths {
+		fixture, err := services.LoadFixture(path)
+		if err != nil {
+			continue
+		}
+		if strings.TrimSuffix(filepath.Base(path), ".json") == captureID {
+			return fixture, nil
+		}
+		if fixture.RequestID != "" && strings.HasPrefix(fixture.RequestID, captureID) {
+			matches = append(matches, fixture)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("在 %s 中未找到录制: %s", cfg.RecordDir, captureID)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, match := range matches {
+			names[i] = match.Name
+		}
+		return nil, fmt.Errorf("%s 对应 %d 个录制，请使用文件名指定: %s", captureID, len(matches), strings.Join(names, ", "))
+	}
+}
+
+// fixtureFiles returns the fixture files at path, which may be a file or directory
+func fixtureFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(file, ".json") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// firstDifference describes the first line where expected and actual differ
+func firstDifference(expected, actual string) string {
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var want, got string
+		if i < len(expectedLines) {
+			want = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			got = actualLines[i]
+		}
+		if want != got {
+			return fmt.Sprintf("第 %d 行\n     期望: %s\n     实际: %s", i+1, want, got)
+		}
+	}
+	return "内容不同"
+}
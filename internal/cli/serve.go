@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/server"
+)
+
+// ServeOptions are the flags of the serve command; empty values keep the
+// environment variable or default
+type ServeOptions struct {
+	Host       string
+	Port       string
+	BaseURL    string
+	BigModel   string
+	SmallModel string
+	LogLevel   string
+}
+
+// RunServe runs the server in the foreground in stateless mode for
+// containers: configuration comes only from environment variables and flags,
+// logs go to stdout, and no instance file, config file or shell profile is touched
+func RunServe(opts ServeOptions) error {
+	cfg := config.LoadEnv()
+	cfg.Stateless = true
+	for target, value := range map[*string]string{
+		&cfg.Host:           opts.Host,
+		&cfg.Port:           opts.Port,
+		&cfg.OpenAIBaseURL:  opts.BaseURL,
+		&cfg.BigModelName:   opts.BigModel,
+		&cfg.SmallModelName: opts.SmallModel,
+		&cfg.LogLevel:       opts.LogLevel,
+	} {
+		if value != "" {
+			*target = value
+		}
+	}
+
+	return server.New(cfg).Start()
+}
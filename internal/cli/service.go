@@ -1,7 +1,14 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,41 +17,80 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+	"claude-code-provider-proxy/internal/server"
+	"claude-code-provider-proxy/internal/services"
+)
+
+const (
+	// startTimeout is how long a new server may take to start listening
+	startTimeout = 15 * time.Second
+
+	// stopTimeout is how long a stopping server may take to close its listener
+	stopTimeout = 10 * time.Second
+
+	// handoffTimeout covers starting the successor process during a restart
+	handoffTimeout = 30 * time.Second
 )
 
-// ServiceManager handles server lifecycle
+// Errors of ServiceManager.instance
+var (
+	errNotRunning = errors.New("服务未运行")
+	errPortInUse  = errors.New("端口已被其他程序占用")
+	errNoResponse = errors.New("端口上的服务没有响应")
+)
+
+// ServiceManager handles server lifecycle. It finds the server it manages
+// by the token in the instance file, which the server confirms on the
+// configured port, rather than by process ID.
 type ServiceManager struct {
 	configManager *ConfigManager
-	pidFile       string
+	idleMarker    string // Written by the server when it stops after idling
 }
 
 // NewServiceManager creates a new service manager
 func NewServiceManager(cm *ConfigManager) *ServiceManager {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		homeDir, _ = os.Getwd()
-	}
-
-	configDir := filepath.Join(homeDir, ".claudeproxy")
-	os.MkdirAll(configDir, 0755)
+	configDir := config.Dir()
+	os.MkdirAll(configDir, config.PrivateDirMode)
 
 	return &ServiceManager{
 		configManager: cm,
-		pidFile:       filepath.Join(configDir, "server.pid"),
+		idleMarker:    filepath.Join(configDir, "idle_shutdown"),
 	}
 }
 
-// Start starts the server in background
+// Start starts the server in background and waits until it is listening
 func (sm *ServiceManager) Start() error {
 	// Check if server is already running
-	if sm.IsRunning() {
+	_, err := sm.instance()
+	if err != nil {
+		if pid, ok := sm.legacyServer(); ok {
+			return fmt.Errorf("旧版本启动的服务仍在运行 (PID: %d)，请先运行 'claudeproxy stop'", pid)
+		}
+	}
+	switch {
+	case err == nil:
 		return fmt.Errorf("服务已经在运行")
+	case errors.Is(err, errPortInUse):
+		return fmt.Errorf("端口 %s 已被其他程序占用，如果是失去跟踪或旧版本启动的服务，可运行 'claudeproxy stop --all' 结束", sm.configManager.GetConfig("PORT"))
+	case errors.Is(err, errNoResponse):
+		return fmt.Errorf("端口 %s 上的服务没有响应，可稍后重试或运行 'claudeproxy stop --all' 结束", sm.configManager.GetConfig("PORT"))
 	}
 
 	// Load configuration
 	if err := sm.configManager.LoadConfig(); err != nil {
 		return fmt.Errorf("加载配置失败: %v", err)
 	}
+	if _, err := config.Load(); err != nil {
+		return fmt.Errorf("配置无效: %v", err)
+	}
+	warnInsecurePermissions()
+	if cfg, err := sm.configManager.jsonConfigManager.LoadConfig(); err == nil {
+		warnInsecureTLS(cfg)
+	}
 
 	// Get current executable path
 	execPath, err := os.Executable()
@@ -54,15 +100,22 @@ func (sm *ServiceManager) Start() error {
 
 	// Start server in background
 	cmd := exec.Command(execPath, "server")
-	cmd.Env = os.Environ() // Inherit environment variables
+	// Inherit environment variables; the configuration directory is recorded
+	// so stop --all can tell the servers of different directories apart
+	cmd.Env = append(os.Environ(), "CLAUDEPROXY_HOME="+config.Dir())
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("启动服务失败: %v", err)
 	}
-
-	// Save PID
-	if err := sm.savePID(cmd.Process.Pid); err != nil {
-		return fmt.Errorf("保存PID失败: %v", err)
+	os.Remove(sm.idleMarker)
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	if err := sm.waitForInstance(cmd.Process.Pid, exited); err != nil {
+		return err
 	}
 
 	fmt.Printf("服务已启动，PID: %d\n", cmd.Process.Pid)
@@ -83,36 +136,65 @@ func (sm *ServiceManager) Start() error {
 	return nil
 }
 
-// Stop stops the running server
+// waitForInstance waits until the started process answers on the
+// configured port, failing early when it exits
+func (sm *ServiceManager) waitForInstance(pid int, exited <-chan struct{}) error {
+	logFile := filepath.Join(config.Dir(), "logs", "service.log")
+	deadline := time.After(startTimeout)
+	for {
+		if info, err := sm.instance(); err == nil && info.PID == pid {
+			return nil
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("服务启动失败，请查看日志 %s", logFile)
+		case <-deadline:
+			return fmt.Errorf("服务启动超时 (PID: %d)，请查看日志 %s", pid, logFile)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// Stop stops the running server, or the server an earlier version started
 func (sm *ServiceManager) Stop() error {
-	pid, err := sm.readPID()
+	info, err := sm.instance()
 	if err != nil {
-		return fmt.Errorf("服务未运行")
+		if pid, ok := sm.legacyServer(); ok {
+			if err := terminateProcess(pid); err != nil {
+				return fmt.Errorf("停止服务失败: %v", err)
+			}
+			os.Remove(legacyPIDFile())
+			fmt.Printf("服务已停止 (PID: %d)\n", pid)
+			return nil
+		}
+		return err
 	}
 
-	// Find and kill the process
-	process, err := os.FindProcess(pid)
+	// The server stops accepting connections at once and finishes the
+	// requests in flight in the background
+	resp, err := sm.adminRequest("POST", "/admin/instance/stop", nil)
 	if err != nil {
-		sm.cleanupPID()
-		return fmt.Errorf("找不到进程 %d", pid)
+		return fmt.Errorf("停止服务失败: %v", err)
 	}
+	resp.Body.Close()
 
-	// Try graceful shutdown first
-	if err := process.Signal(syscall.SIGTERM); err != nil {
-		// If graceful shutdown fails, force kill
-		if err := process.Signal(syscall.SIGKILL); err != nil {
-			sm.cleanupPID()
-			return fmt.Errorf("停止服务失败: %v", err)
+	deadline := time.Now().Add(stopTimeout)
+	for sm.IsRunning() {
+		if time.Now().After(deadline) {
+			// Force the process down if it does not stop accepting
+			process, err := os.FindProcess(info.PID)
+			if err == nil {
+				err = process.Kill()
+			}
+			if err != nil {
+				return fmt.Errorf("停止服务失败: %v", err)
+			}
+			break
 		}
+		time.Sleep(200 * time.Millisecond)
 	}
 
-	// Wait a moment for process to stop
-	time.Sleep(2 * time.Second)
-
-	// Clean up PID file
-	sm.cleanupPID()
-
-	fmt.Printf("服务已停止 (PID: %d)\n", pid)
+	fmt.Printf("服务已停止 (PID: %d)\n", info.PID)
 	return nil
 }
 
@@ -122,6 +204,15 @@ func (sm *ServiceManager) Restart() error {
 
 	if wasRunning {
 		fmt.Println("🔄 正在重启服务...")
+		pid, err := sm.handOff()
+		if err == nil {
+			fmt.Printf("服务已重启，PID: %d（旧进程处理完进行中的请求后退出）\n", pid)
+			return nil
+		}
+		fmt.Printf("⚠️  无中断重启失败 (%v)，改为停止后重新启动\n", err)
+		if !sm.IsRunning() {
+			return sm.Start()
+		}
 		if err := sm.Stop(); err != nil {
 			return fmt.Errorf("停止服务失败: %v", err)
 		}
@@ -132,6 +223,25 @@ func (sm *ServiceManager) Restart() error {
 	return sm.Start()
 }
 
+// handOff asks the running server to start a new process on the same
+// listening socket and returns its process ID once it serves. Connections
+// are never refused and streams in flight finish on the old process.
+func (sm *ServiceManager) handOff() (int, error) {
+	resp, err := sm.adminRequestTimeout("POST", "/admin/instance/handoff", nil, handoffTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		PID int `json:"pid"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.PID, nil
+}
+
 // RestartIfRunning restarts the service only if it's currently running
 func (sm *ServiceManager) RestartIfRunning() error {
 	if sm.IsRunning() {
@@ -143,67 +253,282 @@ func (sm *ServiceManager) RestartIfRunning() error {
 	}
 }
 
-// Status shows the current status of the server
-func (sm *ServiceManager) Status() error {
-	if sm.IsRunning() {
-		pid, _ := sm.readPID()
-		fmt.Printf("服务正在运行 (PID: %d)\n", pid)
-		fmt.Printf("服务地址: http://%s:%s\n",
-			sm.configManager.GetConfig("HOST"),
-			sm.configManager.GetConfig("PORT"))
-	} else {
-		fmt.Println("服务未运行")
+// UpdateModels switches the models of the running service through the admin
+// API, so in-flight Claude Code streams are not interrupted by a restart
+func (sm *ServiceManager) UpdateModels(bigModel, smallModel string) error {
+	body, err := json.Marshal(map[string]string{"big": bigModel, "small": smallModel})
+	if err != nil {
+		return err
 	}
+
+	resp, err := sm.adminRequest("PUT", "/admin/models", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
 	return nil
 }
 
-// IsRunning checks if the server is currently running
-func (sm *ServiceManager) IsRunning() bool {
-	pid, err := sm.readPID()
+// Stats fetches the live request statistics of the running service
+func (sm *ServiceManager) Stats() (*services.MetricsSnapshot, error) {
+	resp, err := sm.adminRequest("GET", "/admin/stats", nil)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var snapshot services.MetricsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return nil, err
 	}
+	return &snapshot, nil
+}
+
+// adminRequest calls the admin API of the running service. Responses other
+// than 200 OK are returned as errors.
+func (sm *ServiceManager) adminRequest(method, path string, body io.Reader) (*http.Response, error) {
+	return sm.adminRequestTimeout(method, path, body, 5*time.Second)
+}
 
-	// Check if process exists
-	process, err := os.FindProcess(pid)
+// adminRequestTimeout calls the admin API with a timeout for the whole
+// exchange. The instance token is sent along for the /admin/instance endpoints.
+func (sm *ServiceManager) adminRequestTimeout(method, path string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequest(method, sm.localURL()+path, body)
 	if err != nil {
-		sm.cleanupPID()
-		return false
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := sm.configManager.GetConfig("ADMIN_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if info, err := server.ReadInstanceFile(); err == nil {
+		req.Header.Set(server.InstanceTokenHeader, info.Token)
 	}
 
-	// Send signal 0 to check if process is alive
-	err = process.Signal(syscall.Signal(0))
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
 	if err != nil {
-		sm.cleanupPID()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body models.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != nil {
+			return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, body.Error.Message)
+		}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// instance asks the server on the configured port to identify itself with
+// the token of the instance file. errNotRunning means nothing listens,
+// errNoResponse that the connection was accepted but not answered in time,
+// and errPortInUse that something else answers, such as a server of another
+// config directory or of an earlier version.
+func (sm *ServiceManager) instance() (*server.InstanceInfo, error) {
+	resp, err := sm.adminRequestTimeout("GET", "/admin/instance", nil, 2*time.Second)
+	if err != nil {
+		var urlErr *url.Error
+		switch {
+		case connectionRefused(err):
+			return nil, errNotRunning
+		case errors.As(err, &urlErr):
+			// Something accepted the connection but did not answer in time
+			return nil, fmt.Errorf("%w (%v)", errNoResponse, err)
+		}
+		return nil, fmt.Errorf("%w (%v)", errPortInUse, err)
+	}
+	defer resp.Body.Close()
+
+	var info server.InstanceInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("%w (%v)", errPortInUse, err)
+	}
+	return &info, nil
+}
+
+// connectionRefused reports whether a request failed because nothing listens
+// on the port. Windows words the refusal differently from ECONNREFUSED.
+func connectionRefused(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
 		return false
 	}
+	return errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(opErr.Err.Error(), "refused")
+}
 
-	return true
+// legacyPIDFile is where earlier versions, which tracked the server by
+// process ID, recorded it
+func legacyPIDFile() string {
+	return filepath.Join(config.Dir(), "server.pid")
 }
 
-// savePID saves the process ID to file
-func (sm *ServiceManager) savePID(pid int) error {
-	return os.WriteFile(sm.pidFile, []byte(strconv.Itoa(pid)), 0644)
+// legacyServer returns the server an earlier version recorded in server.pid
+// while that process is still a server of this program. A stale file is
+// removed, so the file is only consulted until it stops being useful.
+func (sm *ServiceManager) legacyServer() (int, bool) {
+	data, err := os.ReadFile(legacyPIDFile())
+	if err != nil {
+		return 0, false
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+		name := ""
+		if exe, err := os.Executable(); err == nil {
+			name = filepath.Base(exe)
+		}
+		if processes, err := listProcesses(); err == nil {
+			for _, p := range processes {
+				if p.PID == pid && p.isServer(name) {
+					return pid, true
+				}
+			}
+		}
+	}
+	os.Remove(legacyPIDFile())
+	return 0, false
 }
 
-// readPID reads the process ID from file
-func (sm *ServiceManager) readPID() (int, error) {
-	data, err := os.ReadFile(sm.pidFile)
+// ServerVersion asks the running service which build it is
+func (sm *ServiceManager) ServerVersion() (*buildinfo.Info, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(sm.localURL() + "/version")
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	var info buildinfo.Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Health of the proxy as reported by ProxyHealth
+const (
+	ProxyStopped  = "stopped"
+	ProxyStarting = "starting" // Running but not yet listening or probing
+	ProxyReady    = "ready"
+	ProxyBroken   = "broken" // Running but not ready, with a reason
+)
+
+// ProxyHealth distinguishes a server that is still starting from one that is
+// broken using the /livez and /readyz probes. The reason explains a broken server.
+func (sm *ServiceManager) ProxyHealth() (state string, reason string) {
+	if !sm.IsRunning() {
+		return ProxyStopped, ""
 	}
 
-	pid, err := strconv.Atoi(string(data))
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(sm.localURL() + "/livez")
 	if err != nil {
-		return 0, err
+		return ProxyStarting, ""
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// Servers started before the probes existed
+		return ProxyReady, ""
 	}
 
-	return pid, nil
+	resp, err = client.Get(sm.localURL() + "/readyz")
+	if err != nil {
+		return ProxyBroken, err.Error()
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return ProxyReady, ""
+	case body.Status == ProxyStarting:
+		return ProxyStarting, ""
+	case body.Reason != "":
+		return ProxyBroken, body.Reason
+	}
+	return ProxyBroken, body.Status
+}
+
+// localURL returns the base URL for reaching the service from this machine.
+// The running server may still listen on the address configured before a
+// change, which the instance file records.
+func (sm *ServiceManager) localURL() string {
+	host, port := sm.configManager.GetConfig("HOST"), sm.configManager.GetConfig("PORT")
+	if info, err := server.ReadInstanceFile(); err == nil {
+		if h, p, err := net.SplitHostPort(info.Addr); err == nil {
+			host, port = h, p
+		}
+	}
+	if host == "" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// Status shows the current status of the server
+func (sm *ServiceManager) Status() error {
+	info, err := sm.instance()
+	if err == nil {
+		fmt.Printf("服务正在运行 (PID: %d)\n", info.PID)
+		fmt.Printf("服务地址: http://%s:%s\n",
+			sm.configManager.GetConfig("HOST"),
+			sm.configManager.GetConfig("PORT"))
+		switch state, reason := sm.ProxyHealth(); state {
+		case ProxyReady:
+			fmt.Println("健康状态: ✅ 就绪")
+		case ProxyStarting:
+			fmt.Println("健康状态: ⏳ 启动中")
+		case ProxyBroken:
+			fmt.Printf("健康状态: ❌ 异常 (%s)\n", reason)
+		}
+		if cfg, err := sm.configManager.jsonConfigManager.LoadConfig(); err == nil {
+			warnInsecureTLS(cfg)
+		}
+		return nil
+	}
+
+	if pid, ok := sm.legacyServer(); ok {
+		fmt.Printf("旧版本启动的服务正在运行 (PID: %d)，运行 'claudeproxy stop' 停止后重新启动即可升级\n", pid)
+		return nil
+	} else if errors.Is(err, errPortInUse) {
+		fmt.Printf("服务未运行 (端口 %s 已被其他程序占用)\n", sm.configManager.GetConfig("PORT"))
+	} else if errors.Is(err, errNoResponse) {
+		fmt.Printf("服务没有响应 (端口 %s)\n", sm.configManager.GetConfig("PORT"))
+	} else if sm.StoppedForIdle() {
+		fmt.Println("服务未运行 (因空闲超时自动停止，运行 'claudeproxy code' 时会自动重新启动)")
+	} else {
+		fmt.Println("服务未运行")
+	}
+	if servers := sm.unmanagedServers(0); len(servers) > 0 {
+		fmt.Printf("⚠️  发现 %d 个失去跟踪的服务进程:\n", len(servers))
+		for _, p := range servers {
+			fmt.Printf("   PID %d: %s\n", p.PID, p.commandLine())
+		}
+		fmt.Println("💡 运行 'claudeproxy stop --all' 结束这些进程")
+	}
+	return nil
+}
+
+// StoppedForIdle reports whether the server last exited because of idle_shutdown_minutes
+func (sm *ServiceManager) StoppedForIdle() bool {
+	_, err := os.Stat(sm.idleMarker)
+	return err == nil
 }
 
-// cleanupPID removes the PID file
-func (sm *ServiceManager) cleanupPID() {
-	os.Remove(sm.pidFile)
+// IsRunning checks if the server is currently running
+func (sm *ServiceManager) IsRunning() bool {
+	_, err := sm.instance()
+	return err == nil
 }
 
 // setAnthropicEnvVars sets ANTHROPIC environment variables for Claude integration
@@ -268,9 +593,15 @@ func (sm *ServiceManager) printExportCommands(baseURL string) {
 
 // RunClaudeCode runs Claude Code with proxy environment variables unset
 func (sm *ServiceManager) RunClaudeCode(args []string) error {
-	// Make sure server is running
+	// Make sure server is running, restarting it on demand after an idle shutdown
 	if !sm.IsRunning() {
-		return fmt.Errorf("服务未运行，请先运行 'claudeproxy start'")
+		if !sm.StoppedForIdle() {
+			return fmt.Errorf("服务未运行，请先运行 'claudeproxy start'")
+		}
+		fmt.Println("💤 服务因空闲已自动停止，正在重新启动...")
+		if err := sm.Start(); err != nil {
+			return err
+		}
 	}
 
 	// Ensure Claude Code is installed
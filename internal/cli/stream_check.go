@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/services"
+)
+
+// streamCheckTimeout bounds the streaming health check
+const streamCheckTimeout = 30 * time.Second
+
+// RunStreamCheck requests the streaming health check of the proxy at baseURL,
+// or at ANTHROPIC_BASE_URL or the local server when baseURL is empty, and
+// reports whether its events arrive one by one. Events arriving together at
+// the end mean a reverse proxy or the network buffers the stream, which makes
+// Claude Code show responses only once they are complete.
+func RunStreamCheck(sm *ServiceManager, baseURL string) error {
+	if baseURL == "" {
+		baseURL = os.Getenv("ANTHROPIC_BASE_URL")
+		if baseURL == "" {
+			baseURL = sm.localURL()
+		}
+	}
+	url := strings.TrimSuffix(baseURL, "/") + "/health?deep=stream"
+	fmt.Printf("\n🩺 检查流式响应: %s\n", url)
+
+	client := &http.Client{Timeout: streamCheckTimeout}
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务返回 HTTP %d，可能不是 claudeproxy 或版本过旧", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		return fmt.Errorf("响应类型为 %q，不是 text/event-stream，反向代理可能改写了响应", contentType)
+	}
+
+	var arrivals []time.Duration
+	var stopped bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		event, ok := strings.CutPrefix(scanner.Text(), "event: ")
+		if !ok {
+			continue
+		}
+		arrivals = append(arrivals, time.Since(start))
+		if event == "error" {
+			return fmt.Errorf("服务在流式响应中返回了错误事件")
+		}
+		stopped = event == "message_stop"
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取流式响应失败: %v", err)
+	}
+	if !stopped || len(arrivals) < 2 {
+		return fmt.Errorf("流式响应不完整 (收到 %d 个事件)，反向代理可能提前断开了连接", len(arrivals))
+	}
+
+	first, last := arrivals[0], arrivals[len(arrivals)-1]
+	fmt.Printf("   收到 %d 个事件，首个事件 %v，最后一个事件 %v\n",
+		len(arrivals), first.Round(time.Millisecond), last.Round(time.Millisecond))
+	if last-first < services.StreamCheckInterval {
+		fmt.Println("❌ 所有事件同时到达，流式响应被缓冲，Claude Code 只能在回答完成后才显示内容")
+		fmt.Println("💡 如使用 nginx，请在 location 中设置 proxy_buffering off; 并关闭该路径的 gzip")
+		fmt.Println("   如使用 Caddy，请在 reverse_proxy 中设置 flush_interval -1")
+		if resp.Uncompressed {
+			fmt.Println("   响应经过了 gzip 压缩，压缩通常会缓冲流式响应")
+		}
+		return nil
+	}
+	fmt.Println("✅ 事件逐个到达，流式响应工作正常")
+	return nil
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// RunTap prints the response of a request in flight as the client receives
+// it, without affecting the client. Without a request ID the most recently
+// started request is observed.
+func RunTap(sm *ServiceManager, requestID string) error {
+	if !sm.IsRunning() {
+		return fmt.Errorf("服务未运行，请先运行 'claudeproxy start'")
+	}
+
+	if requestID == "" {
+		snapshot, err := sm.Stats()
+		if err != nil {
+			return fmt.Errorf("获取进行中的请求失败: %v", err)
+		}
+		if len(snapshot.Active) == 0 {
+			return fmt.Errorf("当前没有进行中的请求")
+		}
+		requestID = snapshot.Active[len(snapshot.Active)-1].ID
+	}
+
+	req, err := http.NewRequest("GET", sm.localURL()+"/admin/tap/"+url.PathEscape(requestID), nil)
+	if err != nil {
+		return err
+	}
+	if token := sm.configManager.GetConfig("ADMIN_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("没有 ID 为 %s 的进行中的请求，可运行 'claudeproxy top' 查看", requestID)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("访问被拒绝 (HTTP %d)，请检查 admin_token", resp.StatusCode)
+	default:
+		return fmt.Errorf("旁观请求失败 (HTTP %d)", resp.StatusCode)
+	}
+
+	fmt.Fprintf(os.Stderr, "👀 正在旁观请求 %s (只读，按 Ctrl+C 退出)\n", requestID)
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return fmt.Errorf("连接中断: %v", err)
+	}
+	fmt.Fprintln(os.Stderr, "\n✅ 请求已结束")
+	return nil
+}
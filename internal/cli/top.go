@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"claude-code-provider-proxy/internal/services"
+)
+
+// Terminal control sequences used to redraw in place
+const (
+	ansiHome       = "\033[H"
+	ansiClearLine  = "\033[K"
+	ansiClearBelow = "\033[J"
+	ansiHideCursor = "\033[?25l"
+	ansiShowCursor = "\033[?25h"
+)
+
+// RunTop shows live statistics of the running service, refreshing in place
+// until interrupted
+func RunTop(sm *ServiceManager, interval time.Duration) error {
+	if !sm.IsRunning() {
+		return fmt.Errorf("服务未运行，请先运行 'claudeproxy start'")
+	}
+	if interval < 200*time.Millisecond {
+		interval = 200 * time.Millisecond
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	fmt.Print(ansiHideCursor + "\033[2J")
+	defer fmt.Print(ansiShowCursor)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous *services.MetricsSnapshot
+	for {
+		snapshot, err := sm.Stats()
+		fmt.Print(renderTop(sm.localURL(), snapshot, previous, err))
+		if snapshot != nil {
+			previous = snapshot
+		}
+
+		select {
+		case <-quit:
+			fmt.Println()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderTop draws one frame. Rates are derived from the previous snapshot.
+func renderTop(url string, snapshot, previous *services.MetricsSnapshot, fetchErr error) string {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString(ansiClearLine + "\n")
+	}
+
+	b.WriteString(ansiHome)
+	if fetchErr != nil {
+		line("claudeproxy top - %s  (Ctrl+C 退出)", url)
+		line("")
+		line("❌ 无法获取服务状态: %v", fetchErr)
+		b.WriteString(ansiClearBelow)
+		return b.String()
+	}
+
+	line("claudeproxy top - %s  运行 %s  请求总数 %d  (Ctrl+C 退出)",
+		url, time.Duration(snapshot.UptimeSeconds)*time.Second, snapshot.TotalRequests)
+	line("")
+
+	// Requests in flight
+	line("📡 进行中的请求 (%d)", len(snapshot.Active))
+	line("  %-24s %-30s %-6s %8s %10s", "REQUEST ID", "MODEL", "STREAM", "ELAPSED", "SENT")
+	for _, req := range snapshot.Active {
+		stream := "no"
+		if req.Stream {
+			stream = "yes"
+		}
+		elapsed := snapshot.Time.Sub(req.StartedAt).Truncate(100 * time.Millisecond)
+		line("  %-24s %-30s %-6s %8s %10s", truncate(req.ID, 24), truncate(req.Model, 30), stream, elapsed, formatSize(req.Bytes))
+	}
+	line("")
+
+	// Per model counters and throughput
+	dt := 0.0
+	if previous != nil {
+		dt = snapshot.Time.Sub(previous.Time).Seconds()
+	}
+	names := make([]string, 0, len(snapshot.Models))
+	for name := range snapshot.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	line("📊 模型统计")
+	line("  %-30s %7s %6s %12s %12s %9s %10s %9s %5s", "MODEL", "REQS", "ERRS", "INPUT TOK", "OUTPUT TOK", "TOK/S", "STREAM/S", "AVG TTFB", "SLOW")
+	for _, name := range names {
+		counters := snapshot.Models[name]
+		tokenRate, byteRate := 0.0, 0.0
+		if dt > 0 {
+			before := previous.Models[name]
+			tokenRate = float64(counters.OutputTokens-before.OutputTokens) / dt
+			byteRate = float64(counters.StreamBytes-before.StreamBytes) / dt
+		}
+		ttfb := "-"
+		if counters.TimedStreams > 0 {
+			ttfb = (time.Duration(counters.FirstTokenMs/counters.TimedStreams) * time.Millisecond).String()
+		}
+		line("  %-30s %7d %6d %12d %12d %9.1f %10s %9s %5d",
+			truncate(name, 30), counters.Requests, counters.Errors, counters.InputTokens, counters.OutputTokens,
+			tokenRate, formatSize(int64(byteRate)), ttfb, counters.SlowStreams)
+	}
+	line("")
+
+	// Upstream traffic, request bodies as sent after compression
+	upstream := snapshot.Upstream
+	sendRate, receiveRate := 0.0, 0.0
+	if dt > 0 {
+		sendRate = float64(upstream.RequestBytes-previous.Upstream.RequestBytes) / dt
+		receiveRate = float64(upstream.ResponseBytes-previous.Upstream.ResponseBytes) / dt
+	}
+	line("🌐 上游流量  发送 %s (压缩前 %s, 压缩请求 %d)  接收 %s  发送/S %s  接收/S %s",
+		formatSize(upstream.RequestBytes), formatSize(upstream.UncompressedBytes), upstream.CompressedRequests,
+		formatSize(upstream.ResponseBytes), formatSize(int64(sendRate)), formatSize(int64(receiveRate)))
+	if len(snapshot.UnknownContent) > 0 {
+		var types []string
+		for contentType := range snapshot.UnknownContent {
+			types = append(types, contentType)
+		}
+		sort.Strings(types)
+		var counts []string
+		for _, contentType := range types {
+			counts = append(counts, fmt.Sprintf("%s %d", contentType, snapshot.UnknownContent[contentType]))
+		}
+		line("🧩 不支持的内容块  %s", strings.Join(counts, "  "))
+	}
+	line("")
+
+	// Most recent errors first
+	line("⚠️  最近错误")
+	for i := len(snapshot.RecentErrors) - 1; i >= 0 && i >= len(snapshot.RecentErrors)-10; i-- {
+		failure := snapshot.RecentErrors[i]
+		line("  %s  %3d  %-24s %s", failure.Time.Local().Format("15:04:05"), failure.Status,
+			truncate(failure.Model, 24), truncate(strings.Join(strings.Fields(failure.Message), " "), 80))
+	}
+
+	b.WriteString(ansiClearBelow)
+	return b.String()
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// formatSize formats a byte count for display
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
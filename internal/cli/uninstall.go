@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+// UninstallOptions configures "claudeproxy uninstall"
+type UninstallOptions struct {
+	RemoveBinary bool // Also delete the claudeproxy executable
+	Yes          bool // Skip the confirmation
+}
+
+// uninstallStep is one change of the uninstall plan
+type uninstallStep struct {
+	description string
+	run         func() error
+}
+
+// RunUninstall removes what claudeproxy set up on this machine: it stops
+// every server process, unregisters systemd and launchd units running it,
+// removes the ANTHROPIC variables pointing at the proxy from the shell
+// profiles, the Windows user environment and the Claude Code settings,
+// deletes the config directory with logs, usage and transcripts, and
+// optionally the executable. Settings pointing elsewhere are left alone.
+func RunUninstall(sm *ServiceManager, opts UninstallOptions) error {
+	// Everything is planned before the config is gone, as the configured
+	// port tells which settings point at the proxy. Units go first, so
+	// their service manager does not restart the stopped server.
+	steps := serviceUnitSteps()
+	steps = append(steps, uninstallStep{"停止所有服务进程", sm.StopAll})
+	steps = append(steps, envVarSteps(sm)...)
+	steps = append(steps, claudeSettingsSteps(sm)...)
+	steps = append(steps, configDirSteps()...)
+	if opts.RemoveBinary {
+		steps = append(steps, binarySteps()...)
+	}
+
+	fmt.Println("🗑  将执行以下操作:")
+	for _, step := range steps {
+		fmt.Printf("   - %s\n", step.description)
+	}
+	if !opts.Yes && !ConfirmAction("确认卸载 claudeproxy") {
+		fmt.Println("操作已取消")
+		return nil
+	}
+
+	failed := 0
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			fmt.Printf("⚠️  %s失败: %v\n", step.description, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 项操作失败，请按提示手动处理", failed)
+	}
+
+	fmt.Println("\n✅ 卸载完成")
+	if !opts.RemoveBinary {
+		if exe, err := os.Executable(); err == nil {
+			fmt.Printf("💡 程序文件未删除: %s (使用 --remove-binary 一并删除)\n", exe)
+		}
+	}
+	fmt.Println("💡 请重启终端，使环境变量的清除生效")
+	return nil
+}
+
+// ownEnvVar reports whether an ANTHROPIC variable has the value "claudeproxy
+// start" gives it
+func ownEnvVar(sm *ServiceManager, key, value string) bool {
+	switch key {
+	case "ANTHROPIC_BASE_URL":
+		return sm.pointsHere(value)
+	case "ANTHROPIC_AUTH_TOKEN":
+		return value == "claudeproxy"
+	}
+	return false
+}
+
+// envVarSteps removes the ANTHROPIC variables pointing at the proxy from the
+// shell profiles, or from the user environment on Windows
+func envVarSteps(sm *ServiceManager) []uninstallStep {
+	keys := []string{"ANTHROPIC_BASE_URL", "ANTHROPIC_AUTH_TOKEN"}
+	var steps []uninstallStep
+
+	if runtime.GOOS == "windows" {
+		for _, key := range keys {
+			key := key
+			out, err := exec.Command("reg", "query", `HKCU\Environment`, "/v", key).Output()
+			if err != nil {
+				continue
+			}
+			// "    ANTHROPIC_BASE_URL    REG_SZ    http://127.0.0.1:8000"
+			fields := strings.Fields(string(out))
+			if len(fields) == 0 || !ownEnvVar(sm, key, fields[len(fields)-1]) {
+				continue
+			}
+			steps = append(steps, uninstallStep{
+				fmt.Sprintf("删除用户环境变量 %s", key),
+				func() error {
+					return exec.Command("reg", "delete", `HKCU\Environment`, "/v", key, "/f").Run()
+				},
+			})
+		}
+		return steps
+	}
+
+	for _, profile := range shellProfiles() {
+		profile := profile
+		content, err := os.ReadFile(profile)
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		var kept []string
+		var removed []string
+		for _, line := range lines {
+			own := false
+			for _, key := range keys {
+				value, ok := strings.CutPrefix(strings.TrimSpace(line), fmt.Sprintf("export %s=", key))
+				if ok && ownEnvVar(sm, key, strings.Trim(value, `"'`)) {
+					own = true
+					removed = append(removed, key)
+				}
+			}
+			if !own {
+				kept = append(kept, line)
+			}
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		steps = append(steps, uninstallStep{
+			fmt.Sprintf("从 %s 删除 %s", profile, strings.Join(removed, "、")),
+			func() error {
+				return os.WriteFile(profile, []byte(strings.Join(kept, "\n")), 0644)
+			},
+		})
+	}
+	return steps
+}
+
+// claudeSettingsSteps removes the ANTHROPIC variables pointing at the proxy
+// from the env section of the Claude Code user settings, keeping a backup
+func claudeSettingsSteps(sm *ServiceManager) []uninstallStep {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	path := filepath.Join(homeDir, ".claude", "settings.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var settings map[string]interface{}
+	if json.Unmarshal(data, &settings) != nil {
+		return nil
+	}
+	env, _ := settings["env"].(map[string]interface{})
+
+	var removed []string
+	for key, value := range env {
+		if text, ok := value.(string); ok && ownEnvVar(sm, key, text) {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	sort.Strings(removed)
+
+	return []uninstallStep{{
+		fmt.Sprintf("从 %s 的 env 中删除 %s (原文件备份为 settings.json.bak)", path, strings.Join(removed, "、")),
+		func() error {
+			if err := os.WriteFile(path+".bak", data, 0600); err != nil {
+				return err
+			}
+			for _, key := range removed {
+				delete(env, key)
+			}
+			if len(env) == 0 {
+				delete(settings, "env")
+			}
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(settings); err != nil {
+				return err
+			}
+			return os.WriteFile(path, buf.Bytes(), 0600)
+		},
+	}}
+}
+
+// serviceUnitSteps unregisters the systemd user units and launchd agents
+// that run claudeproxy: named after it or starting this executable
+func serviceUnitSteps() []uninstallStep {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	exe, _ := os.Executable()
+
+	var pattern string
+	switch runtime.GOOS {
+	case "linux":
+		pattern = filepath.Join(homeDir, ".config", "systemd", "user", "*.service")
+	case "darwin":
+		pattern = filepath.Join(homeDir, "Library", "LaunchAgents", "*.plist")
+	default:
+		return nil
+	}
+	paths, _ := filepath.Glob(pattern)
+
+	var steps []uninstallStep
+	for _, path := range paths {
+		path := path
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		named := strings.Contains(strings.ToLower(filepath.Base(path)), "claudeproxy")
+		if !named && (exe == "" || !bytes.Contains(content, []byte(exe))) {
+			continue
+		}
+
+		if runtime.GOOS == "linux" {
+			unit := filepath.Base(path)
+			steps = append(steps, uninstallStep{
+				fmt.Sprintf("停用并删除 systemd 用户服务 %s", unit),
+				func() error {
+					exec.Command("systemctl", "--user", "disable", "--now", unit).Run()
+					if err := os.Remove(path); err != nil {
+						return err
+					}
+					exec.Command("systemctl", "--user", "daemon-reload").Run()
+					return nil
+				},
+			})
+		} else {
+			steps = append(steps, uninstallStep{
+				fmt.Sprintf("卸载并删除 launchd 服务 %s", filepath.Base(path)),
+				func() error {
+					exec.Command("launchctl", "unload", "-w", path).Run()
+					return os.Remove(path)
+				},
+			})
+		}
+	}
+	return steps
+}
+
+// configDirSteps deletes the config directory with the config file, logs,
+// instance file, usage records and transcripts. A directory chosen with
+// CLAUDEPROXY_HOME is only deleted as a whole when its name says it
+// belongs to claudeproxy.
+func configDirSteps() []uninstallStep {
+	dir := config.Dir()
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	if os.Getenv("CLAUDEPROXY_HOME") != "" && !strings.Contains(strings.ToLower(filepath.Base(dir)), "claudeproxy") {
+		return []uninstallStep{{
+			fmt.Sprintf("删除 %s 中的配置文件和实例文件 (该目录由 CLAUDEPROXY_HOME 指定，请手动删除其余内容)", dir),
+			func() error {
+				for _, name := range []string{filepath.Base(config.Path()), "instance.json", "server.pid", "idle_shutdown"} {
+					if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+				return nil
+			},
+		}}
+	}
+	return []uninstallStep{{
+		fmt.Sprintf("删除配置目录 %s (配置、日志、用量记录和会话记录)", dir),
+		func() error { return os.RemoveAll(dir) },
+	}}
+}
+
+// binarySteps deletes the running executable. Windows does not allow that,
+// so it is renamed and left for the user to delete.
+func binarySteps() []uninstallStep {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return []uninstallStep{{
+		fmt.Sprintf("删除程序文件 %s", exe),
+		func() error {
+			if runtime.GOOS != "windows" {
+				return os.Remove(exe)
+			}
+			if err := os.Rename(exe, exe+".old"); err != nil {
+				return err
+			}
+			fmt.Printf("💡 Windows 不允许删除正在运行的程序，已重命名为 %s.old，请在退出后手动删除\n", exe)
+			return nil
+		},
+	}}
+}
@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minUsageDifference ignores deviations of a few tokens, which the local
+// estimate cannot resolve
+const minUsageDifference = 16
+
+// UsageOptions configures the usage report
+type UsageOptions struct {
+	Reconcile bool          // List requests whose upstream usage deviates from the local estimate
+	Threshold float64       // Deviation in percent above which a request is listed
+	Since     time.Duration // Only include requests newer than this; 0 includes all
+	Send      bool          // Send the usage report for the last period now instead of printing
+}
+
+// usageTotals are the summed usage of one upstream model
+type usageTotals struct {
+	requests, unreported                                   int
+	upstreamInput, upstreamOutput, localInput, localOutput int
+	cost                                                   float64
+	priced                                                 bool
+}
+
+// RunUsage prints the usage recorded in the usage ledger per model, comparing
+// the usage reported by the upstream with the local token estimate
+func RunUsage(opts UsageOptions) error {
+	if opts.Send {
+		return sendUsageReport()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	var since time.Time
+	if opts.Since > 0 {
+		since = time.Now().Add(-opts.Since)
+	}
+	records, err := storage.LoadUsage(since)
+	if err != nil {
+		return fmt.Errorf("读取用量记录失败: %v", err)
+	}
+	if len(records) == 0 && opts.Since == 0 {
+		return fmt.Errorf("没有找到用量记录 (%s)，请在配置中设置 \"usage_ledger\": true 并重启服务", storage)
+	}
+	if len(records) == 0 {
+		fmt.Println("没有符合条件的用量记录")
+		return nil
+	}
+
+	totals := make(map[string]*usageTotals)
+	var names []string
+	var toolTokensSaved, compactedRequests int
+	var summarized, summaryInput, summaryOutput int
+	var summaryCost float64
+	for _, record := range records {
+		if record.ToolTokensSaved > 0 {
+			toolTokensSaved += record.ToolTokensSaved
+			compactedRequests++
+		}
+		if record.CompactionInputTokens > 0 || record.CompactionOutputTokens > 0 {
+			summarized++
+			summaryInput += record.CompactionInputTokens
+			summaryOutput += record.CompactionOutputTokens
+			if record.CompactionCost != nil {
+				summaryCost += *record.CompactionCost
+			}
+		}
+		t, ok := totals[record.Model]
+		if !ok {
+			t = &usageTotals{}
+			totals[record.Model] = t
+			names = append(names, record.Model)
+		}
+		t.requests++
+		if !record.UsageReported {
+			t.unreported++
+		}
+		t.upstreamInput += record.UpstreamInputTokens
+		t.upstreamOutput += record.UpstreamOutputTokens
+		t.localInput += record.LocalInputTokens
+		t.localOutput += record.LocalOutputTokens
+		if record.Cost != nil {
+			t.cost += *record.Cost
+			t.priced = true
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Printf("📊 用量记录 (%s, %s 起)\n", storage, records[0].Time.Local().Format("2006-01-02 15:04"))
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("%-30s %6s %8s %12s %12s %8s %12s %12s %8s %10s\n",
+		"MODEL", "REQS", "NO USAGE", "UP INPUT", "EST INPUT", "DIFF", "UP OUTPUT", "EST OUTPUT", "DIFF", "COST")
+	for _, name := range names {
+		t := totals[name]
+		cost := "-"
+		if t.priced {
+			cost = fmt.Sprintf("%.6f", t.cost)
+		}
+		fmt.Printf("%-30s %6d %8d %12d %12d %8s %12d %12d %8s %10s\n",
+			truncate(name, 30), t.requests, t.unreported,
+			t.upstreamInput, t.localInput, formatDeviation(t.upstreamInput, t.localInput),
+			t.upstreamOutput, t.localOutput, formatDeviation(t.upstreamOutput, t.localOutput), cost)
+	}
+	fmt.Println("\n本地数值为估算值，仅用于发现明显异常；差异以上游数值相对本地估算计算")
+	if compactedRequests > 0 {
+		fmt.Printf("🔧 精简工具定义 (token-efficient tools) 的 %d 个请求共节省约 %d 个输入 token\n", compactedRequests, toolTokensSaved)
+	}
+	if summarized > 0 {
+		fmt.Printf("🗜  自动对话压缩为 %d 个请求生成摘要，共使用 %d 个输入 token、%d 个输出 token，估算费用 %.6f（未计入上表）\n",
+			summarized, summaryInput, summaryOutput, summaryCost)
+	}
+
+	if !opts.Reconcile {
+		return nil
+	}
+
+	var flagged []services.UsageRecord
+	for _, record := range records {
+		if !record.UsageReported ||
+			deviates(record.UpstreamInputTokens, record.LocalInputTokens, opts.Threshold) ||
+			deviates(record.UpstreamOutputTokens, record.LocalOutputTokens, opts.Threshold) {
+			flagged = append(flagged, record)
+		}
+	}
+
+	fmt.Printf("\n🔍 差异超过 %.0f%% 或上游未报告用量的请求: %d / %d\n", opts.Threshold, len(flagged), len(records))
+	if len(flagged) == 0 {
+		return nil
+	}
+	fmt.Printf("%-19s %-24s %-24s %15s %15s  %s\n", "TIME", "REQUEST ID", "MODEL", "INPUT UP/EST", "OUTPUT UP/EST", "TRANSCRIPT")
+	for _, record := range flagged {
+		input, output := "未报告", "未报告"
+		if record.UsageReported {
+			input = fmt.Sprintf("%d/%d", record.UpstreamInputTokens, record.LocalInputTokens)
+			output = fmt.Sprintf("%d/%d", record.UpstreamOutputTokens, record.LocalOutputTokens)
+		}
+		fmt.Printf("%-19s %-24s %-24s %15s %15s  %s\n",
+			record.Time.Local().Format("2006-01-02 15:04:05"), truncate(record.RequestID, 24), truncate(record.Model, 24),
+			input, output, truncate(record.TranscriptSHA256, 16))
+	}
+	fmt.Println("\nTRANSCRIPT 为返回给客户端的输出内容的 SHA-256，完整值见用量记录")
+	return nil
+}
+
+// sendUsageReport sends the report of the configured schedule for the
+// period ending now, to check the webhook and SMTP settings
+func sendUsageReport() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	settings := cfg.UsageReport
+	if settings.WebhookURL == "" && settings.SMTP.Host == "" {
+		return fmt.Errorf("未配置 usage_report.webhook_url 或 usage_report.smtp")
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -1)
+	if settings.Schedule == "weekly" {
+		from = to.AddDate(0, 0, -7)
+	}
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	if err := services.NewUsageReporter(cfg, logger, storage).SendReport(from, to); err != nil {
+		return fmt.Errorf("发送用量报告失败: %v", err)
+	}
+	fmt.Println("✅ 用量报告已发送")
+	return nil
+}
+
+// openStorage opens the storage backend the service writes usage records
+// and transcripts to
+func openStorage(cfg *config.Config) (services.Storage, error) {
+	storage, err := services.OpenStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("打开存储失败: %v", err)
+	}
+	return storage, nil
+}
+
+// deviates reports whether the upstream count differs from the local estimate
+// by more than threshold percent
+func deviates(upstream, local int, threshold float64) bool {
+	if abs(upstream-local) < minUsageDifference {
+		return false
+	}
+	if local == 0 {
+		return true
+	}
+	return math.Abs(float64(upstream-local))/float64(local)*100 > threshold
+}
+
+// formatDeviation formats the deviation of the upstream count from the local estimate
+func formatDeviation(upstream, local int) string {
+	if local == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.0f%%", float64(upstream-local)/float64(local)*100)
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
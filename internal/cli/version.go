@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+)
+
+// RunVersion prints the build of this binary and, when the service is
+// running, the build it was started from
+func RunVersion(sm *ServiceManager, asJSON bool) error {
+	local := buildinfo.Get()
+
+	var running *buildinfo.Info
+	var runningErr error
+	if sm.IsRunning() {
+		running, runningErr = sm.ServerVersion()
+	}
+
+	if asJSON {
+		output := map[string]interface{}{"client": local}
+		if running != nil {
+			output["server"] = running
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	printBuildInfo(local)
+
+	switch {
+	case running != nil:
+		if running.Version == local.Version && running.Commit == local.Commit {
+			fmt.Println("\n✅ 运行中的服务与当前程序版本一致")
+			return nil
+		}
+		fmt.Println("\n⚠️  运行中的服务版本不同，运行 'claudeproxy stop' 和 'claudeproxy start' 以使用当前版本:")
+		printBuildInfo(*running)
+	case runningErr != nil:
+		fmt.Printf("\n⚠️  无法获取运行中服务的版本: %v\n", runningErr)
+	}
+	return nil
+}
+
+// printBuildInfo prints build metadata in the form used for bug reports
+func printBuildInfo(info buildinfo.Info) {
+	fmt.Printf("claudeproxy %s\n", info.Version)
+	fmt.Printf("   提交:          %s\n", info.Commit)
+	fmt.Printf("   构建时间:      %s\n", info.BuildTime)
+	fmt.Printf("   Go 版本:       %s\n", info.GoVersion)
+	fmt.Printf("   平台:          %s\n", info.Platform)
+	fmt.Printf("   配置版本:      %d\n", info.ConfigSchema)
+	fmt.Printf("   Anthropic API: %s\n", info.AnthropicVersion)
+	fmt.Printf("   上游格式:      %v\n", info.UpstreamFormats)
+}
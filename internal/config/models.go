@@ -0,0 +1,209 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tiers of client models
+const (
+	TierBig   = "big"   // Mapped to big_model_name
+	TierSmall = "small" // Mapped to small_model_name
+)
+
+//go:embed models.yaml
+var bundledModelsYAML []byte
+
+// bundledModels are the model capabilities shipped with the binary
+var bundledModels = mustParseModels(bundledModelsYAML)
+
+// ModelCapabilities describes what a model supports. Unset fields are not
+// known and fall back to the defaults of the code consulting them.
+type ModelCapabilities struct {
+	Provider          string      `yaml:"provider,omitempty" json:"provider,omitempty"` // "anthropic" for models of the Anthropic API
+	Tier              string      `yaml:"tier,omitempty" json:"tier,omitempty"`         // "big" or "small" for client models
+	Vision            *bool       `yaml:"vision,omitempty" json:"vision,omitempty"`
+	Tools             *bool       `yaml:"tools,omitempty" json:"tools,omitempty"`
+	JSONSchema        *bool       `yaml:"json_schema,omitempty" json:"json_schema,omitempty"`   // false limits tool schemas to the common subset
+	PromptCache       *bool       `yaml:"prompt_cache,omitempty" json:"prompt_cache,omitempty"` // Accepts Anthropic cache_control markers
+	ContextWindow     int         `yaml:"context_window,omitempty" json:"context_window,omitempty"`
+	MaxOutputTokens   int         `yaml:"max_output_tokens,omitempty" json:"max_output_tokens,omitempty"`
+	Pricing           *ModelPrice `yaml:"pricing,omitempty" json:"pricing,omitempty"`
+	UnsupportedParams []string    `yaml:"unsupported_params,omitempty" json:"unsupported_params,omitempty"` // Request parameters the model rejects
+}
+
+// modelEntry applies capabilities to the models matching its patterns
+type modelEntry struct {
+	Match             patternList `yaml:"match"`
+	ModelCapabilities `yaml:",inline"`
+}
+
+// patternList is a single model pattern or a list of them
+type patternList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (p *patternList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = patternList{node.Value}
+		return nil
+	}
+	var patterns []string
+	if err := node.Decode(&patterns); err != nil {
+		return err
+	}
+	*p = patterns
+	return nil
+}
+
+// ModelRegistry looks up model capabilities in the models.yaml of the config
+// directory and the bundled defaults
+type ModelRegistry struct {
+	entries []modelEntry // In order of precedence
+}
+
+// ModelsPath returns the path of the user's model capability file
+func ModelsPath() string {
+	return filepath.Join(Dir(), "models.yaml")
+}
+
+// LoadModels loads the model registry from ModelsPath on top of the bundled
+// defaults. A missing file is not an error.
+func LoadModels() (*ModelRegistry, error) {
+	registry := &ModelRegistry{}
+	data, err := os.ReadFile(ModelsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		entries, err := parseModels(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ModelsPath(), err)
+		}
+		registry.entries = entries
+	}
+	registry.entries = append(registry.entries, bundledModels...)
+	return registry, nil
+}
+
+// loadModelsOrDefaults loads the model registry, falling back to the bundled
+// defaults when the user's file cannot be read
+func loadModelsOrDefaults() *ModelRegistry {
+	registry, err := LoadModels()
+	if err != nil {
+		return &ModelRegistry{entries: bundledModels}
+	}
+	return registry
+}
+
+// Lookup returns the capabilities of a model, merged field by field from all
+// matching entries with the earliest entry taking precedence
+func (r *ModelRegistry) Lookup(model string) ModelCapabilities {
+	entries := bundledModels
+	if r != nil {
+		entries = r.entries
+	}
+
+	var caps ModelCapabilities
+	for _, entry := range entries {
+		if !entry.matches(model) {
+			continue
+		}
+		found := entry.ModelCapabilities
+		if caps.Provider == "" {
+			caps.Provider = found.Provider
+		}
+		if caps.Tier == "" {
+			caps.Tier = found.Tier
+		}
+		if caps.Vision == nil {
+			caps.Vision = found.Vision
+		}
+		if caps.Tools == nil {
+			caps.Tools = found.Tools
+		}
+		if caps.JSONSchema == nil {
+			caps.JSONSchema = found.JSONSchema
+		}
+		if caps.PromptCache == nil {
+			caps.PromptCache = found.PromptCache
+		}
+		if caps.ContextWindow == 0 {
+			caps.ContextWindow = found.ContextWindow
+		}
+		if caps.MaxOutputTokens == 0 {
+			caps.MaxOutputTokens = found.MaxOutputTokens
+		}
+		if caps.Pricing == nil {
+			caps.Pricing = found.Pricing
+		}
+		if caps.UnsupportedParams == nil {
+			caps.UnsupportedParams = found.UnsupportedParams
+		}
+	}
+	return caps
+}
+
+// matches reports whether one of the patterns of the entry matches the model
+func (e modelEntry) matches(model string) bool {
+	for _, pattern := range e.Match {
+		if matchModel(strings.ToLower(pattern), strings.ToLower(model)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchModel matches a model name against a pattern where "*" stands for
+// any sequence of characters
+func matchModel(pattern, model string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == model
+	}
+	if !strings.HasPrefix(model, parts[0]) {
+		return false
+	}
+	model = model[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(model, part)
+		if i < 0 {
+			return false
+		}
+		model = model[i+len(part):]
+	}
+	return strings.HasSuffix(model, last)
+}
+
+// parseModels parses the entries of a model capability file
+func parseModels(data []byte) ([]modelEntry, error) {
+	var file struct {
+		Models []modelEntry `yaml:"models"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for i, entry := range file.Models {
+		if len(entry.Match) == 0 {
+			return nil, fmt.Errorf("models[%d]: match is required", i)
+		}
+		if entry.Tier != "" && entry.Tier != TierBig && entry.Tier != TierSmall {
+			return nil, fmt.Errorf("models[%d]: invalid tier %q (big or small)", i, entry.Tier)
+		}
+	}
+	return file.Models, nil
+}
+
+// mustParseModels parses the bundled model capabilities
+func mustParseModels(data []byte) []modelEntry {
+	entries, err := parseModels(data)
+	if err != nil {
+		panic("bundled models.yaml: " + err.Error())
+	}
+	return entries
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Permissions for files that may contain API keys or request contents
+const (
+	PrivateDirMode  os.FileMode = 0700
+	PrivateFileMode os.FileMode = 0600
+)
+
+// PermissionIssue is a config path that other users can access
+type PermissionIssue struct {
+	Path string
+	Mode os.FileMode // Current permissions
+	Want os.FileMode // Permissions it should have
+}
+
+// privatePath is a path that must only be accessible by the owner
+type privatePath struct {
+	path string
+	mode os.FileMode
+}
+
+// privatePaths returns the config directory, config file, instance file, logs
+// and transcripts
+func privatePaths() []privatePath {
+	dir := Dir()
+	logDir := filepath.Join(dir, "logs")
+	return []privatePath{
+		{dir, PrivateDirMode},
+		{Path(), PrivateFileMode},
+		{filepath.Join(dir, "instance.json"), PrivateFileMode},
+		{logDir, PrivateDirMode},
+		{filepath.Join(logDir, "service.log"), PrivateFileMode},
+		{filepath.Join(dir, "transcripts"), PrivateDirMode},
+	}
+}
+
+// CheckPermissions reports config paths readable or writable by group or
+// others. File modes are not meaningful on Windows, so nothing is reported there.
+func CheckPermissions() []PermissionIssue {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	var issues []PermissionIssue
+	for _, private := range privatePaths() {
+		info, err := os.Stat(private.path)
+		if err != nil {
+			continue
+		}
+		if mode := info.Mode().Perm(); mode&0077 != 0 {
+			issues = append(issues, PermissionIssue{Path: private.path, Mode: mode, Want: private.mode})
+		}
+	}
+	return issues
+}
+
+// FixPermissions restricts the reported paths to their owner
+func FixPermissions(issues []PermissionIssue) error {
+	for _, issue := range issues {
+		if err := os.Chmod(issue.Path, issue.Want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
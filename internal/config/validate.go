@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// checks validate options owned by other packages, such as script and enum
+// values defined by the services
+var checks []func(*JSONConfig) error
+
+// RegisterCheck adds a check that Validate runs after its own. Packages that
+// define the meaning of an option register a check for it from init.
+func RegisterCheck(check func(*JSONConfig) error) {
+	checks = append(checks, check)
+}
+
+// Validate checks values that the JSON types alone cannot enforce. Load,
+// LoadFile and the config commands all reject a configuration that fails it.
+func Validate(config *JSONConfig) error {
+	if config.Port != "" {
+		if port, err := strconv.Atoi(config.Port); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("端口无效: %s", config.Port)
+		}
+	}
+
+	switch strings.ToLower(config.LogLevel) {
+	case "", "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+	default:
+		return fmt.Errorf("日志级别无效: %s (可选 debug、info、warn、error)", config.LogLevel)
+	}
+
+	if err := validateURL("base_url", config.BaseURL); err != nil {
+		return err
+	}
+	if err := validateURL("hedging.base_url", config.Hedging.BaseURL); err != nil {
+		return err
+	}
+	if err := validateURL("mirror.base_url", config.Mirror.BaseURL); err != nil {
+		return err
+	}
+	if config.Mirror.BaseURL != "" && config.Mirror.APIKey == "" {
+		return fmt.Errorf("设置 mirror.base_url 时必须配置 mirror.api_key")
+	}
+	if config.Mirror.Percent < 0 || config.Mirror.Percent > 100 {
+		return fmt.Errorf("mirror.percent 无效: %d (应为 0 到 100)", config.Mirror.Percent)
+	}
+	if config.Mirror.Percent > 0 && config.Mirror.Model == "" {
+		return fmt.Errorf("设置 mirror.percent 时必须配置 mirror.model")
+	}
+	if config.TokenEfficientTools.MaxDescriptionChars < 0 {
+		return fmt.Errorf("token_efficient_tools.max_description_chars 无效: %d (应为 0 或正数，0 表示不截断)", config.TokenEfficientTools.MaxDescriptionChars)
+	}
+	if config.TokenEfficientTools.MaxPropertyDescriptionChars < 0 {
+		return fmt.Errorf("token_efficient_tools.max_property_description_chars 无效: %d (应为 0 或正数，0 表示不截断)", config.TokenEfficientTools.MaxPropertyDescriptionChars)
+	}
+	for model, upstream := range config.Upstreams {
+		if upstream.BaseURL == "" {
+			return fmt.Errorf("upstreams.%s.base_url 不能为空", model)
+		}
+		if err := validateURL("upstreams."+model+".base_url", upstream.BaseURL); err != nil {
+			return err
+		}
+	}
+
+	for model, settings := range config.ModelSettings {
+		if err := validatePenalty("model_settings."+model+".frequency_penalty", settings.FrequencyPenalty); err != nil {
+			return err
+		}
+		if err := validatePenalty("model_settings."+model+".presence_penalty", settings.PresencePenalty); err != nil {
+			return err
+		}
+	}
+
+	for host, ips := range config.Transport.Hosts {
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("transport.hosts.%s 无效: %s 不是 IP 地址", host, ip)
+			}
+		}
+	}
+	if server := config.Transport.DNSServer; strings.Contains(server, "://") {
+		if err := validateURL("transport.dns_server", server); err != nil {
+			return err
+		}
+	} else if server != "" {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			host = server
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("transport.dns_server 无效: %s (应为 IP[:端口] 或 https:// 开头的 DNS-over-HTTPS 地址)", server)
+		}
+	}
+
+	for i, hook := range config.Hooks {
+		if (hook.Command == "") == (hook.URL == "") {
+			return fmt.Errorf("hooks.%d 必须且只能配置 command 或 url 之一", i)
+		}
+	}
+
+	// Names are optional, but exports without secrets match keys by name
+	apiKeyNames := make(map[string]bool)
+	for i, key := range config.APIKeys {
+		if key.Key == "" {
+			return fmt.Errorf("api_keys.%d.key 不能为空", i)
+		}
+		if key.Name != "" && apiKeyNames[key.Name] {
+			return fmt.Errorf("api_keys.%d.name 重复: %s", i, key.Name)
+		}
+		apiKeyNames[key.Name] = true
+	}
+	// Quotas are counted by name, so every local key needs a name of its own
+	localKeyNames := make(map[string]bool)
+	for i, key := range config.LocalKeys {
+		if key.Key == "" {
+			return fmt.Errorf("local_keys.%d.key 不能为空", i)
+		}
+		if key.Name == "" {
+			return fmt.Errorf("local_keys.%d.name 不能为空", i)
+		}
+		if localKeyNames[key.Name] {
+			return fmt.Errorf("local_keys.%d.name 重复: %s", i, key.Name)
+		}
+		localKeyNames[key.Name] = true
+		if _, ok := config.ModelPairs[key.ModelPair]; key.ModelPair != "" && !ok {
+			return fmt.Errorf("local_keys.%d.model_pair 未在 model_pairs 中定义: %s", i, key.ModelPair)
+		}
+	}
+
+	if strings.ContainsAny(config.BasePath, "?#% ") {
+		return fmt.Errorf("base_path 无效: %s (应为路径前缀，如 /claudeproxy)", config.BasePath)
+	}
+	for i, proxy := range config.TrustedProxies {
+		valid := net.ParseIP(proxy) != nil
+		if strings.Contains(proxy, "/") {
+			_, _, err := net.ParseCIDR(proxy)
+			valid = err == nil
+		}
+		if !valid {
+			return fmt.Errorf("trusted_proxies.%d 无效: %s (应为 IP 地址或 CIDR 网段)", i, proxy)
+		}
+	}
+
+	for _, check := range checks {
+		if err := check(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateURL checks that a configured URL is an absolute http(s) URL
+func validateURL(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s 不是有效的 http(s) 地址: %s", name, value)
+	}
+	return nil
+}
+
+// validatePenalty checks a frequency or presence penalty, if set
+func validatePenalty(name string, value *float64) error {
+	if value != nil && (*value < -2 || *value > 2) {
+		return fmt.Errorf("%s 无效: %v (取值范围 -2 到 2)", name, *value)
+	}
+	return nil
+}
@@ -1,18 +1,30 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
+	"claude-code-provider-proxy/internal/buildinfo"
 	"claude-code-provider-proxy/internal/config"
 	"claude-code-provider-proxy/internal/models"
 	"claude-code-provider-proxy/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/sirupsen/logrus"
 )
 
+// maxTopLogprobs is the largest top_logprobs value accepted by OpenAI-compatible APIs
+const maxTopLogprobs = 20
+
 // Handler contains all the dependencies for handling HTTP requests
 type Handler struct {
 	config            *config.Config
@@ -22,6 +34,18 @@ type Handler struct {
 	tokenService      *services.TokenCountingService
 	streamingService  *services.StreamingService
 	modelSelector     *services.ModelSelectorService
+	hookService       *services.HookService
+	scriptService     *services.ScriptService
+	truncationService *services.TruncationService
+	compactionService *services.CompactionService
+	visionService     *services.VisionService
+	proxyToolService  *services.ProxyToolService
+	usageLedger       *services.UsageLedger
+	pricingService    *services.PricingService
+	healthMonitor     *services.HealthMonitor
+	mirrorService     *services.MirrorService
+	metrics           *services.MetricsService
+	rejectedChanges   func() map[string]string // Errors of watched files whose last change was rejected
 }
 
 // NewHandler creates a new handler instance
@@ -33,6 +57,18 @@ func NewHandler(
 	tokenService *services.TokenCountingService,
 	streamingService *services.StreamingService,
 	modelSelector *services.ModelSelectorService,
+	hookService *services.HookService,
+	scriptService *services.ScriptService,
+	truncationService *services.TruncationService,
+	compactionService *services.CompactionService,
+	visionService *services.VisionService,
+	proxyToolService *services.ProxyToolService,
+	usageLedger *services.UsageLedger,
+	pricingService *services.PricingService,
+	healthMonitor *services.HealthMonitor,
+	mirrorService *services.MirrorService,
+	metrics *services.MetricsService,
+	rejectedChanges func() map[string]string,
 ) *Handler {
 	return &Handler{
 		config:            cfg,
@@ -42,24 +78,82 @@ func NewHandler(
 		tokenService:      tokenService,
 		streamingService:  streamingService,
 		modelSelector:     modelSelector,
+		hookService:       hookService,
+		scriptService:     scriptService,
+		truncationService: truncationService,
+		compactionService: compactionService,
+		visionService:     visionService,
+		proxyToolService:  proxyToolService,
+		usageLedger:       usageLedger,
+		pricingService:    pricingService,
+		healthMonitor:     healthMonitor,
+		mirrorService:     mirrorService,
+		metrics:           metrics,
+		rejectedChanges:   rejectedChanges,
 	}
 }
 
-// HealthCheck handles health check requests
+// HealthCheck handles health check requests. With ?deep=stream it instead
+// streams a canned response through the conversion path, so clients can
+// check that server-sent events reach them unbuffered.
 func (h *Handler) HealthCheck(c *gin.Context) {
+	if deep := c.Query("deep"); deep != "" {
+		if deep != "stream" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: models.NewValidationError("Unknown deep check: " + deep + " (supported: stream)"),
+			})
+			return
+		}
+		if err := h.streamingService.StreamCheck(c); err != nil {
+			h.streamingService.HandleStreamingError(c, err)
+		}
+		return
+	}
+
+	status := "healthy"
+	if h.healthMonitor.Degraded() {
+		status = "degraded"
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
+		"status":    status,
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 		"app_name":  h.config.AppName,
 		"version":   h.config.AppVersion,
 		"referrer":  h.config.ReferrerURL,
+		"memory":    memoryStats(),
+		"upstreams": h.healthMonitor.Results(),
+	})
+}
+
+// GetTools lists the tools executed by the proxy in a machine-readable format
+func (h *Handler) GetTools(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"tools":  h.proxyToolService.List(),
+		"opt_in": h.config.ProxyToolsOptIn,
 	})
 }
 
+// GetVersion reports the build of the running server
+func (h *Handler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
+
+// memoryStats reports the memory usage of the proxy process
+func memoryStats() gin.H {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return gin.H{
+		"alloc_bytes": stats.Alloc,
+		"sys_bytes":   stats.Sys,
+		"goroutines":  runtime.NumGoroutine(),
+	}
+}
+
 // CreateMessage handles Anthropic-compatible message creation
 func (h *Handler) CreateMessage(c *gin.Context) {
 	var req models.AnthropicRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		h.logger.WithError(err).Warn("Invalid request format")
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error: models.FormatValidationError(err),
@@ -67,17 +161,61 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 		return
 	}
 
+	// Strict validation reports schema errors before conversion can trip over them
+	if h.config.StrictValidation {
+		if apiErr := services.ValidateAnthropicRequest(&req, c.GetString(services.LocaleContextKey)); apiErr != nil {
+			h.logger.WithError(apiErr).Warn("Request failed schema validation")
+			c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+			return
+		}
+	}
+
+	// The session routes the request to the key holding its cached prompt
+	if session := services.SessionID(c.GetHeader("X-Claude-Code-Session-Id"), req.Metadata, ""); session != "" {
+		c.Request = c.Request.WithContext(services.WithSession(c.Request.Context(), session))
+	}
+
+	// A model pair may also be selected with a header instead of a model suffix,
+	// or come from the local API key
+	req.Model = services.WithModelPair(req.Model, c.GetHeader("X-Model-Pair"))
+	req.Model = services.WithModelPair(req.Model, c.GetString(services.ModelPairContextKey))
+
+	// Run pre-conversion hooks on the Anthropic request
+	if err := h.hookService.Run(c.Request.Context(), services.HookPointPreConversion, &req); err != nil {
+		h.writeHookError(c, err)
+		return
+	}
+
+	// Strict mode rejects models that would otherwise be silently rerouted
+	targetModel, reason, known := h.modelSelector.Mapping(req.Model)
+	if h.config.StrictModels && !known {
+		h.logger.WithField("model", req.Model).Warn("Unknown model rejected in strict mode")
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: models.NewNotFoundError(services.RequestMessagef(c, "model: %s", req.Model)),
+		})
+		return
+	}
+
 	// Validate the requested model
 	if !h.modelSelector.ValidateModel(req.Model) {
 		h.logger.WithField("model", req.Model).Warn("Unsupported model requested")
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: models.NewValidationError("Unsupported model: " + req.Model),
+			Error: models.NewValidationError(services.RequestMessage(c, "Unsupported model: ") + req.Model),
 		})
 		return
 	}
 
+	services.TrackModel(c, targetModel, req.Stream)
+
+	// Report how the model was mapped so rerouting is never silent
+	c.Header("X-Proxy-Model-Mapping", fmt.Sprintf("%s -> %s (%s)", req.Model, targetModel, reason))
+	if !known {
+		c.Writer.Header().Add("X-Proxy-Warning", fmt.Sprintf("Unknown model %s was rerouted to the small model %s", req.Model, targetModel))
+	}
+
 	// Log the request with cache control info
 	h.logger.WithFields(logrus.Fields{
+		"request_id":  c.GetString("request_id"),
 		"model":       req.Model,
 		"max_tokens":  req.MaxTokens,
 		"stream":      req.Stream,
@@ -89,32 +227,114 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 		"referrer":    c.GetString("referrer"),
 	}).Info("Processing message request")
 
-	// Validate token limits
-	// tokenReq := &models.TokenCountRequest{
-	// 	Model:    req.Model,
-	// 	Messages: req.Messages,
-	// 	System:   req.System,
-	// 	Tools:    req.Tools,
-	// }
-
-	// if err := h.tokenService.ValidateTokenLimits(tokenReq); err != nil {
-	// 	h.logger.WithError(err).Warn("Token limit exceeded")
-	// 	c.JSON(http.StatusBadRequest, models.ErrorResponse{
-	// 		Error: models.NewValidationError(err.Error()),
-	// 	})
-	// 	return
-	// }
+	// Converted upstreams do not know the token-efficient tools beta, so the
+	// tool definitions are compacted instead
+	if services.UsesTokenEfficientTools(c.GetHeader("anthropic-beta")) && !h.openAIClient.IsAnthropicUpstream() {
+		saved := h.tokenService.CompactTools(&req)
+		services.RecordToolTokensSaved(c, saved)
+		h.logger.WithFields(logrus.Fields{
+			"request_id":        c.GetString("request_id"),
+			"tool_tokens_saved": saved,
+		}).Debug("Compacted tool definitions for token-efficient tools")
+	}
+
+	// Summarize older turns with the small model when the conversation grows too long
+	if warning := h.compactionService.Apply(c, &req); warning != "" {
+		c.Writer.Header().Add("X-Proxy-Warning", warning)
+	}
+
+	// Keep images away from models that cannot read them
+	visionModel, warning := h.visionService.Apply(&req, targetModel)
+	if warning != "" {
+		c.Writer.Header().Add("X-Proxy-Warning", warning)
+	}
+	if visionModel != "" {
+		targetModel = visionModel
+		services.TrackModel(c, targetModel, req.Stream)
+		c.Header("X-Proxy-Model-Mapping", fmt.Sprintf("%s -> %s (vision fallback)", req.Model, targetModel))
+	}
+
+	// Keep the request within the context window of the target model
+	warning, err := h.truncationService.Apply(&req, targetModel)
+	if err != nil {
+		h.logger.WithError(err).Warn("Token limit exceeded")
+		if apiErr, ok := err.(*models.APIError); ok {
+			c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: models.NewInternalError(services.RequestMessage(c, "Failed to count tokens")),
+			})
+		}
+		return
+	}
+	if warning != "" {
+		c.Writer.Header().Add("X-Proxy-Warning", warning)
+	}
+
+	// Anthropic-native upstreams need no conversion
+	if h.openAIClient.IsAnthropicUpstream() {
+		h.handlePassthroughMessage(c, &req, visionModel)
+		return
+	}
+
+	// Attach the final Anthropic request for fixture recording
+	if h.config.RecordDir != "" {
+		c.Request = c.Request.WithContext(services.WithRecordedRequest(c.Request.Context(), &req, c.GetString("request_id")))
+	}
 
 	// Convert to OpenAI format
-	openAIReq, err := h.conversionService.ConvertAnthropicToOpenAI(&req, "gpt-4") // Simple fallback
+	openAIReq, err := h.conversionService.ConvertAnthropicToOpenAI(&req, "gpt-4", c.GetString("request_id")) // Simple fallback
 	if err != nil {
+		// Content rejected by unknown_content_policy
+		var apiErr *models.APIError
+		if errors.As(err, &apiErr) {
+			h.logger.WithError(err).Warn("Request rejected during conversion")
+			c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+			return
+		}
 		h.logger.WithError(err).Error("Failed to convert request")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: models.NewInternalError("Failed to process request"),
+			Error: models.NewInternalError(services.RequestMessage(c, "Failed to process request")),
+		})
+		return
+	}
+
+	if visionModel != "" {
+		openAIReq.Model = visionModel
+	}
+	services.ApplyConversionNotes(c, openAIReq)
+
+	// Offer the tools executed by the proxy to the model
+	proxyTools := h.proxyToolService.Inject(openAIReq, c.GetHeader("X-Proxy-Tools"))
+
+	// Token log probabilities are an opt-in vendor extension for eval tooling
+	if value := c.GetHeader("X-Proxy-Logprobs"); value != "" {
+		topLogprobs, err := strconv.Atoi(value)
+		if err != nil || topLogprobs < 0 || topLogprobs > maxTopLogprobs {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: models.NewValidationError(services.RequestMessagef(c, "X-Proxy-Logprobs must be a number of top log probabilities between 0 and %d", maxTopLogprobs)),
+			})
+			return
+		}
+		openAIReq.Logprobs = true
+		openAIReq.TopLogprobs = topLogprobs
+	}
+
+	// Apply the user transform script to the converted request
+	if err := h.scriptService.Apply(openAIReq); err != nil {
+		h.logger.WithError(err).Error("Transform script failed")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: models.NewInternalError(services.RequestMessage(c, "Failed to transform request")),
 		})
 		return
 	}
 
+	// Run pre-upstream hooks on the converted OpenAI request
+	if err := h.hookService.Run(c.Request.Context(), services.HookPointPreUpstream, openAIReq); err != nil {
+		h.writeHookError(c, err)
+		return
+	}
+
 	// Log the selected model
 	h.logger.WithFields(logrus.Fields{
 		"original_model": req.Model,
@@ -134,11 +354,21 @@ func (h *Handler) CreateMessage(c *gin.Context) {
 		"selected_model":    openAIReq.Model,
 	}).Debug("Configuration and model selection details")
 
-	// Handle streaming vs non-streaming
-	if req.Stream {
+	// Record upstream usage next to the local estimate for billing reconciliation
+	h.usageLedger.Begin(c, &req, openAIReq.Model)
+	defer h.usageLedger.Finish(c)
+
+	// Send a share of the requests to the shadow model for comparison
+	h.mirrorService.Start(c, openAIReq)
+	defer h.mirrorService.Finish(c)
+
+	// Handle streaming vs non-streaming. Proxy tools need complete responses,
+	// so with proxy tools a streaming request is buffered: nothing reaches the
+	// client until the final answer, which is then streamed in one burst.
+	if req.Stream && len(proxyTools) == 0 {
 		h.handleStreamingRequest(c, openAIReq, req.Model)
 	} else {
-		h.handleNonStreamingRequest(c, openAIReq, req.Model)
+		h.handleNonStreamingRequest(c, openAIReq, req.Model, proxyTools, req.Stream)
 	}
 }
 
@@ -154,6 +384,7 @@ func (h *Handler) handleStreamingRequest(c *gin.Context, openAIReq *models.OpenA
 	}).Debug("Starting streaming request")
 
 	// Make streaming request to OpenAI
+	services.StartUpstreamTimer(c)
 	resp, err := h.openAIClient.CreateStreamingChatCompletion(ctx, openAIReq)
 	if err != nil {
 		h.logger.WithFields(logrus.Fields{
@@ -174,11 +405,18 @@ func (h *Handler) handleStreamingRequest(c *gin.Context, openAIReq *models.OpenA
 		return
 	}
 
+	// The usage of a stream is only known at its end, so the cost follows as a trailer
+	if cost, ok := h.pricingService.Charge(c, openAIReq.Model); ok && h.config.CostHeader {
+		c.Writer.Header().Set(http.TrailerPrefix+"X-Proxy-Cost", services.FormatCost(cost))
+	}
+
 	h.logger.Debug("Streaming request completed successfully")
 }
 
-// handleNonStreamingRequest handles non-streaming message requests
-func (h *Handler) handleNonStreamingRequest(c *gin.Context, openAIReq *models.OpenAIRequest, originalModel string) {
+// handleNonStreamingRequest handles non-streaming message requests. Calls to
+// proxy tools are executed before responding; with stream set, the response
+// is sent as stream events.
+func (h *Handler) handleNonStreamingRequest(c *gin.Context, openAIReq *models.OpenAIRequest, originalModel string, proxyTools map[string]bool, stream bool) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
 	defer cancel()
 
@@ -189,16 +427,17 @@ func (h *Handler) handleNonStreamingRequest(c *gin.Context, openAIReq *models.Op
 	}).Debug("Starting non-streaming request")
 
 	// Make request to OpenAI
-	openAIResp, err := h.openAIClient.CreateChatCompletion(ctx, openAIReq)
+	openAIResp, err := h.proxyToolService.Complete(ctx, h.openAIClient, openAIReq, proxyTools)
 	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("OpenAI request failed")
+		services.RecordFailure(c, err.Error())
 		if apiErr, ok := err.(*models.APIError); ok {
-			c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+			writeAPIError(c, apiErr)
 		} else {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-				Error: models.NewInternalError("Failed to process request"),
+				Error: models.NewInternalError(services.RequestMessage(c, "Failed to process request")),
 			})
 		}
 		return
@@ -213,15 +452,42 @@ func (h *Handler) handleNonStreamingRequest(c *gin.Context, openAIReq *models.Op
 			"error": err.Error(),
 		}).Error("Response conversion failed")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: models.NewInternalError("Failed to process response"),
+			Error: models.NewInternalError(services.RequestMessage(c, "Failed to process response")),
 		})
 		return
 	}
+	services.RestoreToolNames(c, anthropicResp)
+	if openAIResp.Choices[0].FinishReason == "content_filter" {
+		services.RecordContentFilter(c)
+	}
 
 	h.logger.Debug("Response conversion completed successfully")
 
+	// Run post-response hooks on the Anthropic response
+	if err := h.hookService.Run(c.Request.Context(), services.HookPointPostResponse, anthropicResp); err != nil {
+		h.writeHookError(c, err)
+		return
+	}
+
+	services.RecordUsage(c, anthropicResp.Usage.InputTokens, anthropicResp.Usage.OutputTokens)
+	services.RecordCachedTokens(c, openAIResp.Usage.CachedTokens())
+	if cost, ok := h.pricingService.Charge(c, openAIReq.Model); ok && h.config.CostHeader {
+		c.Header("X-Proxy-Cost", services.FormatCost(cost))
+	}
+	for _, block := range anthropicResp.Content {
+		switch block.Type {
+		case "text":
+			services.RecordOutput(c, block.Text)
+		case "tool_use":
+			if input, err := json.Marshal(block.Input); err == nil {
+				services.RecordOutput(c, string(input))
+			}
+		}
+	}
+
 	// Log the response
 	h.logger.WithFields(logrus.Fields{
+		"request_id":    c.GetString("request_id"),
 		"response_id":   anthropicResp.ID,
 		"model":         anthropicResp.Model,
 		"stop_reason":   anthropicResp.StopReason,
@@ -229,9 +495,178 @@ func (h *Handler) handleNonStreamingRequest(c *gin.Context, openAIReq *models.Op
 		"output_tokens": anthropicResp.Usage.OutputTokens,
 	}).Info("Sending response")
 
+	if stream {
+		if err := h.streamingService.WriteMessage(c, anthropicResp); err != nil {
+			h.logger.WithError(err).Error("Streaming response failed")
+		}
+		return
+	}
 	c.JSON(http.StatusOK, anthropicResp)
 }
 
+// handlePassthroughMessage forwards a message request to an Anthropic-native upstream.
+// The original body is kept so fields unknown to the proxy survive; every field the
+// proxy, a hook or a script changed in the request replaces its original. modelOverride,
+// when set, replaces the selected upstream model.
+func (h *Handler) handlePassthroughMessage(c *gin.Context, req *models.AnthropicRequest, modelOverride string) {
+	var body map[string]json.RawMessage
+	var original models.AnthropicRequest
+	if raw, ok := c.Get(gin.BodyBytesKey); ok {
+		if data, ok := raw.([]byte); ok {
+			json.Unmarshal(data, &body)
+			json.Unmarshal(data, &original)
+		}
+	}
+	if body == nil {
+		body = make(map[string]json.RawMessage)
+	}
+	// Vendor extensions of the proxy are not part of the Anthropic API
+	for key := range body {
+		if strings.HasPrefix(key, "x_") {
+			delete(body, key)
+		}
+	}
+
+	targetModel := h.modelSelector.SelectModel(req.Model, req)
+	if modelOverride != "" {
+		targetModel = modelOverride
+	}
+	modified := *req
+	modified.Model = targetModel
+	if err := overlayChangedFields(body, &original, &modified); err != nil {
+		h.logger.WithError(err).Error("Failed to encode passthrough request")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: models.NewInternalError(services.RequestMessage(c, "Failed to process request")),
+		})
+		return
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to encode passthrough request")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: models.NewInternalError(services.RequestMessage(c, "Failed to process request")),
+		})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"original_model": req.Model,
+		"selected_model": targetModel,
+		"stream":         req.Stream,
+	}).Info("Forwarding request to Anthropic-native upstream")
+
+	h.forward(c, targetModel, "/messages", payload)
+}
+
+// overlayChangedFields writes the fields of the modified request that differ
+// from the original into the body, and removes those the modified request
+// dropped. Unchanged fields keep their original encoding, including parts
+// the request types do not model, such as the type of server tools.
+func overlayChangedFields(body map[string]json.RawMessage, original, modified *models.AnthropicRequest) error {
+	before, err := requestFields(original)
+	if err != nil {
+		return err
+	}
+	after, err := requestFields(modified)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range after {
+		if !strings.HasPrefix(key, "x_") && !bytes.Equal(before[key], value) {
+			body[key] = value
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			delete(body, key)
+		}
+	}
+	return nil
+}
+
+// requestFields encodes a request as its top-level JSON fields
+func requestFields(req *models.AnthropicRequest) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ChatCompletions handles OpenAI-compatible chat completion requests. The body is
+// forwarded to the upstream unchanged and the response is relayed byte for byte.
+func (h *Handler) ChatCompletions(c *gin.Context) {
+	if h.openAIClient.IsAnthropicUpstream() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: models.NewInvalidRequestError("chat completions are not available with an Anthropic-native upstream"),
+		})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil || len(body) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: models.NewInvalidRequestError(services.RequestMessage(c, "Request body is required")),
+		})
+		return
+	}
+
+	var peek struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	json.Unmarshal(body, &peek)
+	services.TrackModel(c, peek.Model, peek.Stream)
+
+	h.forward(c, peek.Model, "/chat/completions", body)
+}
+
+// forward sends the payload to the upstream path and relays the response
+func (h *Handler) forward(c *gin.Context, model, path string, payload []byte) {
+	resp, err := h.openAIClient.Forward(c.Request.Context(), model, path, payload)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			writeAPIError(c, apiErr)
+			return
+		}
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error: models.NewAPIError(services.RequestMessage(c, "Failed to reach upstream: ") + err.Error()),
+		})
+		return
+	}
+
+	if err := services.CopyResponse(c, resp); err != nil {
+		h.logger.WithError(err).Warn("Passthrough response interrupted")
+	}
+}
+
+// writeAPIError writes an error response. Transient upstream failures tell
+// the client when to retry with a Retry-After header.
+func writeAPIError(c *gin.Context, apiErr *models.APIError) {
+	if apiErr.Retry != nil {
+		c.Header("Retry-After", strconv.Itoa(apiErr.Retry.RetryAfterSeconds))
+	}
+	c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+}
+
+// writeHookError writes the error returned by a hook run
+func (h *Handler) writeHookError(c *gin.Context, err error) {
+	if apiErr, ok := err.(*models.APIError); ok {
+		c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+		return
+	}
+	h.logger.WithError(err).Error("Hook processing failed")
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error: models.NewInternalError(services.RequestMessage(c, "Failed to process request")),
+	})
+}
+
 // CountTokens handles token counting requests
 func (h *Handler) CountTokens(c *gin.Context) {
 	var req models.TokenCountRequest
@@ -248,7 +683,7 @@ func (h *Handler) CountTokens(c *gin.Context) {
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to count tokens")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: models.NewInternalError("Failed to count tokens"),
+			Error: models.NewInternalError(services.RequestMessage(c, "Failed to count tokens")),
 		})
 		return
 	}
@@ -262,56 +697,140 @@ func (h *Handler) CountTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-// GetModels handles model listing requests
+// openAIModel is a model of the model list in the OpenAI schema
+type openAIModel struct {
+	services.ModelListEntry
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// anthropicModel is a model of the model list in the Anthropic schema
+type anthropicModel struct {
+	Type string `json:"type"`
+	services.ModelListEntry
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+// GetModels lists the configured and upstream models with their
+// capabilities. The vision and tools query parameters filter by capability,
+// and format selects the OpenAI or Anthropic schema; by default clients
+// sending anthropic-version get the latter.
 func (h *Handler) GetModels(c *gin.Context) {
-	// Return both OpenAI models and our configured models
-	availableModels := h.modelSelector.GetAvailableModels()
+	format := c.Query("format")
+	if format == "" {
+		format = services.ModelListOpenAI
+		if c.GetHeader("anthropic-version") != "" {
+			format = services.ModelListAnthropic
+		}
+	}
+	if format != services.ModelListOpenAI && format != services.ModelListAnthropic {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: models.NewInvalidRequestError("format must be openai or anthropic", "format"),
+		})
+		return
+	}
+	filters := make(map[string]bool)
+	for _, name := range []string{"vision", "tools"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		wanted, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: models.NewInvalidRequestError(name+" must be true or false", name),
+			})
+			return
+		}
+		filters[name] = wanted
+	}
 
-	// Also try to get OpenAI models if possible
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	openAIModels, err := h.openAIClient.GetModels(ctx)
+	upstreamModels, err := h.openAIClient.GetModels(ctx)
 	if err != nil {
 		h.logger.WithError(err).Warn("Failed to get OpenAI models, returning configured models only")
+		c.Writer.Header().Add("X-Proxy-Warning", "Upstream model list unavailable, listing configured models only")
 	}
 
-	response := gin.H{
-		"configured_models": availableModels,
-		"app_name":          h.config.AppName,
-		"app_version":       h.config.AppVersion,
+	var entries []services.ModelListEntry
+	for _, entry := range h.modelSelector.ListModels(upstreamModels) {
+		if wanted, ok := filters["vision"]; ok && entry.Capabilities.Vision != wanted {
+			continue
+		}
+		if wanted, ok := filters["tools"]; ok && entry.Capabilities.Tools != wanted {
+			continue
+		}
+		entries = append(entries, entry)
 	}
 
-	if openAIModels != nil {
-		response["openai_models"] = openAIModels
+	if format == services.ModelListAnthropic {
+		data := make([]anthropicModel, len(entries))
+		for i, entry := range entries {
+			data[i] = anthropicModel{Type: "model", ModelListEntry: entry, DisplayName: entry.ID}
+			if entry.Created > 0 {
+				data[i].CreatedAt = time.Unix(entry.Created, 0).UTC().Format(time.RFC3339)
+			}
+		}
+		response := gin.H{"data": data, "has_more": false, "first_id": nil, "last_id": nil}
+		if len(data) > 0 {
+			response["first_id"], response["last_id"] = data[0].ID, data[len(data)-1].ID
+		}
+		c.JSON(http.StatusOK, response)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	data := make([]openAIModel, len(entries))
+	for i, entry := range entries {
+		ownedBy := entry.Provider
+		if ownedBy == "" {
+			ownedBy = "upstream"
+		}
+		data[i] = openAIModel{ModelListEntry: entry, Object: "model", Created: entry.Created, OwnedBy: ownedBy}
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
 }
 
-// ValidateAPIKey handles API key validation
+// ValidateAPIKey handles API key validation. The result is cached briefly
+// since every validation performs a paid completion.
 func (h *Handler) ValidateAPIKey(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	if err := h.openAIClient.ValidateAPIKey(ctx); err != nil {
+	checkedAt, err := h.healthMonitor.Validate(ctx)
+	if err != nil {
 		h.logger.WithError(err).Warn("API key validation failed")
 		if apiErr, ok := err.(*models.APIError); ok {
-			c.JSON(apiErr.HTTPStatus(), models.ErrorResponse{Error: apiErr})
+			writeAPIError(c, apiErr)
 		} else {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: models.NewAuthenticationError("Invalid API key"),
+				Error: models.NewAuthenticationError(services.RequestMessage(c, "Invalid API key")),
 			})
 		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"valid": true,
+		"valid":      true,
+		"checked_at": checkedAt.UTC().Format(time.RFC3339),
 	})
 }
 
-// GetStatus provides detailed service status
+// upstreamURLs lists the dedicated upstream base URL of each mapped model
+func (h *Handler) upstreamURLs() map[string]string {
+	urls := make(map[string]string, len(h.config.Upstreams))
+	for model, upstream := range h.config.Upstreams {
+		urls[model] = upstream.BaseURL
+	}
+	return urls
+}
+
+// GetStatus provides detailed service status. Upstream connectivity comes from
+// the health monitor; ?validate=true additionally validates the API key with a
+// real (rate limited) completion.
 func (h *Handler) GetStatus(c *gin.Context) {
 	status := gin.H{
 		"status":    "healthy",
@@ -323,19 +842,52 @@ func (h *Handler) GetStatus(c *gin.Context) {
 			"base_url":    h.config.OpenAIBaseURL,
 			"big_model":   h.config.BigModelName,
 			"small_model": h.config.SmallModelName,
+			"upstreams":   h.upstreamURLs(),
+			"model_pairs": h.config.ModelPairs,
 		},
-		"models": h.modelSelector.GetAvailableModels(),
+		"models":         h.modelSelector.GetAvailableModels(),
+		"api_keys":       h.openAIClient.KeyHealth(),
+		"estimated_cost": h.pricingService.Summary(),
+		"streaming":      h.metrics.StreamingStats(),
+		"prompt_cache":   h.metrics.CacheStats(),
 	}
 
-	// Check OpenAI API connectivity
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
-	defer cancel()
+	if err := h.scriptService.LoadError(); err != nil {
+		status["transform_script_error"] = err.Error()
+	}
+	if rejected := h.rejectedChanges(); len(rejected) > 0 {
+		status["rejected_config_changes"] = rejected
+	}
 
-	if err := h.openAIClient.ValidateAPIKey(ctx); err != nil {
-		status["openai_status"] = "error"
-		status["openai_error"] = err.Error()
-	} else {
-		status["openai_status"] = "connected"
+	// Report OpenAI API connectivity from the latest health probe
+	upstreams := h.healthMonitor.Results()
+	status["upstreams"] = upstreams
+	status["openai_status"] = "unknown"
+	for _, result := range upstreams {
+		if result.Name != "primary" {
+			continue
+		}
+		if result.Healthy {
+			status["openai_status"] = "connected"
+		} else {
+			status["openai_status"] = "error"
+			status["openai_error"] = result.Error
+		}
+	}
+
+	if c.Query("validate") == "true" {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		checkedAt, err := h.healthMonitor.Validate(ctx)
+		validation := gin.H{
+			"valid":      err == nil,
+			"checked_at": checkedAt.UTC().Format(time.RFC3339),
+		}
+		if err != nil {
+			validation["error"] = err.Error()
+		}
+		status["api_key_validation"] = validation
 	}
 
 	c.JSON(http.StatusOK, status)
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// dedupHeaders are the request headers besides the body that change the response
+var dedupHeaders = []string{"x-api-key", "Authorization", "X-Model-Pair", "X-Proxy-Tools", "X-Proxy-Logprobs",
+	"OpenAI-Organization", "OpenAI-Project", "Anthropic-Organization-Id", "Anthropic-Workspace-Id"}
+
+// dedupWriter keeps a copy of the response so it can be replayed
+type dedupWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *dedupWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.record(data[:n])
+	return n, err
+}
+
+func (w *dedupWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.record([]byte(s[:n]))
+	return n, err
+}
+
+func (w *dedupWriter) record(data []byte) {
+	if w.body.Len()+len(data) > services.MaxDedupBodyBytes {
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
+
+// complete reports whether the response is a full successful answer. Streams
+// must have reached message_stop without an error event.
+func (w *dedupWriter) complete() bool {
+	if w.truncated || w.Status() != http.StatusOK {
+		return false
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		body := w.body.Bytes()
+		return bytes.Contains(body, []byte("event: message_stop")) && !bytes.Contains(body, []byte("event: error"))
+	}
+	return true
+}
+
+// dedupKey hashes the request body together with the headers that affect the response
+func dedupKey(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.URL.Path))
+	for _, name := range dedupHeaders {
+		hash.Write([]byte{0})
+		hash.Write([]byte(c.GetHeader(name)))
+	}
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// isRetry reports whether the client marked the request as a retry of an
+// earlier attempt, as the Anthropic SDKs do with X-Stainless-Retry-Count
+func isRetry(c *gin.Context) bool {
+	count, err := strconv.Atoi(c.GetHeader("X-Stainless-Retry-Count"))
+	return err == nil && count > 0
+}
+
+// DedupMiddleware answers a retry identical to a request that recently
+// succeeded with the stored response instead of sending it upstream again.
+// Requests that are not marked as retries are always sent, since a user may
+// deliberately repeat a prompt. A nil cache disables deduplication.
+func DedupMiddleware(cache *services.DedupCache, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cache == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Next()
+			return
+		}
+		// Handlers bind the body from the context, so it is only read once
+		c.Set(gin.BodyBytesKey, body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := dedupKey(c, body)
+		if entry, ok := cache.Get(key); ok && isRetry(c) {
+			logger.WithFields(logrus.Fields{
+				"request_id":  c.GetString("request_id"),
+				"age_ms":      time.Since(entry.StoredAt).Milliseconds(),
+				"retry_count": c.GetHeader("X-Stainless-Retry-Count"),
+			}).Info("Duplicate request answered from the dedup cache")
+
+			for name, values := range entry.Header {
+				if c.Writer.Header().Get(name) == "" {
+					c.Writer.Header()[name] = values
+				}
+			}
+			c.Header("X-Proxy-Dedup", "replayed")
+			c.Status(entry.Status)
+			c.Writer.Write(entry.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &dedupWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		// Keep the response even if the client went away before receiving it,
+		// since that is when the client retries
+		if writer.complete() {
+			cache.Store(key, &services.DedupEntry{
+				Status: writer.Status(),
+				Header: writer.Header().Clone(),
+				Body:   writer.body.Bytes(),
+			})
+		}
+	}
+}
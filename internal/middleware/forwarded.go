@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardedProtoKey is the context key of the scheme the client used to
+// reach a trusted reverse proxy
+const ForwardedProtoKey = "forwarded_proto"
+
+// ParseTrustedProxies parses addresses and CIDR ranges of trusted proxies
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address: %s", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range: %s", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// ForwardedMiddleware applies the X-Forwarded-Proto and X-Forwarded-Host
+// headers of requests from trusted proxies, so URLs built for the client use
+// the scheme and host it connected to. The client address of these requests
+// is taken from X-Forwarded-For by gin itself.
+func ForwardedMiddleware(cfg *config.Config) gin.HandlerFunc {
+	trusted, _ := ParseTrustedProxies(cfg.TrustedProxies)
+	return func(c *gin.Context) {
+		if len(trusted) == 0 || !containsIP(trusted, net.ParseIP(c.RemoteIP())) {
+			c.Next()
+			return
+		}
+		switch proto := strings.ToLower(firstForwarded(c.GetHeader("X-Forwarded-Proto"))); proto {
+		case "http", "https":
+			c.Set(ForwardedProtoKey, proto)
+		}
+		if host := firstForwarded(c.GetHeader("X-Forwarded-Host")); host != "" {
+			c.Request.Host = host
+		}
+		c.Next()
+	}
+}
+
+// containsIP reports whether an address is in one of the ranges
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstForwarded returns the first value of a forwarded header, the one the
+// proxy closest to the client set
+func firstForwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
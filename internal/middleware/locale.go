@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocaleMiddleware selects the language of error messages from the
+// Accept-Language header, falling back to the configured error language.
+// Errors are built in that language, upstream messages are kept as they are.
+func LocaleMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale, ok := services.ParseLocale(c.GetHeader("Accept-Language"))
+		if !ok {
+			locale = strings.ToLower(cfg.ErrorLanguage)
+		}
+		if locale != services.LocaleZH && locale != services.LocaleEN {
+			c.Next()
+			return
+		}
+
+		c.Set(services.LocaleContextKey, locale)
+		c.Request = c.Request.WithContext(services.WithLocale(c.Request.Context(), locale))
+		c.Next()
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"encoding/json"
+
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxErrorBodyBytes limits how much of an error response is kept to extract its message
+const maxErrorBodyBytes = 4096
+
+// metricsWriter counts the response bytes of a tracked request and keeps the
+// start of error responses
+type metricsWriter struct {
+	gin.ResponseWriter
+	request   *services.TrackedRequest
+	errorBody []byte
+}
+
+func (w *metricsWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.record(data[:n])
+	return n, err
+}
+
+func (w *metricsWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.record([]byte(s[:n]))
+	return n, err
+}
+
+func (w *metricsWriter) record(data []byte) {
+	w.request.AddBytes(len(data))
+	w.request.Publish(data)
+	if w.Status() >= 400 && len(w.errorBody) < maxErrorBodyBytes {
+		room := maxErrorBodyBytes - len(w.errorBody)
+		if len(data) > room {
+			data = data[:room]
+		}
+		w.errorBody = append(w.errorBody, data...)
+	}
+}
+
+// errorMessage extracts the message of an Anthropic or OpenAI style error body
+func (w *metricsWriter) errorMessage() string {
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.errorBody, &body); err == nil && body.Error.Message != "" {
+		return body.Error.Message
+	}
+	return string(w.errorBody)
+}
+
+// MetricsMiddleware tracks requests in flight, response sizes and failures
+func MetricsMiddleware(metrics *services.MetricsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := metrics.Begin(c, c.GetString("request_id"))
+		writer := &metricsWriter{ResponseWriter: c.Writer, request: request}
+		c.Writer = writer
+
+		c.Next()
+
+		metrics.End(request, writer.Status(), writer.errorMessage())
+	}
+}
@@ -1,19 +1,26 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"claude-code-provider-proxy/internal/buildinfo"
 	"claude-code-provider-proxy/internal/config"
 	"claude-code-provider-proxy/internal/models"
+	"claude-code-provider-proxy/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-// AuthMiddleware handles API key authentication
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware handles API key authentication. Requests with a configured
+// local key are rejected once the key has used up a daily quota, and their
+// usage is counted towards it.
+func AuthMiddleware(cfg *config.Config, quotas *services.QuotaService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip auth for health check
 		if c.Request.URL.Path == "/" || c.Request.URL.Path == "/health" {
@@ -34,7 +41,7 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		// In a production environment, you would validate against a database or service
 		if apiKey == "" {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: models.NewAuthenticationError("API key is required"),
+				Error: models.NewAuthenticationError(services.RequestMessage(c, "API key is required")),
 			})
 			c.Abort()
 			return
@@ -42,10 +49,96 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		// Store API key in context for later use
 		c.Set("api_key", apiKey)
+		// The organization the client selected goes upstream with its requests
+		c.Request = c.Request.WithContext(services.WithOrgHeaders(c.Request.Context(), c.Request.Header))
+
+		localKey, ok := cfg.LocalKey(apiKey)
+		if !ok {
+			// Other keys are the client's own upstream key. Without it, only
+			// the configured local keys are accepted so none bypasses a quota.
+			if cfg.ForwardClientKey {
+				c.Request = c.Request.WithContext(services.WithClientKey(c.Request.Context(), apiKey))
+			} else if len(cfg.LocalKeys) > 0 {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+					Error: models.NewAuthenticationError(services.RequestMessage(c, "Invalid API key")),
+				})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+		c.Set(services.LocalKeyContextKey, localKey.Name)
+		if localKey.Priority != "" {
+			c.Set(services.PriorityContextKey, localKey.Priority)
+		}
+		if localKey.ModelPair != "" {
+			c.Set(services.ModelPairContextKey, localKey.ModelPair)
+		}
+		if localKey.UpstreamKey != "" {
+			c.Request = c.Request.WithContext(services.WithClientKey(c.Request.Context(), localKey.UpstreamKey))
+		}
+		quota := quotas.Check(localKey)
+		// What is left before this request, for clients to show throttling
+		if quota.TokensLeft >= 0 {
+			c.Header("X-Proxy-RateLimit-Remaining", strconv.Itoa(quota.TokensLeft))
+		}
+		if quota.CostLeft >= 0 {
+			c.Header("X-Proxy-Budget-Remaining", strconv.FormatFloat(quota.CostLeft, 'f', 4, 64))
+		}
+		if quota.Exceeded != "" {
+			c.Header("X-Proxy-Quota-Reset", quota.ResetAt.Format(time.RFC3339))
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(quota.ResetAt).Seconds())+1))
+			resetAt := quota.ResetAt.Format(time.RFC3339)
+			message := services.RequestMessagef(c, "API key %q has used its daily token quota of %d, resets at %s", localKey.Name, localKey.DailyTokens, resetAt)
+			if quota.Exceeded == services.QuotaDailyCost {
+				message = services.RequestMessagef(c, "API key %q has used its daily cost quota of %g, resets at %s", localKey.Name, localKey.DailyCost, resetAt)
+			}
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error: models.NewRateLimitError(message),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+		quotas.Record(c)
+	}
+}
+
+// AdminAuthMiddleware protects the admin API. When an admin token is
+// configured it must be sent as a Bearer token; otherwise only requests from
+// the local machine are accepted.
+func AdminAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status, err := AdminAuthError(cfg, c); err != nil {
+			c.JSON(status, models.ErrorResponse{Error: err})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
+// AdminAuthError checks a request to the admin API as AdminAuthMiddleware
+// does, returning the HTTP status and error of a rejected request, so other
+// protocols can report it in their own format
+func AdminAuthError(cfg *config.Config, c *gin.Context) (int, *models.APIError) {
+	if cfg.AdminToken != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			return http.StatusUnauthorized, models.NewAuthenticationError(services.RequestMessage(c, "Invalid admin token"))
+		}
+		return http.StatusOK, nil
+	}
+
+	// Behind a trusted reverse proxy this is the address of the client
+	if ip := net.ParseIP(c.ClientIP()); ip == nil || !ip.IsLoopback() {
+		return http.StatusForbidden, models.NewPermissionError(services.RequestMessage(c, "Admin API is only available from localhost unless admin_token is set"))
+	}
+	return http.StatusOK, nil
+}
+
 // CORSMiddleware handles Cross-Origin Resource Sharing
 func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -53,7 +146,7 @@ func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
 		c.Header("Access-Control-Allow-Origin", "*") // In production, be more specific
 		c.Header("Access-Control-Allow-Methods", strings.Join(cfg.AllowMethods, ", "))
 		c.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowHeaders, ", "))
-		c.Header("Access-Control-Expose-Headers", "Content-Length")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, X-Proxy-Warning, X-Proxy-Conversion-Note, X-Proxy-Model-Mapping, X-Proxy-Dedup, X-Proxy-Cost, X-Proxy-Quota-Reset, X-Proxy-Queue-Time, X-Proxy-RateLimit-Remaining, X-Proxy-Budget-Remaining, Retry-After")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Max-Age", "86400")
 
@@ -70,7 +163,7 @@ func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
 // LoggingMiddleware provides structured logging
 func LoggingMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		logger.WithFields(logrus.Fields{
+		fields := logrus.Fields{
 			"status_code":  param.StatusCode,
 			"latency":      param.Latency,
 			"client_ip":    param.ClientIP,
@@ -78,22 +171,32 @@ func LoggingMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 			"path":         param.Path,
 			"user_agent":   param.Request.UserAgent(),
 			"error":        param.ErrorMessage,
-		}).Info("HTTP Request")
+			"request_id":   param.Keys["request_id"],
+		}
+		// Streams report their first token latency and throughput
+		for _, key := range []string{services.FirstTokenContextKey, services.TokensPerSecondContextKey, services.SlowFirstTokenContextKey} {
+			if value, ok := param.Keys[key]; ok {
+				fields[key] = value
+			}
+		}
+		logger.WithFields(fields).Info("HTTP Request")
 		return ""
 	})
 }
 
-// ErrorHandlingMiddleware handles panics and errors
-func ErrorHandlingMiddleware(logger *logrus.Logger) gin.HandlerFunc {
+// ErrorHandlingMiddleware handles panics and errors, reporting panics when
+// error reporting is enabled
+func ErrorHandlingMiddleware(logger *logrus.Logger, reporter *services.ErrorReporter) gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
 		logger.WithFields(logrus.Fields{
 			"panic": recovered,
 			"path":  c.Request.URL.Path,
 			"method": c.Request.Method,
 		}).Error("Panic recovered")
+		reporter.ReportPanic(recovered)
 
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: models.NewInternalError("Internal server error"),
+			Error: models.NewInternalError(services.RequestMessage(c, "Internal server error")),
 		})
 	})
 }
@@ -153,7 +256,7 @@ func ContentTypeMiddleware() gin.HandlerFunc {
 		contentType := c.GetHeader("Content-Type")
 		if !strings.Contains(contentType, "application/json") {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
-				Error: models.NewValidationError("Content-Type must be application/json"),
+				Error: models.NewValidationError(services.RequestMessage(c, "Content-Type must be application/json")),
 			})
 			c.Abort()
 			return
@@ -179,7 +282,7 @@ func AnthropicVersionMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Set default Anthropic version if not provided
 		if c.GetHeader("anthropic-version") == "" {
-			c.Header("anthropic-version", "2023-06-01")
+			c.Header("anthropic-version", buildinfo.AnthropicVersion)
 		}
 		c.Next()
 	}
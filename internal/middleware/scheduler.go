@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// requestPriority returns the scheduling priority of a request: the
+// X-Proxy-Priority header, then the priority of the local API key, then
+// interactive for streaming requests and batch for the rest
+func requestPriority(c *gin.Context, body []byte) string {
+	for _, priority := range []string{strings.ToLower(c.GetHeader("X-Proxy-Priority")), c.GetString(services.PriorityContextKey)} {
+		if priority == services.PriorityInteractive || priority == services.PriorityBatch {
+			return priority
+		}
+	}
+
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	if json.Unmarshal(body, &req) == nil && req.Stream {
+		return services.PriorityInteractive
+	}
+	return services.PriorityBatch
+}
+
+// SchedulerMiddleware holds a request until the scheduler admits it and
+// frees the slot when the response is complete. The time spent queued is
+// returned in the X-Proxy-Queue-Time header. A nil scheduler admits every
+// request immediately.
+func SchedulerMiddleware(scheduler *services.RequestScheduler, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scheduler == nil {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if raw, ok := c.Get(gin.BodyBytesKey); ok {
+			body, _ = raw.([]byte)
+		} else {
+			data, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.Next()
+				return
+			}
+			// Handlers bind the body from the context, so it is only read once
+			body = data
+			c.Set(gin.BodyBytesKey, body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		priority := requestPriority(c, body)
+		start := time.Now()
+		release, err := scheduler.Acquire(c.Request.Context(), priority)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"request_id": c.GetString("request_id"),
+				"priority":   priority,
+			}).Info("Client disconnected while queued")
+			c.Abort()
+			return
+		}
+		defer release()
+
+		waited := time.Since(start)
+		c.Header("X-Proxy-Queue-Time", strconv.FormatInt(waited.Milliseconds(), 10))
+		if waited > 10*time.Millisecond {
+			interactive, batch := scheduler.Queued()
+			logger.WithFields(logrus.Fields{
+				"request_id":         c.GetString("request_id"),
+				"priority":           priority,
+				"waited_ms":          waited.Milliseconds(),
+				"queued_interactive": interactive,
+				"queued_batch":       batch,
+			}).Info("Request admitted after queueing")
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"claude-code-provider-proxy/internal/models"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTranscriptResponseBytes limits the response kept for a transcript
+const maxTranscriptResponseBytes = 16 * 1024 * 1024
+
+// transcriptWriter keeps a copy of the response for the transcript
+type transcriptWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *transcriptWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.record(data[:n])
+	return n, err
+}
+
+func (w *transcriptWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.record([]byte(s[:n]))
+	return n, err
+}
+
+func (w *transcriptWriter) record(data []byte) {
+	if w.body.Len()+len(data) > maxTranscriptResponseBytes {
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
+
+// TranscriptMiddleware stores successful message requests with the response
+// the client received in the transcript of their Claude Code session. A nil
+// store disables transcripts.
+func TranscriptMiddleware(store *services.TranscriptStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store == nil {
+			c.Next()
+			return
+		}
+
+		body, ok := c.Get(gin.BodyBytesKey)
+		if !ok {
+			data, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.Next()
+				return
+			}
+			// Handlers bind the body from the context, so it is only read once
+			c.Set(gin.BodyBytesKey, data)
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			body = data
+		}
+		started := time.Now().UTC()
+
+		writer := &transcriptWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		if writer.truncated || writer.Status() != http.StatusOK {
+			return
+		}
+		var req models.AnthropicRequest
+		if data, _ := body.([]byte); json.Unmarshal(data, &req) != nil {
+			return
+		}
+		content, stopReason := services.ParseResponseContent(writer.Header().Get("Content-Type"), writer.body.Bytes())
+		requestID := c.GetString("request_id")
+		store.Append(&services.TranscriptEntry{
+			Time:       started,
+			RequestID:  requestID,
+			Session:    services.SessionID(c.GetHeader("X-Claude-Code-Session-Id"), req.Metadata, requestID),
+			Model:      req.Model,
+			System:     req.System,
+			Messages:   req.Messages,
+			Response:   content,
+			StopReason: stopReason,
+		})
+	}
+}
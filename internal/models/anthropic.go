@@ -14,6 +14,10 @@ type AnthropicRequest struct {
 	Tools         []AnthropicTool        `json:"tools,omitempty"`
 	ToolChoice    *AnthropicToolChoice   `json:"tool_choice,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+
+	// Vendor extensions passed to OpenAI-compatible upstreams
+	FrequencyPenalty *float64 `json:"x_frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"x_presence_penalty,omitempty"`
 }
 
 // AnthropicMessage represents a message in the conversation
@@ -46,6 +50,9 @@ type AnthropicResponse struct {
 	StopReason   string             `json:"stop_reason"`
 	StopSequence string             `json:"stop_sequence,omitempty"`
 	Usage        AnthropicUsage     `json:"usage"`
+	// Vendor extension: upstream token log probabilities, when requested
+	// with the X-Proxy-Logprobs header
+	Logprobs interface{} `json:"x_logprobs,omitempty"`
 }
 
 // AnthropicContent represents content in the response
@@ -58,6 +65,8 @@ type AnthropicContent struct {
 	ID    string                 `json:"id,omitempty"`
 	Name  string                 `json:"name,omitempty"`
 	Input map[string]interface{} `json:"input,omitempty"`
+	// Original arguments when the proxy repaired invalid JSON
+	RawInput string `json:"raw_input,omitempty"`
 	// For tool results
 	ToolUseID string      `json:"tool_use_id,omitempty"`
 	Content   interface{} `json:"content,omitempty"`
@@ -187,10 +196,11 @@ type AnthropicDelta struct {
 
 // TokenCountRequest represents a request to count tokens
 type TokenCountRequest struct {
-	Model    string             `json:"model" binding:"required"`
-	Messages []AnthropicMessage `json:"messages" binding:"required"`
-	System   interface{}        `json:"system,omitempty"` // Can be string or array
-	Tools    []AnthropicTool    `json:"tools,omitempty"`
+	Model      string               `json:"model" binding:"required"`
+	Messages   []AnthropicMessage   `json:"messages" binding:"required"`
+	System     interface{}          `json:"system,omitempty"` // Can be string or array
+	Tools      []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice *AnthropicToolChoice `json:"tool_choice,omitempty"`
 }
 
 // TokenCountResponse represents the response for token counting
@@ -207,11 +217,18 @@ type OpenAIRequest struct {
 	TopP             *float64        `json:"top_p,omitempty"`
 	Stop             []string        `json:"stop,omitempty"`
 	Stream           bool            `json:"stream,omitempty"`
+	N                int             `json:"n,omitempty"`
+	Logprobs         bool            `json:"logprobs,omitempty"`
+	TopLogprobs      int             `json:"top_logprobs,omitempty"`
 	Tools            []OpenAITool    `json:"tools,omitempty"`
 	ToolChoice       interface{}     `json:"tool_choice,omitempty"`
 	User             string          `json:"user,omitempty"`
 	FrequencyPenalty *float64        `json:"frequency_penalty,omitempty"`
 	PresencePenalty  *float64        `json:"presence_penalty,omitempty"`
+
+	// Set by the conversion, never sent upstream
+	Notes     []string          `json:"-"` // Non-fatal differences from the Anthropic request
+	ToolNames map[string]string `json:"-"` // Original names of tools renamed for the upstream
 }
 
 // OpenAIMessage represents a message in OpenAI format
@@ -222,6 +239,7 @@ type OpenAIMessage struct {
 	ToolCalls    []OpenAIToolCall       `json:"tool_calls,omitempty"`
 	ToolCallID   string                 `json:"tool_call_id,omitempty"`
 	CacheControl *AnthropicCacheControl `json:"cache_control,omitempty"` // For tool messages
+	Refusal      string                 `json:"refusal,omitempty"`       // Why the model declined, in responses
 }
 
 // OpenAIContentPart represents a content part in OpenAI format (for multimodal content)
@@ -292,6 +310,24 @@ type OpenAIUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// Prompt tokens read from the upstream prompt cache, reported by OpenAI
+	// in the details and by DeepSeek as cache hit tokens
+	PromptTokensDetails  *OpenAIPromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	PromptCacheHitTokens int                        `json:"prompt_cache_hit_tokens,omitempty"`
+}
+
+// OpenAIPromptTokensDetails breaks down the prompt tokens of a response
+type OpenAIPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CachedTokens returns the prompt tokens read from the upstream prompt cache
+func (u OpenAIUsage) CachedTokens() int {
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+		return u.PromptTokensDetails.CachedTokens
+	}
+	return u.PromptCacheHitTokens
 }
 
 // OpenAIStreamResponse represents a streaming response chunk from OpenAI
@@ -302,4 +338,5 @@ type OpenAIStreamResponse struct {
 	Model             string         `json:"model"`
 	Choices           []OpenAIChoice `json:"choices"`
 	SystemFingerprint string         `json:"system_fingerprint,omitempty"`
+	Usage             *OpenAIUsage   `json:"usage,omitempty"`
 }
@@ -17,14 +17,28 @@ const (
 	ErrorTypeAPI           ErrorType = "api_error"
 	ErrorTypeInternal      ErrorType = "internal_error"
 	ErrorTypeInvalidRequest ErrorType = "invalid_request_error"
+	ErrorTypeBilling       ErrorType = "billing_error"
 )
 
 // APIError represents a structured API error
 type APIError struct {
-	Type    ErrorType `json:"type"`
-	Message string    `json:"message"`
-	Code    string    `json:"code,omitempty"`
-	Param   string    `json:"param,omitempty"`
+	Type    ErrorType  `json:"type"`
+	Message string     `json:"message"`
+	Code    string     `json:"code,omitempty"`
+	Param   string     `json:"param,omitempty"`
+	Retry   *RetryInfo `json:"retry,omitempty"` // Set for transient upstream failures
+
+	// Provider that returned an upstream error: the one a router names, or
+	// the upstream host
+	Provider string `json:"provider,omitempty"`
+}
+
+// RetryInfo describes the upstream attempts behind an error, so clients can
+// back off before sending the request again
+type RetryInfo struct {
+	Attempts          int `json:"attempts"`
+	LastStatus        int `json:"last_status,omitempty"` // 0 when the upstream did not answer
+	RetryAfterSeconds int `json:"retry_after_seconds"`
 }
 
 // Error implements the error interface
@@ -41,6 +55,8 @@ func (e *APIError) HTTPStatus() int {
 		return http.StatusUnauthorized
 	case ErrorTypePermission:
 		return http.StatusForbidden
+	case ErrorTypeBilling:
+		return http.StatusPaymentRequired
 	case ErrorTypeNotFound:
 		return http.StatusNotFound
 	case ErrorTypeRateLimit:
@@ -87,6 +103,14 @@ func NewPermissionError(message string) *APIError {
 	}
 }
 
+// NewBillingError creates a new billing error
+func NewBillingError(message string) *APIError {
+	return &APIError{
+		Type:    ErrorTypeBilling,
+		Message: message,
+	}
+}
+
 // NewNotFoundError creates a new not found error
 func NewNotFoundError(message string) *APIError {
 	return &APIError{
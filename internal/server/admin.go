@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getStats reports live request statistics for claudeproxy top
+func (s *Server) getStats(c *gin.Context) {
+	c.JSON(http.StatusOK, s.metrics.Snapshot())
+}
+
+// usageResponse is the body of GET /admin/usage
+type usageResponse struct {
+	Report services.UsageReport         `json:"report"`
+	Keys   map[string]services.KeyUsage `json:"keys"` // Today's usage of the local API keys
+}
+
+// getUsage summarizes the usage ledger over the period given by ?since= (a
+// duration, 24h by default) together with today's quota usage
+func (s *Server) getUsage(c *gin.Context) {
+	since := 24 * time.Hour
+	if value := c.Query("since"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: models.NewValidationError("Invalid duration: "+value, "since"),
+			})
+			return
+		}
+		since = duration
+	}
+
+	resp, err := s.usage(since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: models.NewInternalError("Failed to read usage ledger: " + err.Error()),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// usage summarizes the usage ledger over the last period
+func (s *Server) usage(since time.Duration) (usageResponse, error) {
+	to := time.Now()
+	records, err := s.storage.LoadUsage(to.Add(-since))
+	if err != nil {
+		return usageResponse{}, err
+	}
+
+	return usageResponse{
+		Report: services.BuildUsageReport(records, to.Add(-since), to),
+		Keys:   s.quotas.Usage(),
+	}, nil
+}
+
+// updateModelsRequest is the body of PUT /admin/models
+type updateModelsRequest struct {
+	Big   string `json:"big"`
+	Small string `json:"small"`
+}
+
+// updateModels switches the big and/or small model of the running service.
+// The change applies to new requests immediately; streams already in flight
+// are not interrupted. It is not written to config.json.
+func (s *Server) updateModels(c *gin.Context) {
+	var req updateModelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: models.FormatValidationError(err),
+		})
+		return
+	}
+	if req.Big == "" && req.Small == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: models.NewValidationError("At least one of big or small is required"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.switchModels(req))
+}
+
+// modelsResponse is the body returned by PUT /admin/models
+type modelsResponse struct {
+	BigModel   string `json:"big_model"`
+	SmallModel string `json:"small_model"`
+}
+
+// switchModels applies the non-empty models of the request
+func (s *Server) switchModels(req updateModelsRequest) modelsResponse {
+	cfg := s.update(func(cfg *config.Config) {
+		if req.Big != "" {
+			cfg.BigModelName = req.Big
+		}
+		if req.Small != "" {
+			cfg.SmallModelName = req.Small
+		}
+	})
+	return modelsResponse{BigModel: cfg.BigModelName, SmallModel: cfg.SmallModelName}
+}
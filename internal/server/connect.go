@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// connectServicePath is the route prefix of the AdminService defined in
+// proto/claudeproxy/admin/v1/admin.proto
+const connectServicePath = "/claudeproxy.admin.v1.AdminService"
+
+// connectError is an error of the Connect protocol
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// connectStatus maps Connect error codes to HTTP statuses
+var connectStatus = map[string]int{
+	"invalid_argument":  http.StatusBadRequest,
+	"unauthenticated":   http.StatusUnauthorized,
+	"permission_denied": http.StatusForbidden,
+	"internal":          http.StatusInternalServerError,
+}
+
+// connectAuth protects the AdminService like the REST admin API, reporting
+// rejected requests as Connect errors
+func connectAuth(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := middleware.AdminAuthError(cfg, c)
+		if err == nil {
+			c.Next()
+			return
+		}
+		code := "permission_denied"
+		if status == http.StatusUnauthorized {
+			code = "unauthenticated"
+		}
+		writeConnectError(c, &connectError{Code: code, Message: err.Message})
+		c.Abort()
+	}
+}
+
+// connectMethod serves one unary RPC. It decodes its request message with
+// bind and returns the response message or an error.
+type connectMethod func(bind func(req interface{}) error) (interface{}, *connectError)
+
+// connectMethods are the RPCs of the AdminService, sharing their
+// implementation with the REST admin API
+func (s *Server) connectMethods() map[string]connectMethod {
+	return map[string]connectMethod{
+		"GetVersion": func(bind func(interface{}) error) (interface{}, *connectError) {
+			var req struct{}
+			if err := bind(&req); err != nil {
+				return nil, &connectError{Code: "invalid_argument", Message: err.Error()}
+			}
+			return buildinfo.Get(), nil
+		},
+		"GetStats": func(bind func(interface{}) error) (interface{}, *connectError) {
+			var req struct{}
+			if err := bind(&req); err != nil {
+				return nil, &connectError{Code: "invalid_argument", Message: err.Error()}
+			}
+			return s.metrics.Snapshot(), nil
+		},
+		"GetUsage": func(bind func(interface{}) error) (interface{}, *connectError) {
+			var req struct {
+				Since string `json:"since"`
+			}
+			if err := bind(&req); err != nil {
+				return nil, &connectError{Code: "invalid_argument", Message: err.Error()}
+			}
+			since := 24 * time.Hour
+			if req.Since != "" {
+				duration, err := time.ParseDuration(req.Since)
+				if err != nil || duration <= 0 {
+					return nil, &connectError{Code: "invalid_argument", Message: "Invalid duration: " + req.Since}
+				}
+				since = duration
+			}
+			resp, err := s.usage(since)
+			if err != nil {
+				return nil, &connectError{Code: "internal", Message: "Failed to read usage ledger: " + err.Error()}
+			}
+			return resp, nil
+		},
+		"UpdateModels": func(bind func(interface{}) error) (interface{}, *connectError) {
+			var req updateModelsRequest
+			if err := bind(&req); err != nil {
+				return nil, &connectError{Code: "invalid_argument", Message: err.Error()}
+			}
+			if req.Big == "" && req.Small == "" {
+				return nil, &connectError{Code: "invalid_argument", Message: "At least one of big or small is required"}
+			}
+			return s.switchModels(req), nil
+		},
+	}
+}
+
+// serveConnect adapts a method to the unary Connect protocol. Only the JSON
+// codec is supported, so generated clients must be configured to use JSON.
+func serveConnect(method connectMethod) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType != "application/json" {
+			c.Header("Accept-Post", "application/json")
+			c.Status(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			writeConnectError(c, &connectError{Code: "invalid_argument", Message: err.Error()})
+			return
+		}
+		resp, connectErr := method(func(req interface{}) error {
+			// Messages with only default values may be sent as an empty body
+			if len(body) == 0 {
+				return nil
+			}
+			return json.Unmarshal(body, req)
+		})
+		if connectErr != nil {
+			writeConnectError(c, connectErr)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// writeConnectError writes an error in the format of the Connect protocol
+func writeConnectError(c *gin.Context, err *connectError) {
+	status, ok := connectStatus[err.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, err)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/services"
+)
+
+var (
+	protoMessage = regexp.MustCompile(`(?m)^message (\w+) \{([^}]*)\}`)
+	protoField   = regexp.MustCompile(`(?m)^\s*(?:repeated\s+)?(map<\s*\w+\s*,\s*([\w.]+)\s*>|[\w.]+)\s+(\w+)\s*=\s*\d+;`)
+)
+
+// protoFields are the fields of a message by name, with the message type of
+// each field, its map value or list element
+type protoFields map[string]string
+
+// TestConnectMessagesMatchHandlers checks that admin.proto describes the JSON
+// the AdminService methods send and accept
+func TestConnectMessagesMatchHandlers(t *testing.T) {
+	data, err := os.ReadFile("../../proto/claudeproxy/admin/v1/admin.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(map[string]protoFields)
+	for _, m := range protoMessage.FindAllStringSubmatch(string(data), -1) {
+		fields := make(protoFields)
+		for _, f := range protoField.FindAllStringSubmatch(m[2], -1) {
+			typ := f[1]
+			if f[2] != "" {
+				typ = f[2]
+			}
+			fields[f[3]] = typ
+		}
+		messages[m[1]] = fields
+	}
+
+	roots := map[string]reflect.Type{
+		"GetVersionResponse":   reflect.TypeOf(buildinfo.Info{}),
+		"GetStatsResponse":     reflect.TypeOf(services.MetricsSnapshot{}),
+		"GetUsageResponse":     reflect.TypeOf(usageResponse{}),
+		"UpdateModelsRequest":  reflect.TypeOf(updateModelsRequest{}),
+		"UpdateModelsResponse": reflect.TypeOf(modelsResponse{}),
+	}
+	for name, typ := range roots {
+		compareMessage(t, messages, name, typ)
+	}
+}
+
+// compareMessage compares the fields of a message with the JSON fields of a
+// Go type, and the messages of its fields recursively
+func compareMessage(t *testing.T, messages map[string]protoFields, name string, typ reflect.Type) {
+	t.Helper()
+	fields, ok := messages[name]
+	if !ok {
+		t.Errorf("message %s is missing from admin.proto", name)
+		return
+	}
+
+	goFields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		goFields[tag] = field.Type
+	}
+
+	for _, field := range sortedKeys(goFields) {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("%s sends %s, which is missing from message %s", typ, field, name)
+		}
+	}
+	for _, field := range sortedKeys(fields) {
+		goType, ok := goFields[field]
+		if !ok {
+			t.Errorf("message %s has %s, which %s does not send", name, field, typ)
+			continue
+		}
+		for goType.Kind() == reflect.Slice || goType.Kind() == reflect.Map || goType.Kind() == reflect.Pointer {
+			goType = goType.Elem()
+		}
+		if _, ok := messages[fields[field]]; ok && goType.Kind() == reflect.Struct && goType != reflect.TypeOf(time.Time{}) {
+			compareMessage(t, messages, fields[field], goType)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
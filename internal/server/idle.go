@@ -0,0 +1,84 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idleShutdownMarker is the file written to the config directory when the
+// server exits because it was idle, so the launcher knows to restart it on demand
+const idleShutdownMarker = "idle_shutdown"
+
+// idleMonitor tracks API activity and signals when the server has been idle
+// for longer than the timeout. Requests still in flight (long streams) keep
+// the server alive.
+type idleMonitor struct {
+	timeout      time.Duration
+	lastActivity atomic.Int64 // Unix nanoseconds
+	inFlight     atomic.Int32
+}
+
+// newIdleMonitor creates an idle monitor, or nil when idle shutdown is disabled
+func newIdleMonitor(minutes int) *idleMonitor {
+	if minutes <= 0 {
+		return nil
+	}
+	m := &idleMonitor{timeout: time.Duration(minutes) * time.Minute}
+	m.touch()
+	return m
+}
+
+// touch records activity now
+func (m *idleMonitor) touch() {
+	m.lastActivity.Store(time.Now().UnixNano())
+}
+
+// middleware records the start and end of every API request
+func (m *idleMonitor) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.inFlight.Add(1)
+		m.touch()
+		defer func() {
+			m.touch()
+			m.inFlight.Add(-1)
+		}()
+		c.Next()
+	}
+}
+
+// idle returns a channel that is closed once the server has been idle for the timeout
+func (m *idleMonitor) idle() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(m.checkInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			last := time.Unix(0, m.lastActivity.Load())
+			if m.inFlight.Load() == 0 && time.Since(last) >= m.timeout {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// checkInterval returns how often the idle state is checked
+func (m *idleMonitor) checkInterval() time.Duration {
+	if interval := m.timeout / 10; interval < 30*time.Second {
+		return interval
+	}
+	return 30 * time.Second
+}
+
+// writeIdleMarker records that the server stopped because it was idle
+func writeIdleMarker() error {
+	marker := filepath.Join(config.Dir(), idleShutdownMarker)
+	return os.WriteFile(marker, []byte(time.Now().UTC().Format(time.RFC3339)), 0644)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InstanceTokenHeader carries the instance token in requests to the
+// /admin/instance endpoints
+const InstanceTokenHeader = "X-Proxy-Instance-Token"
+
+// instanceTokenEnv hands the instance token on to successor processes, so a
+// restarted server keeps the identity the CLI knows it by
+const instanceTokenEnv = "CLAUDEPROXY_INSTANCE_TOKEN"
+
+// InstanceInfo identifies a running server process. It is written to the
+// instance file when the server starts listening; the CLI finds its server
+// by presenting the token on the configured port instead of checking
+// process IDs, which are reused and cannot be signalled on Windows.
+type InstanceInfo struct {
+	Token   string    `json:"token,omitempty"` // Only in the instance file
+	PID     int       `json:"pid"`
+	Addr    string    `json:"addr"` // Listen address, host:port
+	Started time.Time `json:"started"`
+	Version string    `json:"version"`
+}
+
+// handoffResult is the outcome of a handoff requested through the admin API
+type handoffResult struct {
+	pid int
+	err error
+}
+
+// stopResponse is the body of POST /admin/instance/stop
+type stopResponse struct {
+	Status string `json:"status"`
+}
+
+// handoffResponse is the body of POST /admin/instance/handoff
+type handoffResponse struct {
+	PID int `json:"pid"` // Process ID of the new server process
+}
+
+// InstanceFilePath returns the location of the instance file
+func InstanceFilePath() string {
+	return filepath.Join(config.Dir(), "instance.json")
+}
+
+// ReadInstanceFile reads the instance file of the last server started
+func ReadInstanceFile() (*InstanceInfo, error) {
+	data, err := os.ReadFile(InstanceFilePath())
+	if err != nil {
+		return nil, err
+	}
+	var info InstanceInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// instanceToken returns the token inherited from the previous server
+// process, or generates one
+func instanceToken() string {
+	if token := os.Getenv(instanceTokenEnv); token != "" {
+		return token
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	os.Setenv(instanceTokenEnv, token)
+	return token
+}
+
+// writeInstanceFile records this process as the running server
+func (s *Server) writeInstanceFile() error {
+	data, err := json.Marshal(s.instanceInfo(true))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(InstanceFilePath(), data, config.PrivateFileMode)
+}
+
+// removeInstanceFile removes the instance file unless a successor has
+// already replaced it
+func (s *Server) removeInstanceFile() {
+	if info, err := ReadInstanceFile(); err == nil && info.PID == os.Getpid() {
+		os.Remove(InstanceFilePath())
+	}
+}
+
+// instanceInfo describes this process, with the token for the instance file
+func (s *Server) instanceInfo(withToken bool) InstanceInfo {
+	info := InstanceInfo{
+		PID:     os.Getpid(),
+		Addr:    s.httpServer.Addr,
+		Started: s.started,
+		Version: buildinfo.Version,
+	}
+	if withToken {
+		info.Token = s.instanceToken
+	}
+	return info
+}
+
+// requireInstanceToken only lets requests carrying the token of this
+// instance through, proving they were made by someone who can read the
+// instance file
+func (s *Server) requireInstanceToken(c *gin.Context) {
+	token := c.GetHeader(InstanceTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.instanceToken)) != 1 {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: models.NewPermissionError("Invalid instance token"),
+		})
+		c.Abort()
+	}
+}
+
+// getInstance identifies this server process
+func (s *Server) getInstance(c *gin.Context) {
+	c.JSON(http.StatusOK, s.instanceInfo(false))
+}
+
+// stopInstance shuts the server down gracefully, as SIGTERM does
+func (s *Server) stopInstance(c *gin.Context) {
+	select {
+	case s.stopRequests <- struct{}{}:
+	default:
+	}
+	c.JSON(http.StatusOK, stopResponse{Status: "stopping"})
+}
+
+// handOffInstance hands the listener to a new server process, as SIGUSR2
+// does on Unix, and returns the process ID of the successor
+func (s *Server) handOffInstance(c *gin.Context) {
+	reply := make(chan handoffResult, 1)
+	select {
+	case s.handoffRequests <- reply:
+	default:
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: models.NewAPIError("The server is shutting down or already restarting"),
+		})
+		return
+	}
+
+	result := <-reply
+	if result.err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: models.NewInternalError(result.err.Error()),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, handoffResponse{PID: result.pid})
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logPollInterval      = 250 * time.Millisecond
+	logHeartbeatInterval = 15 * time.Second
+	maxBacklogLines      = 1000
+)
+
+// logFilePath returns the location of the service log
+func logFilePath() string {
+	return filepath.Join(config.Dir(), "logs", "service.log")
+}
+
+// streamLogs tails the service log as Server-Sent Events. Each log line is
+// sent as a "log" event. ?level= drops entries below the given level and
+// ?lines= first replays the last lines of the file.
+func (s *Server) streamLogs(c *gin.Context) {
+	minLevel := logrus.TraceLevel
+	if value := c.Query("level"); value != "" {
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: models.NewValidationError("Invalid log level: " + value),
+			})
+			return
+		}
+		minLevel = level
+	}
+	backlog, _ := strconv.Atoi(c.Query("lines"))
+	if backlog > maxBacklogLines {
+		backlog = maxBacklogLines
+	}
+
+	file, err := os.Open(logFilePath())
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: models.NewNotFoundError("Log file not available: " + err.Error()),
+		})
+		return
+	}
+	defer file.Close()
+
+	// The stream outlives the server write timeout
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	send := func(line string) {
+		if line == "" || !logLineVisible(line, minLevel) {
+			return
+		}
+		fmt.Fprintf(c.Writer, "event: log\ndata: %s\n\n", line)
+	}
+
+	offset, err := replayLogTail(file, backlog, send)
+	if err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+
+	reader := bufio.NewReader(file)
+	var partial string
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Start over when the log was cleared
+		if info, err := file.Stat(); err == nil && info.Size() < offset {
+			file.Seek(0, io.SeekStart)
+			reader.Reset(file)
+			offset, partial = 0, ""
+		}
+
+		wrote := false
+		for {
+			chunk, err := reader.ReadString('\n')
+			offset += int64(len(chunk))
+			partial += chunk
+			if err != nil {
+				break
+			}
+			send(strings.TrimRight(partial, "\r\n"))
+			partial = ""
+			wrote = true
+		}
+
+		if wrote {
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= logHeartbeatInterval {
+			// Comment lines keep proxies from closing an idle stream
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			lastWrite = time.Now()
+			wrote = true
+		}
+		if wrote {
+			c.Writer.Flush()
+		}
+	}
+}
+
+// replayLogTail sends the last lines of the file and leaves the file
+// positioned at its end, returning that offset
+func replayLogTail(file *os.File, lines int, send func(string)) (int64, error) {
+	if lines <= 0 {
+		return file.Seek(0, io.SeekEnd)
+	}
+
+	var tail []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		tail = append(tail, scanner.Text())
+		if len(tail) > lines {
+			tail = tail[1:]
+		}
+	}
+	for _, line := range tail {
+		send(line)
+	}
+	return file.Seek(0, io.SeekEnd)
+}
+
+// logLineVisible reports whether a JSON log entry is at least minLevel.
+// Lines that are not JSON log entries are always shown.
+func logLineVisible(line string, minLevel logrus.Level) bool {
+	var entry struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Level == "" {
+		return true
+	}
+	level, err := logrus.ParseLevel(entry.Level)
+	if err != nil {
+		return true
+	}
+	return level <= minLevel
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/buildinfo"
+	"claude-code-provider-proxy/internal/middleware"
+	"claude-code-provider-proxy/internal/models"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiParam is a query or header parameter of an operation
+type apiParam struct {
+	name        string
+	in          string // "query", "header" or "path"
+	kind        string // JSON schema type
+	description string
+}
+
+// instanceTokenParam is the token the /admin/instance endpoints require
+var instanceTokenParam = apiParam{InstanceTokenHeader, "header", "string", "Token from the instance file in the config directory"}
+
+// apiOperation documents one route of the proxy. Request and response bodies
+// are given as zero values of their Go types, from which the schemas are
+// derived; a nil response is a free-form object.
+type apiOperation struct {
+	method, path string
+	tag          string
+	summary      string
+	security     string // "api_key", "admin" or empty for public endpoints
+	params       []apiParam
+	request      interface{}
+	response     interface{}
+	stream       string // When the response is a stream of server-sent events
+}
+
+// apiOperations are the routes registered in setupRouter
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/", tag: "status", summary: "Health check"},
+	{
+		method: "GET", path: "/health", tag: "status", summary: "Health check with upstream probe results",
+		params: []apiParam{{"deep", "query", "string",
+			"\"stream\" streams a canned message through the conversion path, one event every 200 ms, without contacting an upstream"}},
+		stream: "Anthropic message stream events when deep=stream",
+	},
+	{
+		method: "GET", path: "/status", tag: "status",
+		summary: "Service status, configuration, API key health and estimated cost",
+		params:  []apiParam{{"validate", "query", "boolean", "Validate the upstream API key with a real completion"}},
+	},
+	{method: "GET", path: "/version", tag: "status", summary: "Build information", response: buildinfo.Info{}},
+	{method: "GET", path: "/openapi.json", tag: "status", summary: "This OpenAPI document"},
+	{method: "GET", path: "/livez", tag: "status", summary: "Liveness probe: the process is up"},
+	{method: "GET", path: "/healthz", tag: "status", summary: "Alias of /livez"},
+	{
+		method: "GET", path: "/readyz", tag: "status",
+		summary: "Readiness probe: configured, not draining and upstreams reachable within the readiness window",
+	},
+	{
+		method: "POST", path: "/v1/messages", tag: "messages", security: "api_key",
+		summary: "Create a message (Anthropic Messages API)",
+		params: []apiParam{
+			{"anthropic-version", "header", "string", "Anthropic API version"},
+			{"X-Model-Pair", "header", "string", "Named model pair to use"},
+			{"X-Proxy-Tools", "header", "string", "Proxy tools to inject: * or a comma-separated list"},
+			{"X-Proxy-Logprobs", "header", "string", "Return upstream token log probabilities"},
+			{"X-Proxy-Priority", "header", "string", "Scheduling priority: interactive or batch"},
+		},
+		request:  models.AnthropicRequest{},
+		response: models.AnthropicResponse{},
+		stream:   "Sent when stream is true",
+	},
+	{
+		method: "POST", path: "/v1/messages/count_tokens", tag: "messages", security: "api_key",
+		summary: "Count the input tokens of a message request",
+		request: models.TokenCountRequest{}, response: models.TokenCountResponse{},
+	},
+	{
+		method: "POST", path: "/v1/chat/completions", tag: "passthrough", security: "api_key",
+		summary: "OpenAI-compatible chat completions forwarded to the upstream",
+		request: models.OpenAIRequest{}, response: models.OpenAIResponse{},
+		stream: "Sent when stream is true",
+	},
+	{
+		method: "GET", path: "/v1/models", tag: "models", security: "api_key",
+		summary: "Configured and upstream models with their capabilities",
+		params: []apiParam{
+			{"format", "query", "string", "Schema of the list: openai or anthropic; anthropic when anthropic-version is sent"},
+			{"vision", "query", "boolean", "Only models that do or do not read images"},
+			{"tools", "query", "boolean", "Only models that do or do not accept tools"},
+		},
+		response: struct {
+			Object string                    `json:"object"`
+			Data   []services.ModelListEntry `json:"data"`
+		}{},
+	},
+	{
+		method: "GET", path: "/v1/tools", tag: "models", security: "api_key",
+		summary: "Tools executed by the proxy",
+		response: struct {
+			Tools []services.ProxyToolInfo `json:"tools"`
+			OptIn bool                     `json:"opt_in"`
+		}{},
+	},
+	{
+		method: "POST", path: "/v1/validate", tag: "status", security: "api_key",
+		summary: "Validate the upstream API key",
+		response: struct {
+			Valid     bool   `json:"valid"`
+			CheckedAt string `json:"checked_at"`
+		}{},
+	},
+	{
+		method: "PUT", path: "/admin/models", tag: "admin", security: "admin",
+		summary:  "Switch the big and/or small model of the running service",
+		request:  updateModelsRequest{},
+		response: modelsResponse{},
+	},
+	{method: "GET", path: "/admin/stats", tag: "admin", security: "admin", summary: "Live request statistics", response: services.MetricsSnapshot{}},
+	{
+		method: "GET", path: "/admin/usage", tag: "admin", security: "admin",
+		summary:  "Usage ledger summary and today's quota usage of the local API keys",
+		params:   []apiParam{{"since", "query", "string", "Period to summarize as a duration, e.g. 24h"}},
+		response: usageResponse{},
+	},
+	{
+		method: "GET", path: "/admin/logs/stream", tag: "admin", security: "admin",
+		summary: "Tail the service log",
+		params: []apiParam{
+			{"level", "query", "string", "Minimum log level"},
+			{"lines", "query", "integer", "Replay this many lines of the log first"},
+		},
+		stream: "Each log line is sent as a log event",
+	},
+	{
+		method: "GET", path: "/admin/tap/:id", tag: "admin", security: "admin",
+		summary: "Observe the response of a request in flight, read-only",
+		params:  []apiParam{{"id", "path", "string", "Request ID, as listed by /admin/stats"}},
+		stream:  "The response bytes as the client receives them, from the moment of subscribing until the request ends; text/plain for requests that are not streamed",
+	},
+	{
+		method: "GET", path: "/admin/instance", tag: "admin", security: "admin",
+		summary:  "Identify the server process, for the CLI to find the server it started",
+		params:   []apiParam{instanceTokenParam},
+		response: InstanceInfo{},
+	},
+	{
+		method: "POST", path: "/admin/instance/stop", tag: "admin", security: "admin",
+		summary:  "Shut the server down gracefully",
+		params:   []apiParam{instanceTokenParam},
+		response: stopResponse{},
+	},
+	{
+		method: "POST", path: "/admin/instance/handoff", tag: "admin", security: "admin",
+		summary:  "Hand the listener to a new server process without interrupting requests in flight (not on Windows)",
+		params:   []apiParam{instanceTokenParam},
+		response: handoffResponse{},
+	},
+	{
+		method: "POST", path: connectServicePath + "/GetVersion", tag: "connect", security: "admin",
+		summary: "Connect RPC: build information",
+		request: struct{}{}, response: buildinfo.Info{},
+	},
+	{
+		method: "POST", path: connectServicePath + "/GetStats", tag: "connect", security: "admin",
+		summary: "Connect RPC: live request statistics",
+		request: struct{}{}, response: services.MetricsSnapshot{},
+	},
+	{
+		method: "POST", path: connectServicePath + "/GetUsage", tag: "connect", security: "admin",
+		summary: "Connect RPC: usage ledger summary and today's quota usage",
+		request: struct {
+			Since string `json:"since"`
+		}{},
+		response: usageResponse{},
+	},
+	{
+		method: "POST", path: connectServicePath + "/UpdateModels", tag: "connect", security: "admin",
+		summary: "Connect RPC: switch the big and/or small model",
+		request: updateModelsRequest{}, response: modelsResponse{},
+	},
+}
+
+// schemaGenerator derives JSON schemas from Go types. Named struct types
+// become components referenced with $ref.
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+// schema returns the schema of a Go type
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = nil // Placeholder for recursive types
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	// Interfaces accept any value
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct from its exported JSON fields
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// OpenAPISpec returns the OpenAPI document of the proxy API served at serverURL
+func OpenAPISpec(serverURL string) map[string]interface{} {
+	g := &schemaGenerator{components: make(map[string]interface{})}
+	errorSchema := g.schema(reflect.TypeOf(models.ErrorResponse{}))
+
+	paths := make(map[string]interface{})
+	for _, op := range apiOperations {
+		responseSchema := map[string]interface{}{"type": "object"}
+		if op.response != nil {
+			responseSchema = g.schema(reflect.TypeOf(op.response))
+		}
+		content := map[string]interface{}{}
+		if op.response != nil || op.stream == "" {
+			content["application/json"] = map[string]interface{}{"schema": responseSchema}
+		}
+		if op.stream != "" {
+			content["text/event-stream"] = map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string", "description": op.stream},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"operationId": operationID(op.method, op.path),
+			"summary":     op.summary,
+			"tags":        []string{op.tag},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{"description": "OK", "content": content},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorSchema}},
+				},
+			},
+		}
+		switch op.security {
+		case "api_key":
+			operation["security"] = []interface{}{
+				map[string]interface{}{"apiKey": []string{}},
+				map[string]interface{}{"bearer": []string{}},
+			}
+		case "admin":
+			operation["security"] = []interface{}{map[string]interface{}{"adminToken": []string{}}}
+		}
+		if len(op.params) > 0 {
+			var params []interface{}
+			for _, param := range op.params {
+				spec := map[string]interface{}{
+					"name":        param.name,
+					"in":          param.in,
+					"description": param.description,
+					"schema":      map[string]interface{}{"type": param.kind},
+				}
+				if param.in == "path" {
+					spec["required"] = true
+				}
+				params = append(params, spec)
+			}
+			operation["parameters"] = params
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.request))},
+				},
+			}
+		}
+
+		path := openAPIPath(op.path)
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Claude Code Proxy",
+			"description": "Anthropic-compatible proxy for OpenAI-compatible upstreams",
+			"version":     buildinfo.Version,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": serverURL}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": "x-api-key"},
+				"bearer":     map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "admin_token; without one only loopback clients are allowed"},
+			},
+		},
+	}
+}
+
+// openAPIPath turns the gin parameters of a route (":id") into OpenAPI ones ("{id}")
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationID derives a stable operation ID such as postV1MessagesCountTokens
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	words := strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '_' || r == '.' || r == ':' })
+	if len(words) == 0 {
+		words = []string{"root"}
+	}
+	for _, word := range words {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+// getOpenAPI serves the OpenAPI document for the host and base path the
+// client used, as forwarded by a trusted reverse proxy
+func (s *Server) getOpenAPI(c *gin.Context) {
+	scheme := c.GetString(middleware.ForwardedProtoKey)
+	if scheme == "" {
+		scheme = "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+	}
+	c.JSON(http.StatusOK, OpenAPISpec(scheme+"://"+c.Request.Host+requestBasePath(c.Request)))
+}
+
+// undocumentedRoutes lists the registered routes missing from apiOperations
+func undocumentedRoutes(routes gin.RoutesInfo) []string {
+	documented := make(map[string]bool, len(apiOperations))
+	for _, op := range apiOperations {
+		documented[op.method+" "+op.path] = true
+	}
+	var missing []string
+	for _, route := range routes {
+		if !documented[route.Method+" "+route.Path] {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
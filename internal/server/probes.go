@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultReadinessWindow = 5 * time.Minute
+
+// livez is the liveness probe: the process is up and serving HTTP. It never
+// checks the upstreams, so a broken upstream does not get the process restarted.
+func (s *Server) livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz is the readiness probe. It fails once shutdown has begun, so load
+// balancers stop routing to the instance while requests drain, while no
+// upstream API key is configured and clients do not bring their own, and, depending on the readiness setting,
+// while the upstreams have not been reachable within the readiness window.
+// A server whose first upstream probe has not finished reports "starting".
+func (s *Server) readyz(c *gin.Context) {
+	if s.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	inst := s.live.Load()
+	cfg := inst.config
+	if cfg.OpenAIAPIKey == "" && len(cfg.APIKeys) == 0 && !cfg.ForwardClientKey {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "not_ready",
+			"reason": "No upstream API key is configured",
+		})
+		return
+	}
+
+	mode := strings.ToLower(cfg.Readiness)
+	if mode == "config" {
+		c.JSON(http.StatusOK, gin.H{"status": services.ReadinessReady})
+		return
+	}
+	window := defaultReadinessWindow
+	if cfg.ReadinessWindowMinutes > 0 {
+		window = time.Duration(cfg.ReadinessWindowMinutes) * time.Minute
+	}
+
+	readiness, unreachable := inst.healthMonitor.Readiness(window, mode == "all")
+	switch readiness {
+	case services.ReadinessReady:
+		body := gin.H{"status": readiness}
+		if len(unreachable) > 0 {
+			body["unreachable"] = unreachable
+		}
+		c.JSON(http.StatusOK, body)
+	case services.ReadinessStarting:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": readiness})
+	default:
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":      "not_ready",
+			"reason":      fmt.Sprintf("Upstreams not reachable within the last %d minutes", int(window.Minutes())),
+			"unreachable": unreachable,
+		})
+	}
+}
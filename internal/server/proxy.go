@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// basePathKey is the context key of the base path a request was received under
+type basePathKey struct{}
+
+// withoutBasePath removes the base path from the URL of a request, so the
+// routes serve requests under the prefix a reverse proxy forwards them
+// with. Requests outside the prefix are left unchanged.
+func withoutBasePath(r *http.Request, prefix string) *http.Request {
+	if prefix == "" {
+		return r
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok || rest != "" && !strings.HasPrefix(rest, "/") {
+		return r
+	}
+	if rest == "" {
+		rest = "/"
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), basePathKey{}, prefix))
+	u := *r.URL
+	u.Path = rest
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+	}
+	r.URL = &u
+	return r
+}
+
+// requestBasePath returns the base path a request was received under
+func requestBasePath(r *http.Request) string {
+	prefix, _ := r.Context().Value(basePathKey{}).(string)
+	return prefix
+}
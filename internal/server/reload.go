@@ -0,0 +1,209 @@
+package server
+
+import (
+	"os"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configPollInterval is how often watched files are checked for changes
+const configPollInterval = 2 * time.Second
+
+// Reload rebuilds all services from a new configuration and swaps them in
+// atomically. Requests in flight finish on the previous services. Host, port
+// and the storage backend cannot change without a restart.
+func (s *Server) Reload(cfg *config.Config) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.reload(cfg)
+}
+
+// update applies a change to a copy of the live configuration and reloads it,
+// returning the new configuration
+func (s *Server) update(apply func(cfg *config.Config)) *config.Config {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg := *s.live.Load().config
+	apply(&cfg)
+	s.reload(&cfg)
+	return &cfg
+}
+
+// reload swaps in a new instance; the caller must hold reloadMu
+func (s *Server) reload(cfg *config.Config) {
+	if cfg.Host != s.config.Host || cfg.Port != s.config.Port {
+		s.logger.WithFields(logrus.Fields{
+			"host": cfg.Host,
+			"port": cfg.Port,
+		}).Warn("Listen address changed, restart the service to apply it")
+	}
+	if cfg.StorageBackend != s.config.StorageBackend || cfg.StorageDSN != s.config.StorageDSN {
+		s.logger.Warn("Storage backend changed, restart the service to apply it")
+	}
+
+	s.logger.SetLevel(parseLogLevel(cfg.LogLevel))
+
+	next := s.newInstance(cfg)
+	next.healthMonitor.Start()
+	next.usageReporter.Start()
+	previous := s.live.Swap(next)
+	previous.healthMonitor.Stop()
+	previous.usageReporter.Stop()
+
+	s.logger.WithFields(logrus.Fields{
+		"big_model":   cfg.BigModelName,
+		"small_model": cfg.SmallModelName,
+	}).Info("Configuration reloaded")
+}
+
+// fileWatch tracks the modification time of a watched file. A change is only
+// reported once the file has stopped changing for a poll interval, so files
+// that are still being written (a binary being built) are not picked up early.
+type fileWatch struct {
+	path    string
+	applied time.Time // Modification time last acted upon
+	seen    time.Time // Modification time seen at the previous poll
+}
+
+// newFileWatch starts watching a file from its current state
+func newFileWatch(path string) *fileWatch {
+	mod := modTime(path)
+	return &fileWatch{path: path, applied: mod, seen: mod}
+}
+
+// changed reports whether the file changed and has since settled
+func (w *fileWatch) changed() bool {
+	mod := modTime(w.path)
+	settled := mod.Equal(w.seen)
+	w.seen = mod
+	if !settled || mod.Equal(w.applied) {
+		return false
+	}
+	w.applied = mod
+	return true
+}
+
+// watchFiles polls config.json and models.yaml and reloads the configuration
+// whenever one of them changes. A change that fails to parse or to validate
+// is rejected and the last good configuration stays live, so a half-saved
+// edit never takes the service down; /status reports the rejection until the
+// file loads again. In dev mode (dev_mode) the transform script is watched as
+// well, and a rebuilt server binary restarts the server. The returned
+// function stops watching.
+func (s *Server) watchFiles() func() {
+	configFile := newFileWatch(config.Path())
+	modelsFile := newFileWatch(config.ModelsPath())
+	binary := newFileWatch(s.execPath)
+	var script *fileWatch
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			if configFile.changed() {
+				cfg, err := config.LoadFile()
+				if err != nil {
+					s.reject(configFile.path, err)
+				} else {
+					s.rejected.Delete(configFile.path)
+					s.logger.WithField("path", configFile.path).Info("Config file changed, reloading")
+					s.Reload(cfg)
+				}
+			}
+
+			if modelsFile.changed() {
+				registry, err := config.LoadModels()
+				if err != nil {
+					s.reject(modelsFile.path, err)
+				} else {
+					s.rejected.Delete(modelsFile.path)
+					s.logger.WithField("path", modelsFile.path).Info("Models file changed, reloading")
+					s.update(func(cfg *config.Config) { cfg.Models = registry })
+				}
+			}
+
+			live := s.live.Load().config
+			if !live.DevMode {
+				continue
+			}
+
+			// Follow the script named by the live configuration
+			if live.TransformScript == "" {
+				script = nil
+			} else if script == nil || script.path != live.TransformScript {
+				script = newFileWatch(live.TransformScript)
+			} else if script.changed() {
+				if err := services.CheckTransformScript(script.path); err != nil {
+					s.reject(script.path, err)
+				} else {
+					s.rejected.Delete(script.path)
+					s.logger.WithField("path", script.path).Info("Transform script changed, reloading")
+					s.update(func(*config.Config) {})
+				}
+			}
+
+			if s.execPath != "" && binary.changed() {
+				select {
+				case s.restart <- struct{}{}:
+				default:
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// reject records a change of a watched file that failed to load, keeping the
+// live configuration
+func (s *Server) reject(path string, err error) {
+	s.rejected.Store(path, err)
+	s.logger.WithError(err).WithField("path", path).Warn("Ignoring file change, failed to load it")
+}
+
+// rejectedChanges returns the error of each watched file whose last change
+// was rejected, by path
+func (s *Server) rejectedChanges() map[string]string {
+	rejected := make(map[string]string)
+	s.rejected.Range(func(path, err any) bool {
+		rejected[path.(string)] = err.(error).Error()
+		return true
+	})
+	return rejected
+}
+
+// modTime returns the modification time of a file, or the zero time if it is missing
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// parseLogLevel parses a log level, defaulting to info
+func parseLogLevel(value string) logrus.Level {
+	level, err := logrus.ParseLevel(value)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
@@ -0,0 +1,130 @@
+//go:build !windows
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Environment variables telling a successor process which inherited file
+// descriptors hold the listener and the readiness pipe
+const (
+	listenFDEnv = "CLAUDEPROXY_LISTEN_FD"
+	readyFDEnv  = "CLAUDEPROXY_READY_FD"
+)
+
+// successorTimeout is how long a successor may take to start serving
+const successorTimeout = 15 * time.Second
+
+// handoffSignals ask the server to hand its listener to a fresh process
+var handoffSignals = []os.Signal{syscall.SIGUSR2}
+
+// restartProcess replaces the current process with a fresh copy of the
+// server binary. The process ID is kept, so the instance file stays valid.
+func restartProcess(execPath string) error {
+	return syscall.Exec(execPath, os.Args, os.Environ())
+}
+
+// listen returns the listener inherited from the previous server process
+// when there is one on the configured port, or binds a new one
+func listen(addr string) (net.Listener, error) {
+	if fd, err := strconv.Atoi(os.Getenv(listenFDEnv)); err == nil {
+		os.Unsetenv(listenFDEnv)
+		file := os.NewFile(uintptr(fd), "listener")
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err == nil {
+			if sameAddr(ln.Addr(), addr) {
+				return ln, nil
+			}
+			// The address changed, the previous process closes the old one while draining
+			ln.Close()
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// sameAddr reports whether a listener is bound to the configured address
+func sameAddr(bound net.Addr, addr string) bool {
+	tcpAddr, ok := bound.(*net.TCPAddr)
+	host, port, err := net.SplitHostPort(addr)
+	if !ok || err != nil || strconv.Itoa(tcpAddr.Port) != port {
+		return false
+	}
+	if host == "" {
+		return tcpAddr.IP.IsUnspecified()
+	}
+	ip := net.ParseIP(host)
+	// Host names are not resolved again, only the port is compared
+	return ip == nil || ip.Equal(tcpAddr.IP)
+}
+
+// notifyReady tells the previous server process that this one is serving
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(readyFDEnv))
+	if err != nil {
+		return
+	}
+	os.Unsetenv(readyFDEnv)
+	file := os.NewFile(uintptr(fd), "ready")
+	file.Write([]byte{1})
+	file.Close()
+}
+
+// startSuccessor starts a fresh copy of the server binary that inherits the
+// listener, and waits until it accepts connections. Both processes accept on
+// the same socket in the meantime, so no connection is refused.
+func startSuccessor(execPath string, ln net.Listener) (int, error) {
+	tcpListener, ok := ln.(*net.TCPListener)
+	if !ok {
+		return 0, errors.New("listener cannot be handed over")
+	}
+	listenFile, err := tcpListener.File()
+	if err != nil {
+		return 0, err
+	}
+	defer listenFile.Close()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer readyReader.Close()
+
+	cmd := exec.Command(execPath, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), listenFDEnv+"=3", readyFDEnv+"=4")
+	cmd.ExtraFiles = []*os.File{listenFile, readyWriter}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return 0, err
+	}
+	go cmd.Wait()
+
+	// The pipe is closed without a byte when the successor exits early
+	ready := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 1)
+		n, _ := readyReader.Read(buf)
+		ready <- n == 1
+	}()
+	select {
+	case ok := <-ready:
+		if !ok {
+			return 0, fmt.Errorf("new server process %d exited before serving", cmd.Process.Pid)
+		}
+		return cmd.Process.Pid, nil
+	case <-time.After(successorTimeout):
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new server process %d did not start serving within %s", cmd.Process.Pid, successorTimeout)
+	}
+}
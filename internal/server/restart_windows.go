@@ -0,0 +1,35 @@
+//go:build windows
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+)
+
+// handoffSignals is empty, Windows has no signal to request a handoff
+var handoffSignals []os.Signal
+
+// restartProcess starts a fresh copy of the server binary, since Windows
+// cannot replace a running process in place. The new process inherits the
+// instance token and records itself in the instance file.
+func restartProcess(execPath string) error {
+	cmd := exec.Command(execPath, os.Args[1:]...)
+	cmd.Env = os.Environ()
+	return cmd.Start()
+}
+
+// listen binds the listener; sockets are not inherited on Windows
+func listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// notifyReady does nothing, there is no previous process waiting on Windows
+func notifyReady() {}
+
+// startSuccessor is not supported on Windows, the server restarts instead
+func startSuccessor(execPath string, ln net.Listener) (int, error) {
+	return 0, errors.New("listener handoff is not supported on Windows")
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"claude-code-provider-proxy/internal/buildinfo"
 	"claude-code-provider-proxy/internal/config"
 	"claude-code-provider-proxy/internal/handlers"
 	"claude-code-provider-proxy/internal/middleware"
@@ -20,45 +24,164 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// handoffDrainTimeout bounds how long a process that handed over its
+// listener waits for streams in flight to finish
+const handoffDrainTimeout = 10 * time.Minute
+
 // Server represents the HTTP server
 type Server struct {
-	config     *config.Config
-	logger     *logrus.Logger
-	httpServer *http.Server
-	handler    *handlers.Handler
+	config      *config.Config // Configuration the server was started with
+	logger      *logrus.Logger
+	httpServer  *http.Server
+	idleMonitor *idleMonitor // nil when idle shutdown is disabled
+	execPath    string       // Server binary, resolved at startup before it can be replaced
+	restart     chan struct{}
+	started     time.Time
+	metrics     *services.MetricsService // Kept across reloads
+	quotas      *services.QuotaService   // Kept across reloads
+	shared      *services.SharedState    // Cluster mode, nil when state is local; kept across reloads
+	storage     services.Storage         // Usage records and transcripts; kept across reloads
+
+	// Identity and lifecycle requests of the /admin/instance endpoints
+	instanceToken   string
+	stopRequests    chan struct{}
+	handoffRequests chan chan handoffResult
+
+	// Services and routes built from the live configuration, swapped on reload
+	live     atomic.Pointer[instance]
+	reloadMu sync.Mutex
+	rejected sync.Map // Path of a watched file to the error of its last, rejected change
+
+	draining atomic.Bool // Set once shutdown begins, failing readiness
+}
+
+// instance is the set of services and routes built from one configuration.
+// Requests already in flight keep the instance they started with.
+type instance struct {
+	config        *config.Config
+	handler       *handlers.Handler
+	healthMonitor *services.HealthMonitor
+	dedupCache    *services.DedupCache       // nil when deduplication is disabled
+	transcripts   *services.TranscriptStore  // nil when transcripts are disabled
+	scheduler     *services.RequestScheduler // nil when concurrency is unlimited
+	usageReporter *services.UsageReporter
+	errorReporter *services.ErrorReporter // nil when error reporting is off
+	router        *gin.Engine
 }
 
 // New creates a new server instance
 func New(cfg *config.Config) *Server {
 	// Setup logger
 	logger := logrus.New()
-	level, err := logrus.ParseLevel(cfg.LogLevel)
-	if err != nil {
-		level = logrus.InfoLevel
-	}
-	logger.SetLevel(level)
-	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(parseLogLevel(cfg.LogLevel))
+	logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
 
-	// Setup log file
-	if err := setupLogFile(logger); err != nil {
+	// Setup log file; stateless servers only log to stdout
+	if cfg.Stateless {
+		logger.SetOutput(os.Stdout)
+	} else if err := setupLogFile(logger); err != nil {
 		logger.WithError(err).Warn("Failed to setup log file, using stdout")
 	}
 
 	// Log application startup
 	logger.WithFields(logrus.Fields{
-		"app_name":     cfg.AppName,
-		"app_version":  cfg.AppVersion,
-		"referrer_url": cfg.ReferrerURL,
-		"big_model":    cfg.BigModelName,
-		"small_model":  cfg.SmallModelName,
+		"app_name":      cfg.AppName,
+		"app_version":   cfg.AppVersion,
+		"build_version": buildinfo.Version,
+		"build_commit":  buildinfo.Commit,
+		"referrer_url":  cfg.ReferrerURL,
+		"big_model":     cfg.BigModelName,
+		"small_model":   cfg.SmallModelName,
 	}).Info("Starting application")
 
+	// Warn when other users can read the API key or logged requests
+	var permissionIssues []config.PermissionIssue
+	if !cfg.Stateless {
+		permissionIssues = config.CheckPermissions()
+	}
+	for _, issue := range permissionIssues {
+		logger.WithFields(logrus.Fields{
+			"path": issue.Path,
+			"mode": fmt.Sprintf("%04o", issue.Mode),
+		}).Warn("Config path is accessible by other users, run 'claudeproxy doctor --fix-perms'")
+	}
+
+	// Set Gin mode based on log level
+	if cfg.LogLevel == "debug" {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to resolve server binary, reload mode cannot restart it")
+	}
+
+	shared, err := services.NewSharedState(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Error("Cluster mode disabled, state is kept per instance")
+	} else if shared != nil {
+		if err := shared.Ping(); err != nil {
+			logger.WithError(err).Warn("Redis is unreachable, using local state until it is back")
+		} else {
+			logger.Info("Cluster mode enabled, sharing state through Redis")
+		}
+	}
+
+	storage, err := services.OpenStorage(cfg)
+	if err != nil {
+		logger.WithError(err).Error("Failed to open storage backend, using JSONL files in the config directory")
+		storage, _ = services.OpenStorage(&config.Config{})
+	}
+
+	// Idle shutdown is left to the orchestrator in stateless mode
+	var idleMonitor *idleMonitor
+	if !cfg.Stateless {
+		idleMonitor = newIdleMonitor(cfg.IdleShutdownMinutes)
+	}
+
+	s := &Server{
+		config:      cfg,
+		logger:      logger,
+		idleMonitor: idleMonitor,
+		execPath:    execPath,
+		restart:     make(chan struct{}, 1),
+		started:     time.Now().UTC(),
+		metrics:     services.NewMetricsService(),
+		quotas:      services.NewQuotaService(shared, storage),
+		shared:      shared,
+		storage:     storage,
+
+		instanceToken:   instanceToken(),
+		stopRequests:    make(chan struct{}, 1),
+		handoffRequests: make(chan chan handoffResult),
+	}
+	s.live.Store(s.newInstance(cfg))
+	return s
+}
+
+// newInstance creates the services, handler and router for a configuration
+func (s *Server) newInstance(cfg *config.Config) *instance {
+	logger := s.logger
+
 	// Create services
-	openAIClient := services.NewOpenAIClient(cfg, logger)
+	openAIClient := services.NewOpenAIClient(cfg, logger, s.shared, s.metrics)
 	modelSelector := services.NewModelSelectorService(cfg, logger)
-	conversionService := services.NewConversionService(modelSelector, cfg, logger)
-	tokenService := services.NewTokenCountingService()
-	streamingService := services.NewStreamingService(conversionService, logger)
+	conversionService := services.NewConversionService(modelSelector, cfg, logger, s.metrics)
+	tokenService := services.NewTokenCountingService(cfg)
+	streamingService := services.NewStreamingService(conversionService, cfg, logger)
+	hookService := services.NewHookService(cfg, logger)
+	scriptService := services.NewScriptService(cfg, logger)
+	truncationService := services.NewTruncationService(cfg, logger, tokenService)
+	visionService := services.NewVisionService(cfg, logger)
+	proxyToolService := services.NewProxyToolService(cfg, logger)
+	usageLedger := services.NewUsageLedger(cfg, logger, tokenService, s.storage)
+	pricingService := services.NewPricingService(cfg, logger, openAIClient)
+	compactionService := services.NewCompactionService(cfg, logger, openAIClient, tokenService, pricingService)
+	healthMonitor := services.NewHealthMonitor(cfg, logger, openAIClient)
+	mirrorService := services.NewMirrorService(cfg, logger, openAIClient, conversionService, pricingService, s.storage)
+	errorReporter := services.NewErrorReporter(cfg, logger, openAIClient, streamingService, buildinfo.ReportingDSN(cfg), buildinfo.Version)
 
 	// Create handler
 	handler := handlers.NewHandler(
@@ -69,36 +192,60 @@ func New(cfg *config.Config) *Server {
 		tokenService,
 		streamingService,
 		modelSelector,
+		hookService,
+		scriptService,
+		truncationService,
+		compactionService,
+		visionService,
+		proxyToolService,
+		usageLedger,
+		pricingService,
+		healthMonitor,
+		mirrorService,
+		s.metrics,
+		s.rejectedChanges,
 	)
 
-	return &Server{
-		config:  cfg,
-		logger:  logger,
-		handler: handler,
+	inst := &instance{
+		config:        cfg,
+		handler:       handler,
+		healthMonitor: healthMonitor,
+		dedupCache:    services.NewDedupCache(cfg, s.shared),
+		transcripts:   services.NewTranscriptStore(cfg, logger, s.storage),
+		scheduler:     services.NewRequestScheduler(cfg),
+		usageReporter: services.NewUsageReporter(cfg, logger, s.storage),
+		errorReporter: errorReporter,
 	}
+	inst.router = s.setupRouter(inst)
+	return inst
 }
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	// Set Gin mode based on log level
-	if s.config.LogLevel == "debug" {
-		gin.SetMode(gin.DebugMode)
-	} else {
-		gin.SetMode(gin.ReleaseMode)
-	}
-
-	// Create Gin router
-	router := s.setupRouter()
-
-	// Create HTTP server
+	// Create HTTP server; requests are routed through the live instance
 	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf("%s:%s", s.config.Host, s.config.Port),
-		Handler:      router,
+		Addr: fmt.Sprintf("%s:%s", s.config.Host, s.config.Port),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inst := s.live.Load()
+			inst.router.ServeHTTP(w, withoutBasePath(r, inst.config.URLPrefix()))
+		}),
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// Bind before serving so a previous process handing over its listener
+	// only stops once this one accepts connections
+	ln, err := listen(s.httpServer.Addr)
+	if err != nil {
+		s.logger.WithError(err).Fatal("Failed to start server")
+	}
+	if !s.config.Stateless {
+		if err := s.writeInstanceFile(); err != nil {
+			s.logger.WithError(err).Warn("Failed to write instance file, the CLI cannot manage this server")
+		}
+	}
+
 	// Start server in a goroutine
 	go func() {
 		s.logger.WithFields(logrus.Fields{
@@ -106,47 +253,118 @@ func (s *Server) Start() error {
 			"port": s.config.Port,
 		}).Info("Starting HTTP server")
 
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
 			s.logger.WithError(err).Fatal("Failed to start server")
 		}
 	}()
+	notifyReady()
+
+	// Probe upstream health in the background
+	s.live.Load().healthMonitor.Start()
+	s.live.Load().usageReporter.Start()
+
+	// Reload the configuration whenever config.json or models.yaml changes
+	stopWatching := func() {}
+	if !s.config.Stateless {
+		stopWatching = s.watchFiles()
+	}
 
 	// Wait for interrupt signal to gracefully shutdown
-	s.waitForShutdown()
+	restart := s.waitForShutdown(ln)
+	stopWatching()
+	s.live.Load().healthMonitor.Stop()
+	s.live.Load().usageReporter.Stop()
 
+	if restart {
+		return restartProcess(s.execPath)
+	}
+	if !s.config.Stateless {
+		s.removeInstanceFile()
+	}
 	return nil
 }
 
 // setupRouter configures the Gin router with all routes and middleware
-func (s *Server) setupRouter() *gin.Engine {
+func (s *Server) setupRouter(inst *instance) *gin.Engine {
 	router := gin.New()
+	cfg, handler := inst.config, inst.handler
+
+	// Client addresses are only taken from forwarded headers of trusted proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		s.logger.WithError(err).Warn("Invalid trusted_proxies, forwarded headers are ignored")
+		router.SetTrustedProxies(nil)
+	}
 
 	// Global middleware
-	router.Use(middleware.ErrorHandlingMiddleware(s.logger))
+	router.Use(middleware.ForwardedMiddleware(cfg))
+	router.Use(middleware.LocaleMiddleware(cfg))
+	router.Use(middleware.ErrorHandlingMiddleware(s.logger, inst.errorReporter))
 	router.Use(middleware.LoggingMiddleware(s.logger))
-	router.Use(middleware.CORSMiddleware(s.config))
+	router.Use(middleware.CORSMiddleware(cfg))
 	router.Use(middleware.SecurityHeadersMiddleware())
 	router.Use(middleware.RequestIDMiddleware())
-	router.Use(middleware.ReferrerMiddleware(s.config))
+	router.Use(middleware.ReferrerMiddleware(cfg))
 
 	// Health check endpoint (no auth required)
-	router.GET("/", s.handler.HealthCheck)
-	router.GET("/health", s.handler.HealthCheck)
-	router.GET("/status", s.handler.GetStatus)
+	router.GET("/", handler.HealthCheck)
+	router.GET("/health", handler.HealthCheck)
+	router.GET("/status", handler.GetStatus)
+	router.GET("/version", handler.GetVersion)
+	router.GET("/openapi.json", s.getOpenAPI)
+	router.GET("/livez", s.livez)
+	router.GET("/healthz", s.livez)
+	router.GET("/readyz", s.readyz)
 
 	// API routes with authentication
 	v1 := router.Group("/v1")
-	v1.Use(middleware.AuthMiddleware(s.config))
+	if s.idleMonitor != nil {
+		v1.Use(s.idleMonitor.middleware())
+	}
+	v1.Use(middleware.MetricsMiddleware(s.metrics))
+	v1.Use(middleware.AuthMiddleware(cfg, s.quotas))
 	v1.Use(middleware.ContentTypeMiddleware())
 	v1.Use(middleware.AnthropicVersionMiddleware())
 	{
 		// Anthropic-compatible endpoints
-		v1.POST("/messages", s.handler.CreateMessage)
-		v1.POST("/messages/count_tokens", s.handler.CountTokens)
+		v1.POST("/messages",
+			middleware.DedupMiddleware(inst.dedupCache, s.logger),
+			middleware.TranscriptMiddleware(inst.transcripts),
+			middleware.SchedulerMiddleware(inst.scheduler, s.logger),
+			handler.CreateMessage)
+		v1.POST("/messages/count_tokens", handler.CountTokens)
+
+		// OpenAI-compatible passthrough
+		v1.POST("/chat/completions", middleware.SchedulerMiddleware(inst.scheduler, s.logger), handler.ChatCompletions)
 
 		// Additional utility endpoints
-		v1.GET("/models", s.handler.GetModels)
-		v1.POST("/validate", s.handler.ValidateAPIKey)
+		v1.GET("/models", handler.GetModels)
+		v1.GET("/tools", handler.GetTools)
+		v1.POST("/validate", handler.ValidateAPIKey)
+	}
+
+	// Admin API for changing the running service
+	admin := router.Group("/admin")
+	admin.Use(middleware.AdminAuthMiddleware(cfg))
+	{
+		admin.PUT("/models", s.updateModels)
+		admin.GET("/stats", s.getStats)
+		admin.GET("/usage", s.getUsage)
+		admin.GET("/logs/stream", s.streamLogs)
+		admin.GET("/tap/:id", s.tapRequest)
+		admin.GET("/instance", s.requireInstanceToken, s.getInstance)
+		admin.POST("/instance/stop", s.requireInstanceToken, s.stopInstance)
+		admin.POST("/instance/handoff", s.requireInstanceToken, s.handOffInstance)
+	}
+
+	// The admin API over the Connect protocol, for generated clients
+	connect := router.Group(connectServicePath)
+	connect.Use(connectAuth(cfg))
+	for name, method := range s.connectMethods() {
+		connect.POST("/"+name, serveConnect(method))
+	}
+
+	if missing := undocumentedRoutes(router.Routes()); len(missing) > 0 {
+		s.logger.WithField("routes", missing).Warn("Routes missing from the OpenAPI document")
 	}
 
 	// Add custom 404 handler
@@ -172,16 +390,64 @@ func (s *Server) setupRouter() *gin.Engine {
 	return router
 }
 
-// waitForShutdown waits for interrupt signal and gracefully shuts down the server
-func (s *Server) waitForShutdown() {
+// waitForShutdown waits for an interrupt signal or stop request, the idle
+// timeout when enabled, a handoff signal or request, or a restart request in
+// reload mode, and gracefully shuts down the server. It reports whether the server should
+// start again.
+func (s *Server) waitForShutdown(ln net.Listener) bool {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	handoff := make(chan os.Signal, 1)
+	if len(handoffSignals) > 0 {
+		signal.Notify(handoff, handoffSignals...)
+	}
+
+	var idle <-chan struct{}
+	if s.idleMonitor != nil {
+		idle = s.idleMonitor.idle()
+	}
+
+	restart := false
+	drainTimeout := 30 * time.Second
+wait:
+	for {
+		select {
+		case <-quit:
+		case <-s.stopRequests:
+			s.logger.Info("Stop requested through the admin API")
+		case <-handoff:
+			if _, err := s.handOff(ln); err != nil {
+				continue
+			}
+			drainTimeout = handoffDrainTimeout
+		case reply := <-s.handoffRequests:
+			pid, err := s.handOff(ln)
+			reply <- handoffResult{pid: pid, err: err}
+			if err != nil {
+				continue
+			}
+			drainTimeout = handoffDrainTimeout
+		case <-s.restart:
+			s.logger.WithField("binary", s.execPath).Info("Server binary changed, restarting")
+			if _, err := s.handOff(ln); err == nil {
+				drainTimeout = handoffDrainTimeout
+			} else {
+				restart = true
+			}
+		case <-idle:
+			s.logger.WithField("idle_minutes", s.config.IdleShutdownMinutes).Info("No API requests within the idle timeout")
+			if err := writeIdleMarker(); err != nil {
+				s.logger.WithError(err).Warn("Failed to write idle shutdown marker")
+			}
+		}
+		break wait
+	}
 
 	s.logger.Info("Shutting down server...")
+	s.draining.Store(true)
 
 	// Create a deadline for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer cancel()
 
 	// Attempt graceful shutdown
@@ -190,6 +456,21 @@ func (s *Server) waitForShutdown() {
 	} else {
 		s.logger.Info("Server shutdown complete")
 	}
+	return restart
+}
+
+// handOff starts a new server process on the same listener, so a restart
+// neither refuses connections nor interrupts streams: this process stops
+// accepting and finishes the requests in flight. It returns the process ID
+// of the new process once it took over; on error this one keeps serving.
+func (s *Server) handOff(ln net.Listener) (int, error) {
+	pid, err := startSuccessor(s.execPath, ln)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to hand over to a new server process")
+		return 0, err
+	}
+	s.logger.WithField("pid", pid).Info("New server process is serving, draining this one")
+	return pid, nil
 }
 
 // Stop stops the server gracefully
@@ -204,21 +485,14 @@ func (s *Server) Stop() error {
 
 // setupLogFile configures the logger to write to a file
 func setupLogFile(logger *logrus.Logger) error {
-	// Get home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-
 	// Create log directory
-	logDir := filepath.Join(homeDir, ".claudeproxy", "logs")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
+	logFile := logFilePath()
+	if err := os.MkdirAll(filepath.Dir(logFile), config.PrivateDirMode); err != nil {
 		return err
 	}
 
 	// Create log file
-	logFile := filepath.Join(logDir, "service.log")
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, config.PrivateFileMode)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tapRequest streams the response of a request in flight to an observer,
+// byte for byte as the client receives it, until the request ends. The
+// observer only reads a copy, the client's connection is not touched.
+func (s *Server) tapRequest(c *gin.Context) {
+	id := c.Param("id")
+	tap, ok := s.metrics.Tap(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: models.NewNotFoundError("No request in flight with ID " + id),
+		})
+		return
+	}
+	defer tap.Close()
+
+	// The stream outlives the server write timeout
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	// The bytes are relayed as they were written: an SSE stream for
+	// streaming requests, a JSON body otherwise
+	contentType := "text/plain; charset=utf-8"
+	if tap.Stream {
+		contentType = "text/event-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case chunk, ok := <-tap.C:
+			if !ok {
+				return
+			}
+			if _, err := c.Writer.Write(chunk); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"strings"
+
+	"claude-code-provider-proxy/internal/models"
+)
+
+// normalizeAlternation rewrites converted messages for upstreams that reject
+// consecutive messages of the same role. Splitting Anthropic messages into
+// text, tool_calls and tool results produces such sequences:
+//   - consecutive user or assistant messages are merged into one
+//   - user text that follows tool results is folded into the last tool result
+//
+// Consecutive tool messages answer separate tool calls and are kept as is.
+func normalizeAlternation(messages []models.OpenAIMessage) []models.OpenAIMessage {
+	normalized := make([]models.OpenAIMessage, 0, len(messages))
+	for _, msg := range messages {
+		if len(normalized) == 0 {
+			normalized = append(normalized, msg)
+			continue
+		}
+
+		last := &normalized[len(normalized)-1]
+		switch {
+		case msg.Role == last.Role && (msg.Role == "user" || msg.Role == "assistant"):
+			last.Content = mergeMessageContent(last.Content, msg.Content)
+			last.ToolCalls = append(last.ToolCalls, msg.ToolCalls...)
+			if msg.CacheControl != nil {
+				last.CacheControl = msg.CacheControl
+			}
+		case msg.Role == "user" && last.Role == "tool":
+			text, ok := messageText(msg.Content)
+			if !ok {
+				// Images cannot be carried by a tool result
+				normalized = append(normalized, msg)
+				continue
+			}
+			last.Content = mergeMessageContent(last.Content, text)
+		default:
+			normalized = append(normalized, msg)
+		}
+	}
+	return normalized
+}
+
+// mergeMessageContent joins the content of two messages. Plain text stays a
+// string; otherwise the result is a list of content parts.
+func mergeMessageContent(a, b interface{}) interface{} {
+	textA, okA := messageText(a)
+	textB, okB := messageText(b)
+	if okA && okB {
+		switch {
+		case textA == "":
+			return textB
+		case textB == "":
+			return textA
+		}
+		return textA + "\n\n" + textB
+	}
+	return append(contentParts(a), contentParts(b)...)
+}
+
+// messageText returns the content as plain text when it contains nothing but text
+func messageText(content interface{}) (string, bool) {
+	switch c := content.(type) {
+	case nil:
+		return "", true
+	case string:
+		return c, true
+	case []interface{}:
+		var texts []string
+		for _, part := range c {
+			partMap, ok := part.(map[string]interface{})
+			if !ok || partMap["type"] != "text" || partMap["cache_control"] != nil {
+				return "", false
+			}
+			text, _ := partMap["text"].(string)
+			texts = append(texts, text)
+		}
+		return strings.Join(texts, "\n"), true
+	}
+	return "", false
+}
+
+// contentParts returns the content as a list of content parts
+func contentParts(content interface{}) []interface{} {
+	switch c := content.(type) {
+	case nil:
+		return nil
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"type": "text", "text": c}}
+	case []interface{}:
+		return c
+	case []models.OpenAIContentPart:
+		parts := make([]interface{}, len(c))
+		for i, part := range c {
+			parts[i] = part
+		}
+		return parts
+	}
+	return []interface{}{content}
+}
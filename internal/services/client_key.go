@@ -0,0 +1,38 @@
+package services
+
+import "context"
+
+// clientKeyKey is the context key of the upstream API key of a client
+type clientKeyKey struct{}
+
+// WithClientKey attaches the upstream API key of the client to the context:
+// the key it sent with forward_client_key set, or the upstream_key of its
+// local API key. Requests carrying one are sent to the primary upstream with
+// that key instead of the configured keys.
+func WithClientKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, clientKeyKey{}, key)
+}
+
+// clientKey returns the upstream API key of the client, if any
+func clientKey(ctx context.Context) string {
+	key, _ := ctx.Value(clientKeyKey{}).(string)
+	return key
+}
+
+// clientUpstream returns the primary upstream with the key of the client.
+// Models mapped to an upstream of their own keep its credentials, so a
+// client's key is never sent to another provider.
+func (c *OpenAIClient) clientUpstream(ctx context.Context, model string) (upstream, bool) {
+	key := clientKey(ctx)
+	if key == "" {
+		return upstream{}, false
+	}
+	if mapped, ok := c.config.Upstreams[model]; ok && mapped.BaseURL != "" {
+		return upstream{}, false
+	}
+	return upstream{
+		name:    "primary",
+		baseURL: c.config.OpenAIBaseURL,
+		apiKey:  key,
+	}, true
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCompactionKeepMessages  = 6
+	defaultCompactionSummaryTokens = 1024
+	compactionBlockLimit           = 2000 // Maximum characters kept per block in the transcript
+	maxCachedSummaries             = 256  // Summaries kept for reuse by later requests
+
+	// compactionUsageContextKey stores the usage of the summary call of the
+	// current request in the gin context
+	compactionUsageContextKey = "compaction_usage"
+)
+
+const compactionSystemPrompt = `You compress the earlier part of a conversation between a user and a coding assistant.
+Write a concise summary that preserves: the user's goals and constraints, decisions made,
+files and identifiers mentioned, tool calls that were made and their important results,
+and any open questions. Do not add commentary. Respond with the summary only.`
+
+// CompactionService summarizes older conversation turns with the small model
+// when a request grows past the configured token threshold
+type CompactionService struct {
+	config         *config.Config
+	logger         *logrus.Logger
+	openAIClient   *OpenAIClient
+	tokenService   *TokenCountingService
+	pricingService *PricingService
+
+	// Summaries by session and hash of the summarized messages, so each turn
+	// of a long session does not summarize the same history again
+	mu        sync.Mutex
+	summaries map[string]string
+	order     []string // Keys of summaries, oldest first
+}
+
+// compactionUsage is the usage of the summary call made for a request
+type compactionUsage struct {
+	inputTokens, outputTokens int
+	cost                      float64
+	priced                    bool
+}
+
+// NewCompactionService creates a new compaction service
+func NewCompactionService(cfg *config.Config, logger *logrus.Logger, openAIClient *OpenAIClient, tokenService *TokenCountingService, pricingService *PricingService) *CompactionService {
+	return &CompactionService{
+		config:         cfg,
+		logger:         logger,
+		openAIClient:   openAIClient,
+		tokenService:   tokenService,
+		pricingService: pricingService,
+		summaries:      make(map[string]string),
+	}
+}
+
+// Apply replaces older turns of the request with a summary block when the
+// estimated input tokens exceed the threshold. It returns a warning describing
+// the compaction, or an empty string when nothing was changed. Failures to
+// summarize are logged and the request is forwarded unchanged. The usage of
+// the summary call counts toward the usage and quota of the request.
+func (s *CompactionService) Apply(c *gin.Context, req *models.AnthropicRequest) string {
+	if s.config.CompactionThreshold <= 0 {
+		return ""
+	}
+
+	tokenResp, err := s.tokenService.CountTokens(&models.TokenCountRequest{
+		Model:      req.Model,
+		Messages:   req.Messages,
+		System:     req.System,
+		Tools:      req.Tools,
+		ToolChoice: req.ToolChoice,
+	})
+	if err != nil || tokenResp.InputTokens <= s.config.CompactionThreshold {
+		return ""
+	}
+
+	keep := s.config.CompactionKeepMessages
+	if keep <= 0 {
+		keep = defaultCompactionKeepMessages
+	}
+
+	// Split on turn boundaries so tool_use/tool_result pairs stay together
+	groups := groupMessageTurns(req.Messages)
+	split := len(groups)
+	kept := 0
+	for split > 0 && kept < keep {
+		split--
+		kept += len(groups[split])
+	}
+	if split == 0 {
+		return ""
+	}
+
+	older := flattenMessageTurns(groups[:split])
+	recent := flattenMessageTurns(groups[split:])
+
+	ctx := c.Request.Context()
+	key := summaryKey(sessionFrom(ctx), older)
+	summary, cached := s.cachedSummary(key)
+	if !cached {
+		var usage models.OpenAIUsage
+		summary, usage, err = s.summarize(ctx, older)
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"error":    err.Error(),
+				"messages": len(older),
+			}).Warn("Conversation compaction failed, forwarding request unchanged")
+			return ""
+		}
+		s.storeSummary(key, summary)
+		s.recordUsage(c, usage)
+	}
+
+	req.Messages = prependSummary(recent, summary)
+
+	s.logger.WithFields(logrus.Fields{
+		"model":              req.Model,
+		"summarized_count":   len(older),
+		"kept_messages":      len(recent),
+		"estimated_tokens":   tokenResp.InputTokens,
+		"compaction_trigger": s.config.CompactionThreshold,
+		"cached":             cached,
+	}).Info("Conversation compacted with small model")
+
+	return fmt.Sprintf("summarized %d earlier message(s) with %s", len(older), s.config.SmallModelName)
+}
+
+// summaryKey identifies the summary of messages within a session
+func summaryKey(session string, messages []models.AnthropicMessage) string {
+	data, _ := json.Marshal(messages)
+	sum := sha256.Sum256(data)
+	return session + "/" + hex.EncodeToString(sum[:])
+}
+
+// cachedSummary returns the summary stored under key, if any
+func (s *CompactionService) cachedSummary(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary, ok := s.summaries[key]
+	return summary, ok
+}
+
+// storeSummary keeps a summary, dropping the oldest once the cache is full
+func (s *CompactionService) storeSummary(key, summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.summaries[key]; ok {
+		return
+	}
+	if len(s.order) >= maxCachedSummaries {
+		delete(s.summaries, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.summaries[key] = summary
+	s.order = append(s.order, key)
+}
+
+// recordUsage keeps the usage and estimated cost of a summary call for the
+// usage record and quota of the current request
+func (s *CompactionService) recordUsage(c *gin.Context, usage models.OpenAIUsage) {
+	record := compactionUsage{inputTokens: usage.PromptTokens, outputTokens: usage.CompletionTokens}
+	record.cost, record.priced = s.pricingService.chargeTokens(s.config.SmallModelName, record.inputTokens, record.outputTokens)
+	c.Set(compactionUsageContextKey, record)
+}
+
+// summarize asks the small model for a summary of the given messages
+func (s *CompactionService) summarize(ctx context.Context, messages []models.AnthropicMessage) (string, models.OpenAIUsage, error) {
+	maxTokens := s.config.CompactionSummaryTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultCompactionSummaryTokens
+	}
+
+	resp, err := s.openAIClient.CreateChatCompletion(ctx, &models.OpenAIRequest{
+		Model: s.config.SmallModelName,
+		Messages: []models.OpenAIMessage{
+			{Role: "system", Content: compactionSystemPrompt},
+			{Role: "user", Content: renderTranscript(messages)},
+		},
+		MaxTokens: maxTokens,
+		N:         1,
+	})
+	if err != nil {
+		return "", models.OpenAIUsage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return "", resp.Usage, fmt.Errorf("no choices in summary response")
+	}
+
+	summary, _ := resp.Choices[0].Message.Content.(string)
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", resp.Usage, fmt.Errorf("empty summary")
+	}
+
+	return summary, resp.Usage, nil
+}
+
+// renderTranscript renders messages as plain text for summarization
+func renderTranscript(messages []models.AnthropicMessage) string {
+	var sb strings.Builder
+
+	for _, msg := range messages {
+		sb.WriteString(strings.ToUpper(msg.Role))
+		sb.WriteString(":\n")
+
+		switch content := msg.Content.(type) {
+		case string:
+			sb.WriteString(truncateText(content, compactionBlockLimit))
+			sb.WriteString("\n")
+		case []interface{}:
+			for _, item := range content {
+				itemMap, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				switch itemMap["type"] {
+				case "text":
+					text, _ := itemMap["text"].(string)
+					sb.WriteString(truncateText(text, compactionBlockLimit))
+				case "tool_use":
+					input, _ := json.Marshal(itemMap["input"])
+					sb.WriteString(fmt.Sprintf("[tool call %v: %s]", itemMap["name"], truncateText(string(input), compactionBlockLimit)))
+				case "tool_result":
+					result, _ := json.Marshal(itemMap["content"])
+					sb.WriteString(fmt.Sprintf("[tool result: %s]", truncateText(string(result), compactionBlockLimit)))
+				case "image":
+					sb.WriteString("[image]")
+				}
+				sb.WriteString("\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// prependSummary adds the summary block in front of the remaining messages
+func prependSummary(messages []models.AnthropicMessage, summary string) []models.AnthropicMessage {
+	summaryText := "[Summary of the earlier conversation]\n" + summary
+
+	if len(messages) == 0 || messages[0].Role != "user" {
+		return append([]models.AnthropicMessage{{Role: "user", Content: summaryText}}, messages...)
+	}
+
+	first := messages[0]
+	switch content := first.Content.(type) {
+	case string:
+		first.Content = summaryText + "\n\n" + content
+	case []interface{}:
+		block := map[string]interface{}{"type": "text", "text": summaryText}
+		first.Content = append([]interface{}{block}, content...)
+	default:
+		return append([]models.AnthropicMessage{{Role: "user", Content: summaryText}}, messages...)
+	}
+
+	result := make([]models.AnthropicMessage, len(messages))
+	copy(result, messages)
+	result[0] = first
+	return result
+}
+
+// truncateText shortens text to at most limit characters
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+func init() {
+	config.RegisterCheck(checkConfig)
+}
+
+// checkConfig validates the options whose values are defined by the services
+func checkConfig(cfg *config.JSONConfig) error {
+	if cfg.Hedging.BaseURL != "" && cfg.Hedging.APIKey == "" && !SameHost(cfg.Hedging.BaseURL, cfg.BaseURL) {
+		return fmt.Errorf("hedging.base_url 指向其他服务时必须配置 hedging.api_key")
+	}
+
+	if err := checkTruncationStrategy("truncation_strategy", cfg.TruncationStrategy); err != nil {
+		return err
+	}
+	for model, settings := range cfg.ModelSettings {
+		if err := checkTruncationStrategy("model_settings."+model+".truncation_strategy", settings.TruncationStrategy); err != nil {
+			return err
+		}
+	}
+	if err := CheckTransformScript(cfg.TransformScript); err != nil {
+		return fmt.Errorf("transform_script 无法加载: %v", err)
+	}
+	switch cfg.UnknownContentPolicy {
+	case UnknownContentText, UnknownContentDrop, UnknownContentReject:
+	default:
+		return fmt.Errorf("unknown_content_policy 无效: %s (可选 drop、reject)", cfg.UnknownContentPolicy)
+	}
+	switch cfg.ConversionNotesStream {
+	case ConversionNotesHeaderOnly, ConversionNotesComment, ConversionNotesEvent:
+	default:
+		return fmt.Errorf("conversion_notes_stream 无效: %s (可选 comment、event)", cfg.ConversionNotesStream)
+	}
+	for finishReason, stopReason := range cfg.FinishReasonMap {
+		if !IsStopReason(stopReason) {
+			return fmt.Errorf("finish_reason_map.%s 无效: %s (可选 %s)", finishReason, stopReason, strings.Join(StopReasons(), "、"))
+		}
+	}
+
+	switch cfg.UpstreamFormat {
+	case "", UpstreamFormatOpenAI, UpstreamFormatAnthropic:
+	default:
+		return fmt.Errorf("upstream_format 无效: %s (可选 openai、anthropic)", cfg.UpstreamFormat)
+	}
+
+	switch cfg.Transport.HTTPVersion {
+	case "", HTTPVersionAuto, HTTPVersion1, HTTPVersion2:
+	default:
+		return fmt.Errorf("transport.http_version 无效: %s (可选 auto、1.1、2)", cfg.Transport.HTTPVersion)
+	}
+	if cfg.Transport.CACertFile != "" {
+		if _, err := LoadCertPool(cfg.Transport.CACertFile); err != nil {
+			return fmt.Errorf("transport.ca_cert_file 无效: %v", err)
+		}
+	}
+
+	switch cfg.StorageBackend {
+	case "", StorageJSONL:
+	case StoragePostgres:
+		if cfg.StorageDSN == "" {
+			return fmt.Errorf("storage_backend 为 postgres 时必须配置 storage_dsn")
+		}
+	default:
+		return fmt.Errorf("storage_backend 无效: %s (可选 jsonl、postgres)", cfg.StorageBackend)
+	}
+
+	for i, hook := range cfg.Hooks {
+		switch hook.Point {
+		case HookPointPreConversion, HookPointPreUpstream, HookPointPostResponse:
+		default:
+			return fmt.Errorf("hooks.%d.point 无效: %s", i, hook.Point)
+		}
+	}
+
+	if cfg.ErrorReportingDSN != "" {
+		if _, _, err := ParseErrorReportingDSN(cfg.ErrorReportingDSN); err != nil {
+			return fmt.Errorf("error_reporting_dsn 无效: %s (格式为 https://公钥@主机/项目ID)", cfg.ErrorReportingDSN)
+		}
+	}
+	return nil
+}
+
+// checkTruncationStrategy checks a truncation strategy name
+func checkTruncationStrategy(name, value string) error {
+	switch value {
+	case TruncationStrategyNone, "none", TruncationStrategyReject, TruncationStrategyDropOldest:
+		return nil
+	}
+	return fmt.Errorf("%s 无效: %s (可选 none、reject、drop_oldest)", name, value)
+}
@@ -13,36 +13,48 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Policies for request content blocks the conversion does not support
+const (
+	UnknownContentText   = ""       // Send the block as text describing it
+	UnknownContentDrop   = "drop"   // Remove the block
+	UnknownContentReject = "reject" // Fail the request with a validation error
+)
+
 // ConversionService handles conversion between Anthropic and OpenAI formats
 type ConversionService struct {
 	modelSelector *ModelSelectorService
 	config        *config.Config
 	logger        *logrus.Logger
+	metrics       *MetricsService
 }
 
 // NewConversionService creates a new conversion service
-func NewConversionService(modelSelector *ModelSelectorService, cfg *config.Config, logger *logrus.Logger) *ConversionService {
+func NewConversionService(modelSelector *ModelSelectorService, cfg *config.Config, logger *logrus.Logger, metrics *MetricsService) *ConversionService {
 	return &ConversionService{
 		modelSelector: modelSelector,
 		config:        cfg,
 		logger:        logger,
+		metrics:       metrics,
 	}
 }
 
 // isClaudeModel checks if cache control should be enabled for the target model
 func (s *ConversionService) isClaudeModel(targetModelName string) bool {
-	return s.config.OpenClaudeCache && strings.Contains(strings.ToLower(targetModelName), "claude")
+	return s.config.CachesPrompts(targetModelName)
 }
 
-// ConvertAnthropicToOpenAI converts an Anthropic request to OpenAI format
-func (s *ConversionService) ConvertAnthropicToOpenAI(req *models.AnthropicRequest, fallbackModel string) (*models.OpenAIRequest, error) {
+// ConvertAnthropicToOpenAI converts an Anthropic request to OpenAI format.
+// Log entries of the conversion carry the request ID.
+func (s *ConversionService) ConvertAnthropicToOpenAI(req *models.AnthropicRequest, fallbackModel, requestID string) (*models.OpenAIRequest, error) {
+	log := s.logger.WithField("request_id", requestID)
+
 	// Debug log: original Anthropic request
 	if reqBytes, err := json.MarshalIndent(req, "", "  "); err == nil {
-		s.logger.WithFields(logrus.Fields{
+		log.WithFields(logrus.Fields{
 			"original_request": string(reqBytes),
 		}).Debug("Original Anthropic request")
 	} else {
-		s.logger.WithFields(logrus.Fields{
+		log.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to marshal original request")
 	}
@@ -53,18 +65,30 @@ func (s *ConversionService) ConvertAnthropicToOpenAI(req *models.AnthropicReques
 		selectedModel = s.modelSelector.SelectModel(req.Model, req)
 	}
 
-	s.logger.WithFields(logrus.Fields{
+	log.WithFields(logrus.Fields{
 		"selected_model": selectedModel,
 		"original_model": req.Model,
 		"fallback_model": fallbackModel,
 	}).Debug("Model selection completed")
 
 	openAIReq := &models.OpenAIRequest{
-		Model:       selectedModel,
-		MaxTokens:   req.MaxTokens, // Use the max_tokens from the original request
-		Temperature: req.Temperature,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
+		Model:            selectedModel,
+		MaxTokens:        req.MaxTokens, // Use the max_tokens from the original request
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Stream:           req.Stream,
+		N:                1, // Anthropic responses carry a single message
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+	}
+
+	// Penalties the request does not set come from the model settings
+	settings := s.config.ModelSetting(selectedModel)
+	if openAIReq.FrequencyPenalty == nil {
+		openAIReq.FrequencyPenalty = settings.FrequencyPenalty
+	}
+	if openAIReq.PresencePenalty == nil {
+		openAIReq.PresencePenalty = settings.PresencePenalty
 	}
 
 	// Convert stop sequences
@@ -72,15 +96,66 @@ func (s *ConversionService) ConvertAnthropicToOpenAI(req *models.AnthropicReques
 		openAIReq.Stop = req.StopSequences
 	}
 
+	// Note what the upstream will not see as the client sent it
+	if req.TopK != nil {
+		openAIReq.Notes = append(openAIReq.Notes, "top_k is not supported by OpenAI-compatible upstreams and was dropped")
+	}
+	caps := s.config.Capabilities(selectedModel)
+	limit := settings.MaxOutputTokens
+	if limit <= 0 {
+		limit = caps.MaxOutputTokens
+	}
+	if limit > 0 && openAIReq.MaxTokens > limit {
+		openAIReq.Notes = append(openAIReq.Notes, fmt.Sprintf("max_tokens %d was clamped to %d, the max_output_tokens of %s", openAIReq.MaxTokens, limit, selectedModel))
+		openAIReq.MaxTokens = limit
+	}
+	for _, param := range caps.UnsupportedParams {
+		if dropUnsupportedParam(openAIReq, param) {
+			openAIReq.Notes = append(openAIReq.Notes, fmt.Sprintf("%s is not supported by %s and was dropped", param, selectedModel))
+		}
+	}
+	toolsSupported := s.config.SupportsTools(selectedModel)
+	if len(req.Tools) > 0 && !toolsSupported {
+		openAIReq.Notes = append(openAIReq.Notes, fmt.Sprintf("tools are not supported by %s and were dropped", selectedModel))
+	}
+	if len(req.Tools) > 0 && toolsSupported && !s.config.SupportsJSONSchema(selectedModel) {
+		openAIReq.Notes = append(openAIReq.Notes, fmt.Sprintf("tool schemas were reduced to the JSON Schema subset %s accepts", selectedModel))
+	}
+	for _, tool := range req.Tools {
+		if name := sanitizeToolName(tool.Name); name != tool.Name {
+			if openAIReq.ToolNames == nil {
+				openAIReq.ToolNames = make(map[string]string)
+			}
+			if _, taken := openAIReq.ToolNames[name]; !taken {
+				openAIReq.ToolNames[name] = tool.Name
+			}
+			openAIReq.Notes = append(openAIReq.Notes, fmt.Sprintf("tool name %+q was sent upstream as %q", tool.Name, name))
+		}
+	}
+
 	// Convert messages
-	messages, err := s.convertMessages(req.Messages, req.System, selectedModel)
+	messages, err := s.convertMessages(req.Messages, req.System, selectedModel, log)
 	if err != nil {
 		return nil, err
 	}
 	openAIReq.Messages = messages
 
+	// Inject the configured system prompt prefix/suffix
+	prefix, suffix := s.config.SystemPrompt(selectedModel)
+	if prefix != "" {
+		openAIReq.Messages = addSystemText(openAIReq.Messages, prefix, true)
+	}
+	if suffix != "" {
+		openAIReq.Messages = addSystemText(openAIReq.Messages, suffix, false)
+	}
+
+	// Repair role alternation for upstreams that reject consecutive same-role messages
+	if s.config.RequiresAlternation(selectedModel) {
+		openAIReq.Messages = normalizeAlternation(openAIReq.Messages)
+	}
+
 	// Convert tools
-	if len(req.Tools) > 0 {
+	if len(req.Tools) > 0 && toolsSupported {
 		tools, err := s.convertTools(req.Tools, selectedModel)
 		if err != nil {
 			return nil, err
@@ -99,11 +174,11 @@ func (s *ConversionService) ConvertAnthropicToOpenAI(req *models.AnthropicReques
 
 	// Debug log: converted OpenAI request
 	if openAIBytes, err := json.MarshalIndent(openAIReq, "", "  "); err == nil {
-		s.logger.WithFields(logrus.Fields{
+		log.WithFields(logrus.Fields{
 			"converted_request": string(openAIBytes),
 		}).Debug("Converted OpenAI request")
 	} else {
-		s.logger.WithFields(logrus.Fields{
+		log.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to marshal converted request")
 	}
@@ -111,8 +186,38 @@ func (s *ConversionService) ConvertAnthropicToOpenAI(req *models.AnthropicReques
 	return openAIReq, nil
 }
 
+// addSystemText prepends or appends text to the system message, creating one if needed
+func addSystemText(messages []models.OpenAIMessage, text string, prepend bool) []models.OpenAIMessage {
+	if len(messages) == 0 || messages[0].Role != "system" {
+		return append([]models.OpenAIMessage{{Role: "system", Content: text}}, messages...)
+	}
+
+	system := &messages[0]
+	switch content := system.Content.(type) {
+	case string:
+		if content == "" {
+			system.Content = text
+		} else if prepend {
+			system.Content = text + "\n\n" + content
+		} else {
+			system.Content = content + "\n\n" + text
+		}
+	case []models.OpenAIContentPart:
+		part := models.OpenAIContentPart{Type: "text", Text: text}
+		if prepend {
+			system.Content = append([]models.OpenAIContentPart{part}, content...)
+		} else {
+			system.Content = append(content, part)
+		}
+	default:
+		system.Content = text
+	}
+
+	return messages
+}
+
 // convertMessages converts Anthropic messages to OpenAI format
-func (s *ConversionService) convertMessages(anthropicMessages []models.AnthropicMessage, system interface{}, targetModel string) ([]models.OpenAIMessage, error) {
+func (s *ConversionService) convertMessages(anthropicMessages []models.AnthropicMessage, system interface{}, targetModel string, log *logrus.Entry) ([]models.OpenAIMessage, error) {
 	var messages []models.OpenAIMessage
 
 	// Add system message if provided
@@ -138,7 +243,7 @@ func (s *ConversionService) convertMessages(anthropicMessages []models.Anthropic
 
 	// Convert each message while preserving order
 	for i, msg := range anthropicMessages {
-		convertedMessages, err := s.convertSingleMessage(msg, i, targetModel)
+		convertedMessages, err := s.convertSingleMessage(msg, i, targetModel, log)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert message at index %d: %w", i, err)
 		}
@@ -149,7 +254,7 @@ func (s *ConversionService) convertMessages(anthropicMessages []models.Anthropic
 }
 
 // convertSingleMessage converts a single Anthropic message to one or more OpenAI messages
-func (s *ConversionService) convertSingleMessage(msg models.AnthropicMessage, index int, targetModel string) ([]models.OpenAIMessage, error) {
+func (s *ConversionService) convertSingleMessage(msg models.AnthropicMessage, index int, targetModel string, log *logrus.Entry) ([]models.OpenAIMessage, error) {
 	var messages []models.OpenAIMessage
 
 	// Handle different content types
@@ -162,7 +267,7 @@ func (s *ConversionService) convertSingleMessage(msg models.AnthropicMessage, in
 		})
 	case []interface{}:
 		// Complex content (text + images, tool calls, tool results, etc.)
-		convertedMessages, err := s.convertComplexMessage(msg.Role, content, index, targetModel)
+		convertedMessages, err := s.convertComplexMessage(msg.Role, content, index, targetModel, log)
 		if err != nil {
 			return nil, err
 		}
@@ -183,20 +288,20 @@ func (s *ConversionService) convertSingleMessage(msg models.AnthropicMessage, in
 }
 
 // convertComplexMessage handles complex message content and returns multiple OpenAI messages if needed
-func (s *ConversionService) convertComplexMessage(role string, content []interface{}, messageIndex int, targetModel string) ([]models.OpenAIMessage, error) {
+func (s *ConversionService) convertComplexMessage(role string, content []interface{}, messageIndex int, targetModel string, log *logrus.Entry) ([]models.OpenAIMessage, error) {
 	var messages []models.OpenAIMessage
 
 	if role == "user" {
-		return s.convertUserMessage(content, messageIndex, targetModel)
+		return s.convertUserMessage(content, messageIndex, targetModel, log)
 	} else if role == "assistant" {
-		return s.convertAssistantMessage(content, messageIndex, targetModel)
+		return s.convertAssistantMessage(content, messageIndex, targetModel, log)
 	}
 
 	return messages, nil
 }
 
 // convertUserMessage converts user message content to OpenAI format
-func (s *ConversionService) convertUserMessage(content []interface{}, messageIndex int, targetModel string) ([]models.OpenAIMessage, error) {
+func (s *ConversionService) convertUserMessage(content []interface{}, messageIndex int, targetModel string, log *logrus.Entry) ([]models.OpenAIMessage, error) {
 	var messages []models.OpenAIMessage
 	var userContentParts []interface{}
 	isClaudeModel := s.isClaudeModel(targetModel)
@@ -214,7 +319,7 @@ func (s *ConversionService) convertUserMessage(content []interface{}, messageInd
 
 		// Check for cache_control in this content item
 		if cacheControl, exists := itemMap["cache_control"]; exists {
-			fmt.Printf("Cache control found in message %d, content %d: %+v\n", messageIndex, contentIndex, cacheControl)
+			logCacheControl(log, messageIndex, contentIndex, cacheControl)
 		}
 
 		switch contentType {
@@ -263,16 +368,16 @@ func (s *ConversionService) convertUserMessage(content []interface{}, messageInd
 			}
 			messages = append(messages, toolResultMsg)
 		default:
-			// Handle unknown content types
-			unknownBytes, err := json.Marshal(itemMap)
+			text, err := s.convertUnknownContent(itemMap, contentType, messageIndex, contentIndex, log)
 			if err != nil {
-				return nil, fmt.Errorf("failed to marshal unknown content type %s: %w", contentType, err)
+				return nil, err
 			}
-			textPart := map[string]interface{}{
-				"type": "text",
-				"text": fmt.Sprintf("[UNKNOWN_CONTENT_TYPE:%s] %s", contentType, string(unknownBytes)),
+			if text != "" {
+				userContentParts = append(userContentParts, map[string]interface{}{
+					"type": "text",
+					"text": text,
+				})
 			}
-			userContentParts = append(userContentParts, textPart)
 		}
 	}
 
@@ -305,7 +410,7 @@ func (s *ConversionService) convertUserMessage(content []interface{}, messageInd
 }
 
 // convertAssistantMessage converts assistant message content to OpenAI format
-func (s *ConversionService) convertAssistantMessage(content []interface{}, messageIndex int, targetModel string) ([]models.OpenAIMessage, error) {
+func (s *ConversionService) convertAssistantMessage(content []interface{}, messageIndex int, targetModel string, log *logrus.Entry) ([]models.OpenAIMessage, error) {
 	var messages []models.OpenAIMessage
 	var textParts []string
 	var toolCalls []models.OpenAIToolCall
@@ -324,7 +429,7 @@ func (s *ConversionService) convertAssistantMessage(content []interface{}, messa
 
 		// Check for cache_control in this content item
 		if cacheControl, exists := itemMap["cache_control"]; exists {
-			fmt.Printf("Cache control found in message %d, content %d: %+v\n", messageIndex, contentIndex, cacheControl)
+			logCacheControl(log, messageIndex, contentIndex, cacheControl)
 		}
 
 		switch contentType {
@@ -338,21 +443,33 @@ func (s *ConversionService) convertAssistantMessage(content []interface{}, messa
 				return nil, err
 			}
 			toolCalls = append(toolCalls, toolCall)
+		case "thinking", "redacted_thinking":
+			// The signed reasoning of an earlier turn only means something to
+			// Anthropic models; other models get the answer that followed it
+			continue
 		default:
-			// Handle unknown content types by adding to text
-			unknownBytes, err := json.Marshal(itemMap)
+			text, err := s.convertUnknownContent(itemMap, contentType, messageIndex, contentIndex, log)
 			if err != nil {
-				return nil, fmt.Errorf("failed to marshal unknown content type %s: %w", contentType, err)
+				return nil, err
+			}
+			if text != "" {
+				textParts = append(textParts, text)
 			}
-			textParts = append(textParts, fmt.Sprintf("[UNKNOWN_CONTENT_TYPE:%s] %s", contentType, string(unknownBytes)))
 		}
 	}
 
 	// Create assistant messages based on what we found
 	assistantText := strings.Join(textParts, "\n")
 
-	if assistantText != "" && len(toolCalls) > 0 {
-		// Both text and tool calls - create two separate messages
+	if assistantText != "" && len(toolCalls) > 0 && !s.config.SplitsToolCalls(targetModel) {
+		// Both text and tool calls - a single message carries both
+		messages = append(messages, models.OpenAIMessage{
+			Role:      "assistant",
+			Content:   assistantText,
+			ToolCalls: toolCalls,
+		})
+	} else if assistantText != "" && len(toolCalls) > 0 {
+		// Split into two messages for upstreams that reject the combined form
 		messages = append(messages, models.OpenAIMessage{
 			Role:    "assistant",
 			Content: assistantText,
@@ -378,6 +495,55 @@ func (s *ConversionService) convertAssistantMessage(content []interface{}, messa
 	return messages, nil
 }
 
+// logCacheControl logs the cache_control marker of a content block at debug
+// level, with its type and TTL only
+func logCacheControl(log *logrus.Entry, messageIndex, contentIndex int, cacheControl interface{}) {
+	fields := logrus.Fields{
+		"message_index": messageIndex,
+		"content_index": contentIndex,
+	}
+	if control, ok := cacheControl.(map[string]interface{}); ok {
+		if cacheType, ok := control["type"].(string); ok {
+			fields["cache_type"] = cacheType
+		}
+		if ttl, ok := control["ttl"].(string); ok {
+			fields["cache_ttl"] = ttl
+		}
+	}
+	log.WithFields(fields).Debug("Cache control found")
+}
+
+// convertUnknownContent applies unknown_content_policy to a content block of
+// a type the conversion does not support. It returns the text sent in its
+// place, empty when the block is dropped.
+func (s *ConversionService) convertUnknownContent(block map[string]interface{}, contentType string, messageIndex, contentIndex int, log *logrus.Entry) (string, error) {
+	if s.metrics != nil {
+		s.metrics.recordUnknownContent(contentType)
+	}
+	log.WithFields(logrus.Fields{
+		"content_type":  contentType,
+		"message_index": messageIndex,
+		"content_index": contentIndex,
+		"policy":        s.config.UnknownContentPolicy,
+	}).Debug("Unsupported content block")
+
+	switch s.config.UnknownContentPolicy {
+	case UnknownContentDrop:
+		return "", nil
+	case UnknownContentReject:
+		return "", models.NewInvalidRequestError(
+			fmt.Sprintf("Unsupported content block type %q", contentType),
+			fmt.Sprintf("messages.%d.content.%d.type", messageIndex, contentIndex),
+		)
+	default:
+		unknownBytes, err := json.Marshal(block)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal unknown content type %s: %w", contentType, err)
+		}
+		return fmt.Sprintf("[UNKNOWN_CONTENT_TYPE:%s] %s", contentType, string(unknownBytes)), nil
+	}
+}
+
 // convertToolResultToMessage converts a tool result to an OpenAI "tool" role message
 func (s *ConversionService) convertToolResultToMessage(toolResult map[string]interface{}, isClaudeModel bool) (models.OpenAIMessage, error) {
 	var toolMsg models.OpenAIMessage
@@ -520,7 +686,7 @@ func (s *ConversionService) convertToolUse(toolUse map[string]interface{}, isCla
 	}
 
 	if name, ok := toolUse["name"].(string); ok {
-		toolCall.Function.Name = name
+		toolCall.Function.Name = sanitizeToolName(name)
 	}
 
 	// Handle input parameters more robustly
@@ -567,16 +733,20 @@ func (s *ConversionService) convertToolUse(toolUse map[string]interface{}, isCla
 func (s *ConversionService) convertTools(anthropicTools []models.AnthropicTool, targetModel string) ([]models.OpenAITool, error) {
 	var tools []models.OpenAITool
 	isClaudeModel := s.isClaudeModel(targetModel)
+	fullSchema := s.config.SupportsJSONSchema(targetModel)
 
 	for _, tool := range anthropicTools {
 		openAITool := models.OpenAITool{
 			Type: "function",
 			Function: models.OpenAIFunction{
-				Name:        tool.Name,
+				Name:        sanitizeToolName(tool.Name),
 				Description: tool.Description,
 				Parameters:  tool.InputSchema,
 			},
 		}
+		if !fullSchema {
+			openAITool.Function.Parameters = simplifySchema(tool.InputSchema)
+		}
 
 		// For Claude models, preserve cache_control directly on the tool
 		if isClaudeModel && tool.CacheControl != nil {
@@ -589,6 +759,82 @@ func (s *ConversionService) convertTools(anthropicTools []models.AnthropicTool,
 	return tools, nil
 }
 
+// schemaKeywords are the JSON Schema keywords kept for upstreams that only
+// accept a subset of JSON Schema in tool parameters
+var schemaKeywords = map[string]bool{
+	"type":        true,
+	"description": true,
+	"properties":  true,
+	"required":    true,
+	"items":       true,
+	"enum":        true,
+	"nullable":    true,
+}
+
+// simplifySchema returns a copy of a tool schema with only the keywords of
+// schemaKeywords, recursively through properties and items
+func simplifySchema(schema map[string]interface{}) map[string]interface{} {
+	simplified := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		if !schemaKeywords[key] {
+			continue
+		}
+		switch key {
+		case "properties":
+			if properties, ok := value.(map[string]interface{}); ok {
+				simplifiedProperties := make(map[string]interface{}, len(properties))
+				for name, property := range properties {
+					if propertySchema, ok := property.(map[string]interface{}); ok {
+						simplifiedProperties[name] = simplifySchema(propertySchema)
+					} else {
+						simplifiedProperties[name] = property
+					}
+				}
+				value = simplifiedProperties
+			}
+		case "items":
+			if items, ok := value.(map[string]interface{}); ok {
+				value = simplifySchema(items)
+			}
+		}
+		simplified[key] = value
+	}
+	return simplified
+}
+
+// dropUnsupportedParam clears a request parameter a model does not accept
+// and reports whether the request had set it
+func dropUnsupportedParam(req *models.OpenAIRequest, param string) bool {
+	switch param {
+	case "temperature":
+		if req.Temperature != nil {
+			req.Temperature = nil
+			return true
+		}
+	case "top_p":
+		if req.TopP != nil {
+			req.TopP = nil
+			return true
+		}
+	case "frequency_penalty":
+		if req.FrequencyPenalty != nil {
+			req.FrequencyPenalty = nil
+			return true
+		}
+	case "presence_penalty":
+		if req.PresencePenalty != nil {
+			req.PresencePenalty = nil
+			return true
+		}
+	case "stop":
+		if len(req.Stop) > 0 {
+			req.Stop = nil
+			return true
+		}
+	}
+	return false
+}
+
 // convertToolChoice converts Anthropic tool choice to OpenAI format
 func (s *ConversionService) convertToolChoice(choice *models.AnthropicToolChoice) (interface{}, error) {
 	switch choice.Type {
@@ -601,7 +847,7 @@ func (s *ConversionService) convertToolChoice(choice *models.AnthropicToolChoice
 			return map[string]interface{}{
 				"type": "function",
 				"function": map[string]string{
-					"name": choice.Name,
+					"name": sanitizeToolName(choice.Name),
 				},
 			}, nil
 		}
@@ -629,6 +875,13 @@ func (s *ConversionService) ConvertOpenAIToAnthropic(resp *models.OpenAIResponse
 	}
 
 	choice := resp.Choices[0]
+	if len(resp.Choices) > 1 {
+		dropped := map[int]interface{}{}
+		for _, extra := range resp.Choices[1:] {
+			dropped[extra.Index] = extra.Message.Content
+		}
+		logDroppedChoices(s.logger, len(resp.Choices), dropped)
+	}
 
 	anthropicResp := &models.AnthropicResponse{
 		ID:         resp.ID,
@@ -640,6 +893,7 @@ func (s *ConversionService) ConvertOpenAIToAnthropic(resp *models.OpenAIResponse
 			InputTokens:  resp.Usage.PromptTokens,
 			OutputTokens: resp.Usage.CompletionTokens,
 		},
+		Logprobs: choice.Logprobs,
 	}
 
 	// Convert content
@@ -648,6 +902,9 @@ func (s *ConversionService) ConvertOpenAIToAnthropic(resp *models.OpenAIResponse
 		return nil, err
 	}
 	anthropicResp.Content = content
+	if choice.FinishReason == "content_filter" {
+		anthropicResp.Content = append(anthropicResp.Content, models.AnthropicContent{Type: "text", Text: contentFilterNotice})
+	}
 
 	// Debug log: converted Anthropic response
 	if anthropicBytes, err := json.MarshalIndent(anthropicResp, "", "  "); err == nil {
@@ -663,6 +920,16 @@ func (s *ConversionService) ConvertOpenAIToAnthropic(resp *models.OpenAIResponse
 	return anthropicResp, nil
 }
 
+// logDroppedChoices reports choices beyond the first, which the Anthropic
+// format cannot represent. Their content is logged so that it ends up in
+// debug bundles rather than being discarded silently.
+func logDroppedChoices(logger *logrus.Logger, count int, dropped map[int]interface{}) {
+	logger.WithFields(logrus.Fields{
+		"choices":         count,
+		"dropped_choices": dropped,
+	}).Warn("Upstream returned multiple choices, only the first is used")
+}
+
 // convertOpenAIMessageContent converts OpenAI message content to Anthropic format
 func (s *ConversionService) convertOpenAIMessageContent(msg models.OpenAIMessage) ([]models.AnthropicContent, error) {
 	var content []models.AnthropicContent
@@ -701,6 +968,13 @@ func (s *ConversionService) convertOpenAIMessageContent(msg models.OpenAIMessage
 								}
 							}
 							content = append(content, textContent)
+						case "refusal":
+							if refusal, ok := partMap["refusal"].(string); ok && refusal != "" {
+								content = append(content, models.AnthropicContent{
+									Type: "text",
+									Text: refusal,
+								})
+							}
 						case "image_url":
 							// Image content (not typically in responses, but handle it)
 							textContent := models.AnthropicContent{
@@ -715,18 +989,22 @@ func (s *ConversionService) convertOpenAIMessageContent(msg models.OpenAIMessage
 		}
 	}
 
+	// A refusal explains why the model declined, shown as text
+	if msg.Refusal != "" {
+		content = append(content, models.AnthropicContent{
+			Type: "text",
+			Text: msg.Refusal,
+		})
+	}
+
 	// Handle tool calls - convert to tool_use blocks
 	for _, toolCall := range msg.ToolCalls {
-		var input map[string]interface{}
-		if toolCall.Function.Arguments != "" {
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &input); err != nil {
-				// If JSON parsing fails, store the raw arguments with error info
-				input = map[string]interface{}{
-					"error_parsing_arguments": toolCall.Function.Arguments,
-				}
+		input, repaired, err := parseToolArguments(toolCall.Function.Arguments, s.config.RepairToolArguments)
+		if err != nil {
+			// If JSON parsing fails, store the raw arguments with error info
+			input = map[string]interface{}{
+				"error_parsing_arguments": toolCall.Function.Arguments,
 			}
-		} else {
-			input = map[string]interface{}{}
 		}
 
 		toolUseContent := models.AnthropicContent{
@@ -735,6 +1013,10 @@ func (s *ConversionService) convertOpenAIMessageContent(msg models.OpenAIMessage
 			Name:  toolCall.Function.Name,
 			Input: input,
 		}
+		if repaired {
+			s.logger.WithField("tool", toolCall.Function.Name).Warn("Repaired invalid tool call arguments")
+			toolUseContent.RawInput = toolCall.Function.Arguments
+		}
 
 		// Restore cache_control if present
 		if toolCall.CacheControl != nil {
@@ -757,18 +1039,7 @@ func (s *ConversionService) convertOpenAIMessageContent(msg models.OpenAIMessage
 
 // convertFinishReason converts OpenAI finish reason to Anthropic format
 func (s *ConversionService) convertFinishReason(reason string) string {
-	switch reason {
-	case "stop":
-		return "end_turn"
-	case "length":
-		return "max_tokens"
-	case "tool_calls":
-		return "tool_use"
-	case "content_filter":
-		return "stop_sequence"
-	default:
-		return "end_turn"
-	}
+	return mapFinishReason(s.config.FinishReasonMap, reason)
 }
 
 // ConvertStreamResponse converts OpenAI streaming response to Anthropic format
@@ -801,6 +1072,18 @@ func (s *ConversionService) ConvertStreamResponse(openAIResp *models.OpenAIStrea
 			}
 		}
 
+		// A refusal delta is text explaining why the model declined
+		if choice.Delta.Refusal != "" {
+			return &models.AnthropicStreamResponse{
+				Type:  "content_block_delta",
+				Index: choice.Index,
+				Delta: &models.AnthropicDelta{
+					Type: "text_delta",
+					Text: choice.Delta.Refusal,
+				},
+			}, nil
+		}
+
 		// Handle tool calls in streaming
 		if len(choice.Delta.ToolCalls) > 0 {
 			for _, toolCall := range choice.Delta.ToolCalls {
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ways of reporting conversion notes in streamed responses, besides the
+// X-Proxy-Conversion-Note response header
+const (
+	ConversionNotesHeaderOnly = ""        // Only the response header
+	ConversionNotesComment    = "comment" // An SSE comment line per note
+	ConversionNotesEvent      = "event"   // An x_conversion_notes event
+)
+
+const (
+	// conversionNotesContextKey stores the notes of the request in the gin context
+	conversionNotesContextKey = "conversion_notes"
+
+	// toolNamesContextKey stores the original names of renamed tools in the gin context
+	toolNamesContextKey = "tool_names"
+
+	// maxToolNameLength is the longest function name OpenAI-compatible upstreams accept
+	maxToolNameLength = 64
+)
+
+// ApplyConversionNotes reports the conversion notes of a request in the
+// X-Proxy-Conversion-Note response header and keeps them, with the renamed
+// tools, for the response conversion
+func ApplyConversionNotes(c *gin.Context, req *models.OpenAIRequest) {
+	for _, note := range req.Notes {
+		c.Writer.Header().Add("X-Proxy-Conversion-Note", note)
+	}
+	if len(req.Notes) > 0 {
+		c.Set(conversionNotesContextKey, req.Notes)
+	}
+	if len(req.ToolNames) > 0 {
+		c.Set(toolNamesContextKey, req.ToolNames)
+	}
+}
+
+// RestoreToolNames gives the tool calls of a response the names the client
+// defined the tools with
+func RestoreToolNames(c *gin.Context, resp *models.AnthropicResponse) {
+	value, _ := c.Get(toolNamesContextKey)
+	names, _ := value.(map[string]string)
+	restoreToolNames(names, resp)
+}
+
+// restoreToolNames renames the tool calls of a response by the map of
+// upstream to original names
+func restoreToolNames(names map[string]string, resp *models.AnthropicResponse) {
+	if len(names) == 0 {
+		return
+	}
+	for i := range resp.Content {
+		if original, ok := names[resp.Content[i].Name]; ok && resp.Content[i].Type == "tool_use" {
+			resp.Content[i].Name = original
+		}
+	}
+}
+
+// originalToolName returns the name the client defined a tool with
+func originalToolName(c *gin.Context, name string) string {
+	value, _ := c.Get(toolNamesContextKey)
+	names, _ := value.(map[string]string)
+	if original, ok := names[name]; ok {
+		return original
+	}
+	return name
+}
+
+// sanitizeToolName returns a function name OpenAI-compatible upstreams
+// accept, replacing characters other than letters, digits, underscores and
+// hyphens and shortening it to 64 characters
+func sanitizeToolName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(sanitized) > maxToolNameLength {
+		sanitized = sanitized[:maxToolNameLength]
+	}
+	if sanitized == "" {
+		sanitized = "_"
+	}
+	return sanitized
+}
+
+// writeConversionNotes sends the conversion notes of the request in the
+// stream as configured by conversion_notes_stream
+func (s *StreamingService) writeConversionNotes(c *gin.Context) error {
+	value, _ := c.Get(conversionNotesContextKey)
+	notes, _ := value.([]string)
+	if len(notes) == 0 {
+		return nil
+	}
+	switch s.config.ConversionNotesStream {
+	case ConversionNotesComment:
+		for _, note := range notes {
+			if _, err := fmt.Fprintf(c.Writer, ": conversion note: %s\n\n", note); err != nil {
+				return err
+			}
+		}
+	case ConversionNotesEvent:
+		return s.writeStreamEvent(c, "x_conversion_notes", map[string]interface{}{
+			"type":  "x_conversion_notes",
+			"notes": notes,
+		})
+	}
+	return nil
+}
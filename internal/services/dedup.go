@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+const (
+	maxDedupEntries = 256
+
+	// MaxDedupBodyBytes is the largest response kept for duplicate requests
+	MaxDedupBodyBytes = 8 << 20
+)
+
+// DedupEntry is a completed response kept for duplicate requests
+type DedupEntry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+}
+
+// DedupCache keeps the responses of recent message requests. Claude Code
+// retries a request after transient errors even when the first attempt
+// already succeeded upstream; answering the retry from the cache avoids
+// paying for the same completion twice. In cluster mode responses are
+// shared through Redis, so a retry that reaches another instance is answered too.
+type DedupCache struct {
+	window  time.Duration
+	mu      sync.Mutex
+	entries map[string]*DedupEntry
+	shared  *SharedState // nil without cluster mode
+}
+
+// NewDedupCache creates a dedup cache, or returns nil when deduplication is disabled
+func NewDedupCache(cfg *config.Config, shared *SharedState) *DedupCache {
+	if cfg.DedupWindowSeconds <= 0 {
+		return nil
+	}
+	return &DedupCache{
+		window:  time.Duration(cfg.DedupWindowSeconds) * time.Second,
+		entries: make(map[string]*DedupEntry),
+		shared:  shared,
+	}
+}
+
+// Get returns the response stored for the key if it is still within the window
+func (d *DedupCache) Get(key string) (*DedupEntry, bool) {
+	if d.shared != nil {
+		value, err := d.shared.getString("GET", d.shared.key("dedup", key))
+		if errors.Is(err, errRedisNil) {
+			return nil, false
+		}
+		var entry DedupEntry
+		if err == nil {
+			if err = json.Unmarshal([]byte(value), &entry); err == nil {
+				return &entry, true
+			}
+		}
+		d.shared.warn(err, "read deduplicated response")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[key]
+	if !ok || time.Since(entry.StoredAt) > d.window {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Store keeps a response for the key. Expired entries are dropped first, and
+// the response is not kept when the cache is full or the body is too large.
+func (d *DedupCache) Store(key string, entry *DedupEntry) {
+	if len(entry.Body) > MaxDedupBodyBytes {
+		return
+	}
+
+	entry.StoredAt = time.Now()
+	if d.shared != nil {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			_, err = d.shared.do("SET", d.shared.key("dedup", key), string(data),
+				"PX", strconv.FormatInt(d.window.Milliseconds(), 10))
+		}
+		if err != nil {
+			d.shared.warn(err, "store deduplicated response")
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, existing := range d.entries {
+		if time.Since(existing.StoredAt) > d.window {
+			delete(d.entries, k)
+		}
+	}
+	if len(d.entries) >= maxDedupEntries {
+		return
+	}
+	d.entries[key] = entry
+}
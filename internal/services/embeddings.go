@@ -0,0 +1,63 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CreateEmbeddings returns the embedding vectors of the inputs, in order,
+// from the /embeddings endpoint of the upstream serving the model
+func (c *OpenAIClient) CreateEmbeddings(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	body, err := json.Marshal(map[string]interface{}{"model": model, "input": inputs})
+	if err != nil {
+		return nil, err
+	}
+
+	var vectors [][]float64
+	err = c.withKeyRotation(ctx, model, func(up upstream) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, up.baseURL+"/embeddings", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		c.setHeaders(req, up)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to make request: %w", err)
+		}
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return c.upstreamError(ctx, up, model, resp, respBody)
+		}
+
+		var embeddings struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(respBody, &embeddings); err != nil {
+			return fmt.Errorf("failed to parse embeddings response: %w", err)
+		}
+		if len(embeddings.Data) != len(inputs) {
+			return fmt.Errorf("upstream returned %d embeddings for %d inputs", len(embeddings.Data), len(inputs))
+		}
+		vectors = make([][]float64, len(inputs))
+		for _, item := range embeddings.Data {
+			if item.Index < 0 || item.Index >= len(inputs) {
+				return fmt.Errorf("embedding index %d out of range", item.Index)
+			}
+			vectors[item.Index] = item.Embedding
+		}
+		return nil
+	})
+	return vectors, c.translateError(ctx, err)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// upstreamFailure is a common upstream failure that users can fix themselves
+type upstreamFailure struct {
+	kind        string
+	errorType   models.ErrorType
+	patterns    []string // Lowercase substrings of the upstream message or code
+	requestOnly bool     // Only invalid request errors match, not rate limits
+	hint        phrase   // Shown to the user in the error message
+	remediation string   // Logged with the error
+}
+
+// upstreamFailures are matched in order against upstream error responses
+var upstreamFailures = []upstreamFailure{
+	{
+		kind:      "insufficient_balance",
+		errorType: models.ErrorTypeBilling,
+		patterns:  []string{"insufficient balance", "insufficient_balance", "insufficient_quota", "exceeded your current quota", "balance is not enough", "payment required", "insufficient account balance", "insufficient credits", "more credits", "credit balance is too low", "余额不足", "欠费"},
+		hint: phrase{
+			en: "the upstream account balance is insufficient, top up your ShengSuanYun account at https://www.shengsuanyun.com and try again",
+			zh: "上游账户余额不足，请前往胜算云 (https://www.shengsuanyun.com) 充值后重试",
+		},
+		remediation: "Top up the upstream account balance",
+	},
+	{
+		kind:      "model_not_found",
+		errorType: models.ErrorTypeNotFound,
+		patterns:  []string{"model_not_found", "model not found", "no such model", "model does not exist", "unknown model", "invalid model", "模型不存在"},
+		hint: phrase{
+			en: "the upstream does not serve this model, run 'claudeproxy set' to check the big and small model names",
+			zh: "上游不提供该模型，请运行 'claudeproxy set' 检查大模型和小模型的名称",
+		},
+		remediation: "Check big_model_name and small_model_name against the upstream model list",
+	},
+	{
+		kind:      "region_blocked",
+		errorType: models.ErrorTypePermission,
+		patterns:  []string{"unsupported_country_region_territory", "not available in your region", "not supported in your region", "not available in your country", "region is not supported", "地区不可用", "地区不支持"},
+		hint: phrase{
+			en: "the model is not available in this region, switch models or check the region of your network egress",
+			zh: "该模型在当前地区不可用，请更换模型或检查网络出口所在地区",
+		},
+		remediation: "Use a model available in this region or route upstream traffic through a supported region",
+	},
+	{
+		kind:        "context_length_exceeded",
+		errorType:   models.ErrorTypeInvalidRequest,
+		patterns:    []string{"context_length_exceeded", "maximum context length", "context window", "prompt is too long", "too many tokens", "上下文长度"},
+		requestOnly: true,
+		hint: phrase{
+			en: "the conversation exceeds the context window of the model, run /compact in Claude Code or configure truncation_strategy",
+			zh: "对话超出模型的上下文长度，请在 Claude Code 中运行 /compact，或配置 truncation_strategy 自动截断",
+		},
+		remediation: "Compact the conversation or configure truncation_strategy and max_input_tokens",
+	},
+}
+
+// connectionHint is shown when the upstream could not be reached at all
+var connectionHint = phrase{
+	en: "cannot connect to the upstream, check the network, proxy settings (HTTP_PROXY/HTTPS_PROXY) and base_url",
+	zh: "无法连接上游服务，请检查网络、代理设置 (HTTP_PROXY/HTTPS_PROXY) 和 base_url 配置",
+}
+
+// certificateHint is shown when the upstream certificate is not trusted,
+// usually because a corporate proxy intercepts TLS
+var certificateHint = phrase{
+	en: "the upstream certificate is not trusted, if a corporate proxy intercepts TLS set transport.ca_cert_file to its root CA",
+	zh: "上游证书不受信任，如果公司网络代理拦截了 TLS，请将其根证书配置到 transport.ca_cert_file",
+}
+
+// annotateUpstreamError adds the hint of a known upstream failure to the
+// error in the locale, Chinese by default, and gives it the Anthropic error
+// type of the failure. Errors that match no known failure are returned
+// unchanged.
+func annotateUpstreamError(logger *logrus.Logger, apiErr *models.APIError, locale string) *models.APIError {
+	text := strings.ToLower(apiErr.Message + " " + apiErr.Code)
+	for _, failure := range upstreamFailures {
+		// Rate limits such as "too many tokens per minute" are not failures
+		// of the request itself
+		if failure.requestOnly && apiErr.Type != models.ErrorTypeInvalidRequest {
+			continue
+		}
+		for _, pattern := range failure.patterns {
+			if !strings.Contains(text, pattern) {
+				continue
+			}
+			logger.WithFields(logrus.Fields{
+				"failure":     failure.kind,
+				"error":       apiErr.Message,
+				"remediation": failure.remediation,
+			}).Warn("Upstream request failed")
+			annotated := *apiErr
+			annotated.Type = failure.errorType
+			annotated.Message = fmt.Sprintf("%s (%s)", apiErr.Message, failure.hint.in(locale, LocaleZH))
+			return &annotated
+		}
+	}
+	return apiErr
+}
+
+// translateError turns upstream failures into Anthropic errors with a hint on
+// how to fix them. Errors that match no known failure are returned unchanged.
+// Transient failures carry the retry metadata for the client. Hints are in
+// the locale of the request.
+func (c *OpenAIClient) translateError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var apiErr *models.APIError
+	if errors.As(err, &apiErr) {
+		return c.withRetryInfo(annotateUpstreamError(c.logger, apiErr, localeFrom(ctx)), err)
+	}
+
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		c.logger.WithFields(logrus.Fields{
+			"failure":     "certificate",
+			"error":       err.Error(),
+			"remediation": "Add the root CA of the intercepting proxy with transport.ca_cert_file",
+		}).Warn("Upstream request failed")
+		return models.NewAPIError(unreachableMessage(ctx, err, certificateHint), "connection_error")
+	}
+
+	// Transport failures never reached the upstream
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		c.logger.WithFields(logrus.Fields{
+			"failure":     "connection",
+			"error":       err.Error(),
+			"remediation": "Check network connectivity, proxy environment variables and base_url",
+		}).Warn("Upstream request failed")
+		return c.withRetryInfo(models.NewAPIError(unreachableMessage(ctx, err, connectionHint), "connection_error"), err)
+	}
+
+	var retried *retriedError
+	if errors.As(err, &retried) {
+		return retried.err
+	}
+	return err
+}
+
+// unreachableMessage is the message of an upstream that could not be
+// reached, with a hint in the locale of the request
+func unreachableMessage(ctx context.Context, err error, hint phrase) string {
+	locale := localeFrom(ctx)
+	return fmt.Sprintf("%s%s (%s)", Message(locale, "Failed to reach upstream: "), err.Error(), hint.in(locale, LocaleZH))
+}
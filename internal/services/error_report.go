@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	errorReportTimeout  = 10 * time.Second
+	maxReportsPerMinute = 10 // Further reports within the minute are dropped
+	maxReportFrames     = 50
+	modulePath          = "claude-code-provider-proxy/"
+)
+
+// reportableCode matches the error types and codes upstreams return, so free
+// text in those fields is never reported
+var reportableCode = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ErrorReporter sends anonymous reports of panics and upstream errors to a
+// Sentry-compatible endpoint, so the maintainers see which providers and
+// models break the conversion. Reports never contain prompt or response
+// content: only error types, status codes, model names, the provider host
+// and stack traces of the proxy itself.
+type ErrorReporter struct {
+	logger     *logrus.Logger
+	httpClient *http.Client
+	storeURL   string
+	auth       string
+	release    string
+
+	mu          sync.Mutex
+	windowStart time.Time
+	sent        int
+}
+
+// NewErrorReporter creates an error reporter for the DSN and registers it
+// with the client and the streaming service. It returns nil unless reporting
+// is enabled and the DSN is valid; a nil reporter reports nothing.
+func NewErrorReporter(cfg *config.Config, logger *logrus.Logger, openAIClient *OpenAIClient, streamingService *StreamingService, dsn, release string) *ErrorReporter {
+	if !cfg.ErrorReporting || dsn == "" {
+		return nil
+	}
+	storeURL, key, err := ParseErrorReportingDSN(dsn)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid error reporting DSN, error reporting disabled")
+		return nil
+	}
+
+	reporter := &ErrorReporter{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: errorReportTimeout},
+		storeURL:   storeURL,
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_client=claudeproxy/%s, sentry_key=%s",
+			release, key),
+		release: release,
+	}
+	openAIClient.reporter = reporter
+	streamingService.reporter = reporter
+	logger.Info("Anonymous error reporting enabled")
+	return reporter
+}
+
+// ParseErrorReportingDSN returns the store endpoint and public key of a
+// Sentry DSN, e.g. https://<key>@sentry.example.com/<project>
+func ParseErrorReportingDSN(dsn string) (storeURL, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", errors.New("scheme must be http or https")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", errors.New("missing public key")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return "", "", errors.New("missing project ID")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:slash], project), u.User.Username(), nil
+}
+
+// ReportPanic reports a recovered panic with the stack it happened on. Only
+// the type of the panic value is sent, as its text may quote request
+// content; runtime errors such as index out of range keep their message.
+func (r *ErrorReporter) ReportPanic(recovered interface{}) {
+	if r == nil {
+		return
+	}
+	value := "[redacted]"
+	if err, ok := recovered.(runtime.Error); ok {
+		value = err.Error()
+	}
+	typeName := fmt.Sprintf("%T", recovered)
+
+	r.send(map[string]interface{}{
+		"level": "fatal",
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{
+				"type":       typeName,
+				"value":      value,
+				"mechanism":  map[string]interface{}{"type": "panic", "handled": true},
+				"stacktrace": map[string]interface{}{"frames": stackFrames(3)},
+			}},
+		},
+		"tags": map[string]string{"kind": "panic"},
+	})
+}
+
+// ReportUpstreamError reports an error response of an upstream. Of the body
+// only the error type and code are sent, when they are identifiers.
+func (r *ErrorReporter) ReportUpstreamError(baseURL, model string, status int, body []byte) {
+	if r == nil {
+		return
+	}
+	var errorResp struct {
+		Error struct {
+			Type string      `json:"type"`
+			Code interface{} `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &errorResp)
+	errorType := reportable(errorResp.Error.Type)
+	code := reportable(fmt.Sprint(errorResp.Error.Code))
+	kind := errorType
+	if kind == "" {
+		kind = code
+	}
+
+	provider := providerName(baseURL)
+	r.send(map[string]interface{}{
+		"level":   "error",
+		"message": strings.TrimSpace(fmt.Sprintf("Upstream error %d from %s %s", status, provider, kind)),
+		"tags": map[string]string{
+			"kind":       "upstream_error",
+			"provider":   provider,
+			"model":      model,
+			"status":     strconv.Itoa(status),
+			"error_type": errorType,
+			"error_code": code,
+		},
+		"fingerprint": []string{"upstream_error", provider, model, strconv.Itoa(status), kind},
+	})
+}
+
+// ReportConversionError reports an upstream response the proxy could not
+// convert, naming the failed stage and the Go type of the error
+func (r *ErrorReporter) ReportConversionError(baseURL, model, stage string, err error) {
+	if r == nil {
+		return
+	}
+	provider := providerName(baseURL)
+	r.send(map[string]interface{}{
+		"level":   "error",
+		"message": fmt.Sprintf("Conversion failed at %s for %s", stage, provider),
+		"tags": map[string]string{
+			"kind":       "conversion_error",
+			"provider":   provider,
+			"model":      model,
+			"stage":      stage,
+			"error_type": fmt.Sprintf("%T", err),
+		},
+		"fingerprint": []string{"conversion_error", provider, model, stage},
+	})
+}
+
+// send completes an event and posts it in the background, dropping it when
+// the rate limit is reached
+func (r *ErrorReporter) send(event map[string]interface{}) {
+	r.mu.Lock()
+	now := time.Now()
+	if now.Sub(r.windowStart) >= time.Minute {
+		r.windowStart, r.sent = now, 0
+	}
+	if r.sent >= maxReportsPerMinute {
+		r.mu.Unlock()
+		return
+	}
+	r.sent++
+	r.mu.Unlock()
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	event["event_id"] = hex.EncodeToString(id)
+	event["timestamp"] = now.UTC().Format(time.RFC3339)
+	event["platform"] = "go"
+	event["logger"] = "claudeproxy"
+	event["release"] = "claudeproxy@" + r.release
+	event["contexts"] = map[string]interface{}{
+		"os":      map[string]string{"name": runtime.GOOS},
+		"runtime": map[string]string{"name": "go", "version": runtime.Version()},
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.storeURL, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", r.auth)
+		resp, err := r.httpClient.Do(req)
+		if err != nil {
+			r.logger.WithError(err).Debug("Failed to send error report")
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			r.logger.WithField("status_code", resp.StatusCode).Debug("Error report rejected")
+		}
+	}()
+}
+
+// stackFrames returns the calling stack in Sentry order, oldest call first.
+// File paths are cut to the module or the base name, so the directory the
+// binary was built in is not reported.
+func stackFrames(skip int) []map[string]interface{} {
+	pcs := make([]uintptr, maxReportFrames)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var result []map[string]interface{}
+	for {
+		frame, more := frames.Next()
+		file := frame.File
+		if i := strings.Index(file, "/internal/"); i >= 0 {
+			file = file[i+1:]
+		} else if i := strings.LastIndex(file, "/"); i >= 0 {
+			file = file[i+1:]
+		}
+		result = append([]map[string]interface{}{{
+			"function": frame.Function,
+			"filename": file,
+			"lineno":   frame.Line,
+			"in_app":   strings.HasPrefix(frame.Function, modulePath),
+		}}, result...)
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// providerName returns the host of an upstream base URL. Addresses and
+// hosts of private networks are reported as "self-hosted".
+func providerName(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return "self-hosted"
+	}
+	for _, suffix := range []string{".local", ".internal", ".lan", ".home", ".corp", ".localhost"} {
+		if strings.HasSuffix(host, suffix) {
+			return "self-hosted"
+		}
+	}
+	return host
+}
+
+// reportable returns an error type or code when it is an identifier
+func reportable(value string) string {
+	if reportableCode.MatchString(value) {
+		return value
+	}
+	return ""
+}
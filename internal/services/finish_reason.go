@@ -0,0 +1,54 @@
+package services
+
+import "sort"
+
+// contentFilterNotice is the text block added to responses the upstream
+// content filter stopped, so the client sees why the answer ends
+const contentFilterNotice = "[The response was stopped by the upstream provider's content filter]"
+
+// defaultFinishReasons maps OpenAI finish reasons to Anthropic stop reasons.
+// A filtered response ends like a refusal, with contentFilterNotice added.
+var defaultFinishReasons = map[string]string{
+	"stop":           "end_turn",
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "end_turn",
+}
+
+// anthropicStopReasons are the stop reasons Anthropic clients understand
+var anthropicStopReasons = map[string]bool{
+	"end_turn":      true,
+	"max_tokens":    true,
+	"stop_sequence": true,
+	"tool_use":      true,
+	"pause_turn":    true,
+	"refusal":       true,
+}
+
+// IsStopReason reports whether a finish_reason_map value is an Anthropic stop reason
+func IsStopReason(reason string) bool {
+	return anthropicStopReasons[reason]
+}
+
+// StopReasons lists the Anthropic stop reasons, sorted
+func StopReasons() []string {
+	reasons := make([]string, 0, len(anthropicStopReasons))
+	for reason := range anthropicStopReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// mapFinishReason returns the Anthropic stop reason of an upstream finish
+// reason, from finish_reason_map first and the defaults second
+func mapFinishReason(overrides map[string]string, reason string) string {
+	if stopReason, ok := overrides[reason]; ok {
+		return stopReason
+	}
+	if stopReason, ok := defaultFinishReasons[reason]; ok {
+		return stopReason
+	}
+	return "end_turn"
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Health probe settings
+const (
+	defaultHealthCheckInterval = 60 * time.Second
+	healthProbeTimeout         = 10 * time.Second
+	validationInterval         = time.Minute // Minimum time between paid validation calls
+)
+
+// Readiness of the upstreams reported by HealthMonitor.Readiness
+const (
+	ReadinessReady       = "ready"
+	ReadinessStarting    = "starting"    // No probe has finished yet
+	ReadinessUnreachable = "unreachable" // Not reachable within the readiness window
+)
+
+// UpstreamHealth is the cached result of the latest probe of an upstream
+type UpstreamHealth struct {
+	Name                string    `json:"name"`
+	BaseURL             string    `json:"base_url"`
+	Healthy             bool      `json:"healthy"`
+	Status              int       `json:"status,omitempty"`
+	LatencyMs           int64     `json:"latency_ms"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CheckedAt           time.Time `json:"checked_at"`
+}
+
+// HealthMonitor periodically probes every configured upstream with a models
+// list request, which costs nothing, and caches the result for routing
+// decisions and the health endpoints.
+type HealthMonitor struct {
+	config       *config.Config
+	logger       *logrus.Logger
+	openAIClient *OpenAIClient
+
+	mu          sync.RWMutex
+	results     map[string]*UpstreamHealth
+	lastHealthy map[string]time.Time // Time of the latest successful probe
+
+	stop chan struct{}
+	done chan struct{}
+
+	// Cached outcome of the last explicit API key validation
+	validateMu      sync.Mutex
+	validatedAt     time.Time
+	validationError error
+}
+
+// NewHealthMonitor creates a health monitor and attaches it to the client
+func NewHealthMonitor(cfg *config.Config, logger *logrus.Logger, openAIClient *OpenAIClient) *HealthMonitor {
+	monitor := &HealthMonitor{
+		config:       cfg,
+		logger:       logger,
+		openAIClient: openAIClient,
+		results:      make(map[string]*UpstreamHealth),
+		lastHealthy:  make(map[string]time.Time),
+	}
+	openAIClient.health = monitor
+	return monitor
+}
+
+// Start runs the probe loop in the background until Stop is called.
+// Probing is disabled when the configured interval is negative.
+func (m *HealthMonitor) Start() {
+	if m.config.HealthCheckIntervalSeconds < 0 {
+		m.logger.Info("Upstream health monitor disabled")
+		return
+	}
+	interval := defaultHealthCheckInterval
+	if m.config.HealthCheckIntervalSeconds > 0 {
+		interval = time.Duration(m.config.HealthCheckIntervalSeconds) * time.Second
+	}
+
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.ProbeAll()
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the probe loop and waits for a running probe to finish
+func (m *HealthMonitor) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+// ProbeAll probes all upstreams concurrently and stores the results
+func (m *HealthMonitor) ProbeAll() {
+	var wg sync.WaitGroup
+	for _, up := range m.openAIClient.probeTargets() {
+		wg.Add(1)
+		go func(up upstream) {
+			defer wg.Done()
+			m.record(up, m.probe(up))
+		}(up)
+	}
+	wg.Wait()
+}
+
+// probe sends a models list request to the upstream. The upstream counts as
+// healthy when it answers without a server error and accepts the API key;
+// 404/405 are fine for providers that do not offer a models endpoint.
+func (m *HealthMonitor) probe(up upstream) *UpstreamHealth {
+	result := &UpstreamHealth{
+		Name:      up.name,
+		BaseURL:   up.baseURL,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", up.baseURL+"/models", nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	m.openAIClient.setHeaders(req, up)
+	if m.openAIClient.IsAnthropicUpstream() {
+		req.Header.Set("x-api-key", up.apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	}
+
+	start := time.Now()
+	resp, err := m.openAIClient.httpClient.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	result.Status = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 500:
+		result.Error = fmt.Sprintf("upstream returned HTTP %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.Error = fmt.Sprintf("upstream rejected the API key (HTTP %d)", resp.StatusCode)
+	default:
+		result.Healthy = true
+	}
+	return result
+}
+
+// record stores a probe result and logs health transitions
+func (m *HealthMonitor) record(up upstream, result *UpstreamHealth) {
+	m.mu.Lock()
+	previous := m.results[up.name]
+	if !result.Healthy {
+		result.ConsecutiveFailures = 1
+		if previous != nil {
+			result.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		}
+	}
+	m.results[up.name] = result
+	if result.Healthy {
+		m.lastHealthy[up.name] = result.CheckedAt
+	}
+	m.mu.Unlock()
+
+	fields := logrus.Fields{
+		"upstream":   up.name,
+		"base_url":   up.baseURL,
+		"status":     result.Status,
+		"latency_ms": result.LatencyMs,
+	}
+	switch {
+	case !result.Healthy && (previous == nil || previous.Healthy):
+		fields["error"] = result.Error
+		m.logger.WithFields(fields).Warn("Upstream became unhealthy")
+	case result.Healthy && previous != nil && !previous.Healthy:
+		m.logger.WithFields(fields).Info("Upstream recovered")
+	default:
+		m.logger.WithFields(fields).Debug("Upstream health probe completed")
+	}
+}
+
+// IsHealthy reports whether the named upstream passed its latest probe.
+// Upstreams that have not been probed yet are assumed healthy.
+func (m *HealthMonitor) IsHealthy(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result, ok := m.results[name]
+	return !ok || result.Healthy
+}
+
+// Results returns the latest probe result of every upstream
+func (m *HealthMonitor) Results() []UpstreamHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]UpstreamHealth, 0, len(m.results))
+	for _, up := range m.openAIClient.probeTargets() {
+		if result, ok := m.results[up.name]; ok {
+			results = append(results, *result)
+		}
+	}
+	return results
+}
+
+// Degraded reports whether any upstream failed its latest probe
+func (m *HealthMonitor) Degraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, result := range m.results {
+		if !result.Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// Readiness reports whether any upstream, or all of them when all is set,
+// passed a probe within the window, together with the upstreams that did
+// not. Without probing the upstreams are assumed ready.
+func (m *HealthMonitor) Readiness(window time.Duration, all bool) (string, []string) {
+	if m.config.HealthCheckIntervalSeconds < 0 {
+		return ReadinessReady, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	targets := m.openAIClient.probeTargets()
+	var unreachable []string
+	probed := false
+	for _, up := range targets {
+		if _, ok := m.results[up.name]; ok {
+			probed = true
+		}
+		if at, ok := m.lastHealthy[up.name]; !ok || time.Since(at) > window {
+			unreachable = append(unreachable, up.name)
+		}
+	}
+
+	switch {
+	case !probed:
+		return ReadinessStarting, nil
+	case len(unreachable) == 0 || (!all && len(unreachable) < len(targets)):
+		return ReadinessReady, unreachable
+	}
+	return ReadinessUnreachable, unreachable
+}
+
+// Validate checks the API key with a real one-token completion. Because this
+// costs money, the upstream is called at most once per validation interval;
+// calls within the interval return the cached outcome and its check time.
+func (m *HealthMonitor) Validate(ctx context.Context) (time.Time, error) {
+	m.validateMu.Lock()
+	defer m.validateMu.Unlock()
+
+	if !m.validatedAt.IsZero() && time.Since(m.validatedAt) < validationInterval {
+		return m.validatedAt, m.validationError
+	}
+
+	err := m.openAIClient.ValidateAPIKey(ctx)
+	if ctx.Err() != nil {
+		// Do not cache a validation cut short by the caller
+		return time.Now(), err
+	}
+	m.validatedAt = time.Now()
+	m.validationError = err
+	return m.validatedAt, err
+}
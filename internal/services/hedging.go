@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultHedgeDelay = 800 * time.Millisecond
+
+// hedgeResult is the outcome of one leg of a hedged request
+type hedgeResult struct {
+	resp     *models.OpenAIResponse
+	err      error
+	upstream string
+}
+
+// shouldHedge reports whether the request qualifies for hedging. Only
+// non-streaming small model calls (titles, summaries) are hedged, since they
+// are latency sensitive and cheap to duplicate.
+func (c *OpenAIClient) shouldHedge(req *models.OpenAIRequest) bool {
+	return c.config.Hedging.BaseURL != "" && !req.Stream && req.Model == c.config.SmallModelName
+}
+
+// hedgeUpstream returns the secondary upstream used for hedged requests. The
+// primary key is only reused when the secondary upstream is on the same host.
+func (c *OpenAIClient) hedgeUpstream() upstream {
+	apiKey := c.config.Hedging.APIKey
+	if apiKey == "" && SameHost(c.config.Hedging.BaseURL, c.config.OpenAIBaseURL) {
+		apiKey = c.config.OpenAIAPIKey
+	}
+	return upstream{
+		name:    "hedge",
+		baseURL: c.config.Hedging.BaseURL,
+		apiKey:  apiKey,
+		headers: c.config.Hedging.CustomHeaders,
+	}
+}
+
+// createHedgedChatCompletion sends the request to the primary upstream and, if it
+// has not answered within the hedge delay, duplicates it to the secondary upstream.
+// The first successful response wins and the other request is canceled.
+func (c *OpenAIClient) createHedgedChatCompletion(ctx context.Context, req *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	delay := defaultHedgeDelay
+	if c.config.Hedging.DelayMs > 0 {
+		delay = time.Duration(c.config.Hedging.DelayMs) * time.Millisecond
+	}
+
+	// Skip the wait when the health monitor already knows the primary is down
+	if !c.isHealthy("primary") && c.isHealthy("hedge") {
+		delay = 0
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	results := make(chan hedgeResult, 2)
+	launch := func(name string, send func() (*models.OpenAIResponse, error)) {
+		go func() {
+			resp, err := send()
+			results <- hedgeResult{resp: resp, err: err, upstream: name}
+		}()
+	}
+
+	launch("primary", func() (*models.OpenAIResponse, error) {
+		return c.createPrimaryChatCompletion(ctx, req)
+	})
+	pending := 1
+	hedged := false
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			c.logger.WithFields(logrus.Fields{
+				"model":    req.Model,
+				"delay_ms": delay.Milliseconds(),
+			}).Debug("Primary upstream slow, sending hedged request")
+			hedge := c.hedgeUpstream()
+			launch(hedge.name, func() (*models.OpenAIResponse, error) {
+				return c.createChatCompletion(ctx, req, hedge)
+			})
+			pending++
+			hedged = true
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				c.logger.WithFields(logrus.Fields{
+					"model":      req.Model,
+					"winner":     result.upstream,
+					"hedged":     hedged,
+					"latency_ms": time.Since(start).Milliseconds(),
+				}).Info("Hedged request completed")
+				return result.resp, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if !hedged {
+				// The primary failed before the hedge was sent
+				return nil, firstErr
+			}
+		}
+	}
+
+	return nil, firstErr
+}
+
+// SameHost reports whether two base URLs point at the same host and port
+func SameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil || ua.Host == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Hook points in the request lifecycle
+const (
+	HookPointPreConversion = "pre_conversion" // Anthropic request, before conversion
+	HookPointPreUpstream   = "pre_upstream"   // OpenAI request, before it is sent upstream
+	HookPointPostResponse  = "post_response"  // Anthropic response, before it is returned to the client
+)
+
+const defaultHookTimeout = 10 * time.Second
+
+// HookService invokes user-provided executables or HTTP endpoints at defined points
+// of the request lifecycle. Each hook receives the JSON payload for its point and may
+// return a replacement payload, reject the request, or simply observe it.
+type HookService struct {
+	config     *config.Config
+	logger     *logrus.Logger
+	httpClient *http.Client
+}
+
+// hookRejection is the optional body a hook returns to reject a request
+type hookRejection struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewHookService creates a new hook service
+func NewHookService(cfg *config.Config, logger *logrus.Logger) *HookService {
+	return &HookService{
+		config:     cfg,
+		logger:     logger,
+		httpClient: &http.Client{},
+	}
+}
+
+// Run invokes all hooks registered for the given point in configuration order.
+// The payload is marshaled to JSON and passed to each hook; a non-empty JSON
+// reply replaces the payload, so hooks can rewrite requests and responses.
+// A hook rejects the request by exiting non-zero or returning a non-2xx status.
+func (s *HookService) Run(ctx context.Context, point string, payload interface{}) error {
+	for _, hook := range s.config.Hooks {
+		if hook.Point != point {
+			continue
+		}
+
+		input, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal hook payload: %w", err)
+		}
+
+		output, rejected, err := s.invoke(ctx, hook, point, input)
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"hook":      hook.Name,
+				"point":     point,
+				"error":     err.Error(),
+				"fail_open": hook.FailOpen,
+			}).Error("Hook execution failed")
+			if hook.FailOpen {
+				continue
+			}
+			return models.NewAPIError(fmt.Sprintf("Hook %s failed: %s", hook.Name, err.Error()))
+		}
+
+		if rejected {
+			message := strings.TrimSpace(string(output))
+			var rejection hookRejection
+			if json.Unmarshal(output, &rejection) == nil && rejection.Error.Message != "" {
+				message = rejection.Error.Message
+			}
+			if message == "" {
+				message = "request rejected"
+			}
+			s.logger.WithFields(logrus.Fields{
+				"hook":    hook.Name,
+				"point":   point,
+				"message": message,
+			}).Warn("Request rejected by hook")
+			return models.NewPermissionError(fmt.Sprintf("Hook %s: %s", hook.Name, message))
+		}
+
+		if len(bytes.TrimSpace(output)) == 0 {
+			continue
+		}
+
+		if err := replacePayload(payload, output); err != nil {
+			return models.NewAPIError(fmt.Sprintf("Hook %s returned invalid JSON: %s", hook.Name, err.Error()))
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"hook":  hook.Name,
+			"point": point,
+		}).Debug("Payload rewritten by hook")
+	}
+
+	return nil
+}
+
+// replacePayload decodes a hook reply into a zero value and replaces the
+// payload with it, so fields the hook left out are cleared instead of kept.
+// Fields never sent to hooks (json:"-") keep their values.
+func replacePayload(payload interface{}, output []byte) error {
+	target := reflect.ValueOf(payload).Elem()
+	fresh := reflect.New(target.Type()).Elem()
+	if err := json.Unmarshal(output, fresh.Addr().Interface()); err != nil {
+		return err
+	}
+	if target.Kind() == reflect.Struct {
+		for i := 0; i < target.NumField(); i++ {
+			if target.Type().Field(i).Tag.Get("json") == "-" {
+				fresh.Field(i).Set(target.Field(i))
+			}
+		}
+	}
+	target.Set(fresh)
+	return nil
+}
+
+// invoke runs a single hook and returns its output and whether it rejected the request
+func (s *HookService) invoke(ctx context.Context, hook config.HookConfig, point string, input []byte) ([]byte, bool, error) {
+	timeout := defaultHookTimeout
+	if hook.TimeoutSeconds > 0 {
+		timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case hook.Command != "":
+		return s.invokeCommand(ctx, hook, point, input)
+	case hook.URL != "":
+		return s.invokeHTTP(ctx, hook, point, input)
+	default:
+		return nil, false, fmt.Errorf("hook has neither command nor url")
+	}
+}
+
+// invokeCommand runs an executable hook with the payload on stdin
+func (s *HookService) invokeCommand(ctx context.Context, hook config.HookConfig, point string, input []byte) ([]byte, bool, error) {
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(cmd.Environ(), "CLAUDEPROXY_HOOK_POINT="+point)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+			// A non-zero exit status is a deliberate rejection
+			return stderr.Bytes(), true, nil
+		}
+		return nil, false, err
+	}
+
+	return stdout.Bytes(), false, nil
+}
+
+// invokeHTTP posts the payload to an HTTP hook
+func (s *HookService) invokeHTTP(ctx context.Context, hook config.HookConfig, point string, input []byte) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(input))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hook-Point", point)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, true, nil
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, false, nil
+	}
+
+	return body, false, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+const (
+	// maxImageEdge is the longest edge Anthropic processes; larger images
+	// are scaled down to it keeping their aspect ratio
+	maxImageEdge = 1568
+
+	// maxImageTokens is the cost of an image at the largest processed size,
+	// also used when the size cannot be determined
+	maxImageTokens = 1600
+
+	// imagePixelsPerToken is Anthropic's documented tokens = width*height/750
+	imagePixelsPerToken = 750
+
+	// imageHeaderBytes is enough of an image file to read its dimensions
+	imageHeaderBytes = 64 * 1024
+)
+
+// imageTokens estimates the tokens of an image content block from its source,
+// following Anthropic's image sizing rules. Images given by URL or file ID
+// are counted at the largest size as they are not fetched.
+func imageTokens(source map[string]interface{}) int {
+	if sourceType, _ := source["type"].(string); sourceType != "base64" {
+		return maxImageTokens
+	}
+	data, _ := source["data"].(string)
+	width, height, ok := imageSize(data)
+	if !ok {
+		return maxImageTokens
+	}
+
+	if long := max(width, height); long > maxImageEdge {
+		width = width * maxImageEdge / long
+		height = height * maxImageEdge / long
+	}
+	tokens := (width*height + imagePixelsPerToken - 1) / imagePixelsPerToken
+	return max(min(tokens, maxImageTokens), 1)
+}
+
+// imageSize decodes the dimensions of a base64 encoded PNG, JPEG, GIF or WebP
+// image from the start of the data
+func imageSize(data string) (width, height int, ok bool) {
+	if len(data) > imageHeaderBytes/3*4 {
+		data = data[:imageHeaderBytes/3*4]
+	}
+	// A decoding error past the header does not matter
+	header, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if width, height, ok := webpSize(header); ok {
+		return width, height, true
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(header))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
+
+// webpSize reads the dimensions from the header of a WebP image, which the
+// standard library does not decode
+func webpSize(header []byte) (width, height int, ok bool) {
+	if len(header) < 30 || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	chunk := header[12:]
+	switch string(chunk[0:4]) {
+	case "VP8 ":
+		// Lossy: 14-bit dimensions after the frame tag and start code
+		width = int(binary.LittleEndian.Uint16(chunk[14:16]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(chunk[16:18]) & 0x3fff)
+	case "VP8L":
+		// Lossless: 14-bit dimensions minus one after the signature byte
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+		width = int(bits&0x3fff) + 1
+		height = int(bits>>14&0x3fff) + 1
+	case "VP8X":
+		// Extended: 24-bit canvas dimensions minus one
+		width = int(uint32(chunk[12])|uint32(chunk[13])<<8|uint32(chunk[14])<<16) + 1
+		height = int(uint32(chunk[15])|uint32(chunk[16])<<8|uint32(chunk[17])<<16) + 1
+	default:
+		return 0, 0, false
+	}
+	return width, height, width > 0 && height > 0
+}
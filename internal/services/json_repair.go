@@ -0,0 +1,100 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// repairJSON attempts to turn truncated or slightly malformed JSON produced by
+// a model into valid JSON. It closes unterminated strings, drops trailing
+// commas and completes unbalanced braces and brackets. The second result is
+// false when the text cannot be repaired.
+func repairJSON(raw string) (string, bool) {
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return "{}", true
+	}
+
+	var out []byte
+	var closers []byte
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if inString {
+			out = append(out, ch)
+			if escaped {
+				escaped = false
+			} else if ch == '\\' {
+				escaped = true
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case '{':
+			closers = append(closers, '}')
+		case '[':
+			closers = append(closers, ']')
+		case '}', ']':
+			if len(closers) == 0 || closers[len(closers)-1] != ch {
+				return "", false
+			}
+			closers = closers[:len(closers)-1]
+			out = trimTrailingComma(out)
+		}
+		out = append(out, ch)
+	}
+
+	// Complete the truncated tail
+	if inString {
+		if escaped {
+			out = out[:len(out)-1]
+		}
+		out = append(out, '"')
+	}
+	out = trimTrailingComma(out)
+	if len(out) > 0 && out[len(out)-1] == ':' {
+		out = append(out, "null"...)
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		out = append(out, closers[i])
+	}
+
+	if !json.Valid(out) {
+		return "", false
+	}
+	return string(out), true
+}
+
+// trimTrailingComma removes trailing whitespace and a trailing comma
+func trimTrailingComma(out []byte) []byte {
+	trimmed := strings.TrimRight(string(out), " \t\r\n")
+	return []byte(strings.TrimSuffix(trimmed, ","))
+}
+
+// parseToolArguments parses the JSON arguments of a tool call. With repair
+// set, invalid arguments are repaired first; repaired reports whether that
+// was necessary.
+func parseToolArguments(arguments string, repair bool) (input map[string]interface{}, repaired bool, err error) {
+	if arguments == "" {
+		return map[string]interface{}{}, false, nil
+	}
+	err = json.Unmarshal([]byte(arguments), &input)
+	if err == nil || !repair {
+		return input, false, err
+	}
+
+	fixed, ok := repairJSON(arguments)
+	if !ok {
+		return nil, false, err
+	}
+	input = nil
+	if fixErr := json.Unmarshal([]byte(fixed), &input); fixErr != nil || input == nil {
+		return nil, false, err
+	}
+	return input, true, nil
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Cool-down periods applied to a key after the upstream rejects it
+const (
+	keyRejectedCooldown    = 5 * time.Minute  // 401, or 403 naming the key: key revoked or invalid
+	keyRateLimitedCooldown = 30 * time.Second // 429 without Retry-After
+)
+
+// KeyPool rotates between the configured upstream API keys. Keys with a lower
+// priority value are preferred; keys of equal priority are picked by weight.
+// A key that is rejected (401/403) or rate limited (429) cools down and the
+// request moves on to the next key, so keys can be swapped without downtime.
+// In cluster mode cool-downs are shared with the other instances through Redis.
+// With session affinity a session stays on its key while the key is usable.
+type KeyPool struct {
+	mu       sync.Mutex
+	keys     []*pooledKey
+	sessions *sessionBindings // nil without session affinity
+	logger   *logrus.Logger
+	shared   *SharedState // nil without cluster mode
+}
+
+// pooledKey is an API key with its rotation state
+type pooledKey struct {
+	name          string
+	key           string
+	id            string // Hash of the key identifying it across instances
+	priority      int
+	weight        int
+	cooldownUntil time.Time
+	requests      int
+	failures      int
+	lastStatus    int
+	lastUsed      time.Time
+}
+
+// KeyHealth reports the state of a pooled key
+type KeyHealth struct {
+	Name          string     `json:"name"`
+	Key           string     `json:"key"` // Masked
+	Priority      int        `json:"priority"`
+	Weight        int        `json:"weight"`
+	Healthy       bool       `json:"healthy"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	Requests      int        `json:"requests"`
+	Failures      int        `json:"failures"`
+	LastStatus    int        `json:"last_status,omitempty"`
+}
+
+// keyRejectedError marks an upstream error caused by the API key itself
+type keyRejectedError struct {
+	err error
+}
+
+// Error implements the error interface
+func (e *keyRejectedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *keyRejectedError) Unwrap() error {
+	return e.err
+}
+
+// NewKeyPool creates a key pool from the configured API keys. When no key list
+// is configured the single ssy_api_key is used.
+func NewKeyPool(cfg *config.Config, logger *logrus.Logger, shared *SharedState) *KeyPool {
+	pool := &KeyPool{logger: logger, shared: shared}
+	if cfg.SessionAffinity {
+		pool.sessions = newSessionBindings()
+	}
+
+	for i, keyCfg := range cfg.APIKeys {
+		if keyCfg.Key == "" {
+			continue
+		}
+		name := keyCfg.Name
+		if name == "" {
+			name = "key-" + strconv.Itoa(i+1)
+		}
+		weight := keyCfg.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		pool.keys = append(pool.keys, &pooledKey{
+			name:     name,
+			key:      keyCfg.Key,
+			id:       keyID(keyCfg.Key),
+			priority: keyCfg.Priority,
+			weight:   weight,
+		})
+	}
+
+	if len(pool.keys) == 0 && cfg.OpenAIAPIKey != "" {
+		pool.keys = append(pool.keys, &pooledKey{name: "default", key: cfg.OpenAIAPIKey, id: keyID(cfg.OpenAIAPIKey), weight: 1})
+	}
+
+	return pool
+}
+
+// keyID identifies an API key in shared state without revealing it
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// syncCooldowns adopts the cool-downs other instances have put keys into
+func (p *KeyPool) syncCooldowns() {
+	if p.shared == nil || len(p.keys) == 0 {
+		return
+	}
+
+	args := []string{"MGET"}
+	for _, key := range p.keys {
+		args = append(args, p.shared.key("cooldown", key.id))
+	}
+	values, err := p.shared.getStrings(args...)
+	if err != nil {
+		p.shared.warn(err, "read key cool-downs")
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, key := range p.keys {
+		if i >= len(values) {
+			break
+		}
+		if ms, err := strconv.ParseInt(values[i], 10, 64); err == nil {
+			if until := time.UnixMilli(ms); until.After(key.cooldownUntil) {
+				key.cooldownUntil = until
+			}
+		}
+	}
+}
+
+// Size returns the number of keys in the pool
+func (p *KeyPool) Size() int {
+	return len(p.keys)
+}
+
+// pick selects the next key, skipping keys in exclude. Keys that are cooling
+// down are only used when no other key is left. With session affinity the
+// session keeps the key it was last sent with.
+func (p *KeyPool) pick(session string, exclude map[*pooledKey]bool) *pooledKey {
+	p.syncCooldowns()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.sessions == nil || len(p.keys) < 2 {
+		session = ""
+	}
+	if session != "" {
+		if key := p.boundKey(session, exclude, now); key != nil {
+			key.requests++
+			key.lastUsed = now
+			p.sessions.touch(session, now)
+			return key
+		}
+	}
+
+	var candidates []*pooledKey
+	var fallback *pooledKey
+	for _, key := range p.keys {
+		if exclude[key] {
+			continue
+		}
+		if now.Before(key.cooldownUntil) {
+			if fallback == nil || key.cooldownUntil.Before(fallback.cooldownUntil) {
+				fallback = key
+			}
+			continue
+		}
+		if len(candidates) == 0 || key.priority < candidates[0].priority {
+			candidates = []*pooledKey{key}
+		} else if key.priority == candidates[0].priority {
+			candidates = append(candidates, key)
+		}
+	}
+
+	selected := fallback
+	if len(candidates) > 0 {
+		total := 0
+		for _, key := range candidates {
+			total += key.weight
+		}
+		n := rand.Intn(total)
+		for _, key := range candidates {
+			if n < key.weight {
+				selected = key
+				break
+			}
+			n -= key.weight
+		}
+	}
+
+	if selected != nil {
+		selected.requests++
+		selected.lastUsed = now
+		if session != "" {
+			p.bindSession(session, selected, now)
+		}
+	}
+	return selected
+}
+
+// peek returns the key pick would prefer, without recording a request
+func (p *KeyPool) peek() *pooledKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best *pooledKey
+	for _, key := range p.keys {
+		if now.Before(key.cooldownUntil) {
+			continue
+		}
+		if best == nil || key.priority < best.priority {
+			best = key
+		}
+	}
+	if best == nil && len(p.keys) > 0 {
+		best = p.keys[0]
+	}
+	return best
+}
+
+// reportSuccess records a request that was not rejected because of the key
+func (p *KeyPool) reportSuccess(key *pooledKey, status int) {
+	if key == nil {
+		return
+	}
+	p.mu.Lock()
+	coolingDown := !key.cooldownUntil.IsZero()
+	key.lastStatus = status
+	key.cooldownUntil = time.Time{}
+	p.mu.Unlock()
+
+	if coolingDown && p.shared != nil {
+		if _, err := p.shared.do("DEL", p.shared.key("cooldown", key.id)); err != nil {
+			p.shared.warn(err, "clear key cool-down")
+		}
+	}
+}
+
+// reportFailure puts a rejected or rate limited key into cool-down
+func (p *KeyPool) reportFailure(key *pooledKey, status int, header http.Header) {
+	if key == nil {
+		return
+	}
+
+	cooldown := keyRejectedCooldown
+	if status == http.StatusTooManyRequests {
+		cooldown = keyRateLimitedCooldown
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+	}
+
+	p.mu.Lock()
+	key.failures++
+	key.lastStatus = status
+	key.cooldownUntil = time.Now().Add(cooldown)
+	until := key.cooldownUntil
+	p.mu.Unlock()
+
+	if p.shared != nil {
+		_, err := p.shared.do("SET", p.shared.key("cooldown", key.id), strconv.FormatInt(until.UnixMilli(), 10),
+			"PX", strconv.FormatInt(cooldown.Milliseconds(), 10))
+		if err != nil {
+			p.shared.warn(err, "share key cool-down")
+		}
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"key":         key.name,
+		"status":      status,
+		"cooldown_ms": cooldown.Milliseconds(),
+	}).Warn("Upstream API key rejected, cooling down")
+}
+
+// Health returns the state of all keys
+func (p *KeyPool) Health() []KeyHealth {
+	p.syncCooldowns()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	health := make([]KeyHealth, 0, len(p.keys))
+	for _, key := range p.keys {
+		h := KeyHealth{
+			Name:       key.name,
+			Key:        maskKey(key.key),
+			Priority:   key.priority,
+			Weight:     key.weight,
+			Healthy:    !now.Before(key.cooldownUntil),
+			Requests:   key.requests,
+			Failures:   key.failures,
+			LastStatus: key.lastStatus,
+		}
+		if !h.Healthy {
+			until := key.cooldownUntil
+			h.CooldownUntil = &until
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// keyForbiddenPattern matches 403 messages about the API key or account,
+// rather than about the content or a model the key may not use
+var keyForbiddenPattern = regexp.MustCompile(`(?i)api[ _-]?key|\bkey\b|account|credential|suspended|banned|deactivated`)
+
+// isKeyRejection reports whether an upstream error is caused by the API key:
+// always for 401 and 429, and for 403 only when the body names the key or account
+func isKeyRejection(status int, body []byte) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return keyForbiddenPattern.Match(body)
+	default:
+		return false
+	}
+}
+
+// maskKey hides all but the first characters of an API key
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:6] + "****"
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// LocaleZH shows error messages in Chinese
+	LocaleZH = "zh"
+	// LocaleEN shows error messages in English
+	LocaleEN = "en"
+
+	// LocaleContextKey stores the error message locale in the gin context
+	LocaleContextKey = "locale"
+)
+
+// localeKey is the context key of the error message locale of a request
+type localeKey struct{}
+
+// phrase is a piece of an error message in both languages
+type phrase struct {
+	en, zh string
+}
+
+// errorPhrases are the messages the proxy generates itself, and the prefixes
+// of messages it composes. Upstream messages are never translated.
+var errorPhrases = []phrase{
+	{"OpenAI API key is required", "需要配置上游 API 密钥"},
+	{"API key is required", "需要提供 API 密钥"},
+	{"Invalid admin token", "管理令牌无效"},
+	{"Admin API is only available from localhost unless admin_token is set", "未设置 admin_token 时管理 API 仅允许本机访问"},
+	{"Internal server error", "服务器内部错误"},
+	{"Content-Type must be application/json", "Content-Type 必须为 application/json"},
+	{"Invalid OpenAI API key", "上游 API 密钥无效"},
+	{"Invalid API key", "API 密钥无效"},
+	{"Insufficient permissions", "权限不足"},
+	{"Insufficient account balance", "账户余额不足"},
+	{"Rate limit exceeded", "请求频率超出限制"},
+	{"Failed to count tokens", "Token 计数失败"},
+	{"Failed to process request", "请求处理失败"},
+	{"Failed to transform request", "请求转换失败"},
+	{"Failed to process response", "响应处理失败"},
+	{"Request body is required", "缺少请求体"},
+	{"Unsupported model: ", "不支持的模型: "},
+	{"Failed to reach upstream: ", "无法连接上游: "},
+	{"model: %s", "模型不存在: %s"},
+	{"API key %q has used its daily token quota of %d, resets at %s", "API 密钥 %q 已用完每日 %d token 的额度，将于 %s 重置"},
+	{"API key %q has used its daily cost quota of %g, resets at %s", "API 密钥 %q 已用完每日 %g 的费用额度，将于 %s 重置"},
+	{"X-Proxy-Logprobs must be a number of top log probabilities between 0 and %d", "X-Proxy-Logprobs 必须是 0 到 %d 之间的候选数量"},
+
+	// Problems found by strict_validation, after the JSON pointer of the field
+	{"must be greater than 0", "必须大于 0"},
+	{"must be between 0 and 1", "必须在 0 到 1 之间"},
+	{"must be between -2 and 2", "必须在 -2 到 2 之间"},
+	{"must not be negative", "不能为负数"},
+	{"must not be empty", "不能为空"},
+	{"must be an object", "必须是对象"},
+	{"must be a string", "必须是字符串"},
+	{"must be a non-empty string", "必须是非空字符串"},
+	{"must be a boolean", "必须是布尔值"},
+	{"must be \"text\"", "必须为 \"text\""},
+	{"must be \"object\"", "必须为 \"object\""},
+	{"must be \"ephemeral\"", "必须为 \"ephemeral\""},
+	{"must be \"user\" or \"assistant\"", "必须为 \"user\" 或 \"assistant\""},
+	{"must be a string or an array of text blocks", "必须是字符串或文本块数组"},
+	{"must be a string or an array of content blocks", "必须是字符串或内容块数组"},
+	{"must be one of auto, any, tool, none", "必须是 auto、any、tool、none 之一"},
+	{"must be one of base64, url, file", "必须是 base64、url、file 之一"},
+	{"must be one of image/jpeg, image/png, image/gif, image/webp", "必须是 image/jpeg、image/png、image/gif、image/webp 之一"},
+	{"must be one of text, image, document, search_result", "必须是 text、image、document、search_result 之一"},
+	{"must contain at least one message", "至少需要一条消息"},
+	{"must match %s", "必须匹配 %s"},
+	{"requires tools", "需要同时提供 tools"},
+	{"tool names must be unique, %q is defined twice", "工具名称不能重复，%q 定义了两次"},
+	{"tool %q is not defined in tools", "工具 %q 未在 tools 中定义"},
+	{"tool_use id %q is used more than once", "tool_use id %q 被重复使用"},
+	{"tool_result block %q does not match a tool_use block in the previous message", "tool_result 块 %q 没有对应上一条消息中的 tool_use 块"},
+	{"tool_use id %q of the previous message has no tool_result block in this message", "上一条消息的 tool_use id %q 在本条消息中没有对应的 tool_result 块"},
+	{"tool_use blocks are only allowed in assistant messages", "tool_use 块只能出现在 assistant 消息中"},
+	{"tool_result blocks are only allowed in user messages", "tool_result 块只能出现在 user 消息中"},
+	{"thinking blocks are only allowed in assistant messages", "thinking 块只能出现在 assistant 消息中"},
+	{"redacted_thinking blocks are only allowed in assistant messages", "redacted_thinking 块只能出现在 assistant 消息中"},
+}
+
+// ParseLocale returns the first supported language of an Accept-Language
+// header in order of preference
+func ParseLocale(header string) (string, bool) {
+	type tag struct {
+		lang    string
+		quality float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		tags = append(tags, tag{strings.ToLower(lang), quality})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+	for _, t := range tags {
+		base, _, _ := strings.Cut(t.lang, "-")
+		if t.quality > 0 && (base == LocaleZH || base == LocaleEN) {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// WithLocale attaches the error message locale of a request to the context,
+// so errors built for the request use its language
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// localeFrom returns the error message locale of a request, if any
+func localeFrom(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
+
+// in returns the phrase in the locale, or in fallback when no locale is set
+func (p phrase) in(locale, fallback string) string {
+	if locale == "" {
+		locale = fallback
+	}
+	if locale == LocaleZH {
+		return p.zh
+	}
+	return p.en
+}
+
+// Message returns a message the proxy generates itself in the locale,
+// English by default. Messages that are not in errorPhrases are returned
+// unchanged.
+func Message(locale, message string) string {
+	for _, p := range errorPhrases {
+		if p.en == message {
+			return p.in(locale, LocaleEN)
+		}
+	}
+	return message
+}
+
+// RequestMessage returns a message the proxy generates itself in the locale
+// of the request
+func RequestMessage(c *gin.Context, message string) string {
+	return Message(c.GetString(LocaleContextKey), message)
+}
+
+// Messagef formats a message the proxy generates itself with the format of
+// the locale, looked up by its English format
+func Messagef(locale, format string, args ...interface{}) string {
+	return fmt.Sprintf(Message(locale, format), args...)
+}
+
+// RequestMessagef formats a message the proxy generates itself in the locale
+// of the request
+func RequestMessagef(c *gin.Context, format string, args ...interface{}) string {
+	return Messagef(c.GetString(LocaleContextKey), format, args...)
+}
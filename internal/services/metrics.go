@@ -0,0 +1,515 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRecentErrors is the number of failed requests kept for monitoring
+const maxRecentErrors = 20
+
+// metricsContextKey stores the tracked request in the gin context
+const metricsContextKey = "metrics_request"
+
+// MetricsService keeps live request statistics for monitoring tools such as
+// claudeproxy top. Counters only grow, so clients derive rates from the
+// difference between two snapshots.
+type MetricsService struct {
+	started time.Time
+
+	mu            sync.Mutex
+	active        map[*TrackedRequest]struct{}
+	models        map[string]*ModelMetrics
+	errors        []RequestError
+	totalRequests int64
+
+	// Unsupported content blocks in requests by type, see unknown_content_policy
+	unknownContent map[string]int64
+
+	// Upstream transfer counters, see UpstreamTransfer
+	upstreamRequests      atomic.Int64
+	upstreamCompressed    atomic.Int64
+	upstreamSentBytes     atomic.Int64
+	upstreamBodyBytes     atomic.Int64
+	upstreamResponseBytes atomic.Int64
+}
+
+// TrackedRequest is an API request in flight
+type TrackedRequest struct {
+	metrics *MetricsService
+
+	id    string
+	path  string
+	start time.Time
+	bytes atomic.Int64 // Response bytes written so far
+
+	mu      sync.Mutex
+	model   string
+	stream  bool
+	failure string // Error reported while streaming
+	stack   string // Stack of a panic recovered while streaming
+	ended   bool
+	taps    map[chan []byte]struct{}
+}
+
+// ModelMetrics are the cumulative counters of one upstream model
+type ModelMetrics struct {
+	Requests      int64 `json:"requests"`
+	Errors        int64 `json:"errors"`
+	InputTokens   int64 `json:"input_tokens"`
+	OutputTokens  int64 `json:"output_tokens"`
+	StreamBytes   int64 `json:"stream_bytes"`   // Includes streams still in flight
+	Filtered      int64 `json:"filtered"`       // Responses stopped by the upstream content filter
+	SkippedChunks int64 `json:"skipped_chunks"` // Stream events that were not chat completion chunks
+
+	// Prompt cache reads reported by the upstream, see RecordCachedTokens
+	CacheReads   int64 `json:"cache_reads"`   // Requests with part of the prompt read from the cache
+	CachedTokens int64 `json:"cached_tokens"` // Input tokens read from the cache
+
+	// Streams with a measured first token, see RecordStreamTiming
+	TimedStreams int64 `json:"timed_streams"`
+	FirstTokenMs int64 `json:"first_token_ms"` // Summed time from the upstream request to the first token
+	SlowStreams  int64 `json:"slow_streams"`   // First token later than slow_first_token_seconds
+	StreamTokens int64 `json:"stream_tokens"`  // Output tokens of timed streams
+	GenerationMs int64 `json:"generation_ms"`  // Summed time from the first token to the end of the stream
+}
+
+// StreamingStats summarizes the timed streams of a model
+type StreamingStats struct {
+	Streams            int64   `json:"streams"`
+	AvgFirstTokenMs    int64   `json:"avg_first_token_ms"`
+	AvgTokensPerSecond float64 `json:"avg_tokens_per_second"`
+	SlowStreams        int64   `json:"slow_streams"`
+}
+
+// CacheStats summarizes the prompt cache reads of a model
+type CacheStats struct {
+	Requests     int64   `json:"requests"`
+	CacheReads   int64   `json:"cache_reads"`
+	InputTokens  int64   `json:"input_tokens"`
+	CachedTokens int64   `json:"cached_tokens"`
+	HitRate      float64 `json:"hit_rate"` // Share of the input tokens read from the cache
+}
+
+// ActiveRequest describes a request in flight
+type ActiveRequest struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Model     string    `json:"model"`
+	Stream    bool      `json:"stream"`
+	StartedAt time.Time `json:"started_at"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// RequestError describes a failed request
+type RequestError struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Model     string    `json:"model"`
+	Status    int       `json:"status"`
+	Message   string    `json:"message"`
+	Stack     string    `json:"stack,omitempty"` // Stack of a recovered panic
+}
+
+// UpstreamTransfer counts the body bytes exchanged with upstreams, retries
+// and health checks included
+type UpstreamTransfer struct {
+	Requests           int64 `json:"requests"`
+	CompressedRequests int64 `json:"compressed_requests"`
+	RequestBytes       int64 `json:"request_bytes"`              // Sent, after compression
+	UncompressedBytes  int64 `json:"uncompressed_request_bytes"` // Request bodies before compression
+	ResponseBytes      int64 `json:"response_bytes"`             // Received, after transparent decompression
+}
+
+// MetricsSnapshot is the state reported by GET /admin/stats
+type MetricsSnapshot struct {
+	Time           time.Time               `json:"time"`
+	UptimeSeconds  int64                   `json:"uptime_seconds"`
+	TotalRequests  int64                   `json:"total_requests"`
+	Active         []ActiveRequest         `json:"active"`
+	Models         map[string]ModelMetrics `json:"models"`
+	RecentErrors   []RequestError          `json:"recent_errors"`
+	Upstream       UpstreamTransfer        `json:"upstream"`
+	UnknownContent map[string]int64        `json:"unknown_content,omitempty"` // Unsupported content blocks by type
+}
+
+// NewMetricsService creates a new metrics service
+func NewMetricsService() *MetricsService {
+	return &MetricsService{
+		started:        time.Now(),
+		active:         make(map[*TrackedRequest]struct{}),
+		models:         make(map[string]*ModelMetrics),
+		unknownContent: make(map[string]int64),
+	}
+}
+
+// Begin starts tracking a request and attaches it to the gin context
+func (m *MetricsService) Begin(c *gin.Context, requestID string) *TrackedRequest {
+	req := &TrackedRequest{metrics: m, id: requestID, path: c.Request.URL.Path, start: time.Now()}
+	c.Set(metricsContextKey, req)
+
+	m.mu.Lock()
+	m.active[req] = struct{}{}
+	m.totalRequests++
+	m.mu.Unlock()
+	return req
+}
+
+// AddBytes counts response bytes written for the request
+func (r *TrackedRequest) AddBytes(n int) {
+	r.bytes.Add(int64(n))
+}
+
+// End stops tracking a request. Requests answered with an error status or
+// that reported a streaming failure are added to the recent errors.
+func (m *MetricsService) End(req *TrackedRequest, status int, message string) {
+	req.mu.Lock()
+	model, stream, failure, stack := req.model, req.stream, req.failure, req.stack
+	req.ended = true
+	for tap := range req.taps {
+		close(tap)
+	}
+	req.taps = nil
+	req.mu.Unlock()
+
+	if failure != "" && status < 400 {
+		message = failure
+	}
+	failed := status >= 400 || failure != ""
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.active, req)
+	if model != "" {
+		counters := m.modelMetrics(model)
+		counters.Requests++
+		if stream {
+			counters.StreamBytes += req.bytes.Load()
+		}
+		if failed {
+			counters.Errors++
+		}
+	}
+	if failed {
+		m.errors = append(m.errors, RequestError{
+			Time:      time.Now(),
+			RequestID: req.id,
+			Model:     model,
+			Status:    status,
+			Message:   message,
+			Stack:     stack,
+		})
+		if len(m.errors) > maxRecentErrors {
+			m.errors = m.errors[len(m.errors)-maxRecentErrors:]
+		}
+	}
+}
+
+// recordUpstreamRequest counts a request sent upstream with its body size on
+// the wire and before compression
+func (m *MetricsService) recordUpstreamRequest(sent, uncompressed int) {
+	m.upstreamRequests.Add(1)
+	if sent < uncompressed {
+		m.upstreamCompressed.Add(1)
+	}
+	m.upstreamSentBytes.Add(int64(sent))
+	m.upstreamBodyBytes.Add(int64(uncompressed))
+}
+
+// recordUnknownContent counts a request content block of a type the
+// conversion does not support
+func (m *MetricsService) recordUnknownContent(contentType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unknownContent[contentType]++
+}
+
+// modelMetrics returns the counters of a model; m.mu must be held
+func (m *MetricsService) modelMetrics(model string) *ModelMetrics {
+	counters, ok := m.models[model]
+	if !ok {
+		counters = &ModelMetrics{}
+		m.models[model] = counters
+	}
+	return counters
+}
+
+// StreamingStats returns the first token latency and throughput of the
+// streams of every model
+func (m *MetricsService) StreamingStats() map[string]StreamingStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[string]StreamingStats)
+	for model, counters := range m.models {
+		if counters.TimedStreams == 0 {
+			continue
+		}
+		summary := StreamingStats{
+			Streams:         counters.TimedStreams,
+			AvgFirstTokenMs: counters.FirstTokenMs / counters.TimedStreams,
+			SlowStreams:     counters.SlowStreams,
+		}
+		if counters.GenerationMs > 0 {
+			summary.AvgTokensPerSecond = float64(counters.StreamTokens) / (float64(counters.GenerationMs) / 1000)
+		}
+		stats[model] = summary
+	}
+	return stats
+}
+
+// CacheStats returns the prompt cache hit rate of every model with
+// reported input tokens
+func (m *MetricsService) CacheStats() map[string]CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[string]CacheStats)
+	for model, counters := range m.models {
+		if counters.InputTokens == 0 {
+			continue
+		}
+		stats[model] = CacheStats{
+			Requests:     counters.Requests,
+			CacheReads:   counters.CacheReads,
+			InputTokens:  counters.InputTokens,
+			CachedTokens: counters.CachedTokens,
+			HitRate:      float64(counters.CachedTokens) / float64(counters.InputTokens),
+		}
+	}
+	return stats
+}
+
+// Snapshot returns the current statistics
+func (m *MetricsService) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	snapshot := MetricsSnapshot{
+		Time:          now,
+		UptimeSeconds: int64(now.Sub(m.started).Seconds()),
+		TotalRequests: m.totalRequests,
+		Active:        make([]ActiveRequest, 0, len(m.active)),
+		Models:        make(map[string]ModelMetrics, len(m.models)),
+		RecentErrors:  append([]RequestError(nil), m.errors...),
+		Upstream: UpstreamTransfer{
+			Requests:           m.upstreamRequests.Load(),
+			CompressedRequests: m.upstreamCompressed.Load(),
+			RequestBytes:       m.upstreamSentBytes.Load(),
+			UncompressedBytes:  m.upstreamBodyBytes.Load(),
+			ResponseBytes:      m.upstreamResponseBytes.Load(),
+		},
+	}
+	for model, counters := range m.models {
+		snapshot.Models[model] = *counters
+	}
+	if len(m.unknownContent) > 0 {
+		snapshot.UnknownContent = make(map[string]int64, len(m.unknownContent))
+		for contentType, count := range m.unknownContent {
+			snapshot.UnknownContent[contentType] = count
+		}
+	}
+
+	for req := range m.active {
+		req.mu.Lock()
+		active := ActiveRequest{
+			ID:        req.id,
+			Path:      req.path,
+			Model:     req.model,
+			Stream:    req.stream,
+			StartedAt: req.start,
+			Bytes:     req.bytes.Load(),
+		}
+		req.mu.Unlock()
+		snapshot.Active = append(snapshot.Active, active)
+
+		// Count bytes of streams in flight so throughput is smooth
+		if active.Stream && active.Model != "" {
+			counters := snapshot.Models[active.Model]
+			counters.StreamBytes += active.Bytes
+			snapshot.Models[active.Model] = counters
+		}
+	}
+	sort.Slice(snapshot.Active, func(i, j int) bool {
+		return snapshot.Active[i].StartedAt.Before(snapshot.Active[j].StartedAt)
+	})
+
+	return snapshot
+}
+
+// trackedRequest returns the request tracked for the gin context, if any
+func trackedRequest(c *gin.Context) *TrackedRequest {
+	if value, ok := c.Get(metricsContextKey); ok {
+		if req, ok := value.(*TrackedRequest); ok {
+			return req
+		}
+	}
+	return nil
+}
+
+// TrackModel records the upstream model and mode of the current request
+func TrackModel(c *gin.Context, model string, stream bool) {
+	if req := trackedRequest(c); req != nil {
+		req.mu.Lock()
+		req.model, req.stream = model, stream
+		req.mu.Unlock()
+	}
+}
+
+// RecordUsage adds the token usage of the current request to its model
+func RecordUsage(c *gin.Context, inputTokens, outputTokens int) {
+	c.Set(upstreamUsageContextKey, upstreamUsage{inputTokens: inputTokens, outputTokens: outputTokens})
+	if transcript := usageTranscriptFor(c); transcript != nil {
+		transcript.mu.Lock()
+		transcript.record.UsageReported = true
+		transcript.record.UpstreamInputTokens = inputTokens
+		transcript.record.UpstreamOutputTokens = outputTokens
+		transcript.mu.Unlock()
+	}
+
+	req := trackedRequest(c)
+	if req == nil {
+		return
+	}
+	req.mu.Lock()
+	model := req.model
+	req.mu.Unlock()
+	if model == "" {
+		return
+	}
+
+	req.metrics.mu.Lock()
+	defer req.metrics.mu.Unlock()
+	counters := req.metrics.modelMetrics(model)
+	counters.InputTokens += int64(inputTokens)
+	counters.OutputTokens += int64(outputTokens)
+}
+
+// RecordContentFilter counts a response of the current request that the
+// upstream content filter stopped
+func RecordContentFilter(c *gin.Context) {
+	req := trackedRequest(c)
+	if req == nil {
+		return
+	}
+	req.mu.Lock()
+	model := req.model
+	req.mu.Unlock()
+	if model == "" {
+		return
+	}
+
+	req.metrics.mu.Lock()
+	defer req.metrics.mu.Unlock()
+	req.metrics.modelMetrics(model).Filtered++
+}
+
+// RecordCachedTokens adds the input tokens of the current request that the
+// upstream read from its prompt cache to its model
+func RecordCachedTokens(c *gin.Context, cachedTokens int) {
+	if cachedTokens <= 0 {
+		return
+	}
+	req := trackedRequest(c)
+	if req == nil {
+		return
+	}
+	req.mu.Lock()
+	model := req.model
+	req.mu.Unlock()
+	if model == "" {
+		return
+	}
+
+	req.metrics.mu.Lock()
+	defer req.metrics.mu.Unlock()
+	counters := req.metrics.modelMetrics(model)
+	counters.CacheReads++
+	counters.CachedTokens += int64(cachedTokens)
+}
+
+// RecordSkippedChunk counts a stream event of the current request that was
+// skipped as it was not a chat completion chunk
+func RecordSkippedChunk(c *gin.Context) {
+	req := trackedRequest(c)
+	if req == nil {
+		return
+	}
+	req.mu.Lock()
+	model := req.model
+	req.mu.Unlock()
+	if model == "" {
+		return
+	}
+
+	req.metrics.mu.Lock()
+	defer req.metrics.mu.Unlock()
+	req.metrics.modelMetrics(model).SkippedChunks++
+}
+
+// RecordStreamTiming adds the time to the first token, the output tokens and
+// the generation time of a stream to its model and keeps them for the
+// access log
+func RecordStreamTiming(c *gin.Context, firstToken time.Duration, tokens int, generation time.Duration, slow bool) {
+	c.Set(FirstTokenContextKey, firstToken.Milliseconds())
+	if generation > 0 {
+		c.Set(TokensPerSecondContextKey, float64(tokens)/generation.Seconds())
+	}
+	if slow {
+		c.Set(SlowFirstTokenContextKey, true)
+	}
+
+	req := trackedRequest(c)
+	if req == nil {
+		return
+	}
+	req.mu.Lock()
+	model := req.model
+	req.mu.Unlock()
+	if model == "" {
+		return
+	}
+
+	req.metrics.mu.Lock()
+	defer req.metrics.mu.Unlock()
+	counters := req.metrics.modelMetrics(model)
+	counters.TimedStreams++
+	counters.FirstTokenMs += firstToken.Milliseconds()
+	counters.StreamTokens += int64(tokens)
+	counters.GenerationMs += generation.Milliseconds()
+	if slow {
+		counters.SlowStreams++
+	}
+}
+
+// RecordFailure marks the current request as failed after its status was
+// already sent, as happens when a stream breaks off
+func RecordFailure(c *gin.Context, message string) {
+	if transcript := usageTranscriptFor(c); transcript != nil {
+		transcript.mu.Lock()
+		transcript.record.Error = message
+		transcript.mu.Unlock()
+	}
+	if req := trackedRequest(c); req != nil {
+		req.mu.Lock()
+		req.failure = message
+		req.mu.Unlock()
+	}
+}
+
+// RecordPanic marks the current request as failed by a panic recovered after
+// its status was sent, keeping the stack with the recent errors
+func RecordPanic(c *gin.Context, message string, stack []byte) {
+	RecordFailure(c, message)
+	if req := trackedRequest(c); req != nil {
+		req.mu.Lock()
+		req.stack = string(stack)
+		req.mu.Unlock()
+	}
+}
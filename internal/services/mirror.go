@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// mirrorContextKey stores the mirrored request in the gin context
+	mirrorContextKey = "mirror_pair"
+
+	mirrorTimeout          = 2 * time.Minute
+	maxMirrorsInFlight     = 8 // Further requests are not mirrored until one completes
+	maxMirrorResponseBytes = 16 * 1024 * 1024
+)
+
+// MirrorResult summarizes the response of one side of a mirrored request
+type MirrorResult struct {
+	Model        string        `json:"model"`
+	LatencyMs    int64         `json:"latency_ms"` // Until the response was complete
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+	Cost         *float64      `json:"cost,omitempty"`        // Estimated from the price table
+	TextLength   int           `json:"text_length"`           // Characters of text in the answer
+	ToolCalls    []string      `json:"tool_calls,omitempty"`  // Names of the called tools, in order
+	StopReason   string        `json:"stop_reason,omitempty"` // Anthropic stop reason
+	Content      []interface{} `json:"content,omitempty"`     // Content blocks of the answer
+	Error        string        `json:"error,omitempty"`
+}
+
+// MirrorRecord pairs the response the client received with the response of
+// the shadow model to the same request
+type MirrorRecord struct {
+	Time      time.Time    `json:"time"`
+	RequestID string       `json:"request_id"`
+	Key       string       `json:"key,omitempty"` // Name of the local API key
+	Stream    bool         `json:"stream"`
+	Primary   MirrorResult `json:"primary"`
+	Shadow    MirrorResult `json:"shadow"`
+	SameTools bool         `json:"same_tools"` // Both called the same tools in the same order
+}
+
+// mirrorPair is a mirrored request in flight
+type mirrorPair struct {
+	record     MirrorRecord
+	start      time.Time
+	writer     *mirrorWriter
+	shadowDone chan struct{} // Closed once record.Shadow is set
+}
+
+// mirrorWriter keeps a copy of the primary response
+type mirrorWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *mirrorWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.record(data[:n])
+	return n, err
+}
+
+func (w *mirrorWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.record([]byte(s[:n]))
+	return n, err
+}
+
+func (w *mirrorWriter) record(data []byte) {
+	if w.body.Len()+len(data) > maxMirrorResponseBytes {
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
+
+// MirrorService sends a share of the message requests to a shadow model as
+// well and records both responses in the storage backend for
+// "claudeproxy compare". The client only
+// ever receives the primary response.
+type MirrorService struct {
+	config     *config.Config
+	logger     *logrus.Logger
+	client     *OpenAIClient
+	conversion *ConversionService
+	pricing    *PricingService
+	storage    Storage
+
+	inFlight atomic.Int32
+}
+
+// NewMirrorService creates the mirror service, or returns nil when mirroring
+// is disabled. Requests to Anthropic-native upstreams are not converted and
+// are never mirrored.
+func NewMirrorService(cfg *config.Config, logger *logrus.Logger, client *OpenAIClient, conversion *ConversionService, pricing *PricingService, storage Storage) *MirrorService {
+	if cfg.Mirror.Model == "" || cfg.Mirror.Percent <= 0 || client.IsAnthropicUpstream() {
+		return nil
+	}
+	logger.WithFields(logrus.Fields{
+		"shadow_model": cfg.Mirror.Model,
+		"percent":      cfg.Mirror.Percent,
+	}).Info("Mirroring requests to shadow model")
+	return &MirrorService{
+		config:     cfg,
+		logger:     logger,
+		client:     client,
+		conversion: conversion,
+		pricing:    pricing,
+		storage:    storage,
+	}
+}
+
+// Start sends a sampled request to the shadow model in the background and
+// starts capturing the primary response for Finish. Requests sent with the
+// client's own upstream key are never mirrored, as the shadow would be billed
+// to the configured keys.
+func (m *MirrorService) Start(c *gin.Context, req *models.OpenAIRequest) {
+	if m == nil || clientKey(c.Request.Context()) != "" || !m.sampled(req.Model) {
+		return
+	}
+	if m.inFlight.Add(1) > maxMirrorsInFlight {
+		m.inFlight.Add(-1)
+		m.logger.Debug("Too many mirrored requests in flight, not mirroring")
+		return
+	}
+
+	// A copy, as the primary request may still change while the shadow is sent
+	shadowReq, err := m.shadowRequest(req)
+	if err != nil {
+		m.inFlight.Add(-1)
+		m.logger.WithError(err).Warn("Failed to copy request for mirroring")
+		return
+	}
+
+	pair := &mirrorPair{
+		record: MirrorRecord{
+			Time:      time.Now().UTC(),
+			RequestID: c.GetString("request_id"),
+			Key:       c.GetString(LocalKeyContextKey),
+			Stream:    req.Stream,
+			Primary:   MirrorResult{Model: req.Model},
+		},
+		start:      time.Now(),
+		writer:     &mirrorWriter{ResponseWriter: c.Writer},
+		shadowDone: make(chan struct{}),
+	}
+	c.Writer = pair.writer
+	c.Set(mirrorContextKey, pair)
+
+	go func() {
+		defer m.inFlight.Add(-1)
+		pair.record.Shadow = m.sendShadow(shadowReq)
+		close(pair.shadowDone)
+	}()
+}
+
+// Finish summarizes the primary response and stores the record once the
+// shadow response is in as well
+func (m *MirrorService) Finish(c *gin.Context) {
+	value, ok := c.Get(mirrorContextKey)
+	if m == nil || !ok {
+		return
+	}
+	pair := value.(*mirrorPair)
+
+	primary := &pair.record.Primary
+	primary.LatencyMs = time.Since(pair.start).Milliseconds()
+	if value, ok := c.Get(upstreamUsageContextKey); ok {
+		usage := value.(upstreamUsage)
+		primary.InputTokens, primary.OutputTokens = usage.inputTokens, usage.outputTokens
+	}
+	if value, ok := c.Get(estimatedCostContextKey); ok {
+		cost := value.(float64)
+		primary.Cost = &cost
+	}
+	switch status := c.Writer.Status(); {
+	case status != http.StatusOK:
+		primary.Error = http.StatusText(status)
+	case pair.writer.truncated:
+		primary.Error = "response too large to compare"
+	default:
+		content, stopReason := ParseResponseContent(pair.writer.Header().Get("Content-Type"), pair.writer.body.Bytes())
+		primary.summarize(content, stopReason)
+	}
+
+	go func() {
+		<-pair.shadowDone
+		record := &pair.record
+		record.SameTools = sameTools(record.Primary.ToolCalls, record.Shadow.ToolCalls)
+		if err := m.storage.AppendMirror(record); err != nil {
+			m.logger.WithError(err).Warn("Failed to write mirror record")
+			return
+		}
+		m.logger.WithFields(logrus.Fields{
+			"request_id":      record.RequestID,
+			"primary_model":   record.Primary.Model,
+			"shadow_model":    record.Shadow.Model,
+			"primary_latency": record.Primary.LatencyMs,
+			"shadow_latency":  record.Shadow.LatencyMs,
+			"primary_output":  record.Primary.OutputTokens,
+			"shadow_output":   record.Shadow.OutputTokens,
+			"same_tools":      record.SameTools,
+			"shadow_error":    record.Shadow.Error,
+		}).Info("Mirrored request completed")
+	}()
+}
+
+// sampled reports whether a request to the upstream model is mirrored
+func (m *MirrorService) sampled(model string) bool {
+	mirror := m.config.Mirror
+	if model == mirror.Model {
+		return false
+	}
+	if len(mirror.Models) > 0 {
+		listed := false
+		for _, name := range mirror.Models {
+			listed = listed || name == model
+		}
+		if !listed {
+			return false
+		}
+	}
+	return rand.Intn(100) < mirror.Percent
+}
+
+// shadowRequest returns a deep copy of the request for the shadow model. The
+// shadow response is only summarized, so it is requested without streaming.
+func (m *MirrorService) shadowRequest(req *models.OpenAIRequest) (*models.OpenAIRequest, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var shadow models.OpenAIRequest
+	if err := json.Unmarshal(data, &shadow); err != nil {
+		return nil, err
+	}
+	shadow.Model = m.config.Mirror.Model
+	shadow.Stream = false
+	shadow.ToolNames = req.ToolNames
+	return &shadow, nil
+}
+
+// sendShadow sends the request to the shadow upstream and summarizes the
+// response as the client would have received it
+func (m *MirrorService) sendShadow(req *models.OpenAIRequest) MirrorResult {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+
+	result := MirrorResult{Model: req.Model}
+	start := time.Now()
+	var resp *models.OpenAIResponse
+	var err error
+	if mirror := m.config.Mirror; mirror.BaseURL != "" {
+		// The primary key never goes to the shadow upstream
+		resp, err = m.client.createChatCompletion(ctx, req, upstream{
+			name:    "mirror",
+			baseURL: mirror.BaseURL,
+			apiKey:  mirror.APIKey,
+			headers: mirror.CustomHeaders,
+		})
+	} else {
+		resp, err = m.client.createPrimaryChatCompletion(ctx, req)
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.InputTokens, result.OutputTokens = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+	if price, ok := m.pricing.Price(req.Model); ok {
+		cost := (float64(result.InputTokens)*price.InputPerMillion + float64(result.OutputTokens)*price.OutputPerMillion) / 1e6
+		result.Cost = &cost
+	}
+
+	anthropicResp, err := m.conversion.ConvertOpenAIToAnthropic(resp, req.Model)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	restoreToolNames(req.ToolNames, anthropicResp)
+	data, _ := json.Marshal(anthropicResp.Content)
+	var content []interface{}
+	json.Unmarshal(data, &content)
+	result.summarize(content, anthropicResp.StopReason)
+	return result
+}
+
+// summarize records the content blocks of an answer with their text
+// length, tool calls and stop reason
+func (r *MirrorResult) summarize(content []interface{}, stopReason string) {
+	r.Content, r.StopReason = content, stopReason
+	for _, item := range content {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			text, _ := block["text"].(string)
+			r.TextLength += utf8.RuneCountInString(text)
+		case "tool_use":
+			name, _ := block["name"].(string)
+			r.ToolCalls = append(r.ToolCalls, name)
+		}
+	}
+}
+
+// sameTools reports whether two answers called the same tools in the same order
+func sameTools(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// TestMirrorSkipsClientKeys checks that requests sent with the client's own
+// upstream key are never mirrored with the configured keys
+func TestMirrorSkipsClientKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := make(chan string, 4)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		keys <- r.Header.Get("Authorization")
+		http.Error(w, `{"error":{"message":"stop"}}`, http.StatusBadRequest)
+	}))
+	defer upstreamServer.Close()
+
+	cfg := &config.Config{
+		OpenAIBaseURL: upstreamServer.URL,
+		OpenAIAPIKey:  "pool-key",
+		Mirror:        config.MirrorConfig{Model: "shadow-model", Percent: 100},
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	mirror := NewMirrorService(cfg, logger, NewOpenAIClient(cfg, logger, nil, NewMetricsService()), nil, nil, nil)
+
+	start := func(clientKey string) bool {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		if clientKey != "" {
+			c.Request = c.Request.WithContext(WithClientKey(c.Request.Context(), clientKey))
+		}
+		mirror.Start(c, &models.OpenAIRequest{Model: "primary-model"})
+		_, mirrored := c.Get(mirrorContextKey)
+		return mirrored
+	}
+
+	if start("client-key") {
+		t.Fatal("request with a client key was mirrored")
+	}
+	select {
+	case key := <-keys:
+		t.Fatalf("shadow request sent with %q for a request with a client key", key)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Without a client key the shadow goes out with the configured key
+	if !start("") {
+		t.Fatal("request without a client key was not mirrored")
+	}
+	select {
+	case key := <-keys:
+		if key != "Bearer pool-key" {
+			t.Fatalf("shadow request sent with %q, want the configured key", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow request was not sent")
+	}
+}
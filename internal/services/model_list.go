@@ -0,0 +1,122 @@
+package services
+
+import (
+	"sort"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+// Schemas of the model list
+const (
+	ModelListOpenAI    = "openai"
+	ModelListAnthropic = "anthropic"
+)
+
+// Sources of the models in the model list
+const (
+	ModelSourceConfig   = "config"
+	ModelSourceUpstream = "upstream"
+)
+
+// ModelListEntry is a model of the model list with what the proxy knows
+// about it
+type ModelListEntry struct {
+	ID           string                `json:"id"`
+	Roles        []string              `json:"roles,omitempty"` // "big", "small", "big@<pair>", "small@<pair>"
+	Sources      []string              `json:"sources"`         // "config" and/or "upstream"
+	Provider     string                `json:"provider,omitempty"`
+	Created      int64                 `json:"-"`
+	Capabilities ModelListCapabilities `json:"capabilities"`
+}
+
+// ModelListCapabilities are the capabilities the proxy assumes for a model, from
+// model_settings and the model registry
+type ModelListCapabilities struct {
+	Vision          bool `json:"vision"`
+	Tools           bool `json:"tools"`
+	JSONSchema      bool `json:"json_schema"`
+	PromptCache     bool `json:"prompt_cache"`
+	ContextWindow   int  `json:"context_window,omitempty"`
+	MaxOutputTokens int  `json:"max_output_tokens,omitempty"`
+}
+
+// ListModels merges the configured models with the models of the upstream
+// and describes each with the model registry, falling back to the context
+// length the upstream reports. Configured models come first: the big and
+// small model, the models of model pairs, then models with a dedicated
+// upstream or settings of their own.
+func (s *ModelSelectorService) ListModels(upstreamModels []UpstreamModel) []ModelListEntry {
+	var entries []ModelListEntry
+	index := make(map[string]int)
+	add := func(id, source, role string) *ModelListEntry {
+		if id == "" {
+			return nil
+		}
+		i, ok := index[id]
+		if !ok {
+			i = len(entries)
+			index[id] = i
+			entries = append(entries, ModelListEntry{ID: id})
+		}
+		entry := &entries[i]
+		if !containsString(entry.Sources, source) {
+			entry.Sources = append(entry.Sources, source)
+		}
+		if role != "" && !containsString(entry.Roles, role) {
+			entry.Roles = append(entry.Roles, role)
+		}
+		return entry
+	}
+
+	add(s.config.BigModelName, ModelSourceConfig, config.TierBig)
+	add(s.config.SmallModelName, ModelSourceConfig, config.TierSmall)
+	pairs := make([]string, 0, len(s.config.ModelPairs))
+	for name := range s.config.ModelPairs {
+		pairs = append(pairs, name)
+	}
+	sort.Strings(pairs)
+	for _, name := range pairs {
+		pair := s.config.ModelPairs[name]
+		add(pair.Big, ModelSourceConfig, config.TierBig+modelPairSeparator+name)
+		add(pair.Small, ModelSourceConfig, config.TierSmall+modelPairSeparator+name)
+	}
+	var others []string
+	for model := range s.config.Upstreams {
+		others = append(others, model)
+	}
+	for model := range s.config.ModelSettings {
+		others = append(others, model)
+	}
+	sort.Strings(others)
+	for _, model := range others {
+		add(model, ModelSourceConfig, "")
+	}
+	upstreamContext := make(map[string]int)
+	for _, model := range upstreamModels {
+		if entry := add(model.ID, ModelSourceUpstream, ""); entry != nil {
+			entry.Created = model.Created
+			upstreamContext[model.ID] = model.ContextLength
+		}
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		caps := s.config.Capabilities(entry.ID)
+		entry.Provider = caps.Provider
+		entry.Capabilities = ModelListCapabilities{
+			Vision:          s.config.SupportsVision(entry.ID),
+			Tools:           s.config.SupportsTools(entry.ID),
+			JSONSchema:      s.config.SupportsJSONSchema(entry.ID),
+			PromptCache:     s.config.CachesPrompts(entry.ID),
+			ContextWindow:   caps.ContextWindow,
+			MaxOutputTokens: caps.MaxOutputTokens,
+		}
+		if entry.Capabilities.ContextWindow == 0 {
+			entry.Capabilities.ContextWindow = upstreamContext[entry.ID]
+		}
+		if limit := s.config.ModelSetting(entry.ID).MaxOutputTokens; limit > 0 {
+			entry.Capabilities.MaxOutputTokens = limit
+		}
+	}
+	return entries
+}
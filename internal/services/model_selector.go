@@ -9,6 +9,32 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// reasonUnknownModel is the selection reason used when the client model is not recognized
+const reasonUnknownModel = "unknown model, defaulting to small"
+
+// ModelPairContextKey stores the model pair of the local API key in the gin context
+const ModelPairContextKey = "model_pair"
+
+// modelPairSeparator separates a client model from the model pair name, as in "claude-sonnet-4@cheap"
+const modelPairSeparator = "@"
+
+// WithModelPair appends a model pair selection to a client model, unless the
+// model already selects one
+func WithModelPair(model, pair string) string {
+	if pair == "" || strings.Contains(model, modelPairSeparator) {
+		return model
+	}
+	return model + modelPairSeparator + pair
+}
+
+// splitModelPair separates the model pair name from a client model
+func splitModelPair(model string) (string, string) {
+	if i := strings.LastIndex(model, modelPairSeparator); i >= 0 {
+		return model[:i], model[i+1:]
+	}
+	return model, ""
+}
+
 // ModelSelectorService handles model selection logic
 type ModelSelectorService struct {
 	config *config.Config
@@ -35,32 +61,19 @@ func (s *ModelSelectorService) SelectModel(anthropicModel string, req *models.An
 		"message_count":   len(req.Messages),
 	}).Debug("Selecting model")
 
-	// Follow Python project logic for model selection
-	clientModelLower := strings.ToLower(anthropicModel)
-	var targetModel string
-
-	if strings.Contains(clientModelLower, "opus") || strings.Contains(clientModelLower, "sonnet") {
-		targetModel = s.config.BigModelName
-		s.logger.WithFields(logrus.Fields{
-			"client_model": anthropicModel,
-			"target_model": targetModel,
-			"reason":       "opus/sonnet detected",
-		}).Debug("Selected big model")
-	} else if strings.Contains(clientModelLower, "haiku") {
-		targetModel = s.config.SmallModelName
+	targetModel, reason := s.resolveModel(anthropicModel)
+	if reason == reasonUnknownModel {
 		s.logger.WithFields(logrus.Fields{
 			"client_model": anthropicModel,
 			"target_model": targetModel,
-			"reason":       "haiku detected",
-		}).Debug("Selected small model")
+			"reason":       reason,
+		}).Warn("Unknown client model, defaulting to small model")
 	} else {
-		// Default to small model for unknown models
-		targetModel = s.config.SmallModelName
 		s.logger.WithFields(logrus.Fields{
 			"client_model": anthropicModel,
 			"target_model": targetModel,
-			"reason":       "unknown model, defaulting to small",
-		}).Warn("Unknown client model, defaulting to small model")
+			"reason":       reason,
+		}).Debug("Selected model")
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -71,6 +84,44 @@ func (s *ModelSelectorService) SelectModel(anthropicModel string, req *models.An
 	return targetModel
 }
 
+// TargetModel returns the upstream model a client model maps to without logging
+func (s *ModelSelectorService) TargetModel(anthropicModel string) string {
+	targetModel, _ := s.resolveModel(anthropicModel)
+	return targetModel
+}
+
+// Mapping returns the upstream model a client model maps to, why, and whether
+// the client model was recognized or rerouted to the small model as a fallback
+func (s *ModelSelectorService) Mapping(anthropicModel string) (target, reason string, known bool) {
+	target, reason = s.resolveModel(anthropicModel)
+	return target, reason, reason != reasonUnknownModel
+}
+
+// resolveModel maps a client model to an upstream model and explains why
+func (s *ModelSelectorService) resolveModel(anthropicModel string) (string, string) {
+	clientModel, pairName := splitModelPair(anthropicModel)
+	bigModel, smallModel := s.config.BigModelName, s.config.SmallModelName
+	if pair, ok := s.config.ModelPairs[pairName]; ok {
+		if pair.Big != "" {
+			bigModel = pair.Big
+		}
+		if pair.Small != "" {
+			smallModel = pair.Small
+		}
+	}
+
+	// The tier of the client model in the model registry selects the upstream model
+	switch s.config.Capabilities(clientModel).Tier {
+	case config.TierBig:
+		return bigModel, "big tier model"
+	case config.TierSmall:
+		return smallModel, "small tier model"
+	}
+
+	// Default to small model for unknown models
+	return smallModel, reasonUnknownModel
+}
+
 // GetModelInfo returns information about the selected model
 func (s *ModelSelectorService) GetModelInfo(modelName string) map[string]interface{} {
 	info := map[string]interface{}{
@@ -109,34 +160,24 @@ func (s *ModelSelectorService) GetAvailableModels() []map[string]interface{} {
 
 // ValidateModel checks if the requested model is supported
 func (s *ModelSelectorService) ValidateModel(modelName string) bool {
-	// Use a more flexible validation strategy that matches the Python project
-	// Accept any model that starts with "claude" and contains known model types
-	modelNameLower := strings.ToLower(modelName)
-
-	// Check if it's a Claude model
-	if !strings.HasPrefix(modelNameLower, "claude") {
+	modelName, pairName := splitModelPair(modelName)
+	if _, ok := s.config.ModelPairs[pairName]; pairName != "" && !ok {
+		s.logger.WithField("model_pair", pairName).Warn("Unknown model pair requested")
 		return false
 	}
 
-	// Known Claude model patterns that we support
-	supportedPatterns := []string{
-		"opus",
-		"sonnet",
-		"haiku",
-		"claude-2",
-		"claude-3",
-		"claude-instant",
+	// Accept any model of the Anthropic API in the model registry, as the
+	// Python project accepts any model starting with "claude"
+	caps := s.config.Capabilities(modelName)
+	if caps.Provider != "anthropic" {
+		return false
 	}
-
-	// Check if the model name contains any supported pattern
-	for _, pattern := range supportedPatterns {
-		if strings.Contains(modelNameLower, pattern) {
-			return true
-		}
+	if caps.Tier != "" {
+		return true
 	}
 
-	// If it starts with "claude" but doesn't match known patterns,
-	// still accept it but log a warning (same as Python project behavior)
+	// A model without a tier is still accepted but logged with a warning
+	// (same as Python project behavior)
 	s.logger.WithFields(logrus.Fields{
 		"model_name": modelName,
 		"reason":     "unknown_claude_model_accepting_anyway",
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"claude-code-provider-proxy/internal/config"
@@ -29,52 +32,185 @@ type OpenAIClient struct {
 	config     *config.Config
 	httpClient *http.Client
 	logger     *logrus.Logger
+	keys       *KeyPool
+	health     *HealthMonitor // Set by NewHealthMonitor, nil when not monitored
+	reporter   *ErrorReporter // Set by NewErrorReporter, nil when reporting is off
+
+	protocolWarning sync.Once
 }
 
 // NewOpenAIClient creates a new OpenAI client with optimized timeout settings
-func NewOpenAIClient(cfg *config.Config, logger *logrus.Logger) *OpenAIClient {
+func NewOpenAIClient(cfg *config.Config, logger *logrus.Logger, shared *SharedState, metrics *MetricsService) *OpenAIClient {
 	// 优化网络超时设置，避免早期连接重置
+	var transport http.RoundTripper = newUpstreamTransport(cfg.Transport, logger)
+	transport = newTransferTransport(transport, metrics, cfg.Transport.CompressRequests, logger)
+
+	// Record upstream interactions as replayable fixtures
+	if cfg.RecordDir != "" {
+		transport = newRecordingTransport(transport, cfg.RecordDir, cfg.BigModelName, cfg.SmallModelName, logger)
+		logger.WithField("record_dir", cfg.RecordDir).Info("Recording upstream interactions")
+	}
+
 	return &OpenAIClient{
 		config: cfg,
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second, // 减少总体超时
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     30 * time.Second,
-				TLSHandshakeTimeout: 10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-				DisableKeepAlives:   false, // 允许keep-alive提高效率
-			},
+			Timeout:   60 * time.Second, // 减少总体超时
+			Transport: transport,
 		},
 		logger: logger,
+		keys:   NewKeyPool(cfg, logger, shared),
+	}
+}
+
+// upstream is an OpenAI-compatible endpoint and the credentials used for it
+type upstream struct {
+	name    string
+	baseURL string
+	apiKey  string
+	key     *pooledKey        // Pool entry for apiKey, nil when the key is not pooled
+	headers map[string]string // Upstream-specific custom headers
+}
+
+// primaryUpstream returns the configured default upstream with the next pooled key
+func (c *OpenAIClient) primaryUpstream() upstream {
+	return c.upstreamFor("", "", nil)
+}
+
+// upstreamFor returns the upstream serving the given model. Models mapped in
+// the upstreams config use their own endpoint and only their own key, so the
+// pooled keys never reach another host; all others use the default upstream
+// with the next pooled key not in exclude, or the key of the session.
+func (c *OpenAIClient) upstreamFor(model, session string, exclude map[*pooledKey]bool) upstream {
+	if mapped, ok := c.config.Upstreams[model]; ok && mapped.BaseURL != "" {
+		return upstream{
+			name:    "model:" + model,
+			baseURL: mapped.BaseURL,
+			apiKey:  mapped.APIKey,
+			headers: mapped.CustomHeaders,
+		}
+	}
+
+	up := upstream{
+		name:    "primary",
+		baseURL: c.config.OpenAIBaseURL,
+		apiKey:  c.config.OpenAIAPIKey,
+	}
+	if key := c.keys.pick(session, exclude); key != nil {
+		up.apiKey = key.key
+		up.key = key
+	}
+	return up
+}
+
+// withKeyRotation runs fn against the upstream serving the model, moving on to
+// the next pooled key whenever the current one is rejected or rate limited.
+// The upstream key of a client is used alone.
+func (c *OpenAIClient) withKeyRotation(ctx context.Context, model string, fn func(up upstream) error) error {
+	if up, ok := c.clientUpstream(ctx, model); ok {
+		return fn(up)
+	}
+
+	tried := make(map[*pooledKey]bool)
+	for {
+		up := c.upstreamFor(model, sessionFrom(ctx), tried)
+		err := fn(up)
+
+		var rejected *keyRejectedError
+		if !errors.As(err, &rejected) {
+			return err
+		}
+
+		tried[up.key] = true
+		if len(tried) >= c.keys.Size() {
+			return rejected.err
+		}
+		c.logger.WithFields(logrus.Fields{
+			"key":   up.key.name,
+			"error": rejected.err.Error(),
+		}).Warn("Rotating to next upstream API key")
+	}
+}
+
+// probeTargets returns every configured upstream once, for health probing.
+// Pooled upstreams are probed with the preferred key.
+func (c *OpenAIClient) probeTargets() []upstream {
+	primary := upstream{
+		name:    "primary",
+		baseURL: c.config.OpenAIBaseURL,
+		apiKey:  c.config.OpenAIAPIKey,
+	}
+	if key := c.keys.peek(); key != nil {
+		primary.apiKey = key.key
+	}
+	targets := []upstream{primary}
+
+	models := make([]string, 0, len(c.config.Upstreams))
+	for model := range c.config.Upstreams {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		mapped := c.config.Upstreams[model]
+		if mapped.BaseURL == "" {
+			continue
+		}
+		targets = append(targets, upstream{
+			name:    "model:" + model,
+			baseURL: mapped.BaseURL,
+			apiKey:  mapped.APIKey,
+			headers: mapped.CustomHeaders,
+		})
+	}
+
+	if c.config.Hedging.BaseURL != "" {
+		targets = append(targets, c.hedgeUpstream())
 	}
+	return targets
+}
+
+// isHealthy reports whether the named upstream passed its latest health probe
+func (c *OpenAIClient) isHealthy(name string) bool {
+	return c.health == nil || c.health.IsHealthy(name)
+}
+
+// KeyHealth returns the state of the pooled upstream API keys
+func (c *OpenAIClient) KeyHealth() []KeyHealth {
+	return c.keys.Health()
 }
 
 // CreateChatCompletion sends a chat completion request to OpenAI with retry for EOF errors
 func (c *OpenAIClient) CreateChatCompletion(ctx context.Context, req *models.OpenAIRequest) (*models.OpenAIResponse, error) {
-	const maxRetries = 3
-	const retryDelay = 100 * time.Millisecond
-	
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		result, err := c.createChatCompletionWithRetry(ctx, req, attempt)
-		if err != nil {
-			// 检查是否是EOF错误
-			if isEOFError(err) && attempt < maxRetries-1 {
-				c.logger.WithFields(logrus.Fields{
-					"attempt": attempt + 1,
-					"error":   err.Error(),
-				}).Warn("Retrying EOF error")
-				// 指数退避延迟
-				time.Sleep(retryDelay * time.Duration(1<<uint(attempt)))
-				continue
-			}
-			return nil, err
-		}
-		return result, nil
+	var resp *models.OpenAIResponse
+	var err error
+	if c.shouldHedge(req) && clientKey(ctx) == "" {
+		resp, err = c.createHedgedChatCompletion(ctx, req)
+	} else {
+		resp, err = c.createPrimaryChatCompletion(ctx, req)
 	}
-	
-	return nil, fmt.Errorf("failed after %d retries: %w", maxRetries, fmt.Errorf("all retry attempts exhausted"))
+	return resp, c.translateError(ctx, err)
+}
+
+// createPrimaryChatCompletion sends a chat completion request to the upstream serving the model
+func (c *OpenAIClient) createPrimaryChatCompletion(ctx context.Context, req *models.OpenAIRequest) (*models.OpenAIResponse, error) {
+	var resp *models.OpenAIResponse
+	err := c.withKeyRotation(ctx, req.Model, func(up upstream) error {
+		var err error
+		resp, err = c.createChatCompletion(ctx, req, up)
+		return err
+	})
+	return resp, err
+}
+
+// createChatCompletion sends a chat completion request to the given upstream,
+// retrying according to the retry policy
+func (c *OpenAIClient) createChatCompletion(ctx context.Context, req *models.OpenAIRequest, up upstream) (*models.OpenAIResponse, error) {
+	var resp *models.OpenAIResponse
+	err := c.withRetries(ctx, func(attempt int) error {
+		var err error
+		resp, err = c.createChatCompletionWithRetry(ctx, req, up, attempt)
+		return err
+	})
+	return resp, err
 }
 
 // isEOFError checks if the error is an EOF or unexpected EOF error
@@ -86,7 +222,7 @@ func isEOFError(err error) bool {
 }
 
 // createChatCompletionWithRetry is the actual implementation without retry logic
-func (c *OpenAIClient) createChatCompletionWithRetry(ctx context.Context, req *models.OpenAIRequest, attempt int) (*models.OpenAIResponse, error) {
+func (c *OpenAIClient) createChatCompletionWithRetry(ctx context.Context, req *models.OpenAIRequest, up upstream, attempt int) (*models.OpenAIResponse, error) {
 	// Prepare request body
 	reqBody, err := json.Marshal(req)
 	if err != nil {
@@ -95,23 +231,24 @@ func (c *OpenAIClient) createChatCompletionWithRetry(ctx context.Context, req *m
 
 	// Debug log: detailed request info
 	c.logger.WithFields(logrus.Fields{
-		"url":     fmt.Sprintf("%s/chat/completions", c.config.OpenAIBaseURL),
-		"method":  "POST",
-		"headers": fmt.Sprintf("Content-Type=application/json, Authorization=Bearer %s...", c.config.OpenAIAPIKey[:min(len(c.config.OpenAIAPIKey), 10)]),
-		"body_length": len(reqBody),
+		"url":          fmt.Sprintf("%s/chat/completions", up.baseURL),
+		"method":       "POST",
+		"headers":      fmt.Sprintf("Content-Type=application/json, Authorization=Bearer %s...", up.apiKey[:min(len(up.apiKey), 10)]),
+		"body_length":  len(reqBody),
 		"body_preview": string(reqBody[:min(len(reqBody), 200)]),
-		"attempt": attempt,
+		"attempt":      attempt,
+		"upstream":     up.name,
 	}).Info("Making API request")
 
 	// Create HTTP request
-	url := fmt.Sprintf("%s/chat/completions", c.config.OpenAIBaseURL)
+	url := fmt.Sprintf("%s/chat/completions", up.baseURL)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
-	c.setHeaders(httpReq)
+	c.setHeaders(httpReq, up)
 
 	// Log request
 	c.logger.WithFields(logrus.Fields{
@@ -123,16 +260,22 @@ func (c *OpenAIClient) createChatCompletionWithRetry(ctx context.Context, req *m
 	// Make request
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
+		if ctx.Err() == context.Canceled {
+			// Canceled by the caller, e.g. the losing leg of a hedged request
+			return nil, fmt.Errorf("failed to make request: %w", err)
+		}
 		c.logger.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("HTTP request failed")
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
+	c.checkProtocol(resp)
 
 	// Debug log: response info
 	c.logger.WithFields(logrus.Fields{
 		"status_code": resp.StatusCode,
+		"proto":       resp.Proto,
 		"headers":     fmt.Sprintf("%v", resp.Header),
 		"attempt":     attempt,
 	}).Info("HTTP response received")
@@ -154,12 +297,14 @@ func (c *OpenAIClient) createChatCompletionWithRetry(ctx context.Context, req *m
 
 	// Check for errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.handleAPIError(resp.StatusCode, respBody)
+		return nil, c.upstreamError(ctx, up, req.Model, resp, respBody)
 	}
+	c.keys.reportSuccess(up.key, resp.StatusCode)
 
 	// Parse response
 	var openAIResp models.OpenAIResponse
 	if err := json.Unmarshal(respBody, &openAIResp); err != nil {
+		c.reporter.ReportConversionError(up.baseURL, req.Model, "parse_response", err)
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
@@ -180,6 +325,19 @@ func (c *OpenAIClient) CreateStreamingChatCompletion(ctx context.Context, req *m
 	// Ensure streaming is enabled
 	req.Stream = true
 
+	var resp *http.Response
+	err := c.withKeyRotation(ctx, req.Model, func(up upstream) error {
+		return c.withRetries(ctx, func(int) error {
+			var err error
+			resp, err = c.createStreamingChatCompletion(ctx, req, up)
+			return err
+		})
+	})
+	return resp, c.translateError(ctx, err)
+}
+
+// createStreamingChatCompletion sends a streaming chat completion request to the given upstream
+func (c *OpenAIClient) createStreamingChatCompletion(ctx context.Context, req *models.OpenAIRequest, up upstream) (*http.Response, error) {
 	// Prepare request body
 	reqBody, err := json.Marshal(req)
 	if err != nil {
@@ -188,21 +346,21 @@ func (c *OpenAIClient) CreateStreamingChatCompletion(ctx context.Context, req *m
 
 	// Debug log: detailed streaming request info
 	c.logger.WithFields(logrus.Fields{
-		"url":     fmt.Sprintf("%s/chat/completions", c.config.OpenAIBaseURL),
+		"url":     fmt.Sprintf("%s/chat/completions", up.baseURL),
 		"method":  "POST",
-		"headers": fmt.Sprintf("Content-Type=application/json, Accept=text/event-stream, Authorization=Bearer %s...", c.config.OpenAIAPIKey[:min(len(c.config.OpenAIAPIKey), 10)]),
+		"headers": fmt.Sprintf("Content-Type=application/json, Accept=text/event-stream, Authorization=Bearer %s...", up.apiKey[:min(len(up.apiKey), 10)]),
 		"body":    string(reqBody),
 	}).Debug("HTTP streaming request details")
 
 	// Create HTTP request
-	url := fmt.Sprintf("%s/chat/completions", c.config.OpenAIBaseURL)
+	url := fmt.Sprintf("%s/chat/completions", up.baseURL)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
-	c.setHeaders(httpReq)
+	c.setHeaders(httpReq, up)
 	httpReq.Header.Set("Accept", "text/event-stream")
 	httpReq.Header.Set("Cache-Control", "no-cache")
 
@@ -222,9 +380,12 @@ func (c *OpenAIClient) CreateStreamingChatCompletion(ctx context.Context, req *m
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 
+	c.checkProtocol(resp)
+
 	// Debug log: streaming response info
 	c.logger.WithFields(logrus.Fields{
 		"status_code": resp.StatusCode,
+		"proto":       resp.Proto,
 		"headers":     fmt.Sprintf("%v", resp.Header),
 	}).Debug("HTTP streaming response received")
 
@@ -236,63 +397,87 @@ func (c *OpenAIClient) CreateStreamingChatCompletion(ctx context.Context, req *m
 			"status_code":    resp.StatusCode,
 			"error_response": string(respBody),
 		}).Error("HTTP streaming request error")
-		return nil, c.handleAPIError(resp.StatusCode, respBody)
+		return nil, c.upstreamError(ctx, up, req.Model, resp, respBody)
 	}
+	c.keys.reportSuccess(up.key, resp.StatusCode)
 
 	c.logger.Debug("HTTP streaming connection established successfully")
 
 	return resp, nil
 }
 
+// checkProtocol warns once when HTTP/2 is required but the upstream negotiated HTTP/1.x
+func (c *OpenAIClient) checkProtocol(resp *http.Response) {
+	if c.config.Transport.HTTPVersion != HTTPVersion2 || resp.ProtoMajor == 2 {
+		return
+	}
+	c.protocolWarning.Do(func() {
+		c.logger.WithFields(logrus.Fields{
+			"proto":    resp.Proto,
+			"base_url": c.config.OpenAIBaseURL,
+		}).Warn("Upstream did not negotiate HTTP/2, falling back to HTTP/1.1")
+	})
+}
+
 // setHeaders sets the required headers for OpenAI API requests
-func (c *OpenAIClient) setHeaders(req *http.Request) {
+func (c *OpenAIClient) setHeaders(req *http.Request, up upstream) {
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.config.OpenAIAPIKey))
+	if up.apiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", up.apiKey))
+	}
 	req.Header.Set("User-Agent", "claude-code-provider-proxy/1.0")
 
 	// Set custom headers as per Python version
 	req.Header.Set("HTTP-Referer", c.config.ReferrerURL)
 	req.Header.Set("X-Title", c.config.AppName)
+
+	// Configured headers override the organization the client selected, and
+	// upstream-specific values override global ones
+	setClientOrgHeaders(req)
+	if c.config.OpenAIOrganization != "" {
+		req.Header.Set("OpenAI-Organization", c.config.OpenAIOrganization)
+	}
+	if c.config.OpenAIProject != "" {
+		req.Header.Set("OpenAI-Project", c.config.OpenAIProject)
+	}
+	for name, value := range c.config.CustomHeaders {
+		req.Header.Set(name, value)
+	}
+	for name, value := range up.headers {
+		req.Header.Set(name, value)
+	}
 }
 
-// handleAPIError handles API errors from OpenAI
-func (c *OpenAIClient) handleAPIError(statusCode int, body []byte) error {
-	// Try to parse OpenAI error format
-	var errorResp struct {
-		Error struct {
-			Message string `json:"message"`
-			Type    string `json:"type"`
-			Code    string `json:"code"`
-		} `json:"error"`
-	}
-
-	if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error.Message != "" {
-		return &models.APIError{
-			Type:    models.ErrorTypeAPI,
-			Message: errorResp.Error.Message,
-			Code:    errorResp.Error.Code,
+// upstreamError converts an upstream error response, putting the key into
+// cool-down when the upstream rejected it
+func (c *OpenAIClient) upstreamError(ctx context.Context, up upstream, model string, resp *http.Response, body []byte) error {
+	c.reporter.ReportUpstreamError(up.baseURL, model, resp.StatusCode, body)
+	err := c.handleAPIError(ctx, resp.StatusCode, body)
+	if apiErr, ok := err.(*models.APIError); ok {
+		apiErr.Retry = &models.RetryInfo{
+			LastStatus:        resp.StatusCode,
+			RetryAfterSeconds: retryAfterSeconds(resp.Header),
+		}
+		if apiErr.Provider == "" {
+			apiErr.Provider = providerName(up.baseURL)
 		}
 	}
-
-	// Fallback to generic error
-	switch statusCode {
-	case http.StatusUnauthorized:
-		return models.NewAuthenticationError("Invalid API key")
-	case http.StatusForbidden:
-		return models.NewPermissionError("Insufficient permissions")
-	case http.StatusTooManyRequests:
-		return models.NewRateLimitError("Rate limit exceeded")
-	case http.StatusBadRequest:
-		return models.NewValidationError(fmt.Sprintf("Bad request: %s", string(body)))
-	default:
-		return models.NewAPIError(fmt.Sprintf("OpenAI API error: %d - %s", statusCode, string(body)))
+	if up.key == nil || !isKeyRejection(resp.StatusCode, body) {
+		return err
 	}
+	c.keys.reportFailure(up.key, resp.StatusCode, resp.Header)
+	return &keyRejectedError{err: err}
+}
+
+// handleAPIError handles API errors from OpenAI
+func (c *OpenAIClient) handleAPIError(ctx context.Context, statusCode int, body []byte) error {
+	return parseUpstreamErrorResponse(statusCode, body, localeFrom(ctx))
 }
 
 // ValidateAPIKey validates the OpenAI API key
 func (c *OpenAIClient) ValidateAPIKey(ctx context.Context) error {
-	if c.config.OpenAIAPIKey == "" {
-		return models.NewAuthenticationError("OpenAI API key is required")
+	if c.config.OpenAIAPIKey == "" && c.keys.Size() == 0 {
+		return models.NewAuthenticationError(Message(localeFrom(ctx), "OpenAI API key is required"))
 	}
 
 	// Make a simple request to validate the key
@@ -305,7 +490,7 @@ func (c *OpenAIClient) ValidateAPIKey(ctx context.Context) error {
 	_, err := c.CreateChatCompletion(ctx, req)
 	if err != nil {
 		if apiErr, ok := err.(*models.APIError); ok && apiErr.Type == models.ErrorTypeAuthentication {
-			return models.NewAuthenticationError("Invalid OpenAI API key")
+			return models.NewAuthenticationError(Message(localeFrom(ctx), "Invalid OpenAI API key"))
 		}
 		return err
 	}
@@ -313,15 +498,71 @@ func (c *OpenAIClient) ValidateAPIKey(ctx context.Context) error {
 	return nil
 }
 
+// upstreamModel is an entry of the upstream model list. Routers that report
+// prices use the per-token pricing fields of the OpenRouter model list.
+type upstreamModel struct {
+	ID            string `json:"id"`
+	Created       int64  `json:"created"`
+	ContextLength int    `json:"context_length"`
+	Pricing       *struct {
+		Prompt     priceValue `json:"prompt"`
+		Completion priceValue `json:"completion"`
+	} `json:"pricing"`
+}
+
+// UpstreamModel is a model listed by the primary upstream
+type UpstreamModel struct {
+	ID            string
+	Created       int64 // Unix time, 0 when not reported
+	ContextLength int   // 0 when not reported
+}
+
 // GetModels retrieves available models from OpenAI
-func (c *OpenAIClient) GetModels(ctx context.Context) ([]string, error) {
-	url := fmt.Sprintf("%s/models", c.config.OpenAIBaseURL)
+func (c *OpenAIClient) GetModels(ctx context.Context) ([]UpstreamModel, error) {
+	data, err := c.listModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]UpstreamModel, len(data))
+	for i, model := range data {
+		models[i] = UpstreamModel{ID: model.ID, Created: model.Created, ContextLength: model.ContextLength}
+	}
+
+	return models, nil
+}
+
+// GetModelPrices retrieves the prices per million tokens of the upstream
+// models that report pricing
+func (c *OpenAIClient) GetModelPrices(ctx context.Context) (map[string]config.ModelPrice, error) {
+	data, err := c.listModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]config.ModelPrice)
+	for _, model := range data {
+		if model.Pricing == nil {
+			continue
+		}
+		prices[model.ID] = config.ModelPrice{
+			InputPerMillion:  float64(model.Pricing.Prompt) * 1e6,
+			OutputPerMillion: float64(model.Pricing.Completion) * 1e6,
+		}
+	}
+	return prices, nil
+}
+
+// listModels requests the model list of the primary upstream
+func (c *OpenAIClient) listModels(ctx context.Context) ([]upstreamModel, error) {
+	up := c.primaryUpstream()
+	url := fmt.Sprintf("%s/models", up.baseURL)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	c.setHeaders(req)
+	c.setHeaders(req, up)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -331,25 +572,18 @@ func (c *OpenAIClient) GetModels(ctx context.Context) ([]string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, c.handleAPIError(resp.StatusCode, body)
+		return nil, c.handleAPIError(ctx, resp.StatusCode, body)
 	}
 
 	var modelsResp struct {
-		Data []struct {
-			ID string `json:"id"`
-		} `json:"data"`
+		Data []upstreamModel `json:"data"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
 		return nil, fmt.Errorf("failed to parse models response: %w", err)
 	}
 
-	models := make([]string, len(modelsResp.Data))
-	for i, model := range modelsResp.Data {
-		models[i] = model.ID
-	}
-
-	return models, nil
+	return modelsResp.Data, nil
 }
 
 // SetTimeout sets the HTTP client timeout
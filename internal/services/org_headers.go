@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"net/http"
+)
+
+// orgHeaders maps the organization and project headers clients may send to
+// the headers sent upstream. The Anthropic names let clients configured for
+// an Anthropic organization or workspace select the provider's equivalent.
+var orgHeaders = map[string]string{
+	"OpenAI-Organization":       "OpenAI-Organization",
+	"OpenAI-Project":            "OpenAI-Project",
+	"Anthropic-Organization-Id": "OpenAI-Organization",
+	"Anthropic-Workspace-Id":    "OpenAI-Project",
+}
+
+// orgHeadersKey is the context key of the organization headers of a client
+type orgHeadersKey struct{}
+
+// WithOrgHeaders attaches the organization and project headers the client
+// sent to the context, keyed by their upstream names
+func WithOrgHeaders(ctx context.Context, header http.Header) context.Context {
+	found := make(map[string]string)
+	for name, upstreamName := range orgHeaders {
+		if value := header.Get(name); value != "" {
+			found[upstreamName] = value
+		}
+	}
+	if len(found) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, orgHeadersKey{}, found)
+}
+
+// setClientOrgHeaders sets the organization headers the client sent. Headers
+// configured for the upstream are set afterwards and take precedence.
+func setClientOrgHeaders(req *http.Request) {
+	found, _ := req.Context().Value(orgHeadersKey{}).(map[string]string)
+	for name, value := range found {
+		req.Header.Set(name, value)
+	}
+}
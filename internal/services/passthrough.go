@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Upstream API formats
+const (
+	UpstreamFormatOpenAI    = "openai"    // OpenAI-compatible chat completions (default)
+	UpstreamFormatAnthropic = "anthropic" // Anthropic-native messages API, no conversion needed
+)
+
+// passthroughBufferSize is the copy buffer used when forwarding response bytes
+const passthroughBufferSize = 32 * 1024
+
+// IsAnthropicUpstream reports whether the upstream speaks the Anthropic messages API
+func (c *OpenAIClient) IsAnthropicUpstream() bool {
+	return c.config.UpstreamFormat == UpstreamFormatAnthropic
+}
+
+// Forward posts a raw request body to the path of the upstream serving the
+// model and returns the upstream response unmodified. Non-2xx responses are
+// returned as well so the caller can relay them; the caller must close the
+// response body.
+func (c *OpenAIClient) Forward(ctx context.Context, model, path string, body []byte) (*http.Response, error) {
+	if up, ok := c.clientUpstream(ctx, model); ok {
+		resp, err := c.forward(ctx, up, path, body)
+		return resp, c.translateError(ctx, err)
+	}
+
+	tried := make(map[*pooledKey]bool)
+	for {
+		up := c.upstreamFor(model, sessionFrom(ctx), tried)
+		resp, err := c.forward(ctx, up, path, body)
+		if err != nil {
+			return nil, c.translateError(ctx, err)
+		}
+
+		var body []byte
+		if resp.StatusCode == http.StatusForbidden {
+			// Whether a 403 is about the key depends on its message; the
+			// body is put back for the caller to relay
+			body, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if up.key == nil || !isKeyRejection(resp.StatusCode, body) {
+			c.keys.reportSuccess(up.key, resp.StatusCode)
+			return resp, nil
+		}
+
+		c.keys.reportFailure(up.key, resp.StatusCode, resp.Header)
+		tried[up.key] = true
+		if len(tried) >= c.keys.Size() {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// forward posts the body to the given upstream
+func (c *OpenAIClient) forward(ctx context.Context, up upstream, path string, body []byte) (*http.Response, error) {
+	url := up.baseURL + path
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(httpReq, up)
+	if c.IsAnthropicUpstream() {
+		httpReq.Header.Set("x-api-key", up.apiKey)
+		httpReq.Header.Set("anthropic-version", "2023-06-01")
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"url":         url,
+		"body_length": len(body),
+	}).Debug("Forwarding passthrough request")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Passthrough request failed")
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	c.checkProtocol(resp)
+
+	return resp, nil
+}
+
+// CopyResponse relays an upstream response to the client byte for byte,
+// flushing after every read so SSE events are delivered without delay.
+// No per-chunk decoding or re-encoding takes place.
+func CopyResponse(c *gin.Context, resp *http.Response) error {
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		setStreamHeaders(c)
+	}
+	c.Status(resp.StatusCode)
+
+	buf := make([]byte, passthroughBufferSize)
+	_, err := io.CopyBuffer(&flushWriter{w: c.Writer}, resp.Body, buf)
+	return err
+}
+
+// flushWriter flushes the underlying response writer after every write
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+// Write implements io.Writer
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// upstreamUsageContextKey stores the upstream usage of a request in the gin context
+	upstreamUsageContextKey = "upstream_usage"
+
+	pricingRefreshInterval = time.Hour
+	pricingRetryInterval   = time.Minute // After a failed refresh
+	pricingRefreshTimeout  = 15 * time.Second
+)
+
+// upstreamUsage is the token usage reported by the upstream for a request
+type upstreamUsage struct {
+	inputTokens, outputTokens int
+}
+
+// priceValue is a price from the router's model metadata, which may be
+// encoded as a number or a string
+type priceValue float64
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *priceValue) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text == "" {
+			*p = 0
+			return nil
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		*p = priceValue(value)
+		return nil
+	}
+	var value float64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*p = priceValue(value)
+	return nil
+}
+
+// CostSummary is the estimated spend since the service started
+type CostSummary struct {
+	Total       float64                      `json:"total"`
+	Models      map[string]float64           `json:"models"`
+	Prices      map[string]config.ModelPrice `json:"prices"`
+	RefreshedAt *time.Time                   `json:"prices_refreshed_at,omitempty"`
+	RefreshErr  string                       `json:"prices_refresh_error,omitempty"`
+}
+
+// PricingService estimates the cost of requests from a price table. Prices
+// come from the pricing metadata of the upstream model list, refreshed
+// hourly. The pricing section of the configuration and then the model
+// registry take precedence.
+type PricingService struct {
+	config *config.Config
+	logger *logrus.Logger
+	client *OpenAIClient
+
+	mu          sync.Mutex
+	prices      map[string]config.ModelPrice // From the upstream model list
+	refreshedAt time.Time
+	refreshErr  string
+	refreshing  bool
+	totals      map[string]float64
+}
+
+// NewPricingService creates a new pricing service and starts loading the
+// upstream prices
+func NewPricingService(cfg *config.Config, logger *logrus.Logger, client *OpenAIClient) *PricingService {
+	s := &PricingService{
+		config: cfg,
+		logger: logger,
+		client: client,
+		prices: make(map[string]config.ModelPrice),
+		totals: make(map[string]float64),
+	}
+	if !client.IsAnthropicUpstream() {
+		s.refreshing = true
+		go s.refresh()
+	}
+	return s
+}
+
+// Price returns the price of an upstream model. A stale price table is
+// refreshed in the background.
+func (s *PricingService) Price(model string) (config.ModelPrice, bool) {
+	if price, ok := s.config.Pricing[model]; ok {
+		return price, true
+	}
+	if price := s.config.Capabilities(model).Pricing; price != nil {
+		return *price, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	interval := pricingRefreshInterval
+	if s.refreshErr != "" {
+		interval = pricingRetryInterval
+	}
+	if !s.refreshing && time.Since(s.refreshedAt) > interval && !s.client.IsAnthropicUpstream() {
+		s.refreshing = true
+		go s.refresh()
+	}
+	price, ok := s.prices[model]
+	return price, ok
+}
+
+// refresh reloads the prices from the upstream model list
+func (s *PricingService) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), pricingRefreshTimeout)
+	defer cancel()
+
+	prices, err := s.client.GetModelPrices(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshing = false
+	s.refreshedAt = time.Now()
+	if err != nil {
+		s.refreshErr = err.Error()
+		s.logger.WithError(err).Warn("Failed to refresh model prices")
+		return
+	}
+	s.refreshErr = ""
+	s.prices = prices
+	s.logger.WithField("models", len(prices)).Debug("Model prices refreshed")
+}
+
+// Charge estimates the cost of the current request from the usage reported
+// by the upstream and adds it to the totals. It returns false when the usage
+// or the price of the model is unknown.
+func (s *PricingService) Charge(c *gin.Context, model string) (float64, bool) {
+	value, ok := c.Get(upstreamUsageContextKey)
+	if !ok {
+		return 0, false
+	}
+	usage := value.(upstreamUsage)
+	cost, ok := s.chargeTokens(model, usage.inputTokens, usage.outputTokens)
+	if !ok {
+		return 0, false
+	}
+	c.Set(estimatedCostContextKey, cost)
+
+	if transcript := usageTranscriptFor(c); transcript != nil {
+		transcript.mu.Lock()
+		transcript.record.Cost = &cost
+		transcript.mu.Unlock()
+	}
+	return cost, true
+}
+
+// chargeTokens estimates the cost of the given usage of a model and adds it
+// to the totals. It returns false when the price of the model is unknown.
+func (s *PricingService) chargeTokens(model string, inputTokens, outputTokens int) (float64, bool) {
+	price, ok := s.Price(model)
+	if !ok {
+		return 0, false
+	}
+
+	cost := (float64(inputTokens)*price.InputPerMillion + float64(outputTokens)*price.OutputPerMillion) / 1e6
+
+	s.mu.Lock()
+	s.totals[model] += cost
+	s.mu.Unlock()
+	return cost, true
+}
+
+// Summary returns the estimated spend per model and the prices of the
+// configured and charged models
+func (s *PricingService) Summary() CostSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := CostSummary{
+		Models:     make(map[string]float64, len(s.totals)),
+		Prices:     make(map[string]config.ModelPrice, len(s.prices)+len(s.config.Pricing)),
+		RefreshErr: s.refreshErr,
+	}
+	for model, cost := range s.totals {
+		summary.Models[model] = cost
+		summary.Total += cost
+		if price, ok := s.prices[model]; ok {
+			summary.Prices[model] = price
+		}
+	}
+	for model, price := range s.config.Pricing {
+		summary.Prices[model] = price
+	}
+	if !s.refreshedAt.IsZero() {
+		refreshedAt := s.refreshedAt.UTC()
+		summary.RefreshedAt = &refreshedAt
+	}
+	return summary
+}
+
+// FormatCost formats an estimated cost for the X-Proxy-Cost header
+func FormatCost(cost float64) string {
+	return fmt.Sprintf("%.6f", cost)
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultProxyToolTimeout = 30 * time.Second
+	maxProxyToolRounds      = 8        // Upstream round trips per client request
+	maxProxyToolResultBytes = 64 << 10 // Tool results are truncated beyond this size
+)
+
+// ProxyToolService executes tools declared in the proxy configuration on
+// behalf of the model. Their definitions are added to upstream requests, and
+// calls to them are answered by the proxy instead of being returned to the
+// client, so every Claude Code user of the proxy shares the same tools.
+type ProxyToolService struct {
+	config     *config.Config
+	logger     *logrus.Logger
+	httpClient *http.Client
+}
+
+// NewProxyToolService creates a new proxy tool service
+func NewProxyToolService(cfg *config.Config, logger *logrus.Logger) *ProxyToolService {
+	return &ProxyToolService{
+		config:     cfg,
+		logger:     logger,
+		httpClient: &http.Client{},
+	}
+}
+
+// ProxyToolInfo describes a proxy tool in the tool registry, using the field
+// names of MCP tool listings
+type ProxyToolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// List returns the proxy tools for the tool registry endpoint
+func (s *ProxyToolService) List() []ProxyToolInfo {
+	tools := make([]ProxyToolInfo, 0, len(s.config.ProxyTools))
+	for _, tool := range s.config.ProxyTools {
+		tools = append(tools, ProxyToolInfo{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: toolInputSchema(tool),
+		})
+	}
+	return tools
+}
+
+// toolInputSchema returns the input schema of a tool, defaulting to an empty object
+func toolInputSchema(tool config.ToolConfig) map[string]interface{} {
+	if tool.InputSchema == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return tool.InputSchema
+}
+
+// Inject adds the definitions of the selected proxy tools to an upstream
+// request and returns the names of the tools added. selection is the value of
+// the X-Proxy-Tools header: "*" for all tools or a comma-separated list of
+// names. Without it all tools are added, unless proxy_tools_opt_in is set.
+// Tools the client declares itself keep the client definition and are left
+// to the client.
+func (s *ProxyToolService) Inject(req *models.OpenAIRequest, selection string) map[string]bool {
+	if len(s.config.ProxyTools) == 0 {
+		return nil
+	}
+
+	selected := map[string]bool{}
+	switch selection = strings.TrimSpace(selection); selection {
+	case "":
+		if s.config.ProxyToolsOptIn {
+			return nil
+		}
+		selected["*"] = true
+	default:
+		for _, name := range strings.Split(selection, ",") {
+			selected[strings.TrimSpace(name)] = true
+		}
+	}
+
+	declared := make(map[string]bool, len(req.Tools))
+	for _, tool := range req.Tools {
+		declared[tool.Function.Name] = true
+	}
+
+	injected := make(map[string]bool)
+	for _, tool := range s.config.ProxyTools {
+		if !selected["*"] && !selected[tool.Name] {
+			continue
+		}
+		if declared[tool.Name] {
+			s.logger.WithField("tool", tool.Name).Warn("Client declares a tool with the name of a proxy tool, leaving it to the client")
+			continue
+		}
+		req.Tools = append(req.Tools, models.OpenAITool{
+			Type: "function",
+			Function: models.OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  toolInputSchema(tool),
+			},
+		})
+		injected[tool.Name] = true
+	}
+	return injected
+}
+
+// Complete sends a non-streaming request and executes the proxy tools the
+// model calls, feeding their results back until the model answers without
+// calling a proxy tool. Text the model wrote alongside proxy tool calls is
+// kept in the final response, and usage covers every round.
+func (s *ProxyToolService) Complete(ctx context.Context, client *OpenAIClient, req *models.OpenAIRequest, tools map[string]bool) (*models.OpenAIResponse, error) {
+	req.Stream = false
+
+	var preamble interface{}
+	var usage models.OpenAIUsage
+	for round := 1; ; round++ {
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+		if len(tools) == 0 || len(resp.Choices) == 0 {
+			return resp, nil
+		}
+
+		choice := &resp.Choices[0]
+		var proxyCalls, clientCalls []models.OpenAIToolCall
+		for _, call := range choice.Message.ToolCalls {
+			if tools[call.Function.Name] {
+				proxyCalls = append(proxyCalls, call)
+			} else {
+				clientCalls = append(clientCalls, call)
+			}
+		}
+
+		if len(proxyCalls) > 0 && (len(clientCalls) > 0 || round >= maxProxyToolRounds) {
+			// The client cannot answer tool calls it never saw
+			s.logger.WithFields(logrus.Fields{
+				"proxy_tool_calls":  len(proxyCalls),
+				"client_tool_calls": len(clientCalls),
+				"round":             round,
+			}).Warn("Dropping proxy tool calls that cannot be executed in this round")
+			choice.Message.ToolCalls = clientCalls
+			if len(clientCalls) == 0 && choice.FinishReason == "tool_calls" {
+				choice.FinishReason = "stop"
+			}
+			proxyCalls = nil
+		}
+
+		if len(proxyCalls) == 0 {
+			choice.Message.Content = mergeMessageContent(preamble, choice.Message.Content)
+			resp.Usage = usage
+			return resp, nil
+		}
+
+		// Answer the proxy tool calls and ask the model again
+		preamble = mergeMessageContent(preamble, choice.Message.Content)
+		req.Messages = append(req.Messages, models.OpenAIMessage{
+			Role:      "assistant",
+			Content:   choice.Message.Content,
+			ToolCalls: proxyCalls,
+		})
+		for _, call := range proxyCalls {
+			req.Messages = append(req.Messages, models.OpenAIMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    s.execute(ctx, call),
+			})
+		}
+	}
+}
+
+// execute runs a proxy tool and returns its result. Failures are reported to
+// the model as the tool result rather than failing the request.
+func (s *ProxyToolService) execute(ctx context.Context, call models.OpenAIToolCall) string {
+	var tool config.ToolConfig
+	for _, candidate := range s.config.ProxyTools {
+		if candidate.Name == call.Function.Name {
+			tool = candidate
+			break
+		}
+	}
+
+	timeout := defaultProxyToolTimeout
+	if tool.TimeoutSeconds > 0 {
+		timeout = time.Duration(tool.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	arguments := call.Function.Arguments
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+
+	start := time.Now()
+	var output []byte
+	var err error
+	switch {
+	case tool.Command != "":
+		output, err = s.executeCommand(ctx, tool, arguments)
+	case tool.URL != "":
+		output, err = s.executeHTTP(ctx, tool, arguments)
+	default:
+		err = fmt.Errorf("tool has neither command nor url")
+	}
+
+	fields := logrus.Fields{
+		"tool":        tool.Name,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		s.logger.WithFields(fields).Warn("Proxy tool failed")
+		return fmt.Sprintf("Error: tool %s failed: %s", tool.Name, err.Error())
+	}
+	s.logger.WithFields(fields).Info("Proxy tool executed")
+
+	return truncateToolOutput(output)
+}
+
+// truncateToolOutput cuts a tool result to maxProxyToolResultBytes at a rune
+// boundary, so multi-byte characters are never split
+func truncateToolOutput(output []byte) string {
+	if len(output) <= maxProxyToolResultBytes {
+		return string(output)
+	}
+	cut := maxProxyToolResultBytes
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return string(output[:cut]) + "\n[output truncated]"
+}
+
+// executeCommand runs an executable tool with the tool input on stdin. Only
+// the part of stdout that can be returned is kept; the rest is discarded
+// while the tool runs.
+func (s *ProxyToolService) executeCommand(ctx context.Context, tool config.ToolConfig, arguments string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, tool.Command, tool.Args...)
+	cmd.Stdin = strings.NewReader(arguments)
+	cmd.Env = append(cmd.Environ(), "CLAUDEPROXY_TOOL_NAME="+tool.Name)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	output, readErr := io.ReadAll(io.LimitReader(stdout, maxProxyToolResultBytes+1))
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return output, nil
+}
+
+// executeHTTP posts the tool input to an HTTP tool
+func (s *ProxyToolService) executeHTTP(ctx context.Context, tool config.ToolConfig, arguments string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tool.URL, strings.NewReader(arguments))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Tool", tool.Name)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyToolResultBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// LocalKeyContextKey stores the name of the local API key in the gin context
+	LocalKeyContextKey = "local_key"
+
+	// estimatedCostContextKey stores the estimated cost of a request in the gin context
+	estimatedCostContextKey = "estimated_cost"
+)
+
+// KeyUsage is the usage of a local API key on the current day
+type KeyUsage struct {
+	Tokens int     `json:"tokens"`
+	Cost   float64 `json:"cost"`
+}
+
+// QuotaService counts the daily usage of local API keys for quota
+// enforcement. Counters reset at local midnight and are restored from the
+// usage ledger when the service starts. In cluster mode the counters of all
+// instances are summed in Redis; the local counters are used while Redis is
+// unavailable.
+type QuotaService struct {
+	mu     sync.Mutex
+	day    string
+	usage  map[string]*KeyUsage
+	shared *SharedState // nil without cluster mode
+}
+
+// NewQuotaService creates a quota service with today's usage from the usage ledger
+func NewQuotaService(shared *SharedState, storage Storage) *QuotaService {
+	now := time.Now()
+	q := &QuotaService{
+		day:    today(now),
+		usage:  make(map[string]*KeyUsage),
+		shared: shared,
+	}
+	records, _ := storage.LoadUsage(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local))
+	for _, record := range records {
+		if record.Key == "" || today(record.Time) != q.day {
+			continue
+		}
+		cost := 0.0
+		if record.Cost != nil {
+			cost = *record.Cost
+		}
+		q.add(record.Key, record.UpstreamInputTokens+record.UpstreamOutputTokens, cost)
+	}
+	return q
+}
+
+// today returns the local date of t
+func today(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// rollover clears the counters when the day has changed; q.mu must be held
+func (q *QuotaService) rollover() {
+	if day := today(time.Now()); day != q.day {
+		q.day = day
+		q.usage = make(map[string]*KeyUsage)
+	}
+}
+
+// add counts usage for a key; q.mu must be held
+func (q *QuotaService) add(key string, tokens int, cost float64) {
+	usage, ok := q.usage[key]
+	if !ok {
+		usage = &KeyUsage{}
+		q.usage[key] = usage
+	}
+	usage.Tokens += tokens
+	usage.Cost += cost
+}
+
+// Record adds the upstream usage and estimated cost of the current request
+// to the daily usage of its local API key
+func (q *QuotaService) Record(c *gin.Context) {
+	key := c.GetString(LocalKeyContextKey)
+	if key == "" {
+		return
+	}
+	var tokens int
+	var cost float64
+	if value, ok := c.Get(upstreamUsageContextKey); ok {
+		usage := value.(upstreamUsage)
+		tokens, cost = usage.inputTokens+usage.outputTokens, c.GetFloat64(estimatedCostContextKey)
+	}
+	// The summary call made to compact the conversation counts as well
+	if value, ok := c.Get(compactionUsageContextKey); ok {
+		summary := value.(compactionUsage)
+		tokens += summary.inputTokens + summary.outputTokens
+		cost += summary.cost
+	}
+	if tokens == 0 && cost == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	q.rollover()
+	q.add(key, tokens, cost)
+	day := q.day
+	q.mu.Unlock()
+
+	if q.shared != nil {
+		hash := q.shared.key("quota", day)
+		_, err := q.shared.pipeline(
+			[]string{"HINCRBY", hash, "tokens:" + key, strconv.Itoa(tokens)},
+			[]string{"HINCRBYFLOAT", hash, "cost:" + key, strconv.FormatFloat(cost, 'g', -1, 64)},
+			[]string{"EXPIRE", hash, strconv.Itoa(int((48 * time.Hour).Seconds()))},
+		)
+		if err != nil {
+			q.shared.warn(err, "record quota usage")
+		}
+	}
+}
+
+// sharedUsage reads today's usage of all local API keys from Redis
+func (q *QuotaService) sharedUsage(day string) (map[string]KeyUsage, error) {
+	values, err := q.shared.getStrings("HGETALL", q.shared.key("quota", day))
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[string]KeyUsage)
+	for i := 0; i+1 < len(values); i += 2 {
+		field, value := values[i], values[i+1]
+		if key, ok := strings.CutPrefix(field, "tokens:"); ok {
+			u := usage[key]
+			u.Tokens, _ = strconv.Atoi(value)
+			usage[key] = u
+		} else if key, ok := strings.CutPrefix(field, "cost:"); ok {
+			u := usage[key]
+			u.Cost, _ = strconv.ParseFloat(value, 64)
+			usage[key] = u
+		}
+	}
+	return usage, nil
+}
+
+// Daily quotas of a local API key
+const (
+	QuotaDailyTokens = "daily_tokens"
+	QuotaDailyCost   = "daily_cost"
+)
+
+// QuotaStatus is the state of the daily quotas of a local API key before a
+// request
+type QuotaStatus struct {
+	Exceeded   string    // QuotaDailyTokens or QuotaDailyCost, empty within quota
+	ResetAt    time.Time // Next local midnight
+	TokensLeft int       // -1 without a token quota
+	CostLeft   float64   // -1 without a cost quota
+}
+
+// Check reports whether the local API key has used up a daily quota, what is
+// left of its quotas and the time they reset.
+func (q *QuotaService) Check(key config.LocalKeyConfig) QuotaStatus {
+	now := time.Now()
+	status := QuotaStatus{
+		ResetAt:    time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()),
+		TokensLeft: -1,
+		CostLeft:   -1,
+	}
+	if key.DailyTokens <= 0 && key.DailyCost <= 0 {
+		return status
+	}
+
+	usage := q.Usage()[key.Name]
+	if key.DailyTokens > 0 {
+		status.TokensLeft = max(key.DailyTokens-usage.Tokens, 0)
+		if usage.Tokens >= key.DailyTokens {
+			status.Exceeded = QuotaDailyTokens
+		}
+	}
+	if key.DailyCost > 0 {
+		status.CostLeft = max(key.DailyCost-usage.Cost, 0)
+		if status.Exceeded == "" && usage.Cost >= key.DailyCost {
+			status.Exceeded = QuotaDailyCost
+		}
+	}
+	return status
+}
+
+// Usage returns the usage of every local API key on the current day
+func (q *QuotaService) Usage() map[string]KeyUsage {
+	q.mu.Lock()
+	q.rollover()
+	day := q.day
+	usage := make(map[string]KeyUsage, len(q.usage))
+	for key, value := range q.usage {
+		usage[key] = *value
+	}
+	q.mu.Unlock()
+
+	if q.shared != nil {
+		shared, err := q.sharedUsage(day)
+		if err == nil {
+			return shared
+		}
+		q.shared.warn(err, "read quota usage")
+	}
+	return usage
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fixture is a recorded upstream interaction together with the Anthropic
+// request that produced it. Fixtures are replayed through the conversion and
+// streaming services to catch regressions in provider-specific handling.
+type Fixture struct {
+	Name       string                   `json:"name"`
+	RequestID  string                   `json:"request_id,omitempty"`
+	RecordedAt time.Time                `json:"recorded_at"`
+	BigModel   string                   `json:"big_model"`
+	SmallModel string                   `json:"small_model"`
+	Anthropic  *models.AnthropicRequest `json:"anthropic_request"`
+	Upstream   FixtureExchange          `json:"upstream"`
+
+	// Golden results written by "claudeproxy dev replay --update"
+	ExpectedRequest string `json:"expected_request,omitempty"`
+	ExpectedOutput  string `json:"expected_output,omitempty"`
+}
+
+// FixtureExchange is the raw upstream HTTP request and response
+type FixtureExchange struct {
+	URL         string          `json:"url"`
+	Request     json.RawMessage `json:"request"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type"`
+	Response    string          `json:"response"`
+}
+
+// recordedRequestKey is the context key for the Anthropic request being recorded
+type recordedRequestKey struct{}
+
+// recordedRequest is the client request attached to the context for recording
+type recordedRequest struct {
+	anthropic *models.AnthropicRequest
+	requestID string
+}
+
+// WithRecordedRequest attaches the Anthropic request and its proxy request ID
+// to the context so that the recording transport can store them alongside the
+// upstream interaction
+func WithRecordedRequest(ctx context.Context, req *models.AnthropicRequest, requestID string) context.Context {
+	return context.WithValue(ctx, recordedRequestKey{}, &recordedRequest{anthropic: req, requestID: requestID})
+}
+
+// recordingTransport writes upstream chat completion interactions to fixture files
+type recordingTransport struct {
+	next       http.RoundTripper
+	dir        string
+	bigModel   string
+	smallModel string
+	logger     *logrus.Logger
+}
+
+// newRecordingTransport wraps the transport so interactions are recorded into dir
+func newRecordingTransport(next http.RoundTripper, dir, bigModel, smallModel string, logger *logrus.Logger) http.RoundTripper {
+	return &recordingTransport{
+		next:       next,
+		dir:        dir,
+		bigModel:   bigModel,
+		smallModel: smallModel,
+		logger:     logger,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, ok := req.Context().Value(recordedRequestKey{}).(*recordedRequest)
+	if !ok || req.Body == nil || !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return t.next.RoundTrip(req)
+	}
+
+	reqBody, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(reqBody))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := &Fixture{
+		RequestID:  recorded.requestID,
+		RecordedAt: time.Now().UTC(),
+		BigModel:   t.bigModel,
+		SmallModel: t.smallModel,
+		Anthropic:  recorded.anthropic,
+		Upstream: FixtureExchange{
+			URL:         req.URL.Path,
+			Request:     json.RawMessage(reqBody),
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+		},
+	}
+
+	// The fixture is written once the caller has consumed the response body
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		onClose: func(body []byte) {
+			fixture.Upstream.Response = string(body)
+			t.save(fixture)
+		},
+	}
+
+	return resp, nil
+}
+
+var fixtureNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// save writes the fixture to the record directory. The request ID keeps
+// fixtures of concurrent requests to the same model apart.
+func (t *recordingTransport) save(fixture *Fixture) {
+	fixture.Name = fmt.Sprintf("%s-%s",
+		fixture.RecordedAt.Format("20060102-150405.000"),
+		fixtureNameSanitizer.ReplaceAllString(fixture.Anthropic.Model, "_"))
+	if fixture.RequestID != "" {
+		fixture.Name += "-" + fixtureNameSanitizer.ReplaceAllString(fixture.RequestID, "_")
+	}
+
+	if err := os.MkdirAll(t.dir, config.PrivateDirMode); err != nil {
+		t.logger.WithError(err).Warn("Failed to create record directory")
+		return
+	}
+
+	path := filepath.Join(t.dir, fixture.Name+".json")
+	if err := SaveFixture(path, fixture); err != nil {
+		t.logger.WithError(err).Warn("Failed to write fixture")
+		return
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"fixture": path,
+		"status":  fixture.Upstream.Status,
+	}).Debug("Upstream interaction recorded")
+}
+
+// recordingBody captures the response body as it is read
+type recordingBody struct {
+	io.ReadCloser
+	buf     bytes.Buffer
+	once    sync.Once
+	onClose func([]byte)
+}
+
+// Read implements io.Reader
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.onClose(b.buf.Bytes())
+	})
+	return err
+}
+
+// LoadFixture reads a fixture file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture: %w", err)
+	}
+	if fixture.Anthropic == nil {
+		return nil, fmt.Errorf("fixture has no anthropic_request")
+	}
+
+	return &fixture, nil
+}
+
+// SaveFixture writes a fixture file, readable only by the user as it holds
+// prompts and responses
+func SaveFixture(path string, fixture *Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, config.PrivateFileMode)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ReplayResult is the outcome of replaying a fixture
+type ReplayResult struct {
+	Request string // Converted upstream request
+	Output  string // Converted client output, with generated IDs normalized
+}
+
+// generatedIDPattern matches message and tool IDs generated by the proxy
+var generatedIDPattern = regexp.MustCompile(`\b(msg|toolu)_[0-9a-f]{16}\b`)
+
+// ReplayFixture runs a recorded fixture through the conversion and streaming
+// services without contacting the upstream API
+func ReplayFixture(fixture *Fixture, logger *logrus.Logger) (*ReplayResult, error) {
+	cfg := &config.Config{
+		BigModelName:   fixture.BigModel,
+		SmallModelName: fixture.SmallModel,
+	}
+	modelSelector := NewModelSelectorService(cfg, logger)
+	conversionService := NewConversionService(modelSelector, cfg, logger, NewMetricsService())
+	streamingService := NewStreamingService(conversionService, cfg, logger)
+
+	// Anthropic request -> OpenAI request
+	anthropicReq := *fixture.Anthropic
+	openAIReq, err := conversionService.ConvertAnthropicToOpenAI(&anthropicReq, "gpt-4", fixture.RequestID)
+	if err != nil {
+		return nil, fmt.Errorf("request conversion failed: %w", err)
+	}
+	reqBody, err := json.MarshalIndent(openAIReq, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReplayResult{Request: string(reqBody)}
+	if fixture.Upstream.Status != http.StatusOK {
+		result.Output = fmt.Sprintf("upstream status %d\n%s", fixture.Upstream.Status, fixture.Upstream.Response)
+		return result, nil
+	}
+
+	// OpenAI response -> Anthropic response
+	if strings.HasPrefix(fixture.Upstream.ContentType, "text/event-stream") {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		resp := &http.Response{
+			StatusCode: fixture.Upstream.Status,
+			Body:       io.NopCloser(strings.NewReader(fixture.Upstream.Response)),
+		}
+		// Errors in the stream end it with an error event, as in the handler
+		if err := streamingService.StreamResponse(c, resp, fixture.Anthropic.Model); err != nil {
+			streamingService.HandleStreamingError(c, err)
+		}
+		result.Output = recorder.Body.String()
+	} else {
+		var openAIResp models.OpenAIResponse
+		if err := json.Unmarshal([]byte(fixture.Upstream.Response), &openAIResp); err != nil {
+			return nil, fmt.Errorf("failed to parse recorded response: %w", err)
+		}
+		anthropicResp, err := conversionService.ConvertOpenAIToAnthropic(&openAIResp, fixture.Anthropic.Model)
+		if err != nil {
+			return nil, fmt.Errorf("response conversion failed: %w", err)
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(anthropicResp); err != nil {
+			return nil, err
+		}
+		result.Output = buf.String()
+	}
+
+	result.Request = generatedIDPattern.ReplaceAllString(result.Request, "${1}_generated")
+	result.Output = generatedIDPattern.ReplaceAllString(result.Output, "${1}_generated")
+	return result, nil
+}
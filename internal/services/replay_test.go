@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// TestFixtures replays the corpus in testdata/fixtures and compares the
+// converted request and output with the golden results of each fixture. The
+// golden results are rewritten with "claudeproxy dev replay --update".
+func TestFixtures(t *testing.T) {
+	files, err := filepath.Glob("../../testdata/fixtures/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures found in testdata/fixtures")
+	}
+
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			fixture, err := LoadFixture(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fixture.ExpectedRequest == "" && fixture.ExpectedOutput == "" {
+				t.Fatal("fixture has no golden results")
+			}
+			result, err := ReplayFixture(fixture, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := lineDiff(fixture.ExpectedRequest, result.Request); diff != "" {
+				t.Errorf("converted request differs from the golden result\n%s", diff)
+			}
+			if diff := lineDiff(fixture.ExpectedOutput, result.Output); diff != "" {
+				t.Errorf("converted output differs from the golden result\n%s", diff)
+			}
+		})
+	}
+}
+
+// lineDiff describes the first line where got differs from want, or returns
+// an empty string when they are equal
+func lineDiff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; ; i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"claude-code-provider-proxy/internal/models"
+)
+
+// toolNamePattern matches the tool names the Anthropic API accepts
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// imageMediaTypes are the media types of base64 images the Anthropic API accepts
+var imageMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// requestValidator checks requests, describing problems in the locale
+type requestValidator struct {
+	locale string
+}
+
+// ValidateAnthropicRequest checks a request against the Anthropic Messages
+// schema: roles, content block shapes, tools and the pairing of tool_use and
+// tool_result blocks. The returned error names the offending field with a
+// JSON pointer, both in its message and its param, and describes the problem
+// in the locale. Content block types the proxy does not know are left to
+// unknown_content_policy.
+func ValidateAnthropicRequest(req *models.AnthropicRequest, locale string) *models.APIError {
+	v := requestValidator{locale: locale}
+	if req.MaxTokens <= 0 {
+		return v.invalidField("/max_tokens", "must be greater than 0")
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 1) {
+		return v.invalidField("/temperature", "must be between 0 and 1")
+	}
+	if req.TopP != nil && (*req.TopP < 0 || *req.TopP > 1) {
+		return v.invalidField("/top_p", "must be between 0 and 1")
+	}
+	if req.TopK != nil && *req.TopK < 0 {
+		return v.invalidField("/top_k", "must not be negative")
+	}
+	if req.FrequencyPenalty != nil && (*req.FrequencyPenalty < -2 || *req.FrequencyPenalty > 2) {
+		return v.invalidField("/x_frequency_penalty", "must be between -2 and 2")
+	}
+	if req.PresencePenalty != nil && (*req.PresencePenalty < -2 || *req.PresencePenalty > 2) {
+		return v.invalidField("/x_presence_penalty", "must be between -2 and 2")
+	}
+	if err := v.validateSystem(req.System); err != nil {
+		return err
+	}
+	if err := v.validateTools(req.Tools, req.ToolChoice); err != nil {
+		return err
+	}
+	return v.validateMessages(req.Messages)
+}
+
+// invalidField returns the error for the field at the JSON pointer
+func (v requestValidator) invalidField(pointer, format string, args ...interface{}) *models.APIError {
+	return models.NewInvalidRequestError(pointer+": "+Messagef(v.locale, format, args...), pointer)
+}
+
+// validateSystem checks that the system prompt is a string or text blocks
+func (v requestValidator) validateSystem(system interface{}) *models.APIError {
+	switch sys := system.(type) {
+	case nil, string:
+		return nil
+	case []interface{}:
+		for i, item := range sys {
+			pointer := fmt.Sprintf("/system/%d", i)
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				return v.invalidField(pointer, "must be an object")
+			}
+			if block["type"] != "text" {
+				return v.invalidField(pointer+"/type", "must be \"text\"")
+			}
+			if _, ok := block["text"].(string); !ok {
+				return v.invalidField(pointer+"/text", "must be a string")
+			}
+		}
+		return nil
+	default:
+		return v.invalidField("/system", "must be a string or an array of text blocks")
+	}
+}
+
+// validateTools checks the tool definitions and that the tool choice refers
+// to one of them
+func (v requestValidator) validateTools(tools []models.AnthropicTool, choice *models.AnthropicToolChoice) *models.APIError {
+	names := make(map[string]bool, len(tools))
+	for i, tool := range tools {
+		pointer := fmt.Sprintf("/tools/%d", i)
+		if !toolNamePattern.MatchString(tool.Name) {
+			return v.invalidField(pointer+"/name", "must match %s", toolNamePattern)
+		}
+		if names[tool.Name] {
+			return v.invalidField(pointer+"/name", "tool names must be unique, %q is defined twice", tool.Name)
+		}
+		names[tool.Name] = true
+		if schemaType, _ := tool.InputSchema["type"].(string); schemaType != "object" {
+			return v.invalidField(pointer+"/input_schema/type", "must be \"object\"")
+		}
+	}
+
+	if choice == nil {
+		return nil
+	}
+	switch choice.Type {
+	case "auto", "any", "none":
+	case "tool":
+		if !names[choice.Name] {
+			return v.invalidField("/tool_choice/name", "tool %q is not defined in tools", choice.Name)
+		}
+	default:
+		return v.invalidField("/tool_choice/type", "must be one of auto, any, tool, none")
+	}
+	if choice.Type != "none" && choice.Type != "auto" && len(tools) == 0 {
+		return v.invalidField("/tool_choice", "requires tools")
+	}
+	return nil
+}
+
+// validateMessages checks the roles and content of the messages and that
+// every tool_use is answered by a tool_result in the next message
+func (v requestValidator) validateMessages(messages []models.AnthropicMessage) *models.APIError {
+	if len(messages) == 0 {
+		return v.invalidField("/messages", "must contain at least one message")
+	}
+
+	seenToolUses := make(map[string]bool)
+	var pending []string // tool_use ids of the previous assistant message
+	for i, msg := range messages {
+		pointer := fmt.Sprintf("/messages/%d", i)
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return v.invalidField(pointer+"/role", "must be \"user\" or \"assistant\"")
+		}
+		last := i == len(messages)-1
+
+		var blocks []interface{}
+		switch content := msg.Content.(type) {
+		case string:
+			if strings.TrimSpace(content) == "" && !(last && msg.Role == "assistant") {
+				return v.invalidField(pointer+"/content", "must not be empty")
+			}
+		case []interface{}:
+			if len(content) == 0 && !(last && msg.Role == "assistant") {
+				return v.invalidField(pointer+"/content", "must not be empty")
+			}
+			blocks = content
+		default:
+			return v.invalidField(pointer+"/content", "must be a string or an array of content blocks")
+		}
+
+		answered := make(map[string]bool)
+		var toolUses []string
+		for j, item := range blocks {
+			blockPointer := fmt.Sprintf("%s/content/%d", pointer, j)
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				return v.invalidField(blockPointer, "must be an object")
+			}
+			if err := v.validateContentBlock(blockPointer, msg.Role, block); err != nil {
+				return err
+			}
+			switch block["type"] {
+			case "tool_use":
+				id := block["id"].(string)
+				if seenToolUses[id] {
+					return v.invalidField(blockPointer+"/id", "tool_use id %q is used more than once", id)
+				}
+				seenToolUses[id] = true
+				toolUses = append(toolUses, id)
+			case "tool_result":
+				id := block["tool_use_id"].(string)
+				if !containsString(pending, id) {
+					return v.invalidField(blockPointer+"/tool_use_id",
+						"tool_result block %q does not match a tool_use block in the previous message", id)
+				}
+				answered[id] = true
+			}
+		}
+
+		// The message after an assistant message with tool calls answers all of them
+		if len(pending) > 0 {
+			for _, id := range pending {
+				if !answered[id] {
+					return v.invalidField(pointer+"/content",
+						"tool_use id %q of the previous message has no tool_result block in this message", id)
+				}
+			}
+		}
+		pending = toolUses
+	}
+	return nil
+}
+
+// validateContentBlock checks the fields of a content block of a message
+// with the role
+func (v requestValidator) validateContentBlock(pointer, role string, block map[string]interface{}) *models.APIError {
+	blockType, ok := block["type"].(string)
+	if !ok {
+		return v.invalidField(pointer+"/type", "must be a string")
+	}
+	requireString := func(field string) *models.APIError {
+		if value, ok := block[field].(string); !ok || value == "" {
+			return v.invalidField(pointer+"/"+field, "must be a non-empty string")
+		}
+		return nil
+	}
+
+	switch blockType {
+	case "text":
+		if _, ok := block["text"].(string); !ok {
+			return v.invalidField(pointer+"/text", "must be a string")
+		}
+	case "image":
+		return v.validateImageSource(pointer, block["source"])
+	case "tool_use":
+		if role != "assistant" {
+			return v.invalidField(pointer+"/type", "tool_use blocks are only allowed in assistant messages")
+		}
+		if err := requireString("id"); err != nil {
+			return err
+		}
+		if err := requireString("name"); err != nil {
+			return err
+		}
+		if _, ok := block["input"].(map[string]interface{}); !ok {
+			return v.invalidField(pointer+"/input", "must be an object")
+		}
+	case "tool_result":
+		if role != "user" {
+			return v.invalidField(pointer+"/type", "tool_result blocks are only allowed in user messages")
+		}
+		if err := requireString("tool_use_id"); err != nil {
+			return err
+		}
+		switch content := block["content"].(type) {
+		case nil, string:
+		case []interface{}:
+			for i, item := range content {
+				itemPointer := fmt.Sprintf("%s/content/%d", pointer, i)
+				itemBlock, ok := item.(map[string]interface{})
+				if !ok {
+					return v.invalidField(itemPointer, "must be an object")
+				}
+				switch itemBlock["type"] {
+				case "text", "image", "document", "search_result":
+					if err := v.validateContentBlock(itemPointer, role, itemBlock); err != nil {
+						return err
+					}
+				default:
+					return v.invalidField(itemPointer+"/type", "must be one of text, image, document, search_result")
+				}
+			}
+		default:
+			return v.invalidField(pointer+"/content", "must be a string or an array of content blocks")
+		}
+		if isError, ok := block["is_error"]; ok {
+			if _, ok := isError.(bool); !ok {
+				return v.invalidField(pointer+"/is_error", "must be a boolean")
+			}
+		}
+	case "thinking":
+		if role != "assistant" {
+			return v.invalidField(pointer+"/type", "thinking blocks are only allowed in assistant messages")
+		}
+		if _, ok := block["thinking"].(string); !ok {
+			return v.invalidField(pointer+"/thinking", "must be a string")
+		}
+		if err := requireString("signature"); err != nil {
+			return err
+		}
+	case "redacted_thinking":
+		if role != "assistant" {
+			return v.invalidField(pointer+"/type", "redacted_thinking blocks are only allowed in assistant messages")
+		}
+		if err := requireString("data"); err != nil {
+			return err
+		}
+	case "document":
+		if _, ok := block["source"].(map[string]interface{}); !ok {
+			return v.invalidField(pointer+"/source", "must be an object")
+		}
+	}
+
+	if cacheControl, ok := block["cache_control"]; ok && cacheControl != nil {
+		control, ok := cacheControl.(map[string]interface{})
+		if !ok || control["type"] != "ephemeral" {
+			return v.invalidField(pointer+"/cache_control/type", "must be \"ephemeral\"")
+		}
+	}
+	return nil
+}
+
+// validateImageSource checks the source of an image block
+func (v requestValidator) validateImageSource(pointer string, value interface{}) *models.APIError {
+	source, ok := value.(map[string]interface{})
+	if !ok {
+		return v.invalidField(pointer+"/source", "must be an object")
+	}
+	pointer += "/source"
+	switch source["type"] {
+	case "base64":
+		mediaType, _ := source["media_type"].(string)
+		if !imageMediaTypes[mediaType] {
+			return v.invalidField(pointer+"/media_type", "must be one of image/jpeg, image/png, image/gif, image/webp")
+		}
+		if data, ok := source["data"].(string); !ok || data == "" {
+			return v.invalidField(pointer+"/data", "must be a non-empty string")
+		}
+	case "url":
+		if url, ok := source["url"].(string); !ok || url == "" {
+			return v.invalidField(pointer+"/url", "must be a non-empty string")
+		}
+	case "file":
+		if id, ok := source["file_id"].(string); !ok || id == "" {
+			return v.invalidField(pointer+"/file_id", "must be a non-empty string")
+		}
+	default:
+		return v.invalidField(pointer+"/type", "must be one of base64, url, file")
+	}
+	return nil
+}
+
+// containsString reports whether the list contains the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
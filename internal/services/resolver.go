@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+const (
+	dnsTimeout         = 5 * time.Second
+	maxDNSMessageBytes = 65535
+)
+
+// upstreamDialer dials upstreams through the addresses pinned in
+// transport.hosts, the configured DNS server or the system resolver, in
+// that order. Only the dialed address changes: TLS still verifies the
+// certificate against the host name of the URL.
+type upstreamDialer struct {
+	dialer   *net.Dialer
+	hosts    map[string][]string
+	resolver *net.Resolver // nil without a configured DNS server
+}
+
+// newUpstreamDialer creates the dialer for the transport settings
+func newUpstreamDialer(cfg config.TransportConfig, dialer *net.Dialer) *upstreamDialer {
+	d := &upstreamDialer{
+		dialer: dialer,
+		hosts:  make(map[string][]string, len(cfg.Hosts)),
+	}
+	for host, ips := range cfg.Hosts {
+		d.hosts[strings.ToLower(host)] = ips
+	}
+	if cfg.DNSServer != "" {
+		d.resolver = newDNSResolver(cfg.DNSServer)
+	}
+	return d
+}
+
+// DialContext connects to the address, resolving its host name first
+func (d *upstreamDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	ips := d.hosts[strings.ToLower(host)]
+	if len(ips) == 0 && d.resolver != nil {
+		// The system resolver is still tried when the DNS server fails
+		ips, _ = d.resolver.LookupHost(ctx, host)
+	}
+	if len(ips) == 0 {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	// Like the standard dialer, every address gets a share of the dial
+	// timeout, so an unreachable first address does not use all of it
+	attemptTimeout := d.dialer.Timeout / time.Duration(len(ips))
+	var firstErr error
+	for _, ip := range ips {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		conn, err := d.dialer.DialContext(attemptCtx, network, net.JoinHostPort(ip, port))
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// newDNSResolver creates a resolver querying a DNS server ("8.8.8.8",
+// "8.8.8.8:53") or a DNS-over-HTTPS endpoint ("https://1.1.1.1/dns-query")
+func newDNSResolver(server string) *net.Resolver {
+	if strings.Contains(server, "://") {
+		client := &http.Client{Timeout: dnsTimeout}
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return &dohConn{ctx: ctx, url: server, client: client}, nil
+			},
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	dialer := &net.Dialer{Timeout: dnsTimeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// dohConn carries the queries of the Go resolver over DNS-over-HTTPS
+// (RFC 8484). It is not a net.PacketConn, so the resolver frames every
+// message with a two-byte length as it does over TCP.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	client   *http.Client
+	response bytes.Buffer
+}
+
+// Write sends a length-prefixed query and buffers the framed answer
+func (c *dohConn) Write(b []byte) (int, error) {
+	if len(b) < 2 {
+		return 0, errors.New("dns-over-https: short query")
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(b[2:]))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("dns-over-https: server returned %s", resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageBytes+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(answer) > maxDNSMessageBytes {
+		return 0, errors.New("dns-over-https: answer too large")
+	}
+
+	c.response.Write([]byte{byte(len(answer) >> 8), byte(len(answer))})
+	c.response.Write(answer)
+	return len(b), nil
+}
+
+// Read returns the buffered answer
+func (c *dohConn) Read(b []byte) (int, error) {
+	return c.response.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// dohAddr is the address of a DNS-over-HTTPS endpoint
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRetryAttempts     = 3
+	defaultRetryDelay        = 100 * time.Millisecond
+	defaultMaxBackoffSeconds = 60
+)
+
+// retryPolicy is the retry configuration with defaults applied
+type retryPolicy struct {
+	attempts   int
+	delay      time.Duration
+	statuses   map[int]bool
+	maxBackoff int // Seconds
+}
+
+// newRetryPolicy applies the defaults to the retry configuration
+func newRetryPolicy(cfg config.RetryConfig) retryPolicy {
+	policy := retryPolicy{
+		attempts:   cfg.MaxAttempts,
+		delay:      time.Duration(cfg.BaseDelayMs) * time.Millisecond,
+		statuses:   make(map[int]bool, len(cfg.Statuses)),
+		maxBackoff: cfg.MaxBackoffSeconds,
+	}
+	if policy.attempts <= 0 {
+		policy.attempts = defaultRetryAttempts
+	}
+	if policy.delay <= 0 {
+		policy.delay = defaultRetryDelay
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultMaxBackoffSeconds
+	}
+	for _, status := range cfg.Statuses {
+		policy.statuses[status] = true
+	}
+	return policy
+}
+
+// backoff returns the delay before the retry following the given attempt
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	return p.delay * time.Duration(1<<uint(min(attempt, 16)))
+}
+
+// clientBackoff returns the seconds a client should wait before repeating a
+// request that failed after the given number of attempts
+func (p retryPolicy) clientBackoff(attempts int) int {
+	seconds := int(math.Ceil(p.backoff(attempts).Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	if seconds > p.maxBackoff {
+		return p.maxBackoff
+	}
+	return seconds
+}
+
+// retriedError is an upstream error together with the number of attempts made
+type retriedError struct {
+	err      error
+	attempts int
+}
+
+// Error implements the error interface
+func (e *retriedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *retriedError) Unwrap() error {
+	return e.err
+}
+
+// upstreamStatus returns the HTTP status of an upstream error, or 0 when the
+// upstream did not answer
+func upstreamStatus(err error) int {
+	var apiErr *models.APIError
+	if errors.As(err, &apiErr) && apiErr.Retry != nil {
+		return apiErr.Retry.LastStatus
+	}
+	return 0
+}
+
+// retryAfterSeconds parses the Retry-After header of an upstream response
+func retryAfterSeconds(header http.Header) int {
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return seconds
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if seconds := int(math.Ceil(time.Until(at).Seconds())); seconds > 0 {
+			return seconds
+		}
+	}
+	return 0
+}
+
+// retryable reports whether a failed upstream request may be sent again.
+// Dropped connections are always retried; upstream errors only when their
+// status is listed in the retry policy.
+func (c *OpenAIClient) retryable(err error, policy retryPolicy) bool {
+	var rejected *keyRejectedError
+	if errors.As(err, &rejected) {
+		// Rejected keys are rotated instead
+		return false
+	}
+	if isEOFError(err) {
+		return true
+	}
+	return policy.statuses[upstreamStatus(err)]
+}
+
+// withRetries calls fn until it succeeds, fails with an error that is not
+// retryable or the attempts of the retry policy are used up. Failures carry
+// the number of attempts for the retry metadata returned to the client.
+func (c *OpenAIClient) withRetries(ctx context.Context, fn func(attempt int) error) error {
+	policy := newRetryPolicy(c.config.Retry)
+	attempts := 0
+	for {
+		err := fn(attempts)
+		attempts++
+		if err == nil {
+			return nil
+		}
+		if attempts >= policy.attempts || ctx.Err() != nil || !c.retryable(err, policy) {
+			return &retriedError{err: err, attempts: attempts}
+		}
+
+		delay := policy.backoff(attempts - 1)
+		c.logger.WithFields(logrus.Fields{
+			"attempt":  attempts,
+			"status":   upstreamStatus(err),
+			"delay_ms": delay.Milliseconds(),
+			"error":    err.Error(),
+		}).Warn("Retrying upstream request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &retriedError{err: err, attempts: attempts}
+		case <-timer.C:
+		}
+	}
+}
+
+// withRetryInfo completes the retry metadata of a translated error from a
+// transient upstream failure: the attempts made and how long the client
+// should back off, preferring the upstream's own Retry-After
+func (c *OpenAIClient) withRetryInfo(translated *models.APIError, err error) *models.APIError {
+	status := upstreamStatus(err)
+	var netErr net.Error
+	transient := status == http.StatusTooManyRequests || status >= 500 ||
+		isEOFError(err) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+	if !transient {
+		translated.Retry = nil
+		return translated
+	}
+
+	policy := newRetryPolicy(c.config.Retry)
+	info := models.RetryInfo{Attempts: 1, LastStatus: status}
+	var original *models.APIError
+	if errors.As(err, &original) && original.Retry != nil {
+		info.RetryAfterSeconds = original.Retry.RetryAfterSeconds
+	}
+	var retried *retriedError
+	if errors.As(err, &retried) {
+		info.Attempts = retried.attempts
+	}
+	if info.RetryAfterSeconds == 0 {
+		info.RetryAfterSeconds = policy.clientBackoff(info.Attempts)
+	}
+	translated.Retry = &info
+	return translated
+}
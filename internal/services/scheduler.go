@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+const (
+	// PriorityInteractive requests are admitted before batch requests
+	PriorityInteractive = "interactive"
+	// PriorityBatch requests wait while interactive requests are queued
+	PriorityBatch = "batch"
+
+	// PriorityContextKey stores the priority of the local API key in the gin context
+	PriorityContextKey = "priority"
+)
+
+// RequestScheduler limits the number of message requests sent upstream at
+// once. When the limit is reached, queued interactive requests take the next
+// free slot before any batch request, and batch requests never occupy more
+// than their own share of the slots, so an interactive session stays
+// responsive while batch jobs run.
+type RequestScheduler struct {
+	limit      int
+	batchLimit int
+
+	mu          sync.Mutex
+	running     int
+	batch       int // Running batch requests
+	interactive []chan struct{}
+	queued      []chan struct{} // Waiting batch requests
+}
+
+// NewRequestScheduler creates a request scheduler, or returns nil when
+// concurrency is unlimited
+func NewRequestScheduler(cfg *config.Config) *RequestScheduler {
+	if cfg.MaxConcurrentRequests <= 0 {
+		return nil
+	}
+	batchLimit := cfg.MaxBatchRequests
+	if batchLimit <= 0 || batchLimit > cfg.MaxConcurrentRequests {
+		// Keep one slot free for interactive requests
+		batchLimit = max(cfg.MaxConcurrentRequests-1, 1)
+	}
+	return &RequestScheduler{
+		limit:      cfg.MaxConcurrentRequests,
+		batchLimit: batchLimit,
+	}
+}
+
+// Acquire waits for a slot for a request of the given priority. The returned
+// function releases the slot; it returns ctx.Err() if the context ends first.
+func (s *RequestScheduler) Acquire(ctx context.Context, priority string) (func(), error) {
+	batch := priority == PriorityBatch
+
+	s.mu.Lock()
+	if s.admits(batch) {
+		s.start(batch)
+		s.mu.Unlock()
+		return s.releaser(batch), nil
+	}
+	ready := make(chan struct{})
+	if batch {
+		s.queued = append(s.queued, ready)
+	} else {
+		s.interactive = append(s.interactive, ready)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return s.releaser(batch), nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	removed := s.remove(ready, batch)
+	s.mu.Unlock()
+	if !removed {
+		// The slot was granted while the context ended
+		s.release(batch)
+	}
+	return nil, ctx.Err()
+}
+
+// Queued returns the number of waiting interactive and batch requests
+func (s *RequestScheduler) Queued() (interactive, batch int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.interactive), len(s.queued)
+}
+
+// admits reports whether a new request can start without queueing; s.mu must be held
+func (s *RequestScheduler) admits(batch bool) bool {
+	if s.running >= s.limit || len(s.interactive) > 0 {
+		return false
+	}
+	return !batch || (len(s.queued) == 0 && s.batch < s.batchLimit)
+}
+
+// start counts a running request; s.mu must be held
+func (s *RequestScheduler) start(batch bool) {
+	s.running++
+	if batch {
+		s.batch++
+	}
+}
+
+// releaser returns the function that frees the slot of a request, once
+func (s *RequestScheduler) releaser(batch bool) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.release(batch) })
+	}
+}
+
+// release frees a slot and hands it to the next waiting request
+func (s *RequestScheduler) release(batch bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	if batch {
+		s.batch--
+	}
+
+	if len(s.interactive) > 0 {
+		next := s.interactive[0]
+		s.interactive = s.interactive[1:]
+		s.start(false)
+		close(next)
+		return
+	}
+	if len(s.queued) > 0 && s.batch < s.batchLimit {
+		next := s.queued[0]
+		s.queued = s.queued[1:]
+		s.start(true)
+		close(next)
+	}
+}
+
+// remove takes a waiting request out of its queue; s.mu must be held. It
+// returns false when the request has already been admitted.
+func (s *RequestScheduler) remove(ready chan struct{}, batch bool) bool {
+	queue := &s.interactive
+	if batch {
+		queue = &s.queued
+	}
+	for i, waiting := range *queue {
+		if waiting == ready {
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
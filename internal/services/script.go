@@ -0,0 +1,432 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ScriptService applies a user transform script to converted OpenAI requests.
+//
+// Scripts are line oriented. Each line is a statement; "#" starts a comment and
+// string arguments may be double quoted. Statements can be guarded by
+// "when <field> <op> <value>" ... "end" blocks, which may be nested:
+//
+//	when model contains "deepseek"
+//	  remove_tool WebSearch
+//	  set_temperature 0.3
+//	end
+//	prepend_system "Follow the team coding guidelines."
+//
+// Fields: model, stream, tools, messages, max_tokens.
+// Operators: ==, !=, contains, >, <, >=, <=.
+// Actions: set_model, prepend_system, append_system, strip_tools, remove_tool,
+// set_max_tokens, set_temperature.
+type ScriptService struct {
+	config     *config.Config
+	logger     *logrus.Logger
+	statements []scriptStatement
+	loadErr    error // Why the configured script could not be loaded
+}
+
+// scriptStatement is a single parsed script line
+type scriptStatement struct {
+	line      int
+	action    string
+	args      []string
+	condition *scriptCondition
+	body      []scriptStatement
+}
+
+// scriptCondition is the guard of a when block
+type scriptCondition struct {
+	field string
+	op    string
+	value string
+}
+
+// NewScriptService creates a new script service and loads the configured script
+func NewScriptService(cfg *config.Config, logger *logrus.Logger) *ScriptService {
+	s := &ScriptService{
+		config: cfg,
+		logger: logger,
+	}
+
+	if cfg.TransformScript == "" {
+		return s
+	}
+
+	statements, err := loadTransformScript(cfg.TransformScript)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"script": cfg.TransformScript,
+			"error":  err.Error(),
+		}).Error("Failed to load transform script, request transformation disabled")
+		s.loadErr = err
+		return s
+	}
+
+	s.statements = statements
+	logger.WithFields(logrus.Fields{
+		"script":     cfg.TransformScript,
+		"statements": len(statements),
+	}).Info("Transform script loaded")
+
+	return s
+}
+
+// CheckTransformScript reports why a transform script cannot be loaded, so a
+// broken script can be refused before it replaces a working one
+func CheckTransformScript(path string) error {
+	if path == "" {
+		return nil
+	}
+	_, err := loadTransformScript(path)
+	return err
+}
+
+// loadTransformScript reads and parses a transform script file
+func loadTransformScript(path string) ([]scriptStatement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open script: %w", err)
+	}
+	defer file.Close()
+
+	var lines [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens, err := tokenizeScriptLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(lines)+1, err)
+		}
+		lines = append(lines, tokens)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	statements, next, err := parseScriptBlock(lines, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if next != len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected end", next+1)
+	}
+
+	return statements, nil
+}
+
+// Enabled reports whether a transform script is active
+func (s *ScriptService) Enabled() bool {
+	return len(s.statements) > 0
+}
+
+// LoadError returns why the configured script could not be loaded, or nil
+func (s *ScriptService) LoadError() error {
+	return s.loadErr
+}
+
+// Apply runs the transform script against the converted request
+func (s *ScriptService) Apply(req *models.OpenAIRequest) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	if err := s.execute(s.statements, req); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"model":    req.Model,
+		"tools":    len(req.Tools),
+		"messages": len(req.Messages),
+	}).Debug("Transform script applied")
+
+	return nil
+}
+
+// execute runs a list of statements
+func (s *ScriptService) execute(statements []scriptStatement, req *models.OpenAIRequest) error {
+	for _, stmt := range statements {
+		if stmt.condition != nil {
+			matched, err := evaluateScriptCondition(stmt.condition, req)
+			if err != nil {
+				return fmt.Errorf("script line %d: %w", stmt.line, err)
+			}
+			if matched {
+				if err := s.execute(stmt.body, req); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := applyScriptAction(stmt, req); err != nil {
+			return fmt.Errorf("script line %d: %w", stmt.line, err)
+		}
+	}
+	return nil
+}
+
+// parseScriptBlock parses statements until the end of input or a closing "end"
+func parseScriptBlock(lines [][]string, start int, nested bool) ([]scriptStatement, int, error) {
+	var statements []scriptStatement
+
+	for i := start; i < len(lines); i++ {
+		tokens := lines[i]
+		if len(tokens) == 0 {
+			continue
+		}
+
+		switch tokens[0] {
+		case "end":
+			if !nested {
+				return nil, i, fmt.Errorf("line %d: end without when", i+1)
+			}
+			return statements, i, nil
+		case "when":
+			if len(tokens) != 4 {
+				return nil, i, fmt.Errorf("line %d: expected 'when <field> <op> <value>'", i+1)
+			}
+			condition := &scriptCondition{field: tokens[1], op: tokens[2], value: tokens[3]}
+			if err := validateScriptCondition(condition); err != nil {
+				return nil, i, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			body, end, err := parseScriptBlock(lines, i+1, true)
+			if err != nil {
+				return nil, i, err
+			}
+			if end >= len(lines) {
+				return nil, i, fmt.Errorf("line %d: when without end", i+1)
+			}
+			statements = append(statements, scriptStatement{
+				line:      i + 1,
+				condition: condition,
+				body:      body,
+			})
+			i = end
+		default:
+			if err := validateScriptAction(tokens); err != nil {
+				return nil, i, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			statements = append(statements, scriptStatement{
+				line:   i + 1,
+				action: tokens[0],
+				args:   tokens[1:],
+			})
+		}
+	}
+
+	return statements, len(lines), nil
+}
+
+// validateScriptAction checks the action name and its argument count
+func validateScriptAction(tokens []string) error {
+	expected := map[string]int{
+		"set_model":       1,
+		"prepend_system":  1,
+		"append_system":   1,
+		"strip_tools":     0,
+		"remove_tool":     1,
+		"set_max_tokens":  1,
+		"set_temperature": 1,
+	}
+
+	count, ok := expected[tokens[0]]
+	if !ok {
+		return fmt.Errorf("unknown action %q", tokens[0])
+	}
+	if len(tokens)-1 != count {
+		return fmt.Errorf("%s expects %d argument(s)", tokens[0], count)
+	}
+
+	switch tokens[0] {
+	case "set_max_tokens":
+		if _, err := strconv.Atoi(tokens[1]); err != nil {
+			return fmt.Errorf("invalid max_tokens %q", tokens[1])
+		}
+	case "set_temperature":
+		if _, err := strconv.ParseFloat(tokens[1], 64); err != nil {
+			return fmt.Errorf("invalid temperature %q", tokens[1])
+		}
+	}
+	return nil
+}
+
+// scriptFields are the request fields a when block can test, and whether
+// they are numeric
+var scriptFields = map[string]bool{
+	"model":      false,
+	"stream":     false,
+	"tools":      true,
+	"messages":   true,
+	"max_tokens": true,
+}
+
+// validateScriptCondition checks the field, operator and value of a when block
+func validateScriptCondition(cond *scriptCondition) error {
+	numeric, ok := scriptFields[cond.field]
+	if !ok {
+		return fmt.Errorf("unknown field %q", cond.field)
+	}
+
+	switch cond.op {
+	case "==", "!=", "contains":
+		return nil
+	case ">", "<", ">=", "<=":
+		if !numeric {
+			return fmt.Errorf("operator %s requires a numeric field", cond.op)
+		}
+		if _, err := strconv.Atoi(cond.value); err != nil {
+			return fmt.Errorf("invalid number %q", cond.value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operator %q", cond.op)
+	}
+}
+
+// tokenizeScriptLine splits a script line into tokens, honoring quotes and comments
+func tokenizeScriptLine(line string) ([]string, error) {
+	var tokens []string
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case runes[i] == '#':
+			return tokens, nil
+		case runes[i] == '"':
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == '\\' {
+					j++
+					continue
+				}
+				if runes[j] == '"' {
+					break
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			value, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string: %w", err)
+			}
+			tokens = append(tokens, value)
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '#' {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+// evaluateScriptCondition evaluates a when condition against the request
+func evaluateScriptCondition(cond *scriptCondition, req *models.OpenAIRequest) (bool, error) {
+	var actual string
+	numeric := true
+
+	switch cond.field {
+	case "model":
+		actual = req.Model
+		numeric = false
+	case "stream":
+		actual = strconv.FormatBool(req.Stream)
+		numeric = false
+	case "tools":
+		actual = strconv.Itoa(len(req.Tools))
+	case "messages":
+		actual = strconv.Itoa(len(req.Messages))
+	case "max_tokens":
+		actual = strconv.Itoa(req.MaxTokens)
+	default:
+		return false, fmt.Errorf("unknown field %q", cond.field)
+	}
+
+	switch cond.op {
+	case "==":
+		return actual == cond.value, nil
+	case "!=":
+		return actual != cond.value, nil
+	case "contains":
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(cond.value)), nil
+	case ">", "<", ">=", "<=":
+		if !numeric {
+			return false, fmt.Errorf("operator %s requires a numeric field", cond.op)
+		}
+		left, _ := strconv.Atoi(actual)
+		right, err := strconv.Atoi(cond.value)
+		if err != nil {
+			return false, fmt.Errorf("invalid number %q", cond.value)
+		}
+		switch cond.op {
+		case ">":
+			return left > right, nil
+		case "<":
+			return left < right, nil
+		case ">=":
+			return left >= right, nil
+		default:
+			return left <= right, nil
+		}
+	default:
+		return false, fmt.Errorf("unknown operator %q", cond.op)
+	}
+}
+
+// applyScriptAction mutates the request according to a single action
+func applyScriptAction(stmt scriptStatement, req *models.OpenAIRequest) error {
+	switch stmt.action {
+	case "set_model":
+		req.Model = stmt.args[0]
+	case "prepend_system":
+		req.Messages = addSystemText(req.Messages, stmt.args[0], true)
+	case "append_system":
+		req.Messages = addSystemText(req.Messages, stmt.args[0], false)
+	case "strip_tools":
+		req.Tools = nil
+		req.ToolChoice = nil
+	case "remove_tool":
+		var tools []models.OpenAITool
+		for _, tool := range req.Tools {
+			if tool.Function.Name != stmt.args[0] {
+				tools = append(tools, tool)
+			}
+		}
+		req.Tools = tools
+		if len(req.Tools) == 0 {
+			req.ToolChoice = nil
+		}
+	case "set_max_tokens":
+		value, err := strconv.Atoi(stmt.args[0])
+		if err != nil {
+			return fmt.Errorf("invalid max_tokens %q", stmt.args[0])
+		}
+		req.MaxTokens = value
+	case "set_temperature":
+		value, err := strconv.ParseFloat(stmt.args[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid temperature %q", stmt.args[0])
+		}
+		req.Temperature = &value
+	}
+	return nil
+}
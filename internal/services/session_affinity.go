@@ -0,0 +1,115 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// sessionAffinityTTL is how long a session keeps its key after its last
+	// request, the longest prompt cache lifetime of common upstreams
+	sessionAffinityTTL = time.Hour
+
+	// maxSessionBindings bounds the sessions remembered; beyond it the least
+	// recently used session loses its binding
+	maxSessionBindings = 1024
+)
+
+// sessionKey is the context key of the Claude Code session of a request
+type sessionKey struct{}
+
+// sessionBinding is the key a session was last sent with
+type sessionBinding struct {
+	session  string
+	key      *pooledKey
+	lastUsed time.Time
+}
+
+// sessionBindings holds the binding of each session, least recently used
+// last, so expired and surplus bindings are dropped from the back without
+// scanning the rest
+type sessionBindings struct {
+	byID  map[string]*list.Element
+	order *list.List // Of *sessionBinding, most recently used first
+}
+
+// newSessionBindings creates an empty set of bindings
+func newSessionBindings() *sessionBindings {
+	return &sessionBindings{byID: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns the binding of a session, or nil
+func (b *sessionBindings) get(session string) *sessionBinding {
+	if element, ok := b.byID[session]; ok {
+		return element.Value.(*sessionBinding)
+	}
+	return nil
+}
+
+// touch marks the binding of a session as used now
+func (b *sessionBindings) touch(session string, now time.Time) {
+	if element, ok := b.byID[session]; ok {
+		element.Value.(*sessionBinding).lastUsed = now
+		b.order.MoveToFront(element)
+	}
+}
+
+// add binds a new session, first dropping expired bindings and then, while
+// the set is still full, the least recently used one
+func (b *sessionBindings) add(session string, key *pooledKey, now time.Time) {
+	for back := b.order.Back(); back != nil; back = b.order.Back() {
+		binding := back.Value.(*sessionBinding)
+		if now.Sub(binding.lastUsed) <= sessionAffinityTTL && b.order.Len() < maxSessionBindings {
+			break
+		}
+		b.order.Remove(back)
+		delete(b.byID, binding.session)
+	}
+	b.byID[session] = b.order.PushFront(&sessionBinding{session: session, key: key, lastUsed: now})
+}
+
+// WithSession attaches the Claude Code session of a request to the context.
+// With session_affinity set, requests of the same session are sent with the
+// same pooled key.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// sessionFrom returns the Claude Code session of a request, if any
+func sessionFrom(ctx context.Context) string {
+	session, _ := ctx.Value(sessionKey{}).(string)
+	return session
+}
+
+// boundKey returns the key the session is bound to while it can still be
+// used; p.mu must be held
+func (p *KeyPool) boundKey(session string, exclude map[*pooledKey]bool, now time.Time) *pooledKey {
+	binding := p.sessions.get(session)
+	if binding == nil || now.Sub(binding.lastUsed) > sessionAffinityTTL {
+		return nil
+	}
+	if exclude[binding.key] || now.Before(binding.key.cooldownUntil) {
+		return nil
+	}
+	return binding.key
+}
+
+// bindSession binds the session to the key; p.mu must be held
+func (p *KeyPool) bindSession(session string, key *pooledKey, now time.Time) {
+	if binding := p.sessions.get(session); binding != nil {
+		if binding.key != key {
+			p.logger.WithFields(logrus.Fields{
+				"session": session,
+				"from":    binding.key.name,
+				"to":      key.name,
+			}).Debug("Moving session to another upstream API key")
+		}
+		binding.key = key
+		p.sessions.touch(session, now)
+		return
+	}
+	p.sessions.add(session, key, now)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSessionBindingsBounded checks that bindings never exceed
+// maxSessionBindings and that the least recently used session is dropped first
+func TestSessionBindingsBounded(t *testing.T) {
+	bindings := newSessionBindings()
+	key := &pooledKey{name: "key-1"}
+	start := time.Now()
+
+	for i := 0; i < maxSessionBindings; i++ {
+		bindings.add(fmt.Sprintf("session-%d", i), key, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	// The oldest session is used again, so the next oldest is dropped
+	now := start.Add(time.Duration(maxSessionBindings) * time.Millisecond)
+	bindings.touch("session-0", now)
+	bindings.add("session-new", key, now)
+
+	if len(bindings.byID) != maxSessionBindings || bindings.order.Len() != maxSessionBindings {
+		t.Fatalf("got %d bindings (%d in order), want %d", len(bindings.byID), bindings.order.Len(), maxSessionBindings)
+	}
+	for session, want := range map[string]bool{"session-0": true, "session-1": false, "session-2": true, "session-new": true} {
+		if got := bindings.get(session) != nil; got != want {
+			t.Errorf("binding of %s present = %v, want %v", session, got, want)
+		}
+	}
+
+	// Expired bindings are dropped as soon as a session is added
+	later := now.Add(sessionAffinityTTL + time.Second)
+	bindings.touch("session-new", later)
+	bindings.add("session-later", key, later)
+	if len(bindings.byID) != 2 || bindings.get("session-new") == nil || bindings.get("session-later") == nil {
+		t.Fatalf("got %d bindings after expiry, want session-new and session-later", len(bindings.byID))
+	}
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRedisPrefix = "claudeproxy:"
+	redisTimeout       = 2 * time.Second
+	maxIdleRedisConns  = 16
+	redisWarnInterval  = time.Minute
+
+	// Redis is skipped for a backoff window after it fails, doubling with
+	// each failure in a row, so an outage does not add a timeout to every request
+	redisMinBackoff = time.Second
+	redisMaxBackoff = 30 * time.Second
+)
+
+// errRedisNil is the nil reply of Redis
+var errRedisNil = errors.New("redis: nil")
+
+// errRedisBackoff is returned without contacting Redis during the backoff
+// window after a failure
+var errRedisBackoff = errors.New("redis: skipped after a recent failure")
+
+// SharedState keeps the state several proxy instances behind a load
+// balancer must agree on in Redis: daily quota usage, deduplicated responses
+// and upstream key cool-downs. Callers fall back to their local state when
+// Redis cannot be reached, so an outage degrades to per-instance limits
+// instead of failing requests.
+type SharedState struct {
+	addr     string
+	username string
+	password string
+	db       int
+	useTLS   bool
+	prefix   string
+	logger   *logrus.Logger
+
+	idle     chan *redisConn
+	lastWarn atomic.Int64 // Unix nanoseconds of the last outage warning
+
+	mu        sync.Mutex
+	failures  int       // Failures in a row
+	skipUntil time.Time // End of the backoff window
+}
+
+// redisConn is a connection speaking the Redis protocol (RESP2)
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewSharedState creates the Redis client for cluster mode, or returns nil
+// when no Redis is configured
+func NewSharedState(cfg *config.Config, logger *logrus.Logger) (*SharedState, error) {
+	if cfg.RedisURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis_url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis_url: unsupported scheme %q", u.Scheme)
+	}
+
+	s := &SharedState{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+		prefix: cfg.RedisPrefix,
+		logger: logger,
+		idle:   make(chan *redisConn, maxIdleRedisConns),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if s.prefix == "" {
+		s.prefix = defaultRedisPrefix
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis_url: database %q is not a number", db)
+		}
+	}
+	return s, nil
+}
+
+// key returns the Redis key for a name within the configured prefix
+func (s *SharedState) key(parts ...string) string {
+	return s.prefix + strings.Join(parts, ":")
+}
+
+// Ping checks that Redis is reachable
+func (s *SharedState) Ping() error {
+	_, err := s.do("PING")
+	return err
+}
+
+// dial opens and authenticates a new connection
+func (s *SharedState) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if s.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.username != "" {
+			args = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := rc.pipeline(args); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := rc.pipeline([]string{"SELECT", strconv.Itoa(s.db)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// do sends a command and returns its reply: a string, an int64, a
+// []interface{} or nil
+func (s *SharedState) do(args ...string) (interface{}, error) {
+	replies, err := s.pipeline(args)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// pipeline sends commands in one round trip on an idle or new connection and
+// returns their replies. It fails with the first error reply.
+func (s *SharedState) pipeline(cmds ...[]string) ([]interface{}, error) {
+	if s.backingOff() {
+		return nil, errRedisBackoff
+	}
+
+	var rc *redisConn
+	select {
+	case rc = <-s.idle:
+	default:
+		var err error
+		if rc, err = s.dial(); err != nil {
+			s.recordResult(err)
+			return nil, err
+		}
+	}
+
+	replies, err := rc.pipeline(cmds...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state after I/O errors
+		rc.conn.Close()
+		s.recordResult(err)
+		return nil, err
+	}
+	s.recordResult(nil)
+	select {
+	case s.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+	return replies, err
+}
+
+// backingOff reports whether Redis is skipped after a recent failure
+func (s *SharedState) backingOff() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Now().Before(s.skipUntil)
+}
+
+// recordResult closes the backoff window after a success and opens a longer
+// one after each failed connection or I/O error
+func (s *SharedState) recordResult(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.failures = 0
+		return
+	}
+	backoff := redisMaxBackoff
+	if s.failures < 5 {
+		backoff = redisMinBackoff << s.failures
+	}
+	s.failures++
+	s.skipUntil = time.Now().Add(backoff)
+}
+
+// warn logs a failed Redis command, at most once per minute during an
+// outage; the caller continues with local state
+func (s *SharedState) warn(err error, operation string) {
+	now := time.Now().UnixNano()
+	last := s.lastWarn.Load()
+	if now-last < int64(redisWarnInterval) || !s.lastWarn.CompareAndSwap(last, now) {
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"operation": operation,
+		"error":     err.Error(),
+	}).Warn("Shared state unavailable, using local state")
+}
+
+// redisError is an error reply of Redis
+type redisError string
+
+// Error implements the error interface
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// pipeline writes commands and reads all of their replies, so the
+// connection stays usable after an error reply
+func (rc *redisConn) pipeline(cmds ...[]string) ([]interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	var buf strings.Builder
+	for _, args := range cmds {
+		fmt.Fprintf(&buf, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(rc.conn, buf.String()); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range replies {
+		reply, err := rc.read()
+		var redisErr redisError
+		if err != nil && !errors.As(err, &redisErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// read parses one reply
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rc.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = rc.read(); err != nil {
+				var redisErr redisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				items[i] = nil
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// getString returns a string reply, or errRedisNil for a missing key
+func (s *SharedState) getString(args ...string) (string, error) {
+	reply, err := s.do(args...)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", errRedisNil
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+	return value, nil
+}
+
+// getStrings returns an array reply; missing values are empty strings
+func (s *SharedState) getStrings(args ...string) ([]string, error) {
+	reply, err := s.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]interface{})
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i], _ = item.(string)
+	}
+	return values, nil
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+)
+
+// Storage backends
+const (
+	StorageJSONL    = "jsonl"
+	StoragePostgres = "postgres"
+)
+
+// maxTranscriptLineBytes bounds a stored request with its whole conversation
+const maxTranscriptLineBytes = 64 * 1024 * 1024
+
+// Storage persists usage records, transcripts and mirrored requests. The JSONL backend keeps
+// them in files in the config directory of one machine; a database lets the
+// instances of a team deployment keep them in one place.
+type Storage interface {
+	// AppendUsage stores the usage record of a request
+	AppendUsage(record *UsageRecord) error
+
+	// LoadUsage returns the usage records from since on, oldest first; the
+	// zero time returns all of them
+	LoadUsage(since time.Time) ([]UsageRecord, error)
+
+	// AppendTranscript stores a request of a session with its response
+	AppendTranscript(entry *TranscriptEntry) error
+
+	// LoadTranscript returns the entries of a session, oldest first. A
+	// unique prefix of the session ID is enough.
+	LoadTranscript(session string) ([]TranscriptEntry, error)
+
+	// ListTranscripts summarizes the stored sessions, most recently updated first
+	ListTranscripts() ([]TranscriptSession, error)
+
+	// AppendMirror stores the primary and shadow results of a mirrored request
+	AppendMirror(record *MirrorRecord) error
+
+	// LoadMirror returns the mirrored requests from since on, oldest first;
+	// the zero time returns all of them
+	LoadMirror(since time.Time) ([]MirrorRecord, error)
+
+	// String describes where the data is kept, without credentials
+	String() string
+
+	Close() error
+}
+
+// OpenStorage opens the storage backend of the configuration
+func OpenStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "", StorageJSONL:
+		return &jsonlStorage{dir: config.Dir()}, nil
+	case StoragePostgres:
+		return openPostgresStorage(cfg.StorageDSN)
+	}
+	return nil, fmt.Errorf("unsupported storage backend %q", cfg.StorageBackend)
+}
+
+// jsonlStorage appends usage records to usage.jsonl, mirrored requests to
+// mirror.jsonl and transcripts to one JSONL file per session in
+// transcripts/, all in the config directory
+type jsonlStorage struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func (s *jsonlStorage) AppendUsage(record *UsageRecord) error {
+	return s.append(filepath.Join(s.dir, "usage.jsonl"), record)
+}
+
+func (s *jsonlStorage) LoadUsage(since time.Time) ([]UsageRecord, error) {
+	file, err := os.Open(filepath.Join(s.dir, "usage.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Malformed lines, such as one cut short by a crash, are skipped
+	var records []UsageRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil && !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func (s *jsonlStorage) AppendTranscript(entry *TranscriptEntry) error {
+	dir := filepath.Join(s.dir, "transcripts")
+	if err := os.MkdirAll(dir, config.PrivateDirMode); err != nil {
+		return err
+	}
+	return s.append(filepath.Join(dir, entry.Session+".jsonl"), entry)
+}
+
+func (s *jsonlStorage) LoadTranscript(session string) ([]TranscriptEntry, error) {
+	sessions, err := s.sessions(session)
+	if err != nil {
+		return nil, err
+	}
+	if session, err = pickSession(session, sessions); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(s.dir, "transcripts", session+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []TranscriptEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxTranscriptLineBytes)
+	for scanner.Scan() {
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (s *jsonlStorage) ListTranscripts() ([]TranscriptSession, error) {
+	sessions, err := s.sessions("")
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []TranscriptSession
+	for _, session := range sessions {
+		entries, err := s.LoadTranscript(session)
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+		summaries = append(summaries, TranscriptSession{
+			ID:       entries[0].Session,
+			Started:  entries[0].Time,
+			Updated:  entries[len(entries)-1].Time,
+			Requests: len(entries),
+			Title:    conversationTitle(Conversation(entries).Messages),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Updated.After(summaries[j].Updated)
+	})
+	return summaries, nil
+}
+
+func (s *jsonlStorage) AppendMirror(record *MirrorRecord) error {
+	return s.append(filepath.Join(s.dir, "mirror.jsonl"), record)
+}
+
+func (s *jsonlStorage) LoadMirror(since time.Time) ([]MirrorRecord, error) {
+	file, err := os.Open(filepath.Join(s.dir, "mirror.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []MirrorRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxTranscriptLineBytes)
+	for scanner.Scan() {
+		var record MirrorRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil && !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func (s *jsonlStorage) String() string {
+	return s.dir
+}
+
+func (s *jsonlStorage) Close() error {
+	return nil
+}
+
+// sessions returns the sessions with a transcript file starting with prefix
+func (s *jsonlStorage) sessions(prefix string) ([]string, error) {
+	prefix = unsafeSessionChars.ReplaceAllString(prefix, "_")
+	paths, err := filepath.Glob(filepath.Join(s.dir, "transcripts", prefix+"*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]string, 0, len(paths))
+	for _, path := range paths {
+		sessions = append(sessions, strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+	}
+	return sessions, nil
+}
+
+// append writes a value as a line of a private JSONL file
+func (s *jsonlStorage) append(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, config.PrivateFileMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// pickSession chooses the session a prefix refers to from the sessions
+// starting with it; an exact match wins
+func pickSession(prefix string, sessions []string) (string, error) {
+	prefix = unsafeSessionChars.ReplaceAllString(prefix, "_")
+	for _, session := range sessions {
+		if session == prefix {
+			return session, nil
+		}
+	}
+	switch len(sessions) {
+	case 0:
+		return "", fmt.Errorf("no transcript for session %s", prefix)
+	case 1:
+		return sessions[0], nil
+	default:
+		return "", fmt.Errorf("session prefix %s matches %d sessions", prefix, len(sessions))
+	}
+}
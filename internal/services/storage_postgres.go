@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"claude-code-provider-proxy/internal/models"
+
+	// Registers the "postgres" database/sql driver
+	_ "github.com/lib/pq"
+)
+
+const (
+	postgresTimeout       = 10 * time.Second
+	maxPostgresOpenConns  = 8
+	postgresStorageSchema = `
+CREATE TABLE IF NOT EXISTS claudeproxy_usage (
+	id BIGSERIAL PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	record JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS claudeproxy_usage_time ON claudeproxy_usage (time);
+
+CREATE TABLE IF NOT EXISTS claudeproxy_transcripts (
+	id BIGSERIAL PRIMARY KEY,
+	session TEXT NOT NULL,
+	time TIMESTAMPTZ NOT NULL,
+	messages INTEGER NOT NULL,
+	entry JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS claudeproxy_transcripts_session ON claudeproxy_transcripts (session, id);
+
+CREATE TABLE IF NOT EXISTS claudeproxy_mirror (
+	id BIGSERIAL PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	record JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS claudeproxy_mirror_time ON claudeproxy_mirror (time);
+`
+)
+
+// postgresStorage keeps usage records, transcripts and mirrored requests as
+// JSON documents in a PostgreSQL database, so several instances can share
+// it. The tables are created on first use.
+type postgresStorage struct {
+	db   *sql.DB
+	name string // DSN without credentials
+}
+
+// openPostgresStorage connects to the database and creates the tables
+func openPostgresStorage(dsn string) (*postgresStorage, error) {
+	if dsn == "" {
+		return nil, errors.New("storage_dsn is required for the postgres backend")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxPostgresOpenConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, postgresStorageSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	name := "postgres"
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		name = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	}
+	return &postgresStorage{db: db, name: name}, nil
+}
+
+func (s *postgresStorage) AppendUsage(record *UsageRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO claudeproxy_usage (time, record) VALUES ($1, $2)`, record.Time, string(data))
+	return err
+}
+
+func (s *postgresStorage) LoadUsage(since time.Time) ([]UsageRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT record FROM claudeproxy_usage WHERE time >= $1 ORDER BY id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []UsageRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var record UsageRecord
+		if err := json.Unmarshal(data, &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, rows.Err()
+}
+
+func (s *postgresStorage) AppendTranscript(entry *TranscriptEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO claudeproxy_transcripts (session, time, messages, entry) VALUES ($1, $2, $3, $4)`,
+		entry.Session, entry.Time, len(entry.Messages), string(data))
+	return err
+}
+
+func (s *postgresStorage) LoadTranscript(session string) ([]TranscriptEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	// left() instead of LIKE, as "_" in session IDs is a LIKE wildcard
+	prefix := unsafeSessionChars.ReplaceAllString(session, "_")
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT session FROM claudeproxy_transcripts WHERE left(session, length($1)) = $1`, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []string
+	for rows.Next() {
+		var match string
+		if err := rows.Scan(&match); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sessions = append(sessions, match)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if session, err = pickSession(session, sessions); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx,
+		`SELECT entry FROM claudeproxy_transcripts WHERE session = $1 ORDER BY id`, session)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []TranscriptEntry
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry TranscriptEntry
+		if err := json.Unmarshal(data, &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, rows.Err()
+}
+
+func (s *postgresStorage) ListTranscripts() ([]TranscriptSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	// The title comes from the longest history, like the exported conversation
+	rows, err := s.db.QueryContext(ctx, `
+SELECT s.session, s.started, s.updated, s.requests, t.history
+FROM (
+	SELECT session, min(time) AS started, max(time) AS updated, count(*) AS requests
+	FROM claudeproxy_transcripts GROUP BY session
+) s
+CROSS JOIN LATERAL (
+	SELECT entry->'messages' AS history FROM claudeproxy_transcripts
+	WHERE session = s.session ORDER BY messages DESC, id DESC LIMIT 1
+) t
+ORDER BY s.updated DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []TranscriptSession
+	for rows.Next() {
+		var summary TranscriptSession
+		var data []byte
+		if err := rows.Scan(&summary.ID, &summary.Started, &summary.Updated, &summary.Requests, &data); err != nil {
+			return nil, err
+		}
+		var messages []models.AnthropicMessage
+		if json.Unmarshal(data, &messages) == nil {
+			summary.Title = conversationTitle(messages)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+func (s *postgresStorage) AppendMirror(record *MirrorRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO claudeproxy_mirror (time, record) VALUES ($1, $2)`, record.Time, string(data))
+	return err
+}
+
+func (s *postgresStorage) LoadMirror(since time.Time) ([]MirrorRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT record FROM claudeproxy_mirror WHERE time >= $1 ORDER BY id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []MirrorRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var record MirrorRecord
+		if err := json.Unmarshal(data, &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, rows.Err()
+}
+
+func (s *postgresStorage) String() string {
+	return s.name
+}
+
+func (s *postgresStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamCheckInterval is the time between the events of the streaming
+// health check
+const StreamCheckInterval = 200 * time.Millisecond
+
+// streamCheckModel is the model named in the streaming health check
+const streamCheckModel = "health-check"
+
+// streamCheckChunks is the upstream stream replayed by the streaming health
+// check: text deltas, the finish reason and the usage
+var streamCheckChunks = []string{
+	`{"id":"health-check","object":"chat.completion.chunk","model":"health-check","choices":[{"index":0,"delta":{"role":"assistant","content":"stream"}}]}`,
+	`{"id":"health-check","object":"chat.completion.chunk","model":"health-check","choices":[{"index":0,"delta":{"content":" check"}}]}`,
+	`{"id":"health-check","object":"chat.completion.chunk","model":"health-check","choices":[{"index":0,"delta":{"content":" ok"}}]}`,
+	`{"id":"health-check","object":"chat.completion.chunk","model":"health-check","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	`{"id":"health-check","object":"chat.completion.chunk","model":"health-check","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":3,"total_tokens":4}}`,
+	`[DONE]`,
+}
+
+// StreamCheck streams a canned upstream response through the conversion
+// path to the client, one upstream event every StreamCheckInterval, without
+// contacting any upstream. When the events reach the client spread out
+// rather than all at once, server-sent events are flushed end to end,
+// through any reverse proxy in front of the proxy included.
+func (s *StreamingService) StreamCheck(c *gin.Context) error {
+	reader, writer := io.Pipe()
+	go func() {
+		for i, chunk := range streamCheckChunks {
+			if i > 0 {
+				select {
+				case <-time.After(StreamCheckInterval):
+				case <-c.Request.Context().Done():
+					writer.CloseWithError(c.Request.Context().Err())
+					return
+				}
+			}
+			// Fails once StreamResponse closed the body
+			if _, err := writer.Write([]byte("data: " + chunk + "\n\n")); err != nil {
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       reader,
+	}
+	return s.StreamResponse(c, resp, streamCheckModel)
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"claude-code-provider-proxy/internal/models"
+)
+
+// maxStreamLineBytes bounds one line of an upstream stream. Chunks with long
+// tool arguments can exceed the 64 KiB default of bufio.Scanner.
+const maxStreamLineBytes = 8 << 20
+
+// streamChunkEnvelope holds the fields that tell an upstream event apart from
+// a chat completion chunk: an inline error, or the type of an event of
+// another stream format
+type streamChunkEnvelope struct {
+	Error json.RawMessage `json:"error"`
+	Type  string          `json:"type"`
+}
+
+// sseField returns the value of an SSE field line such as "data: {...}". The
+// space after the colon is optional.
+func sseField(line, name string) (string, bool) {
+	if !strings.HasPrefix(line, name+":") {
+		return "", false
+	}
+	return strings.TrimPrefix(line[len(name)+1:], " "), true
+}
+
+// parseStreamChunk parses the data of an upstream SSE event. It returns the
+// chat completion chunk, or the error the upstream sent in the stream. Any
+// other event is returned as an error and skipped by the caller.
+func parseStreamChunk(event, data string) (*models.OpenAIStreamResponse, *models.APIError, error) {
+	data = strings.TrimSpace(data)
+	if !strings.HasPrefix(data, "{") {
+		return nil, nil, fmt.Errorf("not a JSON object")
+	}
+
+	var envelope streamChunkEnvelope
+	if err := json.Unmarshal([]byte(data), &envelope); err != nil {
+		return nil, nil, err
+	}
+	if event == "error" || envelope.Type == "error" || hasJSONValue(envelope.Error) {
+		return nil, inlineStreamError(envelope, data), nil
+	}
+
+	var chunk models.OpenAIStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil, nil, err
+	}
+	// Chat completion chunks carry no type; events of other formats, such as
+	// Anthropic's message_start, do
+	if envelope.Type != "" && len(chunk.Choices) == 0 && chunk.Usage == nil {
+		return nil, nil, fmt.Errorf("unexpected %s event", envelope.Type)
+	}
+	return &chunk, nil, nil
+}
+
+// inlineStreamError converts an error sent in the stream. The error is an
+// object or a plain message under "error", or the whole data of an "error"
+// event. Routers send the HTTP status of the failure as a numeric code, which
+// gives the error its type as it would for an error response.
+func inlineStreamError(envelope streamChunkEnvelope, data string) *models.APIError {
+	raw := envelope.Error
+	if !hasJSONValue(raw) {
+		raw = json.RawMessage(data)
+	}
+	if apiErr, ok := decodeUpstreamError(raw); ok {
+		if status, err := strconv.Atoi(apiErr.Code); err == nil && apiErr.Type == models.ErrorTypeAPI {
+			apiErr.Type = errorTypeForStatus(status)
+		}
+		return apiErr
+	}
+	return models.NewAPIError("Upstream stream error: " + truncateText(data, 200))
+}
@@ -0,0 +1,43 @@
+package services
+
+import "testing"
+
+// FuzzParseStreamChunk feeds arbitrary upstream events to parseStreamChunk,
+// which must never panic and must return exactly one of a chunk, an upstream
+// error or a parse error
+func FuzzParseStreamChunk(f *testing.F) {
+	seeds := []struct{ event, data string }{
+		{"", `{"id":"x","choices":[{"index":0,"delta":{"content":"hi"}}]}`},
+		{"", `{"id":"x","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"c1","type":"function","function":{"name":"read","arguments":"{\"pa"}}]}}]}`},
+		{"", `{"id":"x","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2}}`},
+		{"", `{"error":{"message":"Rate limit reached","code":429}}`},
+		{"", `{"error":"model crashed"}`},
+		{"error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+		{"error", `not json`},
+		{"", `{"type":"message_start","message":{"id":"msg_1"}}`},
+		{"", `{"type":"ping"}`},
+		{"", `: keep-alive`},
+		{"", `[DONE]`},
+		{"", `{"error":null,"choices":null}`},
+		{"", `{"error":{"message":""}}`},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.event, seed.data)
+	}
+
+	f.Fuzz(func(t *testing.T, event, data string) {
+		chunk, apiErr, err := parseStreamChunk(event, data)
+		results := 0
+		for _, set := range []bool{chunk != nil, apiErr != nil, err != nil} {
+			if set {
+				results++
+			}
+		}
+		if results != 1 {
+			t.Fatalf("parseStreamChunk(%q, %q) = %v, %v, %v; want exactly one result", event, data, chunk, apiErr, err)
+		}
+		if apiErr != nil && apiErr.Message == "" {
+			t.Fatalf("parseStreamChunk(%q, %q) returned an upstream error without a message", event, data)
+		}
+	})
+}
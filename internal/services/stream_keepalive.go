@@ -0,0 +1,97 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveComment is the SSE comment sent on idle streams; clients ignore it
+const keepAliveComment = ": keep-alive\n\n"
+
+// setStreamHeaders sets the headers of a server-sent event stream. nginx
+// honours X-Accel-Buffering and proxies such as Cloudflare leave no-transform
+// responses uncompressed, so neither holds events back.
+func setStreamHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache, no-transform")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+}
+
+// keepAliveWriter serializes the writes of a stream with the keep-alive
+// comments sent while it is idle
+type keepAliveWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex
+	lastWrite time.Time
+}
+
+func (w *keepAliveWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWrite = time.Now()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *keepAliveWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWrite = time.Now()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *keepAliveWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.Flush()
+}
+
+// startKeepAlive sends a keep-alive comment whenever the stream of the
+// request has been idle for stream_keepalive_seconds, so proxies with idle
+// timeouts do not cut it off while the upstream is thinking. The returned
+// function stops sending them.
+func (s *StreamingService) startKeepAlive(c *gin.Context) func() {
+	interval := time.Duration(s.config.StreamKeepAliveSeconds) * time.Second
+	if interval <= 0 {
+		return func() {}
+	}
+
+	writer := &keepAliveWriter{ResponseWriter: c.Writer, lastWrite: time.Now()}
+	c.Writer = writer
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+
+			writer.mu.Lock()
+			idle := time.Since(writer.lastWrite)
+			if idle >= interval {
+				if _, err := writer.ResponseWriter.WriteString(keepAliveComment); err != nil {
+					writer.mu.Unlock()
+					return
+				}
+				writer.ResponseWriter.Flush()
+				writer.lastWrite = time.Now()
+				idle = 0
+			}
+			writer.mu.Unlock()
+			timer.Reset(interval - idle)
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		c.Writer = writer.ResponseWriter
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"time"
+
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Keys of the stream timing in the gin context, included in the access log
+const (
+	FirstTokenContextKey      = "first_token_ms"
+	TokensPerSecondContextKey = "tokens_per_second"
+	SlowFirstTokenContextKey  = "slow_first_token"
+)
+
+const (
+	// upstreamStartContextKey stores when the upstream request was sent in the gin context
+	upstreamStartContextKey = "upstream_start"
+
+	// defaultSlowFirstToken is the first token latency logged as slow by default
+	defaultSlowFirstToken = 10 * time.Second
+)
+
+// StartUpstreamTimer marks the time the upstream request of the current
+// request is sent, from which the first token latency of its stream is measured
+func StartUpstreamTimer(c *gin.Context) {
+	c.Set(upstreamStartContextKey, time.Now())
+}
+
+// upstreamStart returns when the upstream request was sent, or the fallback
+// when the request did not mark it
+func upstreamStart(c *gin.Context, fallback time.Time) time.Time {
+	if value, ok := c.Get(upstreamStartContextKey); ok {
+		if start, ok := value.(time.Time); ok {
+			return start
+		}
+	}
+	return fallback
+}
+
+// slowFirstToken returns the first token latency logged as slow, 0 when the
+// warning is disabled
+func (s *StreamingService) slowFirstToken() time.Duration {
+	switch seconds := s.config.SlowFirstTokenSeconds; {
+	case seconds < 0:
+		return 0
+	case seconds == 0:
+		return defaultSlowFirstToken
+	default:
+		return time.Duration(seconds) * time.Second
+	}
+}
+
+// markFirstToken notes the arrival of streamed content
+func (s *streamSession) markFirstToken(choice models.OpenAIChoice) {
+	delta := choice.Delta
+	if delta == nil {
+		return
+	}
+	text, _ := delta.Content.(string)
+	if text == "" && delta.Refusal == "" && len(delta.ToolCalls) == 0 {
+		return
+	}
+	if s.firstTokenAt.IsZero() {
+		s.firstTokenAt = time.Now()
+	}
+	s.contentChunks++
+}
+
+// recordTiming records the first token latency and throughput of a completed
+// stream and warns about a slow first token. Without usage from the upstream
+// every chunk with content counts as one token.
+func (s *streamSession) recordTiming(c *gin.Context) {
+	if s.firstTokenAt.IsZero() {
+		return
+	}
+	firstToken := s.firstTokenAt.Sub(s.upstreamStart)
+	generation := time.Since(s.firstTokenAt)
+	tokens := s.outputTokens
+	if tokens == 0 {
+		tokens = s.contentChunks
+	}
+
+	threshold := s.slowFirstToken()
+	slow := threshold > 0 && firstToken > threshold
+	if slow {
+		s.logger.WithFields(logrus.Fields{
+			"request_id":     c.GetString("request_id"),
+			"first_token_ms": firstToken.Milliseconds(),
+			"threshold_ms":   threshold.Milliseconds(),
+		}).Warn("Slow first token from upstream")
+	}
+	RecordStreamTiming(c, firstToken, tokens, generation, slow)
+}
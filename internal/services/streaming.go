@@ -10,25 +10,49 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"claude-code-provider-proxy/internal/config"
 	"claude-code-provider-proxy/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// Default limits for buffered tool call arguments
+const (
+	defaultMaxToolArgumentBytes   = 1 << 20 // 1 MiB per tool call
+	defaultMaxStreamArgumentBytes = 4 << 20 // 4 MiB per streamed response
+)
+
 // StreamingService handles streaming responses
 type StreamingService struct {
 	conversionService *ConversionService
+	config            *config.Config
 	logger            *logrus.Logger
-	// Track streaming state
-	currentContentBlockIndex int
-	toolCallStates           map[int]*ToolCallState
-	messageID                string
-	outputTokens             int
-	hasStartedTextBlock      bool
-	hasStartedToolBlocks     map[int]bool
+	reporter          *ErrorReporter // Set by NewErrorReporter, nil when reporting is off
+}
+
+// streamSession tracks the conversion state of a single streaming response.
+// The StreamingService is shared between requests, so all per-stream state
+// lives here.
+type streamSession struct {
+	*StreamingService
+	nextBlockIndex int                    // Index of the next content block opened
+	textBlockIndex int                    // Index of the open text block, -1 when none is open
+	toolCalls      []*ToolCallState       // In the order the calls first appeared
+	toolCallStates map[int]*ToolCallState // Latest tool call by OpenAI index
+	messageID      string
+	outputTokens   int
+	argumentBytes  int                 // Tool argument bytes buffered across all tool calls
+	droppedChoices map[int]interface{} // Text of choices other than the first, by index
+	upstreamStart  time.Time           // When the upstream request was sent
+	firstTokenAt   time.Time           // When the first content arrived
+	contentChunks  int                 // Chunks with content, for throughput without usage
 }
 
 // ToolCallState tracks the state of a tool call during streaming
@@ -36,39 +60,49 @@ type ToolCallState struct {
 	ID              string
 	Name            string
 	ArgumentsBuffer string
-	AnthropicIndex  int
+	AnthropicIndex  int // Content block index, assigned when the block starts
 	OpenAIIndex     int
 	HasSentStart    bool
 }
 
 // NewStreamingService creates a new streaming service
-func NewStreamingService(conversionService *ConversionService, logger *logrus.Logger) *StreamingService {
+func NewStreamingService(conversionService *ConversionService, cfg *config.Config, logger *logrus.Logger) *StreamingService {
 	return &StreamingService{
-		conversionService:    conversionService,
-		logger:               logger,
-		toolCallStates:       make(map[int]*ToolCallState),
-		hasStartedToolBlocks: make(map[int]bool),
+		conversionService: conversionService,
+		config:            cfg,
+		logger:            logger,
+	}
+}
+
+// newSession creates the state for a new streaming response
+func (s *StreamingService) newSession() *streamSession {
+	return &streamSession{
+		StreamingService: s,
+		textBlockIndex:   -1,
+		toolCallStates:   make(map[int]*ToolCallState),
+		messageID:        s.generateMessageID(),
 	}
 }
 
 // StreamResponse handles streaming response from OpenAI and converts to Anthropic format
-func (s *StreamingService) StreamResponse(c *gin.Context, resp *http.Response, originalModel string) error {
+func (s *StreamingService) StreamResponse(c *gin.Context, resp *http.Response, originalModel string) (err error) {
+	defer s.recoverStream(c, &err)
+
 	// Initialize streaming state
-	s.resetStreamingState()
-	s.messageID = s.generateMessageID()
+	session := s.newSession()
+	session.upstreamStart = upstreamStart(c, time.Now())
 
 	// Set headers for Server-Sent Events
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
+	setStreamHeaders(c)
 	c.Header("Access-Control-Allow-Origin", "*")
 
 	// Create a scanner to read the response line by line
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
 	defer resp.Body.Close()
 
 	// Send initial message_start event
-	if err := s.sendMessageStart(c, originalModel); err != nil {
+	if err := session.sendMessageStart(c, originalModel); err != nil {
 		return err
 	}
 
@@ -79,52 +113,75 @@ func (s *StreamingService) StreamResponse(c *gin.Context, resp *http.Response, o
 		return err
 	}
 
+	// Keep the stream alive while the upstream is silent
+	stopKeepAlive := s.startKeepAlive(c)
+	defer stopKeepAlive()
+
 	// Process each line from the stream
+	var event string
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, ":") {
+		// An empty line ends an event; skip comments
+		if line == "" {
+			event = ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
 			continue
 		}
 
 		// Parse Server-Sent Events format
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
+		if name, ok := sseField(line, "event"); ok {
+			event = name
+			continue
+		}
+		data, ok := sseField(line, "data")
+		if !ok {
+			continue
+		}
 
-			// Check for stream end
-			if data == "[DONE]" {
-				s.logger.Debug("Stream ended with [DONE]")
-				break
-			}
+		// Check for stream end
+		if data == "[DONE]" {
+			s.logger.Debug("Stream ended with [DONE]")
+			break
+		}
 
-			// Debug log: raw streaming data
+		// Debug log: raw streaming data
+		s.logger.WithFields(logrus.Fields{
+			"data": data,
+		}).Debug("Streaming data received")
+
+		// Parse the JSON data. An error in the stream ends it with an error
+		// event; anything else that is not a chunk is skipped.
+		openAIResp, upstreamErr, err := parseStreamChunk(event, data)
+		if upstreamErr != nil {
 			s.logger.WithFields(logrus.Fields{
-				"data": data,
-			}).Debug("Streaming data received")
-
-			// Parse the JSON data
-			var openAIResp models.OpenAIStreamResponse
-			if err := json.Unmarshal([]byte(data), &openAIResp); err != nil {
-				s.logger.WithFields(logrus.Fields{
-					"error": err.Error(),
-					"data":  data,
-				}).Warn("Failed to parse streaming response")
-				continue
-			}
+				"error": upstreamErr.Message,
+				"code":  upstreamErr.Code,
+			}).Warn("Upstream sent an error in the stream")
+			return annotateUpstreamError(s.logger, upstreamErr, c.GetString(LocaleContextKey))
+		}
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+				"data":  truncateText(data, 500),
+			}).Warn("Skipped malformed streaming chunk")
+			RecordSkippedChunk(c)
+			continue
+		}
 
-			// Process the chunk
-			if err := s.processStreamChunk(c, &openAIResp, originalModel); err != nil {
-				s.logger.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Error("Failed to process stream chunk")
-				return err
-			}
+		// Process the chunk
+		if err := session.processStreamChunk(c, openAIResp, originalModel); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to process stream chunk")
+			return err
+		}
 
-			// Flush the response
-			if flusher, ok := c.Writer.(http.Flusher); ok {
-				flusher.Flush()
-			}
+		// Flush the response
+		if flusher, ok := c.Writer.(http.Flusher); ok {
+			flusher.Flush()
 		}
 	}
 
@@ -138,14 +195,102 @@ func (s *StreamingService) StreamResponse(c *gin.Context, resp *http.Response, o
 
 	s.logger.Debug("Stream processing completed successfully")
 
+	if len(session.droppedChoices) > 0 {
+		logDroppedChoices(s.logger, len(session.droppedChoices)+1, session.droppedChoices)
+	}
+
 	// Send final events
-	if err := s.sendStreamEnd(c); err != nil {
+	if err := session.sendStreamEnd(c); err != nil {
 		return err
 	}
+	session.recordTiming(c)
 
 	return scanner.Err()
 }
 
+// WriteMessage sends a complete Anthropic response as stream events, for
+// responses that could not be streamed from the upstream as they were produced
+func (s *StreamingService) WriteMessage(c *gin.Context, resp *models.AnthropicResponse) (err error) {
+	defer s.recoverStream(c, &err)
+
+	setStreamHeaders(c)
+
+	if err := s.writeStreamEvent(c, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            resp.ID,
+			"type":          "message",
+			"role":          "assistant",
+			"content":       []interface{}{},
+			"model":         resp.Model,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": map[string]int{
+				"input_tokens":  resp.Usage.InputTokens,
+				"output_tokens": 0,
+			},
+		},
+	}); err != nil {
+		return err
+	}
+	if err := s.writeConversionNotes(c); err != nil {
+		return err
+	}
+
+	index := 0
+	for _, block := range resp.Content {
+		var start, delta map[string]interface{}
+		switch block.Type {
+		case "text":
+			if block.Text == "" {
+				continue
+			}
+			start = map[string]interface{}{"type": "text", "text": ""}
+			delta = map[string]interface{}{"type": "text_delta", "text": block.Text}
+		case "tool_use":
+			input, err := json.Marshal(block.Input)
+			if err != nil {
+				return err
+			}
+			start = map[string]interface{}{"type": "tool_use", "id": block.ID, "name": block.Name, "input": map[string]interface{}{}}
+			delta = map[string]interface{}{"type": "input_json_delta", "partial_json": string(input)}
+		default:
+			continue
+		}
+
+		events := []struct {
+			name string
+			data map[string]interface{}
+		}{
+			{"content_block_start", map[string]interface{}{"type": "content_block_start", "index": index, "content_block": start}},
+			{"content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": index, "delta": delta}},
+			{"content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index}},
+		}
+		for _, event := range events {
+			if err := s.writeStreamEvent(c, event.name, event.data); err != nil {
+				return err
+			}
+		}
+		index++
+	}
+
+	if err := s.writeStreamEvent(c, "message_delta", map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   resp.StopReason,
+			"stop_sequence": nil,
+		},
+		"usage": map[string]int{
+			"output_tokens": resp.Usage.OutputTokens,
+		},
+	}); err != nil {
+		return err
+	}
+	return s.writeStreamEvent(c, "message_stop", map[string]interface{}{
+		"type": "message_stop",
+	})
+}
+
 // writeStreamEvent writes a Server-Sent Event to the response
 func (s *StreamingService) writeStreamEvent(c *gin.Context, eventType string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
@@ -199,14 +344,31 @@ func (s *StreamingService) StreamOpenAIRequest(ctx context.Context, client *http
 // HandleStreamingError handles errors during streaming
 func (s *StreamingService) HandleStreamingError(c *gin.Context, err error) {
 	s.logger.WithError(err).Error("Streaming error")
+	RecordFailure(c, err.Error())
 
-	// Send error event
+	// Send error event, keeping the type and retry metadata of translated
+	// upstream errors
+	errorBody := map[string]interface{}{
+		"type":    models.ErrorTypeAPI,
+		"message": err.Error(),
+	}
+	if apiErr, ok := err.(*models.APIError); ok {
+		errorBody["type"] = apiErr.Type
+		for field, value := range map[string]string{"code": apiErr.Code, "param": apiErr.Param, "provider": apiErr.Provider} {
+			if value != "" {
+				errorBody[field] = value
+			}
+		}
+		if apiErr.Retry != nil {
+			errorBody["retry"] = apiErr.Retry
+			if !c.Writer.Written() {
+				c.Header("Retry-After", strconv.Itoa(apiErr.Retry.RetryAfterSeconds))
+			}
+		}
+	}
 	errorEvent := map[string]interface{}{
-		"type": "error",
-		"error": map[string]interface{}{
-			"type":    "api_error",
-			"message": err.Error(),
-		},
+		"type":  "error",
+		"error": errorBody,
 	}
 
 	if streamErr := s.writeStreamEvent(c, "error", errorEvent); streamErr != nil {
@@ -219,13 +381,39 @@ func (s *StreamingService) HandleStreamingError(c *gin.Context, err error) {
 	}
 }
 
-// resetStreamingState resets the streaming state for a new request
-func (s *StreamingService) resetStreamingState() {
-	s.currentContentBlockIndex = 0
-	s.toolCallStates = make(map[int]*ToolCallState)
-	s.outputTokens = 0
-	s.hasStartedTextBlock = false
-	s.hasStartedToolBlocks = make(map[int]bool)
+// recoverStream ends a stream whose conversion panicked with an error event
+// and message_stop, so the client is not left waiting for events that never
+// come. The panic is kept with its stack in the recent errors, and the
+// stream counts as handled.
+func (s *StreamingService) recoverStream(c *gin.Context, err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	stack := debug.Stack()
+	s.logger.WithFields(logrus.Fields{
+		"panic": recovered,
+		"stack": string(stack),
+	}).Error("Panic recovered while streaming")
+	RecordPanic(c, fmt.Sprintf("panic: %v", recovered), stack)
+	s.reporter.ReportPanic(recovered)
+
+	errorEvent := map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    models.ErrorTypeAPI,
+			"message": RequestMessage(c, "Internal server error"),
+		},
+	}
+	if writeErr := s.writeStreamEvent(c, "error", errorEvent); writeErr == nil {
+		s.writeStreamEvent(c, "message_stop", map[string]interface{}{
+			"type": "message_stop",
+		})
+	}
+	if flusher, ok := c.Writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	*err = nil
 }
 
 // generateMessageID generates a unique message ID
@@ -236,8 +424,8 @@ func (s *StreamingService) generateMessageID() string {
 }
 
 // sendMessageStart sends the initial message_start event
-func (s *StreamingService) sendMessageStart(c *gin.Context, originalModel string) error {
-	return s.writeStreamEvent(c, "message_start", map[string]interface{}{
+func (s *streamSession) sendMessageStart(c *gin.Context, originalModel string) error {
+	if err := s.writeStreamEvent(c, "message_start", map[string]interface{}{
 		"type": "message_start",
 		"message": map[string]interface{}{
 			"id":            s.messageID,
@@ -252,27 +440,71 @@ func (s *StreamingService) sendMessageStart(c *gin.Context, originalModel string
 				"output_tokens": 0,
 			},
 		},
-	})
+	}); err != nil {
+		return err
+	}
+	return s.writeConversionNotes(c)
 }
 
 // processStreamChunk processes a single streaming chunk
-func (s *StreamingService) processStreamChunk(c *gin.Context, openAIResp *models.OpenAIStreamResponse, originalModel string) error {
-	if len(openAIResp.Choices) == 0 {
+func (s *streamSession) processStreamChunk(c *gin.Context, openAIResp *models.OpenAIStreamResponse, originalModel string) error {
+	// Upstreams that report usage send it with the last chunk
+	if openAIResp.Usage != nil {
+		s.outputTokens = openAIResp.Usage.CompletionTokens
+		RecordUsage(c, openAIResp.Usage.PromptTokens, openAIResp.Usage.CompletionTokens)
+		RecordCachedTokens(c, openAIResp.Usage.CachedTokens())
+	}
+
+	choice, ok := s.primaryChoice(openAIResp.Choices)
+	if !ok {
 		return nil
 	}
+	s.markFirstToken(choice)
 
-	choice := openAIResp.Choices[0]
+	if err := s.handleChoice(c, choice); err != nil {
+		return err
+	}
 
-	// Handle text content
-	if choice.Delta != nil && choice.Delta.Content != nil {
-		if textContent, ok := choice.Delta.Content.(string); ok && textContent != "" {
-			return s.handleTextDelta(c, textContent)
+	// Token log probabilities follow the delta they describe as a vendor extension event
+	if choice.Logprobs != nil {
+		index := s.textBlockIndex
+		if index < 0 {
+			index = max(s.nextBlockIndex-1, 0)
 		}
+		return s.writeStreamEvent(c, "x_logprobs", map[string]interface{}{
+			"type":     "x_logprobs",
+			"index":    index,
+			"logprobs": choice.Logprobs,
+		})
 	}
 
-	// Handle tool calls
-	if choice.Delta != nil && len(choice.Delta.ToolCalls) > 0 {
-		return s.handleToolCallDeltas(c, choice.Delta.ToolCalls)
+	return nil
+}
+
+// handleChoice converts the delta and then the finish reason of a streamed
+// choice; some upstreams send the last content with the finish reason
+func (s *streamSession) handleChoice(c *gin.Context, choice models.OpenAIChoice) error {
+	if choice.Delta != nil {
+		// Handle text content
+		if textContent, ok := choice.Delta.Content.(string); ok && textContent != "" {
+			if err := s.handleTextDelta(c, textContent); err != nil {
+				return err
+			}
+		}
+
+		// A refusal is streamed as text so the client sees why the model declined
+		if choice.Delta.Refusal != "" {
+			if err := s.handleTextDelta(c, choice.Delta.Refusal); err != nil {
+				return err
+			}
+		}
+
+		// Handle tool calls
+		if len(choice.Delta.ToolCalls) > 0 {
+			if err := s.handleToolCallDeltas(c, choice.Delta.ToolCalls); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Handle finish reason
@@ -283,13 +515,40 @@ func (s *StreamingService) processStreamChunk(c *gin.Context, openAIResp *models
 	return nil
 }
 
-// handleTextDelta handles text content streaming
-func (s *StreamingService) handleTextDelta(c *gin.Context, textContent string) error {
-	// Start text block if not started
-	if !s.hasStartedTextBlock {
+// primaryChoice returns the choice with index 0 from a chunk. The text of other
+// choices is collected for logging when the stream ends.
+func (s *streamSession) primaryChoice(choices []models.OpenAIChoice) (models.OpenAIChoice, bool) {
+	var primary models.OpenAIChoice
+	found := false
+	for _, choice := range choices {
+		if choice.Index == 0 && !found {
+			primary, found = choice, true
+			continue
+		}
+
+		if s.droppedChoices == nil {
+			s.droppedChoices = make(map[int]interface{})
+		}
+		text, _ := s.droppedChoices[choice.Index].(string)
+		if choice.Delta != nil {
+			if delta, ok := choice.Delta.Content.(string); ok {
+				text += delta
+			}
+		}
+		s.droppedChoices[choice.Index] = text
+	}
+	return primary, found
+}
+
+// handleTextDelta handles text content streaming. Text after a tool call
+// starts a new text block.
+func (s *streamSession) handleTextDelta(c *gin.Context, textContent string) error {
+	// Start text block if none is open
+	if s.textBlockIndex < 0 {
+		s.textBlockIndex = s.openBlock()
 		if err := s.writeStreamEvent(c, "content_block_start", map[string]interface{}{
 			"type":  "content_block_start",
-			"index": s.currentContentBlockIndex,
+			"index": s.textBlockIndex,
 			"content_block": map[string]interface{}{
 				"type": "text",
 				"text": "",
@@ -297,13 +556,13 @@ func (s *StreamingService) handleTextDelta(c *gin.Context, textContent string) e
 		}); err != nil {
 			return err
 		}
-		s.hasStartedTextBlock = true
 	}
 
 	// Send text delta
+	RecordOutput(c, textContent)
 	return s.writeStreamEvent(c, "content_block_delta", map[string]interface{}{
 		"type":  "content_block_delta",
-		"index": s.currentContentBlockIndex,
+		"index": s.textBlockIndex,
 		"delta": map[string]interface{}{
 			"type": "text_delta",
 			"text": textContent,
@@ -312,34 +571,37 @@ func (s *StreamingService) handleTextDelta(c *gin.Context, textContent string) e
 }
 
 // handleToolCallDeltas handles tool call streaming
-func (s *StreamingService) handleToolCallDeltas(c *gin.Context, toolCalls []models.OpenAIToolCall) error {
+func (s *streamSession) handleToolCallDeltas(c *gin.Context, toolCalls []models.OpenAIToolCall) error {
 	for _, toolCall := range toolCalls {
-		openAIIndex := toolCall.Index
-
-		// Get or create tool call state
-		state, exists := s.toolCallStates[openAIIndex]
-		if !exists {
-			s.currentContentBlockIndex++
-			state = &ToolCallState{
-				AnthropicIndex: s.currentContentBlockIndex,
-				OpenAIIndex:    openAIIndex,
-			}
-			s.toolCallStates[openAIIndex] = state
-		}
+		state := s.toolCallState(toolCall)
 
 		// Update state
 		if toolCall.ID != "" {
 			state.ID = toolCall.ID
 		}
 		if toolCall.Function.Name != "" {
-			state.Name = toolCall.Function.Name
+			state.Name = originalToolName(c, toolCall.Function.Name)
 		}
 		if toolCall.Function.Arguments != "" {
+			if err := s.checkArgumentLimits(state, len(toolCall.Function.Arguments)); err != nil {
+				return err
+			}
 			state.ArgumentsBuffer += toolCall.Function.Arguments
+			s.argumentBytes += len(toolCall.Function.Arguments)
 		}
 
-		// Send content_block_start if needed
+		// Arguments are sent once complete when they may need to be repaired
+		pending := toolCall.Function.Arguments
+		if s.config.RepairToolArguments {
+			pending = ""
+		}
+
+		// Send content_block_start if needed, ending the text before the call
 		if !state.HasSentStart && state.ID != "" && state.Name != "" {
+			if err := s.closeTextBlock(c); err != nil {
+				return err
+			}
+			state.AnthropicIndex = s.openBlock()
 			if err := s.writeStreamEvent(c, "content_block_start", map[string]interface{}{
 				"type":  "content_block_start",
 				"index": state.AnthropicIndex,
@@ -353,18 +615,16 @@ func (s *StreamingService) handleToolCallDeltas(c *gin.Context, toolCalls []mode
 				return err
 			}
 			state.HasSentStart = true
+
+			// Arguments that arrived before the ID and name were buffered
+			if !s.config.RepairToolArguments {
+				pending = state.ArgumentsBuffer
+			}
 		}
 
 		// Send arguments delta if we have started and there are new arguments
-		if state.HasSentStart && toolCall.Function.Arguments != "" {
-			if err := s.writeStreamEvent(c, "content_block_delta", map[string]interface{}{
-				"type":  "content_block_delta",
-				"index": state.AnthropicIndex,
-				"delta": map[string]interface{}{
-					"type":         "input_json_delta",
-					"partial_json": toolCall.Function.Arguments,
-				},
-			}); err != nil {
+		if state.HasSentStart {
+			if err := s.sendArgumentsDelta(c, state, pending); err != nil {
 				return err
 			}
 		}
@@ -373,27 +633,147 @@ func (s *StreamingService) handleToolCallDeltas(c *gin.Context, toolCalls []mode
 	return nil
 }
 
-// handleFinishReason handles the finish reason and sends final events
-func (s *StreamingService) handleFinishReason(c *gin.Context, finishReason string) error {
-	// Send content_block_stop for text if it was started
-	if s.hasStartedTextBlock {
-		if err := s.writeStreamEvent(c, "content_block_stop", map[string]interface{}{
-			"type":  "content_block_stop",
-			"index": 0,
-		}); err != nil {
-			return err
+// toolCallState returns the state of the tool call a delta belongs to, creating
+// it for a new call. Deltas that carry an ID are matched by ID because some
+// upstreams reuse one index for parallel calls; deltas without an ID continue
+// the call last seen at their index.
+func (s *streamSession) toolCallState(toolCall models.OpenAIToolCall) *ToolCallState {
+	state, exists := s.toolCallStates[toolCall.Index]
+	if toolCall.ID != "" {
+		for _, known := range s.toolCalls {
+			if known.ID == toolCall.ID {
+				s.toolCallStates[toolCall.Index] = known
+				return known
+			}
 		}
+		// A different ID at a known index starts a new call
+		exists = exists && state.ID == ""
+	}
+	if exists {
+		return state
+	}
+
+	state = &ToolCallState{OpenAIIndex: toolCall.Index}
+	s.toolCalls = append(s.toolCalls, state)
+	s.toolCallStates[toolCall.Index] = state
+	return state
+}
+
+// sendRepairedArguments sends the complete buffered arguments of a tool call,
+// repairing invalid JSON. It returns the original arguments when they were
+// repaired.
+func (s *streamSession) sendRepairedArguments(c *gin.Context, state *ToolCallState) (string, error) {
+	arguments := state.ArgumentsBuffer
+	if arguments == "" || json.Valid([]byte(arguments)) {
+		return "", s.sendArgumentsDelta(c, state, arguments)
 	}
 
-	// Send content_block_stop for each tool call
-	for _, state := range s.toolCallStates {
+	repaired, ok := repairJSON(arguments)
+	if !ok {
+		s.logger.WithField("tool", state.Name).Warn("Invalid tool call arguments could not be repaired")
+		return "", s.sendArgumentsDelta(c, state, arguments)
+	}
+	s.logger.WithField("tool", state.Name).Warn("Repaired invalid tool call arguments")
+	return arguments, s.sendArgumentsDelta(c, state, repaired)
+}
+
+// sendArgumentsDelta sends a chunk of tool call arguments
+func (s *streamSession) sendArgumentsDelta(c *gin.Context, state *ToolCallState, arguments string) error {
+	if arguments == "" {
+		return nil
+	}
+	RecordOutput(c, arguments)
+	return s.writeStreamEvent(c, "content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": state.AnthropicIndex,
+		"delta": map[string]interface{}{
+			"type":         "input_json_delta",
+			"partial_json": arguments,
+		},
+	})
+}
+
+// checkArgumentLimits rejects argument deltas that would exceed the per-call or
+// per-stream buffer limits, protecting the proxy from runaway upstream output
+func (s *streamSession) checkArgumentLimits(state *ToolCallState, size int) error {
+	maxPerCall := intOrDefault(s.config.MaxToolArgumentBytes, defaultMaxToolArgumentBytes)
+	maxPerStream := intOrDefault(s.config.MaxStreamArgumentBytes, defaultMaxStreamArgumentBytes)
+
+	if len(state.ArgumentsBuffer)+size > maxPerCall {
+		s.logger.WithFields(logrus.Fields{
+			"tool":  state.Name,
+			"limit": maxPerCall,
+		}).Error("Tool call arguments exceeded buffer limit")
+		return fmt.Errorf("arguments of tool call %q exceed the %d byte limit", state.Name, maxPerCall)
+	}
+	if s.argumentBytes+size > maxPerStream {
+		s.logger.WithFields(logrus.Fields{
+			"tool_calls": len(s.toolCalls),
+			"limit":      maxPerStream,
+		}).Error("Tool call arguments exceeded stream buffer limit")
+		return fmt.Errorf("tool call arguments in this response exceed the %d byte limit", maxPerStream)
+	}
+	return nil
+}
+
+// openBlock returns the index of a new content block
+func (s *streamSession) openBlock() int {
+	index := s.nextBlockIndex
+	s.nextBlockIndex++
+	return index
+}
+
+// closeTextBlock stops the open text block, if any
+func (s *streamSession) closeTextBlock(c *gin.Context) error {
+	if s.textBlockIndex < 0 {
+		return nil
+	}
+	index := s.textBlockIndex
+	s.textBlockIndex = -1
+	return s.writeStreamEvent(c, "content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": index,
+	})
+}
+
+// handleFinishReason handles the finish reason and sends final events
+func (s *streamSession) handleFinishReason(c *gin.Context, finishReason string) error {
+	// Stop the started tool call blocks in block order, then the text block
+	// opened after the last of them
+	started := make([]*ToolCallState, 0, len(s.toolCalls))
+	for _, state := range s.toolCalls {
 		if state.HasSentStart {
-			if err := s.writeStreamEvent(c, "content_block_stop", map[string]interface{}{
-				"type":  "content_block_stop",
-				"index": state.AnthropicIndex,
-			}); err != nil {
+			started = append(started, state)
+		}
+	}
+	sort.Slice(started, func(i, j int) bool { return started[i].AnthropicIndex < started[j].AnthropicIndex })
+	for _, state := range started {
+		stop := map[string]interface{}{
+			"type":  "content_block_stop",
+			"index": state.AnthropicIndex,
+		}
+		if s.config.RepairToolArguments {
+			rawInput, err := s.sendRepairedArguments(c, state)
+			if err != nil {
 				return err
 			}
+			if rawInput != "" {
+				stop["raw_input"] = rawInput
+			}
+		}
+		if err := s.writeStreamEvent(c, "content_block_stop", stop); err != nil {
+			return err
+		}
+	}
+	if err := s.closeTextBlock(c); err != nil {
+		return err
+	}
+
+	// Explain a response the content filter stopped in a block of its own
+	if finishReason == "content_filter" {
+		RecordContentFilter(c)
+		if err := s.sendContentFilterNotice(c); err != nil {
+			return err
 		}
 	}
 
@@ -413,8 +793,28 @@ func (s *StreamingService) handleFinishReason(c *gin.Context, finishReason strin
 	})
 }
 
+// sendContentFilterNotice sends contentFilterNotice as a text block after
+// the blocks already sent
+func (s *streamSession) sendContentFilterNotice(c *gin.Context) error {
+	index := s.openBlock()
+	events := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"content_block_start", map[string]interface{}{"type": "content_block_start", "index": index, "content_block": map[string]interface{}{"type": "text", "text": ""}}},
+		{"content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": index, "delta": map[string]interface{}{"type": "text_delta", "text": contentFilterNotice}}},
+		{"content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index}},
+	}
+	for _, event := range events {
+		if err := s.writeStreamEvent(c, event.name, event.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // sendStreamEnd sends the final message_stop event
-func (s *StreamingService) sendStreamEnd(c *gin.Context) error {
+func (s *streamSession) sendStreamEnd(c *gin.Context) error {
 	return s.writeStreamEvent(c, "message_stop", map[string]interface{}{
 		"type": "message_stop",
 	})
@@ -422,16 +822,5 @@ func (s *StreamingService) sendStreamEnd(c *gin.Context) error {
 
 // convertFinishReason converts OpenAI finish reason to Anthropic format
 func (s *StreamingService) convertFinishReason(reason string) string {
-	switch reason {
-	case "stop":
-		return "end_turn"
-	case "length":
-		return "max_tokens"
-	case "tool_calls":
-		return "tool_use"
-	case "content_filter":
-		return "stop_sequence"
-	default:
-		return "end_turn"
-	}
+	return mapFinishReason(s.config.FinishReasonMap, reason)
 }
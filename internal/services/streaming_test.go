@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// streamEvent is a content block event of a converted stream
+type streamEvent struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+	} `json:"content_block"`
+	Delta struct {
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+}
+
+// streamChunks converts OpenAI stream chunks and returns the content block
+// events and message_delta events of the Anthropic stream
+func streamChunks(t *testing.T, chunks ...string) []streamEvent {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := &config.Config{}
+	service := NewStreamingService(NewConversionService(NewModelSelectorService(cfg, logger), cfg, logger, nil), cfg, logger)
+
+	var body strings.Builder
+	for _, chunk := range chunks {
+		body.WriteString("data: " + chunk + "\n\n")
+	}
+	body.WriteString("data: [DONE]\n\n")
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body.String()))}
+	if err := service.StreamResponse(c, resp, "claude-sonnet-4"); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []streamEvent
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event streamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid event %s: %v", data, err)
+		}
+		switch event.Type {
+		case "content_block_start", "content_block_stop", "message_delta":
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// checkBlocks checks that every block is started once and stopped once, that
+// blocks are numbered from 0 in the order they start, and that the blocks
+// have the expected types
+func checkBlocks(t *testing.T, events []streamEvent, types ...string) {
+	t.Helper()
+	var started []string
+	stopped := make(map[int]int)
+	for _, event := range events {
+		switch event.Type {
+		case "content_block_start":
+			if event.Index != len(started) {
+				t.Errorf("block %d started at index %d", len(started), event.Index)
+			}
+			started = append(started, event.ContentBlock.Type)
+		case "content_block_stop":
+			if event.Index >= len(started) {
+				t.Errorf("stop of block %d, which was never started", event.Index)
+			}
+			stopped[event.Index]++
+		}
+	}
+	if strings.Join(started, ",") != strings.Join(types, ",") {
+		t.Errorf("got blocks %v, want %v", started, types)
+	}
+	for i := range started {
+		if stopped[i] != 1 {
+			t.Errorf("block %d stopped %d times, want once", i, stopped[i])
+		}
+	}
+}
+
+func TestStreamTextToolText(t *testing.T) {
+	events := streamChunks(t,
+		`{"choices":[{"index":0,"delta":{"content":"Let me look."}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"Read","arguments":"{\"path\":\"a\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"Reading it now."}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	)
+	checkBlocks(t, events, "text", "tool_use", "text")
+
+	// The first text block ends before the tool call starts
+	if events[1].Type != "content_block_stop" || events[1].Index != 0 {
+		t.Errorf("got %s of block %d after the first text block, want its stop", events[1].Type, events[1].Index)
+	}
+}
+
+func TestStreamToolOnly(t *testing.T) {
+	events := streamChunks(t,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"Read","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"Grep","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	)
+	checkBlocks(t, events, "tool_use", "tool_use")
+}
+
+func TestStreamContentWithFinishReason(t *testing.T) {
+	events := streamChunks(t,
+		`{"choices":[{"index":0,"delta":{"content":"Done."},"finish_reason":"stop"}]}`,
+	)
+	checkBlocks(t, events, "text")
+
+	last := events[len(events)-1]
+	if last.Type != "message_delta" || last.Delta.StopReason != "end_turn" {
+		t.Errorf("got last event %s with stop reason %q, want message_delta with end_turn", last.Type, last.Delta.StopReason)
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+// tapBuffer is the number of writes buffered per observer. Observers falling
+// further behind are disconnected, so they never slow down the client.
+const tapBuffer = 256
+
+// RequestTap is a read-only subscription to the response of a request in
+// flight. C delivers the bytes written to the client and is closed when the
+// request ends or the observer falls behind.
+type RequestTap struct {
+	C      <-chan []byte
+	Stream bool // False as well while the request is still being parsed
+
+	request *TrackedRequest
+	tap     chan []byte
+}
+
+// Tap subscribes to the response of the request in flight with the given
+// ID. It reports false when no such request is in flight.
+func (m *MetricsService) Tap(requestID string) (*RequestTap, bool) {
+	m.mu.Lock()
+	var req *TrackedRequest
+	for active := range m.active {
+		if active.id == requestID {
+			req = active
+			break
+		}
+	}
+	m.mu.Unlock()
+	if req == nil {
+		return nil, false
+	}
+
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if req.ended {
+		return nil, false
+	}
+	tap := make(chan []byte, tapBuffer)
+	if req.taps == nil {
+		req.taps = make(map[chan []byte]struct{})
+	}
+	req.taps[tap] = struct{}{}
+	return &RequestTap{C: tap, Stream: req.stream, request: req, tap: tap}, true
+}
+
+// Close unsubscribes the observer
+func (t *RequestTap) Close() {
+	t.request.mu.Lock()
+	defer t.request.mu.Unlock()
+	if _, ok := t.request.taps[t.tap]; ok {
+		delete(t.request.taps, t.tap)
+		close(t.tap)
+	}
+}
+
+// Publish passes response bytes written to the client on to the observers
+// of the request
+func (r *TrackedRequest) Publish(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.taps) == 0 {
+		return
+	}
+
+	chunk := append([]byte(nil), data...)
+	for tap := range r.taps {
+		select {
+		case tap <- chunk:
+		default:
+			delete(r.taps, tap)
+			close(tap)
+		}
+	}
+}
@@ -6,15 +6,18 @@ import (
 	"strings"
 	"unicode/utf8"
 
+	"claude-code-provider-proxy/internal/config"
 	"claude-code-provider-proxy/internal/models"
 )
 
 // TokenCountingService handles token counting for different models
-type TokenCountingService struct{}
+type TokenCountingService struct {
+	config *config.Config
+}
 
 // NewTokenCountingService creates a new token counting service
-func NewTokenCountingService() *TokenCountingService {
-	return &TokenCountingService{}
+func NewTokenCountingService(cfg *config.Config) *TokenCountingService {
+	return &TokenCountingService{config: cfg}
 }
 
 // CountTokens estimates the number of tokens in a request
@@ -39,7 +42,7 @@ func (s *TokenCountingService) CountTokens(req *models.TokenCountRequest) (*mode
 		totalTokens += tokens
 	}
 
-	// Count tool tokens
+	// Count tool tokens, including the system prompt that enables tool use
 	for _, tool := range req.Tools {
 		tokens, err := s.countToolTokens(tool)
 		if err != nil {
@@ -47,6 +50,9 @@ func (s *TokenCountingService) CountTokens(req *models.TokenCountRequest) (*mode
 		}
 		totalTokens += tokens
 	}
+	if len(req.Tools) > 0 {
+		totalTokens += toolUseSystemPromptTokens(req.ToolChoice)
+	}
 
 	// Add overhead for message formatting (approximate)
 	totalTokens += len(req.Messages) * 4 // Rough estimate for message formatting overhead
@@ -64,15 +70,15 @@ func (s *TokenCountingService) countSystemTokens(system interface{}) (int, error
 	case []interface{}:
 		totalTokens := 0
 		for _, item := range sys {
-			if itemMap, ok := item.(map[string]interface{}); ok {
-				if contentType, ok := itemMap["type"].(string); ok && contentType == "text" {
-					if text, ok := itemMap["text"].(string); ok {
-						totalTokens += s.estimateTokens(text)
-					}
-				}
-			} else if textStr, ok := item.(string); ok {
+			if textStr, ok := item.(string); ok {
 				totalTokens += s.estimateTokens(textStr)
+				continue
+			}
+			itemTokens, err := s.countContentItem(item)
+			if err != nil {
+				return 0, err
 			}
+			totalTokens += itemTokens
 		}
 		return totalTokens, nil
 	default:
@@ -116,7 +122,8 @@ func (s *TokenCountingService) countMessageTokens(msg models.AnthropicMessage) (
 	return tokens, nil
 }
 
-// countContentItem counts tokens in a content item
+// countContentItem counts tokens in a content item. Cache control markers
+// only affect billing and are not counted.
 func (s *TokenCountingService) countContentItem(item interface{}) (int, error) {
 	itemMap, ok := item.(map[string]interface{})
 	if !ok {
@@ -140,12 +147,8 @@ func (s *TokenCountingService) countContentItem(item interface{}) (int, error) {
 			tokens += s.estimateTokens(text)
 		}
 	case "image":
-		// Images typically cost more tokens
-		// This is a rough estimate - actual cost depends on image size and model
-		tokens += 85 // Base cost for image processing
-		if detail, ok := itemMap["detail"].(string); ok && detail == "high" {
-			tokens += 170 // Additional cost for high detail
-		}
+		source, _ := itemMap["source"].(map[string]interface{})
+		tokens += imageTokens(source)
 	case "tool_use":
 		if name, ok := itemMap["name"].(string); ok {
 			tokens += s.estimateTokens(name)
@@ -158,30 +161,69 @@ func (s *TokenCountingService) countContentItem(item interface{}) (int, error) {
 			tokens += s.estimateTokens(string(inputBytes))
 		}
 	case "tool_result":
-		if content, ok := itemMap["content"].(string); ok {
+		switch content := itemMap["content"].(type) {
+		case string:
 			tokens += s.estimateTokens(content)
+		case []interface{}:
+			for _, block := range content {
+				blockTokens, err := s.countContentItem(block)
+				if err != nil {
+					return 0, err
+				}
+				tokens += blockTokens
+			}
+		}
+	case "thinking":
+		if thinking, ok := itemMap["thinking"].(string); ok {
+			tokens += s.estimateTokens(thinking)
+		}
+	case "redacted_thinking":
+		// Encrypted reasoning the model reads back, roughly one token per
+		// four characters of its base64 form
+		if data, ok := itemMap["data"].(string); ok {
+			tokens += len(data) / 4
+		}
+	default:
+		// Count unknown blocks as their JSON without the cache marker
+		block := make(map[string]interface{}, len(itemMap))
+		for key, value := range itemMap {
+			if key != "cache_control" {
+				block[key] = value
+			}
+		}
+		blockBytes, err := json.Marshal(block)
+		if err != nil {
+			return 0, err
 		}
+		tokens += s.estimateTokens(string(blockBytes))
 	}
 
 	return tokens, nil
 }
 
-// countToolTokens counts tokens in a tool definition
+// countToolTokens counts tokens in a tool definition as the model sees it:
+// the name, description and input schema serialized together as JSON. The
+// cache control marker is not part of it.
 func (s *TokenCountingService) countToolTokens(tool models.AnthropicTool) (int, error) {
-	tokens := 0
-
-	// Count name and description
-	tokens += s.estimateTokens(tool.Name)
-	tokens += s.estimateTokens(tool.Description)
-
-	// Count input schema
-	schemaBytes, err := json.Marshal(tool.InputSchema)
+	definition := struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description,omitempty"`
+		InputSchema map[string]interface{} `json:"input_schema"`
+	}{tool.Name, tool.Description, tool.InputSchema}
+	definitionBytes, err := json.Marshal(definition)
 	if err != nil {
 		return 0, err
 	}
-	tokens += s.estimateTokens(string(schemaBytes))
+	return s.estimateTokens(string(definitionBytes)), nil
+}
 
-	return tokens, nil
+// toolUseSystemPromptTokens returns the tokens of the system prompt Anthropic
+// adds to requests with tools, which depends on the tool choice
+func toolUseSystemPromptTokens(choice *models.AnthropicToolChoice) int {
+	if choice != nil && (choice.Type == "any" || choice.Type == "tool") {
+		return 313
+	}
+	return 346
 }
 
 // estimateTokens provides a rough estimate of token count for text
@@ -227,25 +269,23 @@ func (s *TokenCountingService) estimateTokens(text string) int {
 	return estimate
 }
 
-// GetModelTokenLimits returns the token limits for different models
+// Limits of models the model registry does not know
+const (
+	defaultInputTokenLimit  = 100000
+	defaultOutputTokenLimit = 4096
+)
+
+// GetModelTokenLimits returns the token limits of a model from the model registry
 func (s *TokenCountingService) GetModelTokenLimits(model string) (inputLimit, outputLimit int) {
-	switch {
-	case strings.Contains(model, "claude-3-opus"):
-		return 200000, 4096
-	case strings.Contains(model, "claude-3-sonnet"):
-		return 200000, 4096
-	case strings.Contains(model, "claude-3-haiku"):
-		return 200000, 4096
-	case strings.Contains(model, "claude-2.1"):
-		return 200000, 4096
-	case strings.Contains(model, "claude-2.0"):
-		return 100000, 4096
-	case strings.Contains(model, "claude-instant"):
-		return 100000, 4096
-	default:
-		// Default limits
-		return 100000, 4096
+	caps := s.config.Capabilities(model)
+	inputLimit, outputLimit = caps.ContextWindow, caps.MaxOutputTokens
+	if inputLimit <= 0 {
+		inputLimit = defaultInputTokenLimit
+	}
+	if outputLimit <= 0 {
+		outputLimit = defaultOutputTokenLimit
 	}
+	return inputLimit, outputLimit
 }
 
 // ValidateTokenLimits checks if the request exceeds model token limits
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// tokenEfficientToolsBeta starts the anthropic-beta flag of token-efficient
+	// tool use, such as token-efficient-tools-2025-02-19
+	tokenEfficientToolsBeta = "token-efficient-tools"
+
+	// toolTokensSavedContextKey stores the input tokens saved by compacting
+	// the tool definitions in the gin context
+	toolTokensSavedContextKey = "tool_tokens_saved"
+)
+
+// schemaAnnotations are JSON Schema keywords that document a schema without
+// constraining the values the model may send
+var schemaAnnotations = map[string]bool{
+	"$schema":  true,
+	"$id":      true,
+	"$comment": true,
+	"title":    true,
+	"examples": true,
+}
+
+// UsesTokenEfficientTools reports whether an anthropic-beta header enables
+// token-efficient tool use
+func UsesTokenEfficientTools(header string) bool {
+	for _, beta := range strings.Split(header, ",") {
+		if strings.HasPrefix(strings.TrimSpace(beta), tokenEfficientToolsBeta) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompactTools compacts the tool definitions of a request as configured in
+// token_efficient_tools and returns the estimated input tokens saved
+func (s *TokenCountingService) CompactTools(req *models.AnthropicRequest) int {
+	cfg := s.config.TokenEfficientTools
+	if cfg.Disabled || len(req.Tools) == 0 {
+		return 0
+	}
+
+	saved := 0
+	compacted := make([]models.AnthropicTool, len(req.Tools))
+	for i, tool := range req.Tools {
+		before, _ := s.countToolTokens(tool)
+		tool.Description = shortenDescription(tool.Description, cfg.MaxDescriptionChars)
+		tool.InputSchema = compactSchema(tool.InputSchema, cfg.MaxPropertyDescriptionChars)
+		after, _ := s.countToolTokens(tool)
+		saved += before - after
+		compacted[i] = tool
+	}
+	req.Tools = compacted
+	return saved
+}
+
+// RecordToolTokensSaved keeps the input tokens saved by compacting the tool
+// definitions of the current request for its usage record
+func RecordToolTokensSaved(c *gin.Context, tokens int) {
+	if tokens > 0 {
+		c.Set(toolTokensSavedContextKey, tokens)
+	}
+}
+
+// compactSchema returns a copy of a schema without annotations and with its
+// descriptions shortened, recursively through its subschemas
+func compactSchema(schema map[string]interface{}, maxDescription int) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	compacted := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		if schemaAnnotations[key] {
+			continue
+		}
+		switch key {
+		case "description":
+			if text, ok := value.(string); ok {
+				value = shortenDescription(text, maxDescription)
+			}
+		case "properties", "patternProperties", "$defs", "definitions":
+			// Keyed by name, so names such as "title" are kept
+			if subschemas, ok := value.(map[string]interface{}); ok {
+				named := make(map[string]interface{}, len(subschemas))
+				for name, subschema := range subschemas {
+					named[name] = compactSubschema(subschema, maxDescription)
+				}
+				value = named
+			}
+		case "items", "additionalProperties", "not", "anyOf", "oneOf", "allOf", "prefixItems":
+			value = compactSubschema(value, maxDescription)
+		}
+		compacted[key] = value
+	}
+	return compacted
+}
+
+// compactSubschema compacts a subschema or a list of subschemas; other
+// values, such as additionalProperties: false, are kept
+func compactSubschema(value interface{}, maxDescription int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return compactSchema(v, maxDescription)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = compactSubschema(item, maxDescription)
+		}
+		return list
+	default:
+		return value
+	}
+}
+
+// shortenDescription cuts a description to limit characters, at the end of a
+// sentence or line when that keeps most of it and with an ellipsis otherwise.
+// A limit of 0 keeps the description whole.
+func shortenDescription(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	cut := string([]rune(text)[:limit])
+	if end := strings.LastIndexAny(cut, ".。\n"); end >= len(cut)/2 {
+		_, size := utf8.DecodeRuneInString(cut[end:])
+		return strings.TrimSpace(cut[:end+size])
+	}
+	return truncateText(text, limit)
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sessionPattern finds the session ID Claude Code puts into metadata.user_id
+var sessionPattern = regexp.MustCompile(`session_([0-9A-Za-z-]+)`)
+
+// unsafeSessionChars are replaced in session IDs used as file names
+var unsafeSessionChars = regexp.MustCompile(`[^0-9A-Za-z_-]`)
+
+// TranscriptEntry is one message request of a session with the response the
+// client received. Claude Code sends the whole conversation with every
+// request, so the latest entries hold the complete history.
+type TranscriptEntry struct {
+	Time       time.Time                 `json:"time"`
+	RequestID  string                    `json:"request_id"`
+	Session    string                    `json:"session"`
+	Model      string                    `json:"model"` // Model requested by the client
+	System     interface{}               `json:"system,omitempty"`
+	Messages   []models.AnthropicMessage `json:"messages"`
+	Response   []interface{}             `json:"response"` // Content blocks of the answer
+	StopReason string                    `json:"stop_reason,omitempty"`
+}
+
+// TranscriptConversation is the complete conversation of a session in the
+// shape of an Anthropic messages request
+type TranscriptConversation struct {
+	Model    string                    `json:"model"`
+	System   interface{}               `json:"system,omitempty"`
+	Messages []models.AnthropicMessage `json:"messages"`
+}
+
+// TranscriptSession summarizes the stored transcript of a session
+type TranscriptSession struct {
+	ID       string
+	Started  time.Time
+	Updated  time.Time
+	Requests int
+	Title    string // Start of the first user message
+}
+
+// TranscriptStore keeps the conversations passing through the proxy per
+// Claude Code session in the storage backend
+type TranscriptStore struct {
+	storage Storage
+	logger  *logrus.Logger
+}
+
+// NewTranscriptStore creates the transcript store, or returns nil when
+// transcripts are disabled
+func NewTranscriptStore(cfg *config.Config, logger *logrus.Logger, storage Storage) *TranscriptStore {
+	if !cfg.Transcripts {
+		return nil
+	}
+	return &TranscriptStore{storage: storage, logger: logger}
+}
+
+// SessionID returns the Claude Code session of a request from the session
+// header or the metadata, falling back to the request ID
+func SessionID(header string, metadata map[string]interface{}, requestID string) string {
+	session := header
+	if session == "" {
+		userID, _ := metadata["user_id"].(string)
+		if match := sessionPattern.FindStringSubmatch(userID); match != nil {
+			session = match[1]
+		}
+	}
+	if session == "" {
+		session = requestID
+	}
+	return unsafeSessionChars.ReplaceAllString(session, "_")
+}
+
+// Append stores a request and its response
+func (s *TranscriptStore) Append(entry *TranscriptEntry) {
+	if s == nil {
+		return
+	}
+	if err := s.storage.AppendTranscript(entry); err != nil {
+		s.logger.WithError(err).Warn("Failed to write transcript")
+	}
+}
+
+// ParseResponseContent extracts the content blocks and stop reason from a
+// message response as sent to the client, a JSON body or an SSE stream
+func ParseResponseContent(contentType string, body []byte) ([]interface{}, string) {
+	if !strings.HasPrefix(contentType, "text/event-stream") {
+		var resp struct {
+			Content    []interface{} `json:"content"`
+			StopReason string        `json:"stop_reason"`
+		}
+		if json.Unmarshal(body, &resp) != nil {
+			return nil, ""
+		}
+		return resp.Content, resp.StopReason
+	}
+
+	var blocks []map[string]interface{}
+	var partialJSON []strings.Builder
+	var stopReason string
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		data, ok := bytes.CutPrefix(line, []byte("data: "))
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type         string                 `json:"type"`
+			Index        int                    `json:"index"`
+			ContentBlock map[string]interface{} `json:"content_block"`
+			Delta        map[string]interface{} `json:"delta"`
+		}
+		if json.Unmarshal(data, &event) != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "content_block_start":
+			for len(blocks) <= event.Index {
+				blocks = append(blocks, nil)
+				partialJSON = append(partialJSON, strings.Builder{})
+			}
+			blocks[event.Index] = event.ContentBlock
+		case "content_block_delta":
+			if event.Index >= len(blocks) || blocks[event.Index] == nil {
+				continue
+			}
+			block := blocks[event.Index]
+			switch event.Delta["type"] {
+			case "text_delta":
+				text, _ := block["text"].(string)
+				delta, _ := event.Delta["text"].(string)
+				block["text"] = text + delta
+			case "thinking_delta":
+				thinking, _ := block["thinking"].(string)
+				delta, _ := event.Delta["thinking"].(string)
+				block["thinking"] = thinking + delta
+			case "input_json_delta":
+				delta, _ := event.Delta["partial_json"].(string)
+				partialJSON[event.Index].WriteString(delta)
+			}
+		case "message_delta":
+			if reason, ok := event.Delta["stop_reason"].(string); ok {
+				stopReason = reason
+			}
+		}
+	}
+
+	content := make([]interface{}, 0, len(blocks))
+	for i, block := range blocks {
+		if block == nil {
+			continue
+		}
+		if arguments := partialJSON[i].String(); arguments != "" {
+			var input interface{}
+			if json.Unmarshal([]byte(arguments), &input) == nil {
+				block["input"] = input
+			}
+		}
+		content = append(content, block)
+	}
+	return content, stopReason
+}
+
+// Conversation returns the complete conversation of a session: the longest
+// history sent, the latest one on ties, followed by the answer to it. Side
+// requests of Claude Code, such as title generation, carry shorter histories.
+func Conversation(entries []TranscriptEntry) *TranscriptConversation {
+	var longest *TranscriptEntry
+	for i := range entries {
+		if longest == nil || len(entries[i].Messages) >= len(longest.Messages) {
+			longest = &entries[i]
+		}
+	}
+	if longest == nil {
+		return &TranscriptConversation{}
+	}
+
+	messages := append([]models.AnthropicMessage(nil), longest.Messages...)
+	if len(longest.Response) > 0 {
+		messages = append(messages, models.AnthropicMessage{Role: "assistant", Content: longest.Response})
+	}
+	return &TranscriptConversation{Model: longest.Model, System: longest.System, Messages: messages}
+}
+
+// conversationTitle returns the start of the first user text
+func conversationTitle(messages []models.AnthropicMessage) string {
+	for _, message := range messages {
+		if message.Role != "user" {
+			continue
+		}
+		for _, text := range MessageTexts(message.Content) {
+			if title := strings.Join(strings.Fields(text), " "); title != "" {
+				return title
+			}
+		}
+	}
+	return ""
+}
+
+// MessageTexts returns the text blocks of message content, leaving out the
+// <system-reminder> blocks Claude Code adds to user messages
+func MessageTexts(content interface{}) []string {
+	var texts []string
+	add := func(text string) {
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "<system-reminder>") && strings.HasSuffix(trimmed, "</system-reminder>") {
+			return
+		}
+		texts = append(texts, text)
+	}
+
+	switch v := content.(type) {
+	case string:
+		add(v)
+	case []interface{}:
+		for _, item := range v {
+			if block, ok := item.(map[string]interface{}); ok && block["type"] == "text" {
+				text, _ := block["text"].(string)
+				add(text)
+			}
+		}
+	}
+	return texts
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minCompressBytes is the smallest request body worth compressing
+const minCompressBytes = 4 * 1024
+
+// transferTransport counts the body bytes exchanged with upstreams and, when
+// compress_requests is enabled, gzips large request bodies such as long
+// conversation histories. An upstream answering a compressed request with
+// 415 Unsupported Media Type gets the request again uncompressed and no
+// compressed requests afterwards.
+type transferTransport struct {
+	next     http.RoundTripper
+	metrics  *MetricsService // nil when not counted
+	compress bool
+	logger   *logrus.Logger
+
+	unsupported sync.Map // Hosts rejecting compressed bodies
+}
+
+// newTransferTransport wraps an upstream transport
+func newTransferTransport(next http.RoundTripper, metrics *MetricsService, compress bool, logger *logrus.Logger) *transferTransport {
+	return &transferTransport{next: next, metrics: metrics, compress: compress, logger: logger}
+}
+
+// RoundTrip sends the request, compressed when worthwhile
+func (t *transferTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return t.send(req, 0, 0)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if compressed := t.compressBody(req, body); compressed != nil {
+		resp, err := t.send(withBody(req, compressed, "gzip"), len(compressed), len(body))
+		if err != nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+			return resp, err
+		}
+		resp.Body.Close()
+		t.unsupported.Store(req.URL.Host, true)
+		t.logger.WithField("host", req.URL.Host).Warn("Upstream does not accept compressed requests, sending them uncompressed")
+	}
+	return t.send(withBody(req, body, ""), len(body), len(body))
+}
+
+// compressBody returns the gzipped body, or nil when it should be sent as is
+func (t *transferTransport) compressBody(req *http.Request, body []byte) []byte {
+	if !t.compress || len(body) < minCompressBytes || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	if _, rejected := t.unsupported.Load(req.URL.Host); rejected {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil || writer.Close() != nil || buf.Len() >= len(body) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// send forwards the request and counts its transfer
+func (t *transferTransport) send(req *http.Request, sent, uncompressed int) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if t.metrics == nil {
+		return resp, err
+	}
+	t.metrics.recordUpstreamRequest(sent, uncompressed)
+	if err == nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, metrics: t.metrics}
+	}
+	return resp, err
+}
+
+// withBody returns a copy of the request with another body
+func withBody(req *http.Request, body []byte, encoding string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	clone.ContentLength = int64(len(body))
+	if encoding != "" {
+		clone.Header.Set("Content-Encoding", encoding)
+	}
+	return clone
+}
+
+// countingBody counts the response bytes read from an upstream
+type countingBody struct {
+	io.ReadCloser
+	metrics *MetricsService
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.metrics.upstreamResponseBytes.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Default upstream transport settings
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultDialTimeout         = 30 * time.Second
+)
+
+// Upstream HTTP protocol versions
+const (
+	HTTPVersionAuto = "auto" // Negotiate HTTP/2 via ALPN, fall back to HTTP/1.1
+	HTTPVersion1    = "1.1"  // Always use HTTP/1.1
+	HTTPVersion2    = "2"    // Expect HTTP/2 and warn when the upstream does not offer it
+)
+
+// newUpstreamTransport builds the HTTP transport for upstream requests from config
+func newUpstreamTransport(cfg config.TransportConfig, logger *logrus.Logger) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: secondsOrDefault(cfg.KeepAliveSeconds, defaultKeepAlive),
+	}
+
+	transport := &http.Transport{
+		DialContext:           newUpstreamDialer(cfg, dialer).DialContext,
+		MaxIdleConns:          intOrDefault(cfg.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   intOrDefault(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		IdleConnTimeout:       secondsOrDefault(cfg.IdleConnTimeoutSeconds, defaultIdleConnTimeout),
+		TLSHandshakeTimeout:   secondsOrDefault(cfg.TLSHandshakeTimeoutSeconds, defaultTLSHandshakeTimeout),
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     cfg.DisableKeepAlives, // 默认允许keep-alive提高效率
+	}
+
+	tlsConfig, err := upstreamTLSConfig(cfg)
+	if err != nil {
+		// Connections fail certificate verification instead of silently
+		// trusting less than configured
+		logger.WithError(err).Error("Failed to load ca_cert_file, using the system root CAs")
+	}
+	if tlsConfig.InsecureSkipVerify {
+		logger.Warn("TLS certificate verification of upstreams is DISABLED (insecure_skip_verify): " +
+			"anyone on the network path can read the API key and conversations. Use ca_cert_file instead.")
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.HTTPVersion == HTTPVersion1 {
+		// A non-nil empty map disables the built-in HTTP/2 support
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else {
+		// A custom dialer disables HTTP/2 unless it is requested explicitly.
+		// HTTP/2 multiplexes concurrent streams over one connection, saving a
+		// TLS handshake per burst of short requests; stream flow control keeps
+		// a slow SSE reader from stalling the other streams.
+		transport.ForceAttemptHTTP2 = true
+	}
+
+	return transport
+}
+
+// upstreamTLSConfig builds the TLS settings of upstream connections. The
+// system root CAs are kept when extra ones are loaded, so public upstreams
+// still verify behind an intercepting proxy that only handles some hosts.
+func upstreamTLSConfig(cfg config.TransportConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CACertFile == "" {
+		return tlsConfig, nil
+	}
+
+	pool, err := LoadCertPool(cfg.CACertFile)
+	if err != nil {
+		return tlsConfig, err
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// LoadCertPool returns the system root CAs together with the certificates
+// of a PEM file
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// intOrDefault returns value when positive, otherwise the default
+func intOrDefault(value, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// secondsOrDefault converts positive seconds to a duration, otherwise returns the default
+func secondsOrDefault(seconds int, defaultValue time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultValue
+}
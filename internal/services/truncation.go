@@ -0,0 +1,194 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Truncation strategies for requests that exceed the model input limit
+const (
+	TruncationStrategyNone       = ""            // Forward the request unchanged
+	TruncationStrategyReject     = "reject"      // Reject with a validation error
+	TruncationStrategyDropOldest = "drop_oldest" // Drop the oldest conversation turns
+)
+
+// TruncationService keeps requests within the input limit of the target model
+type TruncationService struct {
+	config       *config.Config
+	logger       *logrus.Logger
+	tokenService *TokenCountingService
+
+	// Unknown strategy names already warned about
+	unknownStrategies sync.Map
+}
+
+// NewTruncationService creates a new truncation service
+func NewTruncationService(cfg *config.Config, logger *logrus.Logger, tokenService *TokenCountingService) *TruncationService {
+	return &TruncationService{
+		config:       cfg,
+		logger:       logger,
+		tokenService: tokenService,
+	}
+}
+
+// Apply enforces the truncation strategy configured for the target model.
+// It returns a warning describing what was dropped, or an error when the
+// request must be rejected.
+func (s *TruncationService) Apply(req *models.AnthropicRequest, targetModel string) (string, error) {
+	strategy, limit := s.settings(req.Model, targetModel)
+	if strategy == TruncationStrategyNone {
+		return "", nil
+	}
+
+	tokens, err := s.countTokens(req, req.Messages)
+	if err != nil {
+		return "", err
+	}
+	if tokens <= limit {
+		return "", nil
+	}
+
+	if strategy == TruncationStrategyReject {
+		return "", models.NewInvalidRequestError(fmt.Sprintf("input tokens (%d) exceed model limit (%d)", tokens, limit))
+	}
+
+	groups := groupMessageTurns(req.Messages)
+	dropped := 0
+	for len(groups) > 1 && tokens > limit {
+		dropped += len(groups[0])
+		groups = groups[1:]
+
+		// The conversation must still open with a user turn
+		for len(groups) > 1 && groups[0][0].Role != "user" {
+			dropped += len(groups[0])
+			groups = groups[1:]
+		}
+
+		tokens, err = s.countTokens(req, flattenMessageTurns(groups))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if dropped == 0 {
+		return "", nil
+	}
+
+	original := len(req.Messages)
+	req.Messages = flattenMessageTurns(groups)
+
+	s.logger.WithFields(logrus.Fields{
+		"model":             req.Model,
+		"target_model":      targetModel,
+		"original_messages": original,
+		"dropped_messages":  dropped,
+		"estimated_tokens":  tokens,
+		"limit":             limit,
+	}).Warn("Request truncated to fit model context window")
+
+	warning := fmt.Sprintf("dropped %d oldest message(s) to fit the %d token input limit", dropped, limit)
+	if tokens > limit {
+		warning += fmt.Sprintf("; request still estimated at %d tokens", tokens)
+	}
+	return warning, nil
+}
+
+// settings resolves the strategy and input limit for the target model
+func (s *TruncationService) settings(clientModel, targetModel string) (string, int) {
+	strategy := s.config.TruncationStrategy
+	limit := s.config.MaxInputTokens
+
+	modelSettings := s.config.ModelSetting(targetModel)
+	if modelSettings.TruncationStrategy != "" {
+		strategy = modelSettings.TruncationStrategy
+	}
+	if modelSettings.MaxInputTokens > 0 {
+		limit = modelSettings.MaxInputTokens
+	}
+
+	switch strategy {
+	case TruncationStrategyNone, TruncationStrategyReject, TruncationStrategyDropOldest:
+	case "none":
+		strategy = TruncationStrategyNone
+	default:
+		// Unknown strategies never drop messages the client did not agree to
+		if _, warned := s.unknownStrategies.LoadOrStore(strategy, true); !warned {
+			s.logger.WithFields(logrus.Fields{
+				"strategy": strategy,
+				"model":    targetModel,
+			}).Warn("Unknown truncation strategy, forwarding requests unchanged")
+		}
+		strategy = TruncationStrategyNone
+	}
+	if limit <= 0 {
+		limit = s.config.Capabilities(targetModel).ContextWindow
+	}
+	if limit <= 0 {
+		limit, _ = s.tokenService.GetModelTokenLimits(clientModel)
+	}
+
+	return strategy, limit
+}
+
+// countTokens estimates the input tokens of the request with the given messages
+func (s *TruncationService) countTokens(req *models.AnthropicRequest, messages []models.AnthropicMessage) (int, error) {
+	resp, err := s.tokenService.CountTokens(&models.TokenCountRequest{
+		Model:      req.Model,
+		Messages:   messages,
+		System:     req.System,
+		Tools:      req.Tools,
+		ToolChoice: req.ToolChoice,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.InputTokens, nil
+}
+
+// groupMessageTurns splits messages into groups that must be kept or dropped together.
+// An assistant message that issues tool_use blocks is grouped with the following
+// user message carrying the matching tool_result blocks.
+func groupMessageTurns(messages []models.AnthropicMessage) [][]models.AnthropicMessage {
+	var groups [][]models.AnthropicMessage
+
+	for i := 0; i < len(messages); i++ {
+		group := []models.AnthropicMessage{messages[i]}
+		if messages[i].Role == "assistant" && hasContentBlock(messages[i].Content, "tool_use") {
+			if i+1 < len(messages) && hasContentBlock(messages[i+1].Content, "tool_result") {
+				group = append(group, messages[i+1])
+				i++
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// flattenMessageTurns joins message groups back into a message list
+func flattenMessageTurns(groups [][]models.AnthropicMessage) []models.AnthropicMessage {
+	var messages []models.AnthropicMessage
+	for _, group := range groups {
+		messages = append(messages, group...)
+	}
+	return messages
+}
+
+// hasContentBlock reports whether message content contains a block of the given type
+func hasContentBlock(content interface{}, blockType string) bool {
+	items, ok := content.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range items {
+		if itemMap, ok := item.(map[string]interface{}); ok && itemMap["type"] == blockType {
+			return true
+		}
+	}
+	return false
+}
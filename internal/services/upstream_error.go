@@ -0,0 +1,141 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"claude-code-provider-proxy/internal/models"
+)
+
+// anthropicErrorTypes are the error types clients act on, kept when an
+// upstream reports an error of one of these types
+var anthropicErrorTypes = map[string]bool{
+	"invalid_request_error": true,
+	"authentication_error":  true,
+	"permission_error":      true,
+	"billing_error":         true,
+	"not_found_error":       true,
+	"rate_limit_error":      true,
+	"api_error":             true,
+	"overloaded_error":      true,
+}
+
+// upstreamErrorDetail is the error object of an OpenAI or Anthropic format
+// error. Routers such as OpenRouter name the provider that failed in
+// metadata, and some providers send a numeric code.
+type upstreamErrorDetail struct {
+	Message  string          `json:"message"`
+	Type     string          `json:"type"`
+	Code     json.RawMessage `json:"code"`
+	Param    json.RawMessage `json:"param"`
+	Metadata struct {
+		ProviderName string `json:"provider_name"`
+	} `json:"metadata"`
+}
+
+// decodeUpstreamError converts the "error" field of an upstream error, an
+// object or a plain message. It reports false when the field has no message.
+func decodeUpstreamError(raw json.RawMessage) (*models.APIError, bool) {
+	if !hasJSONValue(raw) {
+		return nil, false
+	}
+
+	var detail upstreamErrorDetail
+	var message string
+	if json.Unmarshal(raw, &message) == nil {
+		detail.Message = message
+	} else if err := json.Unmarshal(raw, &detail); err != nil {
+		return nil, false
+	}
+	if detail.Message == "" {
+		return nil, false
+	}
+
+	apiErr := &models.APIError{
+		Type:     models.ErrorTypeAPI,
+		Message:  detail.Message,
+		Code:     rawString(detail.Code),
+		Param:    rawString(detail.Param),
+		Provider: detail.Metadata.ProviderName,
+	}
+	if anthropicErrorTypes[detail.Type] {
+		apiErr.Type = models.ErrorType(detail.Type)
+	} else if apiErr.Code == "" && detail.Type != "error" {
+		// OpenAI names some failures only in the type, such as insufficient_quota
+		apiErr.Code = detail.Type
+	}
+	return apiErr, true
+}
+
+// errorTypeForStatus is the Anthropic error type of an upstream HTTP status
+func errorTypeForStatus(status int) models.ErrorType {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return models.ErrorTypeInvalidRequest
+	case http.StatusUnauthorized:
+		return models.ErrorTypeAuthentication
+	case http.StatusPaymentRequired:
+		return models.ErrorTypeBilling
+	case http.StatusForbidden:
+		return models.ErrorTypePermission
+	case http.StatusNotFound:
+		return models.ErrorTypeNotFound
+	case http.StatusTooManyRequests:
+		return models.ErrorTypeRateLimit
+	default:
+		return models.ErrorTypeAPI
+	}
+}
+
+// parseUpstreamErrorResponse converts an upstream error response. The
+// upstream message, code and param are kept; the error type follows the
+// upstream type when it is an Anthropic one and the HTTP status otherwise.
+// Bodies without a message get one of the proxy in the locale.
+func parseUpstreamErrorResponse(status int, body []byte, locale string) *models.APIError {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil {
+		if apiErr, ok := decodeUpstreamError(envelope.Error); ok {
+			if apiErr.Type == models.ErrorTypeAPI {
+				apiErr.Type = errorTypeForStatus(status)
+			}
+			return apiErr
+		}
+	}
+
+	// Bodies without an error message
+	switch status {
+	case http.StatusUnauthorized:
+		return models.NewAuthenticationError(Message(locale, "Invalid API key"))
+	case http.StatusPaymentRequired:
+		return models.NewBillingError(Message(locale, "Insufficient account balance"))
+	case http.StatusForbidden:
+		return models.NewPermissionError(Message(locale, "Insufficient permissions"))
+	case http.StatusTooManyRequests:
+		return models.NewRateLimitError(Message(locale, "Rate limit exceeded"))
+	case http.StatusBadRequest:
+		return models.NewInvalidRequestError(fmt.Sprintf("Bad request: %s", truncateText(string(body), 1000)))
+	default:
+		return models.NewAPIError(fmt.Sprintf("OpenAI API error: %d - %s", status, truncateText(string(body), 1000)))
+	}
+}
+
+// rawString returns a raw JSON string or number as text, empty for null
+func rawString(raw json.RawMessage) string {
+	if !hasJSONValue(raw) {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// hasJSONValue reports whether a raw JSON field is present and not null
+func hasJSONValue(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// usageContextKey stores the usage transcript in the gin context
+const usageContextKey = "usage_transcript"
+
+// UsageRecord compares the usage the upstream reported for one request with
+// the proxy's own token estimate. The transcript hash identifies the output
+// that was delivered to the client.
+type UsageRecord struct {
+	Time                 time.Time `json:"time"`
+	RequestID            string    `json:"request_id"`
+	Key                  string    `json:"key,omitempty"` // Name of the local API key
+	Model                string    `json:"model"`
+	Stream               bool      `json:"stream"`
+	UsageReported        bool      `json:"usage_reported"`
+	UpstreamInputTokens  int       `json:"upstream_input_tokens"`
+	UpstreamOutputTokens int       `json:"upstream_output_tokens"`
+	LocalInputTokens     int       `json:"local_input_tokens"`
+	LocalOutputTokens    int       `json:"local_output_tokens"`
+	TranscriptSHA256     string    `json:"transcript_sha256"`
+	Cost                 *float64  `json:"cost,omitempty"` // Estimated from the price table
+	Status               int       `json:"status,omitempty"`
+	Error                string    `json:"error,omitempty"`
+	LatencyMs            int64     `json:"latency_ms,omitempty"`        // Until the response was complete
+	FirstTokenMs         int64     `json:"first_token_ms,omitempty"`    // Of streamed responses
+	ToolTokensSaved      int       `json:"tool_tokens_saved,omitempty"` // Estimated, by compacting tool definitions
+
+	// Summary call made with the small model to compact the conversation
+	CompactionInputTokens  int      `json:"compaction_input_tokens,omitempty"`
+	CompactionOutputTokens int      `json:"compaction_output_tokens,omitempty"`
+	CompactionCost         *float64 `json:"compaction_cost,omitempty"`
+}
+
+// usageTranscript collects the usage and output of a request as it is sent
+type usageTranscript struct {
+	mu     sync.Mutex
+	record UsageRecord
+	output strings.Builder
+}
+
+// UsageLedger stores a usage record for every message request in the
+// storage backend, for reconciling upstream billing
+type UsageLedger struct {
+	storage      Storage
+	logger       *logrus.Logger
+	tokenService *TokenCountingService
+}
+
+// NewUsageLedger creates a usage ledger, or returns nil when it is disabled
+func NewUsageLedger(cfg *config.Config, logger *logrus.Logger, tokenService *TokenCountingService, storage Storage) *UsageLedger {
+	if !cfg.UsageLedger {
+		return nil
+	}
+	return &UsageLedger{
+		storage:      storage,
+		logger:       logger,
+		tokenService: tokenService,
+	}
+}
+
+// Begin starts the usage transcript of a request, estimating its input tokens
+func (l *UsageLedger) Begin(c *gin.Context, req *models.AnthropicRequest, model string) {
+	if l == nil {
+		return
+	}
+	transcript := &usageTranscript{record: UsageRecord{
+		Time:      time.Now().UTC(),
+		RequestID: c.GetString("request_id"),
+		Key:       c.GetString(LocalKeyContextKey),
+		Model:     model,
+		Stream:    req.Stream,
+
+		ToolTokensSaved: c.GetInt(toolTokensSavedContextKey),
+	}}
+	if value, ok := c.Get(compactionUsageContextKey); ok {
+		summary := value.(compactionUsage)
+		transcript.record.CompactionInputTokens = summary.inputTokens
+		transcript.record.CompactionOutputTokens = summary.outputTokens
+		if summary.priced {
+			transcript.record.CompactionCost = &summary.cost
+		}
+	}
+	counted, err := l.tokenService.CountTokens(&models.TokenCountRequest{
+		Model:      req.Model,
+		Messages:   req.Messages,
+		System:     req.System,
+		Tools:      req.Tools,
+		ToolChoice: req.ToolChoice,
+	})
+	if err == nil {
+		transcript.record.LocalInputTokens = counted.InputTokens
+	}
+	c.Set(usageContextKey, transcript)
+}
+
+// Finish writes the usage record of the request
+func (l *UsageLedger) Finish(c *gin.Context) {
+	transcript := usageTranscriptFor(c)
+	if l == nil || transcript == nil {
+		return
+	}
+
+	transcript.mu.Lock()
+	record := transcript.record
+	output := transcript.output.String()
+	transcript.mu.Unlock()
+	record.Status = c.Writer.Status()
+	record.LatencyMs = time.Since(record.Time).Milliseconds()
+	if value, ok := c.Get(FirstTokenContextKey); ok {
+		record.FirstTokenMs, _ = value.(int64)
+	}
+	if record.Status >= 400 && record.Error == "" {
+		record.Error = http.StatusText(record.Status)
+	}
+	sum := sha256.Sum256([]byte(output))
+	record.TranscriptSHA256 = hex.EncodeToString(sum[:])
+	record.LocalOutputTokens = l.tokenService.estimateTokens(output)
+
+	if err := l.storage.AppendUsage(&record); err != nil {
+		l.logger.WithError(err).Warn("Failed to write usage record")
+	}
+}
+
+// usageTranscriptFor returns the usage transcript of the gin context, if any
+func usageTranscriptFor(c *gin.Context) *usageTranscript {
+	if value, ok := c.Get(usageContextKey); ok {
+		if transcript, ok := value.(*usageTranscript); ok {
+			return transcript
+		}
+	}
+	return nil
+}
+
+// RecordOutput adds text or tool arguments sent to the client to the usage transcript
+func RecordOutput(c *gin.Context, text string) {
+	if transcript := usageTranscriptFor(c); transcript != nil {
+		transcript.mu.Lock()
+		transcript.output.WriteString(text)
+		transcript.mu.Unlock()
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-code-provider-proxy/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxReportModels    = 5 // Models listed in a usage report
+	usageReportTimeout = 30 * time.Second
+)
+
+// ModelUsage is the usage of one upstream model in a usage report
+type ModelUsage struct {
+	Model        string  `json:"model"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// UsageReport summarizes the usage ledger over a period
+type UsageReport struct {
+	From         time.Time    `json:"from"`
+	To           time.Time    `json:"to"`
+	Requests     int          `json:"requests"`
+	Errors       int          `json:"errors"`
+	InputTokens  int          `json:"input_tokens"`
+	OutputTokens int          `json:"output_tokens"`
+	Cost         float64      `json:"cost"`
+	TopModels    []ModelUsage `json:"top_models"` // By cost, then by tokens
+}
+
+// BuildUsageReport summarizes the records in [from, to)
+func BuildUsageReport(records []UsageRecord, from, to time.Time) UsageReport {
+	report := UsageReport{From: from, To: to}
+	byModel := make(map[string]*ModelUsage)
+	for _, record := range records {
+		if record.Time.Before(from) || !record.Time.Before(to) {
+			continue
+		}
+		usage, ok := byModel[record.Model]
+		if !ok {
+			usage = &ModelUsage{Model: record.Model}
+			byModel[record.Model] = usage
+		}
+
+		usage.Requests++
+		usage.InputTokens += record.UpstreamInputTokens
+		usage.OutputTokens += record.UpstreamOutputTokens
+		if record.Error != "" {
+			usage.Errors++
+		}
+		if record.Cost != nil {
+			usage.Cost += *record.Cost
+		}
+	}
+
+	for _, usage := range byModel {
+		report.Requests += usage.Requests
+		report.Errors += usage.Errors
+		report.InputTokens += usage.InputTokens
+		report.OutputTokens += usage.OutputTokens
+		report.Cost += usage.Cost
+		report.TopModels = append(report.TopModels, *usage)
+	}
+	sort.Slice(report.TopModels, func(i, j int) bool {
+		a, b := report.TopModels[i], report.TopModels[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.InputTokens+a.OutputTokens > b.InputTokens+b.OutputTokens
+	})
+	if len(report.TopModels) > maxReportModels {
+		report.TopModels = report.TopModels[:maxReportModels]
+	}
+	return report
+}
+
+// Text renders the report for chat webhooks and email
+func (r UsageReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Claude Code Proxy 用量报告 (%s - %s)\n",
+		r.From.Local().Format("2006-01-02 15:04"), r.To.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "请求: %d  错误: %d\n", r.Requests, r.Errors)
+	fmt.Fprintf(&b, "Token: 输入 %d  输出 %d\n", r.InputTokens, r.OutputTokens)
+	fmt.Fprintf(&b, "估算费用: %.6f\n", r.Cost)
+	if len(r.TopModels) > 0 {
+		b.WriteString("\n主要模型:\n")
+		for _, usage := range r.TopModels {
+			fmt.Fprintf(&b, "- %s: %d 次请求 (%d 错误), 输入 %d / 输出 %d token, 费用 %.6f\n",
+				usage.Model, usage.Requests, usage.Errors, usage.InputTokens, usage.OutputTokens, usage.Cost)
+		}
+	}
+	return b.String()
+}
+
+// UsageReporter sends a summary of the usage ledger on a daily or weekly
+// schedule. Reports due while the service is not running are skipped.
+type UsageReporter struct {
+	config     *config.Config
+	logger     *logrus.Logger
+	storage    Storage
+	httpClient *http.Client
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewUsageReporter creates a usage reporter
+func NewUsageReporter(cfg *config.Config, logger *logrus.Logger, storage Storage) *UsageReporter {
+	return &UsageReporter{
+		config:     cfg,
+		logger:     logger,
+		storage:    storage,
+		httpClient: &http.Client{Timeout: usageReportTimeout},
+	}
+}
+
+// Start runs the report schedule in the background until Stop is called.
+// Nothing is scheduled without a webhook or SMTP target.
+func (r *UsageReporter) Start() {
+	settings := r.config.UsageReport
+	if settings.WebhookURL == "" && settings.SMTP.Host == "" {
+		return
+	}
+	if !r.config.UsageLedger {
+		r.logger.Warn("Usage reports need usage_ledger to be enabled, reports will be empty")
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		for {
+			next := nextReportTime(time.Now(), settings.Schedule, settings.Hour)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-r.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			from := next.AddDate(0, 0, -1)
+			if settings.Schedule == "weekly" {
+				from = next.AddDate(0, 0, -7)
+			}
+			if err := r.SendReport(from, next); err != nil {
+				r.logger.WithError(err).Warn("Failed to send usage report")
+			}
+		}
+	}()
+}
+
+// Stop ends the report schedule
+func (r *UsageReporter) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.stop = nil
+}
+
+// SendReport builds the report for [from, to) and sends it to every target
+func (r *UsageReporter) SendReport(from, to time.Time) error {
+	records, err := r.storage.LoadUsage(from)
+	if err != nil {
+		return err
+	}
+	report := BuildUsageReport(records, from, to)
+
+	ctx, cancel := context.WithTimeout(context.Background(), usageReportTimeout)
+	defer cancel()
+
+	var errs []error
+	if r.config.UsageReport.WebhookURL != "" {
+		if err := r.postWebhook(ctx, report); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if r.config.UsageReport.SMTP.Host != "" {
+		if err := r.sendMail(report); err != nil {
+			errs = append(errs, fmt.Errorf("smtp: %w", err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"from":     from.Format(time.RFC3339),
+		"to":       to.Format(time.RFC3339),
+		"requests": report.Requests,
+	}).Info("Usage report sent")
+	return nil
+}
+
+// postWebhook posts the report as JSON. The text field carries the rendered
+// report for chat tools that display it directly.
+func (r *UsageReporter) postWebhook(ctx context.Context, report UsageReport) error {
+	body, err := json.Marshal(struct {
+		UsageReport
+		Text string `json:"text"`
+	}{report, report.Text()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.config.UsageReport.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendMail mails the report through the configured SMTP server
+func (r *UsageReporter) sendMail(report UsageReport) error {
+	settings := r.config.UsageReport.SMTP
+	if settings.From == "" || len(settings.To) == 0 {
+		return fmt.Errorf("from and to are required")
+	}
+	port := settings.Port
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if settings.Username != "" {
+		auth = smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)
+	}
+
+	subject := mime.QEncoding.Encode("utf-8", "Claude Code Proxy 用量报告 "+report.To.Local().Format("2006-01-02"))
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", settings.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(settings.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(report.Text(), "\n", "\r\n"))
+
+	addr := settings.Host + ":" + strconv.Itoa(port)
+	return smtp.SendMail(addr, auth, settings.From, settings.To, msg.Bytes())
+}
+
+// nextReportTime returns the next report time after now: the configured hour
+// of every day, or of every Monday for weekly reports
+func nextReportTime(now time.Time, schedule string, hour int) time.Time {
+	if hour < 0 || hour > 23 {
+		hour = 0
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	for !next.After(now) || (schedule == "weekly" && next.Weekday() != time.Monday) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
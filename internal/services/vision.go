@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+
+	"claude-code-provider-proxy/internal/config"
+	"claude-code-provider-proxy/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// VisionService keeps images away from upstream models that cannot read them
+type VisionService struct {
+	config *config.Config
+	logger *logrus.Logger
+}
+
+// NewVisionService creates a new vision service
+func NewVisionService(cfg *config.Config, logger *logrus.Logger) *VisionService {
+	return &VisionService{
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Apply checks a request with images against the vision capability of the
+// target model. If the model cannot read images, it returns the configured
+// vision fallback model to use instead, or strips the images and leaves a note
+// in their place. The returned warning describes what was changed.
+func (s *VisionService) Apply(req *models.AnthropicRequest, targetModel string) (fallbackModel, warning string) {
+	if s.config.SupportsVision(targetModel) {
+		return "", ""
+	}
+	images := 0
+	for _, msg := range req.Messages {
+		if blocks, ok := msg.Content.([]interface{}); ok {
+			images += countImages(blocks)
+		}
+	}
+	if images == 0 {
+		return "", ""
+	}
+
+	if fallback := s.config.VisionFallbackModel; fallback != "" && fallback != targetModel {
+		s.logger.WithFields(logrus.Fields{
+			"target_model":   targetModel,
+			"fallback_model": fallback,
+			"images":         images,
+		}).Warn("Model cannot read images, using vision fallback model")
+		return fallback, fmt.Sprintf("%s does not support images, request was routed to %s", targetModel, fallback)
+	}
+
+	note := fmt.Sprintf("[Image removed: the model %s cannot read images]", targetModel)
+	for i, msg := range req.Messages {
+		if blocks, ok := msg.Content.([]interface{}); ok {
+			req.Messages[i].Content = replaceImages(blocks, note)
+		}
+	}
+	s.logger.WithFields(logrus.Fields{
+		"target_model": targetModel,
+		"images":       images,
+	}).Warn("Model cannot read images, images removed from request")
+	return "", fmt.Sprintf("removed %d image(s) because %s does not support images; set vision_fallback_model to route them to a vision model", images, targetModel)
+}
+
+// countImages counts image blocks, including images inside tool results
+func countImages(blocks []interface{}) int {
+	count := 0
+	for _, block := range blocks {
+		blockMap, ok := block.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch blockMap["type"] {
+		case "image":
+			count++
+		case "tool_result":
+			if nested, ok := blockMap["content"].([]interface{}); ok {
+				count += countImages(nested)
+			}
+		}
+	}
+	return count
+}
+
+// replaceImages returns the blocks with every image replaced by a text note
+func replaceImages(blocks []interface{}, note string) []interface{} {
+	result := make([]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		blockMap, ok := block.(map[string]interface{})
+		if !ok {
+			result = append(result, block)
+			continue
+		}
+		switch blockMap["type"] {
+		case "image":
+			block = map[string]interface{}{"type": "text", "text": note}
+		case "tool_result":
+			if nested, ok := blockMap["content"].([]interface{}); ok {
+				toolResult := make(map[string]interface{}, len(blockMap))
+				for key, value := range blockMap {
+					toolResult[key] = value
+				}
+				toolResult["content"] = replaceImages(nested, note)
+				block = toolResult
+			}
+		}
+		result = append(result, block)
+	}
+	return result
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
+	"claude-code-provider-proxy/internal/buildinfo"
 	"claude-code-provider-proxy/internal/cli"
 	"claude-code-provider-proxy/internal/config"
 	"claude-code-provider-proxy/internal/server"
@@ -15,15 +18,40 @@ var (
 	configManager  *cli.ConfigManager
 	serviceManager *cli.ServiceManager
 	logManager     *cli.LogManager
+
+	configDir string
+
+	// Build metadata, set with -ldflags "-X main.version=..." by the build scripts
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+
+	// Default endpoint of the opt-in error reports, set with
+	// -ldflags "-X main.errorReportingDSN=..." for release builds
+	errorReportingDSN = ""
 )
 
-func init() {
+// initManagers creates the managers once flags are parsed, so --config-dir
+// applies to the config, PID and log locations
+func initManagers() {
+	if configDir != "" {
+		dir, err := filepath.Abs(configDir)
+		if err != nil {
+			cli.ShowError(fmt.Errorf("配置目录无效: %v", err))
+		}
+		// Exported so the background server process uses the same directory
+		os.Setenv("CLAUDEPROXY_HOME", dir)
+	}
+
 	configManager = cli.NewConfigManager()
 	serviceManager = cli.NewServiceManager(configManager)
 	logManager = cli.NewLogManager()
 }
 
 func main() {
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = version, commit, buildTime
+	buildinfo.ErrorReportingDSN = errorReportingDSN
+
 	var rootCmd = &cobra.Command{
 		Use:   "claudeproxy",
 		Short: "Claude Code Proxy - 将Claude API转换为胜算云格式的代理服务",
@@ -32,11 +60,12 @@ func main() {
 		CompletionOptions: cobra.CompletionOptions{
 			DisableDefaultCmd: true,
 		},
-		Args: cobra.NoArgs,
+		Version: version,
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// 如果配置不存在，运行初始设置
 			if !configManager.ConfigExists() {
-				runInitialSetup()
+				runInitialSetup(false)
 				return nil
 			}
 
@@ -45,15 +74,22 @@ func main() {
 		},
 	}
 
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "配置目录 (默认 ~/.claudeproxy，也可通过 CLAUDEPROXY_HOME 环境变量设置)")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		initManagers()
+	}
+
 	// Setup command
+	var setupOffline bool
 	var setupCmd = &cobra.Command{
 		Use:   "setup",
 		Short: "初始化配置",
 		Long:  "运行初始化向导来配置API密钥和模型选择",
 		Run: func(cmd *cobra.Command, args []string) {
-			runInitialSetup()
+			runInitialSetup(setupOffline)
 		},
 	}
+	setupCmd.Flags().BoolVar(&setupOffline, "offline", false, "离线模式：不获取模型列表、不测试模型，手动输入模型 API 名称")
 
 	// Start command
 	var startCmd = &cobra.Command{
@@ -66,6 +102,9 @@ func main() {
 				os.Exit(1)
 			}
 
+			if err := serviceManager.CheckConflicts(); err != nil {
+				cli.ShowError(err)
+			}
 			if err := serviceManager.Start(); err != nil {
 				cli.ShowError(err)
 			}
@@ -73,12 +112,31 @@ func main() {
 	}
 
 	// Stop command
+	var stopAll bool
 	var stopCmd = &cobra.Command{
 		Use:   "stop",
 		Short: "停止服务",
-		Long:  "停止正在运行的Claude代理服务",
+		Long:  "停止正在运行的Claude代理服务；--all 还会结束失去跟踪的服务进程，例如实例文件被删除或旧版本启动的服务",
+		Run: func(cmd *cobra.Command, args []string) {
+			stop := serviceManager.Stop
+			if stopAll {
+				stop = serviceManager.StopAll
+			}
+			if err := stop(); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	stopCmd.Flags().BoolVar(&stopAll, "all", false, "同时结束本程序的其他服务进程和占用配置端口的本程序进程")
+
+	// Restart command
+	var restartCmd = &cobra.Command{
+		Use:   "restart",
+		Short: "重启服务",
+		Long:  "重启服务并加载新的配置和程序文件；新进程接管监听端口后旧进程才停止接受连接，进行中的流式请求不会中断 (Windows 上为先停止后启动)",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := serviceManager.Stop(); err != nil {
+			if err := serviceManager.Restart(); err != nil {
 				cli.ShowError(err)
 			}
 		},
@@ -118,6 +176,93 @@ func main() {
 		},
 	}
 
+	var configSetCmd = &cobra.Command{
+		Use:   "set <配置项> <值>",
+		Short: "直接修改单个配置项",
+		Long: `直接修改单个配置项，无需交互向导。配置项可以是大写名称（如 PORT、LOG_LEVEL、BIG_MODEL_NAME），
+也可以是配置文件中的点分路径（如 hedging.delay_ms、upstreams.deepseek-chat.base_url、api_keys.0.weight），
+键名中的 "." 写作 "\."。值按 JSON 解析，无法解析时作为字符串。`,
+		Example: `  claudeproxy config set PORT 3181
+  claudeproxy config set LOG_LEVEL debug
+  claudeproxy config set model_pairs.cheap.big deepseek/deepseek-v3
+  claudeproxy config set custom_headers '{"OpenAI-Project": "proj_123"}'`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !configManager.ConfigExists() {
+				fmt.Println("❌ 配置文件不存在，请先运行 'claudeproxy setup'")
+				os.Exit(1)
+			}
+
+			if err := configManager.SetValue(args[0], args[1]); err != nil {
+				cli.ShowError(err)
+			}
+			fmt.Printf("✅ 已设置 %s\n", args[0])
+
+			if serviceManager.IsRunning() {
+				fmt.Println("ℹ️  运行中的服务会自动加载新配置 (修改 HOST/PORT 需要重启服务)")
+			}
+		},
+	}
+	configCmd.AddCommand(configSetCmd)
+
+	var exportNoSecrets bool
+	var exportOutput string
+	var configExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "导出完整配置",
+		Long:  "导出完整配置用于团队共享，使用 --no-secrets 可排除 API 密钥等敏感信息",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := configManager.ExportConfig(exportNoSecrets)
+			if err != nil {
+				cli.ShowError(err)
+			}
+
+			if exportOutput == "" {
+				os.Stdout.Write(data)
+				return
+			}
+			perm := os.FileMode(0600)
+			if exportNoSecrets {
+				perm = 0644
+			}
+			if err := os.WriteFile(exportOutput, data, perm); err != nil {
+				cli.ShowError(fmt.Errorf("写入导出文件失败: %v", err))
+			}
+			fmt.Printf("✅ 配置已导出到 %s\n", exportOutput)
+		},
+	}
+	configExportCmd.Flags().BoolVar(&exportNoSecrets, "no-secrets", false, "排除 API 密钥和管理令牌")
+	configExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "导出到文件（默认输出到终端）")
+	configCmd.AddCommand(configExportCmd)
+
+	var importYes bool
+	var configImportCmd = &cobra.Command{
+		Use:   "import <配置文件>",
+		Short: "导入配置",
+		Long:  "用导出的配置文件替换当前配置；文件中未包含的 API 密钥会保留当前的值",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if configManager.ConfigExists() && !importYes && !cli.ConfirmAction("导入将覆盖当前配置，确认继续吗?") {
+				return
+			}
+
+			if err := configManager.ImportConfig(args[0]); err != nil {
+				cli.ShowError(err)
+			}
+			fmt.Println("✅ 配置已导入")
+
+			if configManager.GetConfig("SSY_API_KEY") == "" {
+				fmt.Println("⚠️  导入的配置不包含 API 密钥，请运行 'claudeproxy set' 设置")
+			}
+			if serviceManager.IsRunning() {
+				fmt.Println("ℹ️  运行中的服务会自动加载新配置 (修改 HOST/PORT 需要重启服务)")
+			}
+		},
+	}
+	configImportCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "跳过覆盖确认")
+	configCmd.AddCommand(configImportCmd)
+
 	// Server command (internal use for background service)
 	var serverCmd = &cobra.Command{
 		Use:    "server",
@@ -131,7 +276,10 @@ func main() {
 			}
 
 			// Load config and start server
-			cfg := config.Load()
+			cfg, err := config.Load()
+			if err != nil {
+				cli.ShowError(fmt.Errorf("配置无效: %v", err))
+			}
 			srv := server.New(cfg)
 
 			fmt.Printf("🚀 启动服务器在 http://%s:%s\n", cfg.Host, cfg.Port)
@@ -141,6 +289,29 @@ func main() {
 		},
 	}
 
+	// Serve command - stateless foreground server for containers
+	var serveOpts cli.ServeOptions
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "以无状态模式运行服务 (容器/Kubernetes)",
+		Long:  "在前台运行服务，只从环境变量和命令行参数读取配置，日志输出到标准输出，不读写配置目录、PID 文件和 shell 配置；提供 /healthz 和 /readyz 探针",
+		Args:  cobra.NoArgs,
+		// Skips initManagers, which creates the config directory
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunServe(serveOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	serveCmd.Flags().StringVar(&serveOpts.Host, "host", "", "监听地址 (默认 HOST 环境变量或 0.0.0.0)")
+	serveCmd.Flags().StringVar(&serveOpts.Port, "port", "", "监听端口 (默认 PORT 环境变量或 8000)")
+	serveCmd.Flags().StringVar(&serveOpts.BaseURL, "base-url", "", "上游地址 (默认 BASE_URL 环境变量)")
+	serveCmd.Flags().StringVar(&serveOpts.BigModel, "big-model", "", "大模型 (默认 BIG_MODEL_NAME 环境变量)")
+	serveCmd.Flags().StringVar(&serveOpts.SmallModel, "small-model", "", "小模型 (默认 SMALL_MODEL_NAME 环境变量)")
+	serveCmd.Flags().StringVar(&serveOpts.LogLevel, "log-level", "", "日志级别 (默认 LOG_LEVEL 环境变量或 info)")
+	rootCmd.AddCommand(serveCmd)
+
 	// Clean command
 	var cleanCmd = &cobra.Command{
 		Use:   "clean",
@@ -204,11 +375,64 @@ func main() {
 		},
 	}
 
+	// Backup and restore commands
+	var backupOpts cli.BackupOptions
+	var backupCmd = &cobra.Command{
+		Use:   "backup [备份文件]",
+		Short: "备份配置和用量记录",
+		Long:  "将配置（含路由规则）、用量记录和会话记录打包为一个 .tar.gz 文件，用于迁移到其他机器；不包含日志",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				backupOpts.Output = args[0]
+			}
+			if err := cli.RunBackup(backupOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	backupCmd.Flags().BoolVar(&backupOpts.NoSecrets, "no-secrets", false, "排除 API 密钥和管理令牌")
+	backupCmd.Flags().BoolVar(&backupOpts.Encrypt, "encrypt", false, "使用密码加密备份 (也可通过 CLAUDEPROXY_BACKUP_PASSWORD 环境变量提供密码)")
+	backupCmd.Flags().BoolVar(&backupOpts.NoTranscripts, "no-transcripts", false, "不包含会话记录")
+	rootCmd.AddCommand(backupCmd)
+
+	var restoreYes bool
+	var restoreCmd = &cobra.Command{
+		Use:   "restore <备份文件>",
+		Short: "从备份恢复",
+		Long:  "用备份中的配置、用量记录和会话记录替换当前的；备份中未包含的 API 密钥会保留当前的值",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunRestore(serviceManager, args[0], restoreYes); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	restoreCmd.Flags().BoolVarP(&restoreYes, "yes", "y", false, "跳过覆盖确认")
+	rootCmd.AddCommand(restoreCmd)
+
+	// Uninstall command
+	var uninstallOpts cli.UninstallOptions
+	var uninstallCmd = &cobra.Command{
+		Use:   "uninstall",
+		Short: "卸载 claudeproxy",
+		Long:  "停止所有服务进程，停用 systemd/launchd 服务，删除 shell 配置文件、Windows 用户环境变量和 Claude Code settings.json 中指向本代理的 ANTHROPIC 环境变量，并删除配置目录（配置、日志、用量记录和会话记录）；指向其他服务的设置不会改动",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunUninstall(serviceManager, uninstallOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	uninstallCmd.Flags().BoolVar(&uninstallOpts.RemoveBinary, "remove-binary", false, "同时删除 claudeproxy 程序文件")
+	uninstallCmd.Flags().BoolVarP(&uninstallOpts.Yes, "yes", "y", false, "跳过确认")
+
 	// Log command
 	var logCmd = &cobra.Command{
-		Use:   "log",
-		Short: "查看服务日志",
-		Long:  "查看Claude代理服务的日志文件",
+		Use:     "log",
+		Aliases: []string{"logs"},
+		Short:   "查看服务日志",
+		Long:    "查看Claude代理服务的日志文件",
 		Run: func(cmd *cobra.Command, args []string) {
 			// Show log info by default
 			if err := logManager.ShowLogInfo(); err != nil {
@@ -221,16 +445,40 @@ func main() {
 	var logLines int
 	var logFollow bool
 	var logClear bool
+	var logRemote bool
+	var logURL, logToken, logLevel string
 
 	logCmd.Flags().IntVarP(&logLines, "lines", "l", 100, "显示最后多少行日志")
 	logCmd.Flags().BoolVarP(&logFollow, "follow", "f", false, "实时监控日志")
 	logCmd.Flags().BoolVar(&logClear, "clear", false, "清除日志文件")
+	logCmd.Flags().BoolVar(&logRemote, "remote", false, "通过服务的 HTTP 接口获取日志，无需访问日志文件")
+	logCmd.Flags().StringVar(&logURL, "url", "", "远程服务地址 (默认使用配置中的地址)")
+	logCmd.Flags().StringVar(&logToken, "token", "", "远程服务的 admin_token (默认使用配置中的值)")
+	logCmd.Flags().StringVar(&logLevel, "level", "", "仅显示该级别及以上的日志 (debug/info/warn/error)")
 
 	logCmd.RunE = func(cmd *cobra.Command, args []string) error {
 		if logClear {
 			return logManager.ClearLogs()
 		}
 
+		if logRemote {
+			if logURL == "" {
+				host := configManager.GetConfig("HOST")
+				if host == "" || host == "0.0.0.0" {
+					host = "127.0.0.1"
+				}
+				logURL = fmt.Sprintf("http://%s:%s", host, configManager.GetConfig("PORT"))
+			}
+			if logToken == "" {
+				logToken = configManager.GetConfig("ADMIN_TOKEN")
+			}
+			lines := 0
+			if cmd.Flags().Changed("lines") {
+				lines = logLines
+			}
+			return logManager.FollowRemoteLogs(logURL, logToken, logLevel, lines)
+		}
+
 		if logFollow {
 			return logManager.FollowLogs()
 		}
@@ -247,10 +495,12 @@ func main() {
 	rootCmd.AddCommand(setupCmd)
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(restartCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(setCmd)
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(uninstallCmd)
 	rootCmd.AddCommand(logCmd)
 	rootCmd.AddCommand(serverCmd)
 
@@ -272,6 +522,365 @@ func main() {
 	}
 	rootCmd.AddCommand(codeCmd)
 
+	// Expose command - publish the proxy through a tunnel
+	var tunnelProvider string
+	var exposeCmd = &cobra.Command{
+		Use:   "expose",
+		Short: "通过隧道公开代理服务",
+		Long: `通过 Cloudflare Tunnel (cloudflared) 或 Tailscale Funnel 将代理服务公开到公网，
+并打印在其他电脑上使用的 ANTHROPIC_BASE_URL 和 ANTHROPIC_AUTH_TOKEN，按 Ctrl+C 关闭。
+通过隧道的请求必须携带 local_keys 中的密钥，未配置时自动生成一个；管理接口不会公开。`,
+		Example: `  claudeproxy expose
+  claudeproxy expose --provider tailscale`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !configManager.ConfigExists() {
+				fmt.Println("❌ 配置文件不存在，请先运行 'claudeproxy setup'")
+				os.Exit(1)
+			}
+
+			if err := cli.RunExpose(serviceManager, tunnelProvider); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	exposeCmd.Flags().StringVar(&tunnelProvider, "provider", "auto", "隧道程序: auto, cloudflared 或 tailscale")
+	rootCmd.AddCommand(exposeCmd)
+
+	// Bench command - load test the running proxy
+	var benchOpts cli.BenchOptions
+	var benchCmd = &cobra.Command{
+		Use:   "bench",
+		Short: "压测代理服务",
+		Long:  "向本地代理服务并发发送 /v1/messages 请求，报告吞吐量、p95 延迟和内存占用",
+		Run: func(cmd *cobra.Command, args []string) {
+			if benchOpts.URL == "" {
+				if err := configManager.LoadConfig(); err != nil {
+					cli.ShowError(fmt.Errorf("加载配置失败: %v", err))
+				}
+				host := configManager.GetConfig("HOST")
+				if host == "" || host == "0.0.0.0" {
+					host = "127.0.0.1"
+				}
+				benchOpts.URL = fmt.Sprintf("http://%s:%s", host, configManager.GetConfig("PORT"))
+			}
+
+			if err := cli.RunBench(benchOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	benchCmd.Flags().StringVar(&benchOpts.URL, "url", "", "代理服务地址 (默认使用配置中的地址)")
+	benchCmd.Flags().IntVarP(&benchOpts.Requests, "requests", "n", 50, "请求总数")
+	benchCmd.Flags().IntVarP(&benchOpts.Concurrency, "concurrency", "c", 10, "并发数")
+	benchCmd.Flags().BoolVar(&benchOpts.Stream, "stream", false, "使用流式请求")
+	benchCmd.Flags().StringVar(&benchOpts.Model, "model", "claude-3-5-haiku-20241022", "请求使用的模型")
+	benchCmd.Flags().IntVar(&benchOpts.MaxTokens, "max-tokens", 64, "每个请求的 max_tokens")
+	benchCmd.Flags().StringVar(&benchOpts.Prompt, "prompt", "Reply with a short greeting.", "请求内容")
+	rootCmd.AddCommand(benchCmd)
+
+	// Doctor command - check the local installation
+	var fixPerms bool
+	var checkStream bool
+	var doctorCmd = &cobra.Command{
+		Use:   "doctor [地址]",
+		Short: "检查配置文件权限",
+		Long: `检查配置目录、配置文件（包含 API 密钥）和日志是否可被其他用户访问。
+使用 --stream 时还会检查流式响应能否逐个事件到达客户端，用于排查 nginx、Caddy 等反向代理缓冲流式响应的问题。
+地址为 Claude Code 访问代理使用的地址（如反向代理的地址），默认使用 ANTHROPIC_BASE_URL 或本地服务。`,
+		Example: `  claudeproxy doctor --fix-perms
+  claudeproxy doctor --stream
+  claudeproxy doctor --stream https://proxy.example.com`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 && !checkStream {
+				cli.ShowError(fmt.Errorf("地址只用于 --stream 检查"))
+			}
+			if err := cli.RunDoctor(fixPerms); err != nil {
+				cli.ShowError(err)
+			}
+			if checkStream {
+				var baseURL string
+				if len(args) > 0 {
+					baseURL = args[0]
+				}
+				if err := cli.RunStreamCheck(serviceManager, baseURL); err != nil {
+					cli.ShowError(err)
+				}
+			}
+		},
+	}
+	doctorCmd.Flags().BoolVar(&fixPerms, "fix-perms", false, "将权限收紧为仅当前用户可访问")
+	doctorCmd.Flags().BoolVar(&checkStream, "stream", false, "检查流式响应是否被反向代理或网络缓冲")
+	rootCmd.AddCommand(doctorCmd)
+
+	// Top command - live monitor of the running service
+	var topInterval time.Duration
+	var topCmd = &cobra.Command{
+		Use:   "top",
+		Short: "实时监控运行中的服务",
+		Long:  "在终端中实时显示进行中的请求、各模型的 token 统计、流式吞吐量和最近的错误",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunTop(serviceManager, topInterval); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	topCmd.Flags().DurationVarP(&topInterval, "interval", "i", time.Second, "刷新间隔")
+	rootCmd.AddCommand(topCmd)
+
+	// Tap command - observe a live response
+	var tapCmd = &cobra.Command{
+		Use:   "tap [请求ID]",
+		Short: "旁观进行中的请求",
+		Long:  "只读地实时输出进行中请求的响应内容，与 Claude Code 收到的完全一致，不影响该请求；未指定请求 ID 时使用最近开始的请求",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			requestID := ""
+			if len(args) > 0 {
+				requestID = args[0]
+			}
+			if err := cli.RunTap(serviceManager, requestID); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	rootCmd.AddCommand(tapCmd)
+
+	// Debug command - bundle everything about a request for bug reports
+	var debugOutput string
+	var debugCmd = &cobra.Command{
+		Use:   "debug [请求ID]",
+		Short: "导出请求的调试包",
+		Long:  "将请求的上游交互录制、相关日志、脱敏后的配置和版本信息打包为 zip 文件，便于附加到 Issue；未指定请求 ID 时使用最近失败的请求",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			requestID := ""
+			if len(args) > 0 {
+				requestID = args[0]
+			}
+			if err := cli.RunDebug(configManager, serviceManager, logManager, requestID, debugOutput); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	debugCmd.Flags().StringVarP(&debugOutput, "output", "o", "", "输出文件 (默认 claudeproxy-debug-<请求ID>.zip)")
+	rootCmd.AddCommand(debugCmd)
+
+	// Usage command - reconcile upstream billing with local token counts
+	var usageOpts cli.UsageOptions
+	var usageCmd = &cobra.Command{
+		Use:   "usage",
+		Short: "查看用量记录",
+		Long:  "按模型汇总 usage_ledger 记录的上游用量与本地估算；使用 --reconcile 列出差异明显的请求，便于核对计费异常",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunUsage(usageOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	usageCmd.Flags().BoolVar(&usageOpts.Reconcile, "reconcile", false, "列出上游用量与本地估算差异明显的请求")
+	usageCmd.Flags().Float64Var(&usageOpts.Threshold, "threshold", 30, "差异阈值 (百分比)")
+	usageCmd.Flags().DurationVar(&usageOpts.Since, "since", 0, "只统计最近一段时间的请求，例如 24h")
+	usageCmd.Flags().BoolVar(&usageOpts.Send, "send-report", false, "立即发送最近一个周期的用量报告 (用于检查 usage_report 配置)")
+	rootCmd.AddCommand(usageCmd)
+
+	// Compare command - report on mirrored requests
+	var compareOpts cli.CompareOptions
+	var compareCmd = &cobra.Command{
+		Use:   "compare",
+		Short: "对比主模型与影子模型",
+		Long: `根据请求镜像 (mirror) 记录的成对响应，对比主模型与影子模型的延迟、输出长度、费用、工具调用和结束原因是否一致；
+配置 mirror.embedding_model 或使用 --embedding-model 时还会用 embedding 计算回答的语义相似度，并列出差异最大的请求。`,
+		Example: `  claudeproxy compare
+  claudeproxy compare --since 24h --embedding-model text-embedding-3-small`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunCompare(compareOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	compareCmd.Flags().DurationVar(&compareOpts.Since, "since", 0, "只统计最近一段时间的请求，例如 24h")
+	compareCmd.Flags().StringVar(&compareOpts.EmbeddingModel, "embedding-model", "", "计算语义相似度使用的 embedding 模型 (默认使用 mirror.embedding_model)")
+	compareCmd.Flags().IntVar(&compareOpts.Limit, "limit", 200, "计算相似度的最近请求数，0 表示全部")
+	compareCmd.Flags().IntVar(&compareOpts.Worst, "worst", 5, "列出差异最大的请求数")
+	rootCmd.AddCommand(compareCmd)
+
+	// Recommend command - rank upstream models for the big and small roles
+	recommendOpts := cli.RecommendDefaults
+	var recommendCmd = &cobra.Command{
+		Use:   "recommend",
+		Short: "推荐大小模型",
+		Long: `按能力、上下文长度、价格和最近请求的首字延迟为上游模型评分，分别列出最适合作为大模型和小模型的候选；
+首字延迟和失败率来自 usage_ledger 的用量记录，不支持工具调用的模型不会被推荐。`,
+		Example: `  claudeproxy recommend
+  claudeproxy recommend --since 24h --top 10`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunRecommend(recommendOpts); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	recommendCmd.Flags().DurationVar(&recommendOpts.Since, "since", recommendOpts.Since, "参考最近一段时间的请求延迟")
+	recommendCmd.Flags().IntVar(&recommendOpts.Top, "top", recommendOpts.Top, "每类列出的模型数")
+	rootCmd.AddCommand(recommendCmd)
+
+	// Models command - pinned models listed first by the model selection
+	var modelsCmd = &cobra.Command{
+		Use:   "models",
+		Short: "管理收藏的模型",
+		Long:  "收藏常用模型，收藏的模型会在 setup 和 set 选择模型时排在最前面；不带子命令时列出收藏的模型",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configManager.ListPinnedModels(); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	var modelsPinCmd = &cobra.Command{
+		Use:     "pin <模型>",
+		Short:   "收藏模型",
+		Example: "  claudeproxy models pin deepseek/deepseek-v3",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pinned, err := configManager.PinModel(args[0])
+			if err != nil {
+				cli.ShowError(err)
+			}
+			if !pinned {
+				fmt.Printf("📌 %s 已在收藏中\n", args[0])
+				return
+			}
+			fmt.Printf("✅ 已收藏 %s\n", args[0])
+		},
+	}
+	var modelsUnpinCmd = &cobra.Command{
+		Use:   "unpin <模型>",
+		Short: "取消收藏模型",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			unpinned, err := configManager.UnpinModel(args[0])
+			if err != nil {
+				cli.ShowError(err)
+			}
+			if !unpinned {
+				fmt.Printf("⚠️  %s 不在收藏中\n", args[0])
+				return
+			}
+			fmt.Printf("✅ 已取消收藏 %s\n", args[0])
+		},
+	}
+	modelsCmd.AddCommand(modelsPinCmd, modelsUnpinCmd)
+	rootCmd.AddCommand(modelsCmd)
+
+	// History command - conversations stored by the transcripts option
+	var historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "查看和导出会话记录",
+		Long:  "查看开启 transcripts 后按 Claude Code 会话保存的对话，并导出为 Markdown 或 Anthropic JSON",
+	}
+	var historyListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "列出保存的会话",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunHistoryList(); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	historyCmd.AddCommand(historyListCmd)
+	var historyFormat, historyOutput string
+	var historyExportCmd = &cobra.Command{
+		Use:   "export <会话ID>",
+		Short: "导出会话",
+		Long:  "导出会话的完整对话：markdown 为便于阅读和分享的文档，json 为 Anthropic messages 请求格式 (model、system、messages)；会话 ID 可只写开头几位",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunHistoryExport(args[0], historyFormat, historyOutput); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	historyExportCmd.Flags().StringVarP(&historyFormat, "format", "f", cli.HistoryFormatMarkdown, "导出格式: markdown 或 json")
+	historyExportCmd.Flags().StringVarP(&historyOutput, "output", "o", "", "输出文件，默认输出到终端")
+	historyCmd.AddCommand(historyExportCmd)
+	rootCmd.AddCommand(historyCmd)
+
+	// Version command - build metadata for bug reports
+	var versionJSON bool
+	var versionCmd = &cobra.Command{
+		Use:   "version",
+		Short: "显示版本信息",
+		Long:  "显示程序的版本、Git 提交、构建时间、Go 版本和配置版本；服务运行中时同时显示服务的版本",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunVersion(serviceManager, versionJSON); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "以 JSON 格式输出")
+	rootCmd.AddCommand(versionCmd)
+
+	// Dev command - developer tools
+	var devCmd = &cobra.Command{
+		Use:   "dev",
+		Short: "开发者工具",
+		Long:  "用于调试和回归测试的开发者工具",
+	}
+
+	var replayUpdate bool
+	var replayCmd = &cobra.Command{
+		Use:   "replay <录制文件或目录>",
+		Short: "回放录制的上游交互",
+		Long:  "将 record_dir 录制的上游交互回放到转换服务和流式服务中，并与基准结果比较",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunReplay(args[0], replayUpdate); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	replayCmd.Flags().BoolVar(&replayUpdate, "update", false, "用当前结果更新基准结果")
+	devCmd.AddCommand(replayCmd)
+
+	var addFixtureName, addFixtureDir string
+	var addFixtureCmd = &cobra.Command{
+		Use:   "add-fixture <录制文件名或请求ID>",
+		Short: "将录制加入回归测试集",
+		Long:  "将 record_dir 中的一次录制复制到回归测试集，并写入当前转换结果作为基准结果；请求 ID 可只写开头几位",
+		Example: `  claudeproxy dev add-fixture 20261016-101500.000-claude-sonnet-4
+  claudeproxy dev add-fixture 3f9c2a --name tool_use_read_file`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunAddFixture(args[0], addFixtureName, addFixtureDir); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	addFixtureCmd.Flags().StringVar(&addFixtureName, "name", "", "录制文件名称 (默认使用录制时的名称)")
+	addFixtureCmd.Flags().StringVar(&addFixtureDir, "dir", "testdata/fixtures", "回归测试集目录")
+	devCmd.AddCommand(addFixtureCmd)
+
+	var openAPIOutput string
+	var openAPICmd = &cobra.Command{
+		Use:   "openapi",
+		Short: "生成 OpenAPI 文档",
+		Long:  "输出代理所有接口的 OpenAPI 文档，与运行中服务的 /openapi.json 相同，可用于生成客户端",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.RunOpenAPI(openAPIOutput); err != nil {
+				cli.ShowError(err)
+			}
+		},
+	}
+	openAPICmd.Flags().StringVarP(&openAPIOutput, "output", "o", "", "写入文件而不是标准输出")
+	devCmd.AddCommand(openAPICmd)
+	rootCmd.AddCommand(devCmd)
+
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
 		cli.ShowError(err)
@@ -279,7 +888,7 @@ func main() {
 }
 
 // runInitialSetup runs the initial setup wizard
-func runInitialSetup() {
+func runInitialSetup(offline bool) {
 	cli.ShowWelcome()
 
 	// Check for existing environment variables
@@ -314,11 +923,53 @@ func runInitialSetup() {
 
 	// Note: API key is now stored in JSON config, no need to update global env vars
 
+	// Select models, typing them in when the router cannot be reached
+	var bigModel, smallModel string
+	var isNewBigModel, isNewSmallModel bool
+	if offline {
+		bigModel, smallModel, isNewBigModel, isNewSmallModel = enterModels(existingVars)
+	} else {
+		bigModel, smallModel, isNewBigModel, isNewSmallModel = selectModels(apiKey, existingVars)
+	}
+
+	// Save model configuration
+	if err := configManager.SetModels(bigModel, smallModel); err != nil {
+		cli.ShowError(fmt.Errorf("保存模型配置失败: %v", err))
+	}
+
+	// Note: Models are now stored in JSON config, no need to update global env vars
+
+	// Ask for the opt-in error reports when this build or the config has an endpoint
+	var isNewErrorReporting bool
+	if cfg := loadConfig(); buildinfo.ReportingDSN(cfg) != "" {
+		enabled := cli.PromptForErrorReporting()
+		isNewErrorReporting = enabled != cfg.ErrorReporting
+		if err := configManager.SetErrorReporting(enabled); err != nil {
+			cli.ShowError(fmt.Errorf("保存错误报告设置失败: %v", err))
+		}
+	}
+
+	// Restart service if running and any configuration changed
+	if isNewAPIKey || isNewBigModel || isNewSmallModel || isNewErrorReporting {
+		if err := serviceManager.RestartIfRunning(); err != nil {
+			fmt.Printf("⚠️  重启服务失败: %v\n", err)
+			fmt.Println("请手动重启服务: claudeproxy stop && claudeproxy start")
+		}
+	}
+
+	cli.ShowSetupComplete()
+}
+
+// selectModels fetches the model list and lets the user select and test the
+// big and small model
+func selectModels(apiKey string, existingVars map[string]string) (bigModel, smallModel string, isNewBigModel, isNewSmallModel bool) {
 	// Fetch models
 	fmt.Println("\n🔄 获取可用模型列表...")
 	models, err := cli.FetchModels(apiKey)
 	if err != nil {
-		cli.ShowError(fmt.Errorf("获取模型列表失败: %v", err))
+		fmt.Printf("❌ 错误: 获取模型列表失败: %v\n", err)
+		fmt.Println("💡 无法访问上游时，可运行 'claudeproxy setup --offline' 手动输入模型名称")
+		os.Exit(1)
 	}
 
 	if len(models) == 0 {
@@ -326,55 +977,88 @@ func runInitialSetup() {
 	}
 
 	fmt.Printf("✅ 找到 %d 个可用模型\n\n", len(models))
-
-	// Handle big model selection
-	var bigModel string
-	var isNewBigModel bool
-	if existing, hasExisting := existingVars["BIG_MODEL_NAME"]; hasExisting {
-		bigModel, isNewBigModel, err = cli.PromptForModelWithExisting(models, "大", existing)
-		if err != nil {
-			cli.ShowError(err)
-		}
-	} else {
-		bigModel, err = cli.PromptForModel(models, "大")
-		if err != nil {
-			cli.ShowError(err)
+	recs := recommendModels()
+	pinned := configManager.PinnedModels()
+
+	for {
+		// Handle big model selection
+		if existing, hasExisting := existingVars["BIG_MODEL_NAME"]; hasExisting {
+			bigModel, isNewBigModel, err = cli.PromptForModelWithExisting(models, "大", existing, pinned)
+			if err != nil {
+				cli.ShowError(err)
+			}
+		} else {
+			bigModel, err = cli.PromptForRecommendedModel(models, "大", pinned, recs.Big)
+			if err != nil {
+				cli.ShowError(err)
+			}
+			isNewBigModel = true
 		}
-		isNewBigModel = true
-	}
 
-	// Handle small model selection
-	var smallModel string
-	var isNewSmallModel bool
-	if existing, hasExisting := existingVars["SMALL_MODEL_NAME"]; hasExisting {
-		smallModel, isNewSmallModel, err = cli.PromptForModelWithExisting(models, "小", existing)
-		if err != nil {
-			cli.ShowError(err)
+		// Handle small model selection
+		if existing, hasExisting := existingVars["SMALL_MODEL_NAME"]; hasExisting {
+			smallModel, isNewSmallModel, err = cli.PromptForModelWithExisting(models, "小", existing, pinned)
+			if err != nil {
+				cli.ShowError(err)
+			}
+		} else {
+			smallModel, err = cli.PromptForRecommendedModel(models, "小", pinned, recs.Small)
+			if err != nil {
+				cli.ShowError(err)
+			}
+			isNewSmallModel = true
 		}
-	} else {
-		smallModel, err = cli.PromptForModel(models, "小")
-		if err != nil {
-			cli.ShowError(err)
+
+		// Try both models before saving them; after a failed test both are selected anew
+		if cli.ConfirmModels(loadConfig(), bigModel, smallModel) {
+			break
 		}
-		isNewSmallModel = true
+		delete(existingVars, "BIG_MODEL_NAME")
+		delete(existingVars, "SMALL_MODEL_NAME")
 	}
+	return bigModel, smallModel, isNewBigModel, isNewSmallModel
+}
 
-	// Save model configuration
-	if err := configManager.SetModels(bigModel, smallModel); err != nil {
-		cli.ShowError(fmt.Errorf("保存模型配置失败: %v", err))
+// enterModels lets the user type the big and small model API names, checking
+// only their format
+func enterModels(existingVars map[string]string) (bigModel, smallModel string, isNewBigModel, isNewSmallModel bool) {
+	fmt.Println("\n📴 离线模式: 不获取模型列表，也不测试模型，请手动输入模型的 API 名称")
+	fmt.Println("💡 模型名称须与上游路由器中的名称完全一致，例如 deepseek/deepseek-v3")
+
+	var err error
+	bigModel, err = cli.PromptForModelName("大", existingVars["BIG_MODEL_NAME"])
+	if err != nil {
+		cli.ShowError(err)
+	}
+	smallModel, err = cli.PromptForModelName("小", existingVars["SMALL_MODEL_NAME"])
+	if err != nil {
+		cli.ShowError(err)
 	}
 
-	// Note: Models are now stored in JSON config, no need to update global env vars
+	fmt.Println("⚠️  模型未经测试，联网后可运行 'claudeproxy set' 重新选择并测试模型")
+	return bigModel, smallModel, bigModel != existingVars["BIG_MODEL_NAME"], smallModel != existingVars["SMALL_MODEL_NAME"]
+}
 
-	// Restart service if running and any configuration changed
-	if isNewAPIKey || isNewBigModel || isNewSmallModel {
-		if err := serviceManager.RestartIfRunning(); err != nil {
-			fmt.Printf("⚠️  重启服务失败: %v\n", err)
-			fmt.Println("请手动重启服务: claudeproxy stop && claudeproxy start")
-		}
+// loadConfig loads the configuration saved so far by the wizard, exiting when
+// it is invalid
+func loadConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		cli.ShowError(fmt.Errorf("配置无效: %v", err))
 	}
+	return cfg
+}
 
-	cli.ShowSetupComplete()
+// recommendModels returns the model shortlists of the wizard, empty when the
+// upstream models cannot be ranked
+func recommendModels() *cli.Recommendations {
+	fmt.Println("🔄 为模型评分...")
+	recs, err := cli.RecommendModels(loadConfig(), cli.RecommendDefaults)
+	if err != nil {
+		fmt.Printf("⚠️  无法推荐模型: %v\n", err)
+		return &cli.Recommendations{}
+	}
+	return recs
 }
 
 // runSetConfig runs the configuration modification wizard
@@ -445,15 +1129,25 @@ func runSetConfig() {
 			cli.ShowError(fmt.Errorf("获取模型列表失败: %v", err))
 		}
 
-		// Select models
-		bigModel, err := cli.PromptForModel(models, "大")
-		if err != nil {
-			cli.ShowError(err)
-		}
+		// Select models, offering the pinned and recommended ones first, and try them
+		// before saving
+		recs := recommendModels()
+		pinned := configManager.PinnedModels()
+		var bigModel, smallModel string
+		for {
+			bigModel, err = cli.PromptForRecommendedModel(models, "大", pinned, recs.Big)
+			if err != nil {
+				cli.ShowError(err)
+			}
 
-		smallModel, err := cli.PromptForModel(models, "小")
-		if err != nil {
-			cli.ShowError(err)
+			smallModel, err = cli.PromptForRecommendedModel(models, "小", pinned, recs.Small)
+			if err != nil {
+				cli.ShowError(err)
+			}
+
+			if cli.ConfirmModels(loadConfig(), bigModel, smallModel) {
+				break
+			}
 		}
 
 		if err := configManager.SetModels(bigModel, smallModel); err != nil {
@@ -464,18 +1158,23 @@ func runSetConfig() {
 		configChanges = make(map[string]string)
 		if currentBigModel != bigModel {
 			configChanges["BIG_MODEL_NAME"] = bigModel
-			needRestart = true
-			// Note: Model is now stored in JSON config
 		}
-
 		if currentSmallModel != smallModel {
 			configChanges["SMALL_MODEL_NAME"] = smallModel
-			needRestart = true
-			// Note: Model is now stored in JSON config
 		}
 
 		fmt.Println("✅ 模型配置已更新")
 
+		// Switch the running service without a restart
+		if len(configChanges) > 0 && serviceManager.IsRunning() {
+			if err := serviceManager.UpdateModels(bigModel, smallModel); err != nil {
+				fmt.Printf("⚠️  无法在线切换模型: %v\n", err)
+				needRestart = true
+			} else {
+				fmt.Println("✅ 运行中的服务已切换到新模型，无需重启")
+			}
+		}
+
 	case "查看当前配置":
 		if err := configManager.ListConfig(); err != nil {
 			cli.ShowError(err)
@@ -494,7 +1193,7 @@ func runSetConfig() {
 			if err := configManager.DeleteConfig(); err != nil {
 				cli.ShowError(fmt.Errorf("删除配置失败: %v", err))
 			}
-			runInitialSetup()
+			runInitialSetup(false)
 			return
 		}
 	}
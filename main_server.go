@@ -60,7 +60,10 @@ func main_server() {
 	}
 
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Create and start server
 	srv := server.New(cfg)